@@ -0,0 +1,512 @@
+// Package chaingen generates synthetic but internally consistent bitcoin chains for tests and benchmarks.
+//
+// Generated blocks link to their parent, pay the network subsidy plus the fees of their transactions to the
+// coinbase and commit to the witnesses of their transactions. Transactions only spend outputs created
+// earlier in the chain (coinbase outputs once mature) and pay to the standard output types. Keys are real so
+// every output decodes to an address, but signatures are random bytes of the right shape: blocks pass the
+// context-free block checks but not script validation.
+package chaingen
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// blockInterval is the time between two generated blocks.
+	blockInterval = 10 * time.Minute
+	// numKeys is the number of keys outputs pay to. Keys are reused, like addresses are on the real chain.
+	numKeys = 64
+	// minOutputValue is the minimum value of a spendable output, above the dust limit of every output type.
+	minOutputValue = 1000
+	// maxFeeRate is the maximum fee rate of a transaction, in satoshis per virtual byte.
+	maxFeeRate = 50
+	// maxMultiSigKeys is the maximum number of keys of a multisig script.
+	maxMultiSigKeys = 3
+	// maxNullDataLen is the maximum length of the data pushed by an OP_RETURN output.
+	maxNullDataLen = 80
+)
+
+// OutputType is the type of the script of a generated output.
+type OutputType int
+
+// Output types.
+const (
+	P2PKH OutputType = iota
+	P2SH
+	P2WPKH
+	P2WSH
+	P2TR
+	MultiSig
+	NullData
+)
+
+// String returns the name of the output type.
+func (t OutputType) String() string {
+	switch t {
+	case P2PKH:
+		return "p2pkh"
+	case P2SH:
+		return "p2sh"
+	case P2WPKH:
+		return "p2wpkh"
+	case P2WSH:
+		return "p2wsh"
+	case P2TR:
+		return "p2tr"
+	case MultiSig:
+		return "multisig"
+	case NullData:
+		return "nulldata"
+	default:
+		return fmt.Sprintf("OutputType(%d)", int(t))
+	}
+}
+
+// Config configures a Generator.
+type Config struct {
+	// Params are the parameters of the network the chain is generated for. The chain starts at its genesis
+	// block and its subsidies follow its halving interval.
+	Params *chaincfg.Params
+	// Seed seeds the generator: the same configuration always generates the same chain.
+	Seed int64
+	// TxsPerBlock is the number of transactions of a block besides the coinbase. Fewer transactions are
+	// generated while there aren't enough spendable outputs, e.g. before the first coinbase matures.
+	TxsPerBlock int
+	// MaxInputs is the maximum number of inputs of a transaction.
+	MaxInputs int
+	// MaxOutputs is the maximum number of outputs of a transaction, not counting OP_RETURN outputs.
+	MaxOutputs int
+	// OutputTypes are the types of the outputs of transactions, picked uniformly. Coinbase transactions always
+	// pay to P2WPKH. P2SH and P2WSH outputs pay to multisig scripts. NullData adds an OP_RETURN output
+	// instead of a spendable output.
+	OutputTypes []OutputType
+	// CoinbaseMaturity is the number of blocks before a coinbase output can be spent.
+	CoinbaseMaturity uint16
+}
+
+// DefaultConfig returns the default configuration: a regtest chain with all output types.
+func DefaultConfig() Config {
+	return Config{
+		Params:           &chaincfg.RegressionNetParams,
+		Seed:             1,
+		TxsPerBlock:      10,
+		MaxInputs:        3,
+		MaxOutputs:       3,
+		OutputTypes:      []OutputType{P2PKH, P2SH, P2WPKH, P2WSH, P2TR, MultiSig, NullData},
+		CoinbaseMaturity: chaincfg.RegressionNetParams.CoinbaseMaturity,
+	}
+}
+
+// Block is a generated block.
+type Block struct {
+	*wire.MsgBlock
+	// Height is the height of the block.
+	Height int64
+	// Subsidy is the value created by the block, in satoshis.
+	Subsidy int64
+	// Fees is the sum of the fees of the transactions of the block, in satoshis.
+	Fees int64
+
+	params *chaincfg.Params
+}
+
+// Block returns the block as a types.Block, as decoded from `getblock` with verbosity = 2.
+func (b *Block) Block() *types.Block {
+	return types.NewBlockFromWire(b.MsgBlock, b.Height, b.params)
+}
+
+// Bytes returns the serialized block, as returned by `getblock` with verbosity = 0.
+func (b *Block) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.Grow(b.SerializeSize())
+	// Writing to a bytes.Buffer can't fail.
+	_ = b.Serialize(&buf)
+	return buf.Bytes()
+}
+
+// key is a key outputs pay to.
+type key struct {
+	pubKey     []byte
+	pubKeyHash []byte
+	// taprootKey is the x-only output key of a key path only taproot output.
+	taprootKey []byte
+}
+
+// utxo is an unspent output, along with what is needed to spend it.
+type utxo struct {
+	outPoint wire.OutPoint
+	value    int64
+	typ      OutputType
+	// pubKey is the key of single key outputs.
+	pubKey []byte
+	// script is the multisig script of P2SH, P2WSH and bare multisig outputs.
+	script []byte
+	// nSigs is the number of signatures needed to spend the output.
+	nSigs int
+}
+
+// Generator generates a chain block after block.
+type Generator struct {
+	config Config
+	rng    *rand.Rand
+	keys   []key
+	solve  bool
+
+	tip    *wire.MsgBlock
+	height int64
+	// utxos are the spendable outputs.
+	utxos []utxo
+	// immature are the coinbase outputs by height that can't be spent yet.
+	immature map[int64][]utxo
+}
+
+// New returns a generator of a chain starting at the genesis block of config.Params.
+func New(config Config) (*Generator, error) {
+	if config.Params == nil {
+		return nil, fmt.Errorf("params must be set")
+	}
+	if config.TxsPerBlock < 0 {
+		return nil, fmt.Errorf("txs per block must be non-negative")
+	}
+	if config.MaxInputs < 1 || config.MaxOutputs < 1 {
+		return nil, fmt.Errorf("max inputs and max outputs must be positive")
+	}
+	if config.CoinbaseMaturity < 1 {
+		return nil, fmt.Errorf("coinbase maturity must be positive")
+	}
+	if config.TxsPerBlock > 0 && len(config.OutputTypes) == 0 {
+		return nil, fmt.Errorf("output types must be set")
+	}
+	for _, typ := range config.OutputTypes {
+		if typ < P2PKH || typ > NullData {
+			return nil, fmt.Errorf("invalid output type %s", typ)
+		}
+	}
+
+	g := &Generator{
+		config:   config,
+		rng:      rand.New(rand.NewSource(config.Seed)),
+		tip:      config.Params.GenesisBlock,
+		immature: make(map[int64][]utxo),
+		// Only mine blocks when proof of work is trivial, i.e. on regtest and simnet.
+		solve: config.Params.PowLimit.Cmp(new(big.Int).Lsh(big.NewInt(1), 248)) >= 0,
+	}
+	for i := 0; i < numKeys; i++ {
+		var secret [32]byte
+		g.rng.Read(secret[:])
+		_, pubKey := btcec.PrivKeyFromBytes(secret[:])
+		g.keys = append(g.keys, key{
+			pubKey:     pubKey.SerializeCompressed(),
+			pubKeyHash: btcutil.Hash160(pubKey.SerializeCompressed()),
+			taprootKey: schnorr.SerializePubKey(txscript.ComputeTaprootKeyNoScript(pubKey)),
+		})
+	}
+	return g, nil
+}
+
+// Generate returns the genesis block of config.Params followed by n generated blocks.
+func Generate(config Config, n int) ([]*Block, error) {
+	g, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+	blocks := []*Block{g.Genesis()}
+	for i := 0; i < n; i++ {
+		blocks = append(blocks, g.Next())
+	}
+	return blocks, nil
+}
+
+// Genesis returns the genesis block of the chain.
+func (g *Generator) Genesis() *Block {
+	genesis := g.config.Params.GenesisBlock
+	return &Block{
+		MsgBlock: genesis,
+		Subsidy:  genesis.Transactions[0].TxOut[0].Value,
+		params:   g.config.Params,
+	}
+}
+
+// Next generates the next block of the chain.
+func (g *Generator) Next() *Block {
+	g.height++
+	g.utxos = append(g.utxos, g.immature[g.height-int64(g.config.CoinbaseMaturity)]...)
+	delete(g.immature, g.height-int64(g.config.CoinbaseMaturity))
+
+	var fees int64
+	txs := make([]*wire.MsgTx, 0, g.config.TxsPerBlock+1)
+	for i := 0; i < g.config.TxsPerBlock; i++ {
+		tx, fee := g.nextTx()
+		if tx == nil {
+			break
+		}
+		txs = append(txs, tx)
+		fees += fee
+	}
+
+	subsidy := blockchain.CalcBlockSubsidy(int32(g.height), g.config.Params)
+	coinbase, coinbaseOut := g.coinbaseTx(subsidy+fees, txs)
+	txs = append([]*wire.MsgTx{coinbase}, txs...)
+	coinbaseOut.outPoint = wire.OutPoint{Hash: coinbase.TxHash()}
+	coinbaseOut.value = coinbase.TxOut[0].Value
+	if coinbaseOut.value > 0 {
+		g.immature[g.height] = append(g.immature[g.height], coinbaseOut)
+	}
+
+	msg := g.newBlock(txs)
+	g.tip = msg
+	return &Block{
+		MsgBlock: msg,
+		Height:   g.height,
+		Subsidy:  subsidy,
+		Fees:     fees,
+		params:   g.config.Params,
+	}
+}
+
+// coinbaseTx returns the coinbase of the next block paying value, with a commitment to the witnesses of txs,
+// and its spendable output.
+func (g *Generator) coinbaseTx(value int64, txs []*wire.MsgTx) (*wire.MsgTx, utxo) {
+	// BIP 34 requires the coinbase script to start with the height.
+	script, _ := txscript.NewScriptBuilder().AddInt64(g.height).AddData([]byte("chaingen")).Script()
+	var witnessNonce [blockchain.CoinbaseWitnessDataLen]byte
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex),
+		SignatureScript:  script,
+		Witness:          wire.TxWitness{witnessNonce[:]},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	pkScript, out := g.newOutput(P2WPKH)
+	coinbase.AddTxOut(wire.NewTxOut(value, pkScript))
+
+	// The witness commitment is computed over the witness hashes of the transactions, the coinbase counting
+	// as zero, so it doesn't depend on the coinbase itself.
+	witnessTxs := []*btcutil.Tx{btcutil.NewTx(coinbase)}
+	for _, tx := range txs {
+		witnessTxs = append(witnessTxs, btcutil.NewTx(tx))
+	}
+	merkles := blockchain.BuildMerkleTreeStore(witnessTxs, true)
+	commitment := chainhash.DoubleHashB(append(merkles[len(merkles)-1][:], witnessNonce[:]...))
+	coinbase.AddTxOut(wire.NewTxOut(0, append(append([]byte{}, blockchain.WitnessMagicBytes...), commitment...)))
+	return coinbase, out
+}
+
+// nextTx returns a transaction spending random spendable outputs and its fee, or nil if there aren't enough.
+func (g *Generator) nextTx() (*wire.MsgTx, int64) {
+	nOut := 1 + g.rng.Intn(g.config.MaxOutputs)
+	nIn := 1 + g.rng.Intn(g.config.MaxInputs)
+	// Make sure the inputs can pay for the outputs and the fee.
+	minValue := int64(nOut)*minOutputValue + maxFeeRate*int64(150*nIn+50*nOut)
+	var inputs []utxo
+	var value int64
+	for (len(inputs) < nIn || value < minValue) && len(inputs) < g.config.MaxInputs && len(g.utxos) > 0 {
+		i := g.rng.Intn(len(g.utxos))
+		inputs = append(inputs, g.utxos[i])
+		value += g.utxos[i].value
+		g.utxos[i] = g.utxos[len(g.utxos)-1]
+		g.utxos = g.utxos[:len(g.utxos)-1]
+	}
+	if value < minValue {
+		g.utxos = append(g.utxos, inputs...)
+		return nil, 0
+	}
+
+	tx := wire.NewMsgTx(2)
+	for _, in := range inputs {
+		tx.AddTxIn(g.spend(in))
+	}
+	var outputs []utxo
+	for len(outputs) < nOut {
+		typ := g.config.OutputTypes[g.rng.Intn(len(g.config.OutputTypes))]
+		if typ == NullData {
+			data := make([]byte, g.rng.Intn(maxNullDataLen+1))
+			g.rng.Read(data)
+			script, _ := txscript.NullDataScript(data)
+			tx.AddTxOut(wire.NewTxOut(0, script))
+			if len(g.config.OutputTypes) > 1 {
+				continue
+			}
+			// Transactions still need an output to spend.
+			typ = P2WPKH
+		}
+		pkScript, out := g.newOutput(typ)
+		out.outPoint.Index = uint32(len(tx.TxOut))
+		tx.AddTxOut(wire.NewTxOut(0, pkScript))
+		outputs = append(outputs, out)
+	}
+
+	// Split what's left after the fee randomly between the outputs, keeping each above the minimum.
+	weight := blockchain.GetTransactionWeight(btcutil.NewTx(tx))
+	vsize := (weight + blockchain.WitnessScaleFactor - 1) / blockchain.WitnessScaleFactor
+	fee := (1 + g.rng.Int63n(maxFeeRate)) * vsize
+	if maxFee := value - int64(nOut)*minOutputValue; fee > maxFee {
+		fee = maxFee
+	}
+	left := value - fee - int64(nOut)*minOutputValue
+	for i := range outputs {
+		extra := left
+		if i < len(outputs)-1 {
+			extra = g.rng.Int63n(left + 1)
+		}
+		left -= extra
+		outputs[i].value = minOutputValue + extra
+		tx.TxOut[outputs[i].outPoint.Index].Value = outputs[i].value
+	}
+
+	txHash := tx.TxHash()
+	for _, out := range outputs {
+		out.outPoint.Hash = txHash
+		g.utxos = append(g.utxos, out)
+	}
+	return tx, fee
+}
+
+// spend returns an input spending out with a signature script and witness of the expected shape.
+func (g *Generator) spend(out utxo) *wire.TxIn {
+	in := wire.NewTxIn(&out.outPoint, nil, nil)
+	in.Sequence = wire.MaxTxInSequenceNum - 2
+	builder := txscript.NewScriptBuilder()
+	switch out.typ {
+	case P2PKH:
+		builder.AddData(g.signature()).AddData(out.pubKey)
+		in.SignatureScript, _ = builder.Script()
+	case P2SH:
+		// OP_0 works around the extra item popped by OP_CHECKMULTISIG.
+		builder.AddOp(txscript.OP_0)
+		for i := 0; i < out.nSigs; i++ {
+			builder.AddData(g.signature())
+		}
+		in.SignatureScript, _ = builder.AddData(out.script).Script()
+	case P2WPKH:
+		in.Witness = wire.TxWitness{g.signature(), out.pubKey}
+	case P2WSH:
+		in.Witness = wire.TxWitness{nil}
+		for i := 0; i < out.nSigs; i++ {
+			in.Witness = append(in.Witness, g.signature())
+		}
+		in.Witness = append(in.Witness, out.script)
+	case P2TR:
+		sig := make([]byte, schnorr.SignatureSize)
+		g.rng.Read(sig)
+		in.Witness = wire.TxWitness{sig}
+	case MultiSig:
+		builder.AddOp(txscript.OP_0)
+		for i := 0; i < out.nSigs; i++ {
+			builder.AddData(g.signature())
+		}
+		in.SignatureScript, _ = builder.Script()
+	}
+	return in
+}
+
+// signature returns a random DER encoded ECDSA signature with SIGHASH_ALL.
+func (g *Generator) signature() []byte {
+	r := make([]byte, 32)
+	s := make([]byte, 32)
+	g.rng.Read(r)
+	g.rng.Read(s)
+	// Keep the high bit clear so the integers don't need padding.
+	r[0] &= 0x7f
+	s[0] &= 0x7f
+	sig := []byte{0x30, 0x44, 0x02, 0x20}
+	sig = append(sig, r...)
+	sig = append(sig, 0x02, 0x20)
+	sig = append(sig, s...)
+	return append(sig, byte(txscript.SigHashAll))
+}
+
+// newOutput returns the script of a new output of the given type paying to random keys, and the output
+// without its outpoint and value. Multisig scripts, bare or not, are m-of-n with random m and n.
+func (g *Generator) newOutput(typ OutputType) ([]byte, utxo) {
+	out := utxo{typ: typ, nSigs: 1}
+	keys := g.rng.Perm(numKeys)
+	k := g.keys[keys[0]]
+	switch typ {
+	case P2SH, P2WSH, MultiSig:
+		n := 1 + g.rng.Intn(maxMultiSigKeys)
+		out.nSigs = 1 + g.rng.Intn(n)
+		pubKeys := make([][]byte, n)
+		for i, j := range keys[:n] {
+			pubKeys[i] = g.keys[j].pubKey
+		}
+		out.script = multiSigScript(out.nSigs, pubKeys)
+	default:
+		out.pubKey = k.pubKey
+	}
+
+	builder := txscript.NewScriptBuilder()
+	switch typ {
+	case P2PKH:
+		builder.AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).AddData(k.pubKeyHash).
+			AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG)
+	case P2SH:
+		builder.AddOp(txscript.OP_HASH160).AddData(btcutil.Hash160(out.script)).AddOp(txscript.OP_EQUAL)
+	case P2WPKH:
+		builder.AddOp(txscript.OP_0).AddData(k.pubKeyHash)
+	case P2WSH:
+		builder.AddOp(txscript.OP_0).AddData(chainhash.HashB(out.script))
+	case P2TR:
+		builder.AddOp(txscript.OP_1).AddData(k.taprootKey)
+	case MultiSig:
+		return out.script, out
+	}
+	script, _ := builder.Script()
+	return script, out
+}
+
+// multiSigScript returns a m-of-n multisig script with the given public keys.
+func multiSigScript(m int, pubKeys [][]byte) []byte {
+	builder := txscript.NewScriptBuilder().AddInt64(int64(m))
+	for _, pubKey := range pubKeys {
+		builder.AddData(pubKey)
+	}
+	script, _ := builder.AddInt64(int64(len(pubKeys))).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	return script
+}
+
+// newBlock returns a block with txs on top of the tip.
+func (g *Generator) newBlock(txs []*wire.MsgTx) *wire.MsgBlock {
+	btcTxs := make([]*btcutil.Tx, len(txs))
+	for i, tx := range txs {
+		btcTxs[i] = btcutil.NewTx(tx)
+	}
+	merkles := blockchain.BuildMerkleTreeStore(btcTxs, false)
+	msg := wire.NewMsgBlock(wire.NewBlockHeader(
+		wire.TxVersion,
+		&chainhash.Hash{},
+		merkles[len(merkles)-1],
+		g.config.Params.PowLimitBits,
+		0,
+	))
+	msg.Header.PrevBlock = g.tip.BlockHash()
+	msg.Header.Timestamp = g.tip.Header.Timestamp.Add(blockInterval)
+	for _, tx := range txs {
+		msg.AddTransaction(tx)
+	}
+	if g.solve {
+		target := blockchain.CompactToBig(msg.Header.Bits)
+		for {
+			hash := msg.Header.BlockHash()
+			if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+				break
+			}
+			msg.Header.Nonce++
+		}
+	}
+	return msg
+}
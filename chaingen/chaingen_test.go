@@ -0,0 +1,229 @@
+package chaingen
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ChainGenTestSuite struct {
+	suite.Suite
+	config Config
+	blocks []*Block
+}
+
+func (s *ChainGenTestSuite) SetupSuite() {
+	s.config = DefaultConfig()
+	s.config.CoinbaseMaturity = 5
+	var err error
+	s.blocks, err = Generate(s.config, 50)
+	s.Require().NoError(err)
+}
+
+func (s *ChainGenTestSuite) TestBlocks() {
+	s.Require().Len(s.blocks, 51)
+	s.Equal(s.config.Params.GenesisBlock, s.blocks[0].MsgBlock)
+	timeSource := blockchain.NewMedianTime()
+	for i, blk := range s.blocks[1:] {
+		height := int64(i + 1)
+		s.Equal(height, blk.Height)
+		s.Equal(s.blocks[i].BlockHash(), blk.Header.PrevBlock)
+		s.True(blk.Header.Timestamp.After(s.blocks[i].Header.Timestamp))
+
+		btcBlock := btcutil.NewBlock(blk.MsgBlock)
+		s.NoError(blockchain.CheckBlockSanity(btcBlock, s.config.Params.PowLimit, timeSource))
+		s.NoError(blockchain.ValidateWitnessCommitment(btcBlock))
+
+		// BIP 34 height in coinbase.
+		coinbaseHeight, err := blockchain.ExtractCoinbaseHeight(btcBlock.Transactions()[0])
+		s.NoError(err)
+		s.EqualValues(height, coinbaseHeight)
+	}
+	// Transactions start once the first coinbase matures.
+	for _, blk := range s.blocks[1:6] {
+		s.Len(blk.Transactions, 1)
+	}
+	s.Len(s.blocks[50].Transactions, s.config.TxsPerBlock+1)
+}
+
+func (s *ChainGenTestSuite) TestValues() {
+	utxos := make(map[wire.OutPoint]*wire.TxOut)
+	for _, blk := range s.blocks[1:] {
+		s.Equal(blockchain.CalcBlockSubsidy(int32(blk.Height), s.config.Params), blk.Subsidy)
+		var fees int64
+		for _, tx := range blk.Transactions[1:] {
+			var in, out int64
+			for _, txIn := range tx.TxIn {
+				prevOut, ok := utxos[txIn.PreviousOutPoint]
+				s.Require().True(ok, "input %s spends an unknown or spent output", txIn.PreviousOutPoint)
+				delete(utxos, txIn.PreviousOutPoint)
+				in += prevOut.Value
+			}
+			for i, txOut := range tx.TxOut {
+				out += txOut.Value
+				if txscript.GetScriptClass(txOut.PkScript) != txscript.NullDataTy {
+					s.GreaterOrEqual(txOut.Value, int64(minOutputValue))
+					utxos[wire.OutPoint{Hash: tx.TxHash(), Index: uint32(i)}] = txOut
+				}
+			}
+			s.Greater(in, out)
+			fees += in - out
+		}
+		s.Equal(fees, blk.Fees)
+
+		coinbase := blk.Transactions[0]
+		s.Equal(blk.Subsidy+blk.Fees, coinbase.TxOut[0].Value)
+		utxos[wire.OutPoint{Hash: coinbase.TxHash()}] = coinbase.TxOut[0]
+	}
+}
+
+func (s *ChainGenTestSuite) TestScripts() {
+	// Spends reveal the keys and scripts committed to by the outputs they spend.
+	pkScripts := make(map[wire.OutPoint][]byte)
+	classes := make(map[txscript.ScriptClass]int)
+	for _, blk := range s.blocks[1:] {
+		for _, tx := range blk.Transactions {
+			for _, txIn := range tx.TxIn {
+				pkScript, ok := pkScripts[txIn.PreviousOutPoint]
+				if !ok {
+					continue
+				}
+				switch txscript.GetScriptClass(pkScript) {
+				case txscript.PubKeyHashTy:
+					pushes, err := txscript.PushedData(txIn.SignatureScript)
+					s.Require().NoError(err)
+					s.Equal(pkScript[3:23], btcutil.Hash160(pushes[1]))
+				case txscript.ScriptHashTy:
+					pushes, err := txscript.PushedData(txIn.SignatureScript)
+					s.Require().NoError(err)
+					redeemScript := pushes[len(pushes)-1]
+					s.Equal(pkScript[2:22], btcutil.Hash160(redeemScript))
+					s.Equal(txscript.MultiSigTy, txscript.GetScriptClass(redeemScript))
+				case txscript.WitnessV0PubKeyHashTy:
+					s.Require().Len(txIn.Witness, 2)
+					s.Equal(pkScript[2:], btcutil.Hash160(txIn.Witness[1]))
+				case txscript.WitnessV0ScriptHashTy:
+					witnessScript := txIn.Witness[len(txIn.Witness)-1]
+					s.Equal(pkScript[2:], chainhash.HashB(witnessScript))
+					s.Equal(txscript.MultiSigTy, txscript.GetScriptClass(witnessScript))
+				case txscript.WitnessV1TaprootTy:
+					s.Require().Len(txIn.Witness, 1)
+					s.Len(txIn.Witness[0], 64)
+				case txscript.MultiSigTy:
+					_, nSigs, err := txscript.CalcMultiSigStats(pkScript)
+					s.Require().NoError(err)
+					pushes, err := txscript.PushedData(txIn.SignatureScript)
+					s.Require().NoError(err)
+					// The dummy OP_0 pushes an empty item.
+					s.Len(pushes, nSigs+1)
+				}
+			}
+			for i, txOut := range tx.TxOut {
+				class, addrs, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript, s.config.Params)
+				s.NoError(err)
+				s.NotEqual(txscript.NonStandardTy, class)
+				if class != txscript.NullDataTy {
+					s.NotEmpty(addrs)
+				}
+				classes[class]++
+				pkScripts[wire.OutPoint{Hash: tx.TxHash(), Index: uint32(i)}] = txOut.PkScript
+			}
+		}
+	}
+	for _, class := range []txscript.ScriptClass{
+		txscript.PubKeyHashTy,
+		txscript.ScriptHashTy,
+		txscript.WitnessV0PubKeyHashTy,
+		txscript.WitnessV0ScriptHashTy,
+		txscript.WitnessV1TaprootTy,
+		txscript.MultiSigTy,
+		txscript.NullDataTy,
+	} {
+		s.Positive(classes[class], "no %s output", class)
+	}
+}
+
+func (s *ChainGenTestSuite) TestBlockEncodings() {
+	blk := s.blocks[50]
+	var msg wire.MsgBlock
+	s.Require().NoError(msg.Deserialize(bytes.NewReader(blk.Bytes())))
+	s.Equal(blk.BlockHash(), msg.BlockHash())
+
+	typesBlock := blk.Block()
+	s.Equal(blk.BlockHash().String(), typesBlock.Hash())
+	s.Equal(blk.Height, typesBlock.Height())
+	s.Len(typesBlock.Transactions(), len(blk.Transactions))
+}
+
+func (s *ChainGenTestSuite) TestDeterministic() {
+	blocks, err := Generate(s.config, 50)
+	s.Require().NoError(err)
+	s.Equal(s.blocks[50].BlockHash(), blocks[50].BlockHash())
+
+	config := s.config
+	config.Seed++
+	blocks, err = Generate(config, 50)
+	s.Require().NoError(err)
+	s.NotEqual(s.blocks[50].BlockHash(), blocks[50].BlockHash())
+}
+
+func TestChainGenTestSuite(t *testing.T) {
+	suite.Run(t, new(ChainGenTestSuite))
+}
+
+func TestOutputTypes(t *testing.T) {
+	config := DefaultConfig()
+	config.CoinbaseMaturity = 1
+	config.OutputTypes = []OutputType{NullData}
+	blocks, err := Generate(config, 5)
+	assert.NoError(t, err)
+	for _, tx := range blocks[5].Transactions[1:] {
+		var classes []txscript.ScriptClass
+		for _, txOut := range tx.TxOut {
+			classes = append(classes, txscript.GetScriptClass(txOut.PkScript))
+		}
+		assert.Contains(t, classes, txscript.NullDataTy)
+		assert.Contains(t, classes, txscript.WitnessV0PubKeyHashTy)
+	}
+}
+
+func TestMainNet(t *testing.T) {
+	config := DefaultConfig()
+	config.Params = &chaincfg.MainNetParams
+	config.CoinbaseMaturity = chaincfg.MainNetParams.CoinbaseMaturity
+	blocks, err := Generate(config, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, *chaincfg.MainNetParams.GenesisHash, blocks[0].BlockHash())
+	assert.EqualValues(t, 50*btcutil.SatoshiPerBitcoin, blocks[3].Subsidy)
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(config *Config)
+	}{
+		{name: "no params", update: func(config *Config) { config.Params = nil }},
+		{name: "negative txs per block", update: func(config *Config) { config.TxsPerBlock = -1 }},
+		{name: "no inputs", update: func(config *Config) { config.MaxInputs = 0 }},
+		{name: "no outputs", update: func(config *Config) { config.MaxOutputs = 0 }},
+		{name: "no coinbase maturity", update: func(config *Config) { config.CoinbaseMaturity = 0 }},
+		{name: "no output types", update: func(config *Config) { config.OutputTypes = nil }},
+		{name: "invalid output type", update: func(config *Config) { config.OutputTypes = []OutputType{NullData + 1} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			tt.update(&config)
+			_, err := New(config)
+			assert.Error(t, err)
+		})
+	}
+}
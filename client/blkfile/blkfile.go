@@ -0,0 +1,325 @@
+// Package blkfile implements a client that reads blocks directly from the files of a Bitcoin Core datadir.
+package blkfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// medianTimeBlocks is the number of blocks whose median timestamp is the median time of the tip.
+const medianTimeBlocks = 11
+
+// Client represents an offline connection to the block files of a Bitcoin Core datadir.
+//
+// The block index and the tip of the active chain, recorded in the chainstate, are read once when the client is
+// created, so blocks written by the node afterwards are not seen. Bitcoin Core must not be running while they are
+// read since LevelDB doesn't support concurrent access.
+//
+// The datadir of a pruned node is supported: the blocks it deleted are still part of the chain but can't be read.
+type Client struct {
+	blocksDir string
+	params    *chaincfg.Params
+	index     map[chainhash.Hash]*blockIndex
+	chain     []*blockIndex
+	xorKey    []byte
+	pruned    bool
+	// pruneHeight is the height of the first block of the chain stored on disk.
+	pruneHeight int64
+
+	mu    sync.Mutex
+	files map[int32]*os.File
+}
+
+// New opens the Bitcoin Core datadir for the network described by params, e.g. `~/.bitcoin` for mainnet or
+// `~/.bitcoin/regtest` for regtest.
+func New(dataDir string, params *chaincfg.Params) (*Client, error) {
+	blocksDir := filepath.Join(dataDir, "blocks")
+	index, pruned, err := readBlockIndex(filepath.Join(blocksDir, "index"))
+	if err != nil {
+		return nil, err
+	}
+	best, err := readBestBlock(filepath.Join(dataDir, "chainstate"))
+	if err != nil {
+		return nil, err
+	}
+	chain, err := activeChain(index, best)
+	if err != nil {
+		return nil, err
+	}
+	if chain[0].hash != *params.GenesisHash {
+		return nil, fmt.Errorf("genesis block %s of %s does not belong to %s", chain[0].hash, blocksDir, params.Name)
+	}
+	pruneHeight := firstStoredBlock(chain)
+	if pruneHeight > 0 && !pruned {
+		missing := chain[pruneHeight-1]
+		return nil, fmt.Errorf("block %s at height %d is missing from %s, which isn't pruned",
+			missing.hash, missing.height, blocksDir)
+	}
+	xorKey, err := readXORKey(filepath.Join(blocksDir, "xor.dat"))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		blocksDir:   blocksDir,
+		params:      params,
+		index:       index,
+		chain:       chain,
+		xorKey:      xorKey,
+		pruned:      pruned,
+		pruneHeight: pruneHeight,
+		files:       make(map[int32]*os.File),
+	}, nil
+}
+
+// Shutdown closes every open block file.
+func (client *Client) Shutdown() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	for n, f := range client.files {
+		f.Close()
+		delete(client.files, n)
+	}
+}
+
+// GetBlockCount returns the height of the active chain of the datadir.
+func (client *Client) GetBlockCount(ctx context.Context) (int64, error) {
+	return int64(len(client.chain) - 1), nil
+}
+
+// GetBestBlock returns the hash and height of the tip of the active chain of the datadir.
+func (client *Client) GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error) {
+	tip := client.chain[len(client.chain)-1]
+	hash := tip.hash
+	return &hash, tip.height, nil
+}
+
+// GetChainInfo returns the state of the chain stored in the datadir. The node is considered to be in initial
+// block download if it stored headers beyond the last block it stored, and the verification progress is
+// estimated from the number of blocks rather than transactions. A pruned datadir reports the first block it keeps.
+func (client *Client) GetChainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	tip := client.chain[len(client.chain)-1]
+	headers := tip.height
+	for _, entry := range client.index {
+		if entry.height > headers && entry.status&(blockFailedValid|blockFailedChild) == 0 {
+			headers = entry.height
+		}
+	}
+	timestamps := make([]int64, 0, medianTimeBlocks)
+	for entry := tip; entry != nil && len(timestamps) < medianTimeBlocks; entry = entry.parent {
+		timestamps = append(timestamps, entry.header.Timestamp.Unix())
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return types.NewChainInfo(btcjson.GetBlockChainInfoResult{
+		Chain:                types.ChainName(client.params),
+		Blocks:               int32(tip.height),
+		Headers:              int32(headers),
+		BestBlockHash:        tip.hash.String(),
+		Difficulty:           types.BlockHeaderVerboseFromWire(&tip.header, tip.height).Difficulty,
+		MedianTime:           timestamps[len(timestamps)/2],
+		VerificationProgress: float64(tip.height+1) / float64(headers+1),
+		InitialBlockDownload: tip.height < headers,
+		ChainWork:            fmt.Sprintf("%064x", tip.work),
+		Pruned:               client.pruned,
+		PruneHeight:          int32(client.pruneHeight),
+	}), nil
+}
+
+// GetBlockHashesByRange returns block hashes from the datadir given a range (inclusive) of block numbers.
+// Hashes are returned in order from `minBlockNumber` to `maxBlockNumber`
+func (client *Client) GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error) {
+	if minBlockNumber > maxBlockNumber {
+		return nil, fmt.Errorf(
+			"minBlockNumber (%d) must be less than or equal to maxBlockNumber (%d)",
+			minBlockNumber,
+			maxBlockNumber,
+		)
+	}
+	if minBlockNumber < 0 || maxBlockNumber >= int64(len(client.chain)) {
+		return nil, fmt.Errorf("block range %d to %d is outside of the chain (0 to %d)",
+			minBlockNumber, maxBlockNumber, len(client.chain)-1)
+	}
+	hashes := make([]*chainhash.Hash, 0, maxBlockNumber-minBlockNumber+1)
+	for _, entry := range client.chain[minBlockNumber : maxBlockNumber+1] {
+		hash := entry.hash
+		hashes = append(hashes, &hash)
+	}
+	return hashes, nil
+}
+
+// GetBlockHeaders returns block headers from the block index given a list/range of block hashes, whether or not
+// the blocks are stored on disk.
+func (client *Client) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
+	blockHeaders := make([]*types.BlockHeader, len(hashes))
+	for i, hash := range hashes {
+		entry, err := client.lookup(hash)
+		if err != nil {
+			return nil, err
+		}
+		result := types.BlockHeaderVerboseFromWire(&entry.header, entry.height)
+		result.Confirmations, result.NextHash = client.chainInfo(entry)
+		blockHeaders[i] = types.NewBlockHeader(result)
+	}
+	return blockHeaders, nil
+}
+
+// GetBlocks returns blocks with transactions from the block files given a list/range of block hashes.
+// It stops between two blocks once ctx is done.
+func (client *Client) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	blocks := make([]*types.Block, len(hashes))
+	for i, hash := range hashes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		entry, err := client.lookupData(hash)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := client.readBlock(entry)
+		if err != nil {
+			return nil, err
+		}
+		result := types.BlockVerboseFromWire(msg, entry.height, client.params)
+		result.Confirmations, result.NextHash = client.chainInfo(entry)
+		blocks[i] = types.NewBlock(result)
+	}
+	return blocks, nil
+}
+
+// lookup returns the block index entry of a block. Headers are kept for every block in the index, including the
+// blocks deleted by a pruned node.
+func (client *Client) lookup(hash *chainhash.Hash) (*blockIndex, error) {
+	entry, ok := client.index[*hash]
+	if !ok {
+		return nil, fmt.Errorf("block %s not found", hash)
+	}
+	return entry, nil
+}
+
+// lookupData returns the block index entry of a block whose data is stored on disk. Blocks of the active chain
+// deleted by a pruned node are reported with ErrBlockPruned.
+func (client *Client) lookupData(hash *chainhash.Hash) (*blockIndex, error) {
+	entry, err := client.lookup(hash)
+	if err != nil {
+		return nil, err
+	}
+	if entry.height < client.pruneHeight && client.chain[entry.height] == entry {
+		return nil, NewErrBlockPruned(entry.hash, entry.height, client.pruneHeight)
+	}
+	if !entry.hasData() {
+		return nil, fmt.Errorf("block %s is not available on disk", hash)
+	}
+	return entry, nil
+}
+
+// chainInfo returns the confirmations and next block hash of a block the same way `getblock` does: blocks outside
+// of the active chain have -1 confirmations and no next block.
+func (client *Client) chainInfo(entry *blockIndex) (int64, string) {
+	if entry.height >= int64(len(client.chain)) || client.chain[entry.height] != entry {
+		return -1, ""
+	}
+	confirmations := int64(len(client.chain)) - entry.height
+	if entry.height+1 < int64(len(client.chain)) {
+		return confirmations, client.chain[entry.height+1].hash.String()
+	}
+	return confirmations, ""
+}
+
+// readBlock reads and deserializes a block from its blk*.dat file.
+func (client *Client) readBlock(entry *blockIndex) (*wire.MsgBlock, error) {
+	f, err := client.file(entry.file)
+	if err != nil {
+		return nil, err
+	}
+	// Blocks are stored as <network magic><size><block>, and the index points at the block itself.
+	if entry.dataPos < 4 {
+		return nil, fmt.Errorf("invalid position %d of block %s", entry.dataPos, entry.hash)
+	}
+	sizeBuf := make([]byte, 4)
+	if err := client.readAt(f, sizeBuf, int64(entry.dataPos)-4); err != nil {
+		return nil, fmt.Errorf("reading size of block %s: %w", entry.hash, err)
+	}
+	size := binary.LittleEndian.Uint32(sizeBuf)
+	if size > wire.MaxBlockPayload {
+		return nil, fmt.Errorf("size %d of block %s exceeds the maximum block size", size, entry.hash)
+	}
+	buf := make([]byte, size)
+	if err := client.readAt(f, buf, int64(entry.dataPos)); err != nil {
+		return nil, fmt.Errorf("reading block %s: %w", entry.hash, err)
+	}
+	var msg wire.MsgBlock
+	if err := msg.Deserialize(bytes.NewReader(buf)); err != nil {
+		return nil, fmt.Errorf("decoding block %s: %w", entry.hash, err)
+	}
+	if msg.BlockHash() != entry.hash {
+		return nil, fmt.Errorf("block at %s:%d has hash %s, expected %s",
+			blockFileName(entry.file), entry.dataPos, msg.BlockHash(), entry.hash)
+	}
+	return &msg, nil
+}
+
+// readAt fills buf from f at offset and removes the XOR obfuscation of the block files.
+func (client *Client) readAt(f *os.File, buf []byte, offset int64) error {
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if len(client.xorKey) > 0 {
+		for i := range buf {
+			buf[i] ^= client.xorKey[(offset+int64(i))%int64(len(client.xorKey))]
+		}
+	}
+	return nil
+}
+
+// file returns the open blk*.dat file with the given number.
+func (client *Client) file(n int32) (*os.File, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if f, ok := client.files[n]; ok {
+		return f, nil
+	}
+	f, err := os.Open(filepath.Join(client.blocksDir, blockFileName(n)))
+	if err != nil {
+		return nil, err
+	}
+	client.files[n] = f
+	return f, nil
+}
+
+func blockFileName(n int32) string {
+	return fmt.Sprintf("blk%05d.dat", n)
+}
+
+// readXORKey reads the key used by Bitcoin Core (since v28) to obfuscate block files.
+// A missing file or an all zero key means the files are not obfuscated.
+func readXORKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading block file obfuscation key: %w", err)
+	}
+	for _, b := range key {
+		if b != 0 {
+			return key, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,420 @@
+package blkfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/suite"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+var _ client.Client = (*Client)(nil)
+
+type BlkFileTestSuite struct {
+	suite.Suite
+	dataDir string
+	// chain is the active chain written to the datadir, indexed by height.
+	chain []*wire.MsgBlock
+	// stale is a block at height 3 with less work than the active chain.
+	stale *wire.MsgBlock
+	// headerOnly is a block at height 6 whose data was never downloaded.
+	headerOnly *wire.MsgBlock
+	// invalid is a block at height 6 that failed validation.
+	invalid *wire.MsgBlock
+	// best is the tip recorded in the chainstate.
+	best *wire.MsgBlock
+	// pruneHeight is the height of the first block of the chain stored on disk, the node is pruned if it's not 0.
+	pruneHeight int64
+}
+
+func (s *BlkFileTestSuite) SetupTest() {
+	s.dataDir = s.T().TempDir()
+	s.chain = []*wire.MsgBlock{chaincfg.RegressionNetParams.GenesisBlock}
+	for height := int64(1); height <= 5; height++ {
+		s.chain = append(s.chain, testBlock(s.chain[height-1], height, 0))
+	}
+	s.stale = testBlock(s.chain[2], 3, 1)
+	s.headerOnly = testBlock(s.chain[5], 6, 0)
+	s.invalid = testBlock(s.chain[5], 6, 1)
+	s.best = s.chain[5]
+	s.pruneHeight = 0
+}
+
+// writeDataDir writes the test blocks into block files obfuscated with xorKey and creates their block index and
+// a chainstate recording the best block.
+func (s *BlkFileTestSuite) writeDataDir(xorKey []byte) {
+	s.writeChainstate()
+
+	blocksDir := filepath.Join(s.dataDir, "blocks")
+	s.Require().NoError(os.MkdirAll(blocksDir, 0755))
+	if xorKey != nil {
+		s.Require().NoError(os.WriteFile(filepath.Join(blocksDir, "xor.dat"), xorKey, 0644))
+	}
+	db, err := leveldb.OpenFile(filepath.Join(blocksDir, "index"), nil)
+	s.Require().NoError(err)
+	defer db.Close()
+
+	files := [][]byte{nil, nil}
+	write := func(msg *wire.MsgBlock, height int64, status uint64, file int32) {
+		var dataPos uint32
+		if status&blockHaveData != 0 {
+			var raw bytes.Buffer
+			s.Require().NoError(msg.Serialize(&raw))
+			prefix := make([]byte, 8)
+			binary.LittleEndian.PutUint32(prefix, uint32(chaincfg.RegressionNetParams.Net))
+			binary.LittleEndian.PutUint32(prefix[4:], uint32(raw.Len()))
+			files[file] = append(files[file], prefix...)
+			dataPos = uint32(len(files[file]))
+			files[file] = append(files[file], raw.Bytes()...)
+		}
+		hash := msg.BlockHash()
+		s.Require().NoError(db.Put(append([]byte{blockIndexPrefix}, hash[:]...), encodeBlockIndex(msg, height, status, file, dataPos), nil))
+	}
+	valid := uint64(5 | blockHaveData | blockHaveUndo)
+	for height, msg := range s.chain {
+		if int64(height) < s.pruneHeight {
+			write(msg, int64(height), 5, 0)
+		} else {
+			write(msg, int64(height), valid, int32(height%2))
+		}
+	}
+	if s.pruneHeight > 0 {
+		s.Require().NoError(db.Put(prunedFlagKey, []byte{'1'}, nil))
+	}
+	write(s.stale, 3, valid, 1)
+	write(s.headerOnly, 6, 2, 0)
+	write(s.invalid, 6, 3|blockHaveData|blockFailedValid, 0)
+
+	for n, data := range files {
+		for i := range data {
+			if len(xorKey) > 0 {
+				data[i] ^= xorKey[i%len(xorKey)]
+			}
+		}
+		s.Require().NoError(os.WriteFile(filepath.Join(blocksDir, blockFileName(int32(n))), data, 0644))
+	}
+}
+
+// writeChainstate creates a chainstate recording s.best, obfuscated like Bitcoin Core does.
+func (s *BlkFileTestSuite) writeChainstate() {
+	db, err := leveldb.OpenFile(filepath.Join(s.dataDir, "chainstate"), nil)
+	s.Require().NoError(err)
+	defer db.Close()
+
+	key := []byte{0xa5, 0x5a, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	s.Require().NoError(db.Put(chainstateObfuscateKey, append([]byte{byte(len(key))}, key...), nil))
+	best := s.best.BlockHash()
+	for i := range best {
+		best[i] ^= key[i%len(key)]
+	}
+	s.Require().NoError(db.Put([]byte{chainstateBestBlockKey}, best[:], nil))
+}
+
+func (s *BlkFileTestSuite) TestClient() {
+	tests := []struct {
+		name   string
+		xorKey []byte
+	}{
+		{"plain", nil},
+		{"zero_xor_key", make([]byte, 8)},
+		{"xor_key", []byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.SetupTest()
+			s.writeDataDir(tt.xorKey)
+			c, err := New(s.dataDir, &chaincfg.RegressionNetParams)
+			s.Require().NoError(err)
+			defer c.Shutdown()
+
+			count, err := c.GetBlockCount(context.Background())
+			s.NoError(err)
+			s.EqualValues(len(s.chain)-1, count)
+
+			hashes, err := c.GetBlockHashesByRange(context.Background(), 0, count)
+			s.Require().NoError(err)
+			s.Require().Len(hashes, len(s.chain))
+			for i, msg := range s.chain {
+				s.Equal(msg.BlockHash(), *hashes[i])
+			}
+
+			headers, err := c.GetBlockHeaders(context.Background(), hashes)
+			s.Require().NoError(err)
+			blocks, err := c.GetBlocks(context.Background(), hashes)
+			s.Require().NoError(err)
+			for i, msg := range s.chain {
+				s.Equal(msg.BlockHash().String(), headers[i].Hash())
+				s.EqualValues(i, headers[i].Height())
+				s.Equal(blocks[i].Hash(), headers[i].Hash())
+				s.EqualValues(i, blocks[i].Height())
+				s.EqualValues(len(s.chain)-i, blocks[i].Confirmations())
+				s.EqualValues(len(s.chain)-i, headers[i].Confirmations())
+				if i > 0 {
+					s.Equal(s.chain[i-1].BlockHash().String(), blocks[i].PreviousHash())
+				}
+				if i < len(s.chain)-1 {
+					s.Equal(s.chain[i+1].BlockHash().String(), blocks[i].NextHash())
+				} else {
+					s.Empty(blocks[i].NextHash())
+				}
+				s.Require().Len(blocks[i].Transactions(), len(msg.Transactions))
+				for j, tx := range msg.Transactions {
+					s.Equal(tx.TxHash().String(), blocks[i].Transactions()[j].TxID())
+				}
+			}
+		})
+	}
+}
+
+func (s *BlkFileTestSuite) TestChainInfo() {
+	s.writeDataDir(nil)
+	c, err := New(s.dataDir, &chaincfg.RegressionNetParams)
+	s.Require().NoError(err)
+	defer c.Shutdown()
+
+	hash, height, err := c.GetBestBlock(context.Background())
+	s.NoError(err)
+	s.Equal(s.chain[5].BlockHash(), *hash)
+	s.EqualValues(5, height)
+
+	info, err := c.GetChainInfo(context.Background())
+	s.Require().NoError(err)
+	s.Equal("regtest", info.Chain())
+	s.EqualValues(5, info.Blocks())
+	s.Equal(s.chain[5].BlockHash().String(), info.BestBlockHash())
+	s.Equal(s.chain[3].Header.Timestamp.Unix(), info.MedianTime())
+	// The header only block counts as a header the node hadn't downloaded yet.
+	s.EqualValues(6, info.Headers())
+	s.True(info.InitialBlockDownload())
+	s.InDelta(6.0/7.0, info.VerificationProgress(), 1e-9)
+}
+
+func (s *BlkFileTestSuite) TestStaleBlocks() {
+	s.writeDataDir(nil)
+	c, err := New(s.dataDir, &chaincfg.RegressionNetParams)
+	s.Require().NoError(err)
+	defer c.Shutdown()
+
+	staleHash := s.stale.BlockHash()
+	blocks, err := c.GetBlocks(context.Background(), []*chainhash.Hash{&staleHash})
+	s.Require().NoError(err)
+	s.Equal(staleHash.String(), blocks[0].Hash())
+	s.EqualValues(-1, blocks[0].Confirmations())
+	s.Empty(blocks[0].NextHash())
+
+	for _, msg := range []*wire.MsgBlock{s.headerOnly, s.invalid} {
+		hash := msg.BlockHash()
+		_, err := c.GetBlocks(context.Background(), []*chainhash.Hash{&hash})
+		s.Error(err)
+	}
+	unknown := chainhash.Hash{1}
+	_, err = c.GetBlockHeaders(context.Background(), []*chainhash.Hash{&unknown})
+	s.Error(err)
+}
+
+func (s *BlkFileTestSuite) TestBestBlockFromChainstate() {
+	// Block 5 was stored but not connected yet, the active chain ends at the best block of the chainstate.
+	s.best = s.chain[4]
+	s.writeDataDir(nil)
+	c, err := New(s.dataDir, &chaincfg.RegressionNetParams)
+	s.Require().NoError(err)
+	defer c.Shutdown()
+
+	hash, height, err := c.GetBestBlock(context.Background())
+	s.NoError(err)
+	s.Equal(s.chain[4].BlockHash(), *hash)
+	s.EqualValues(4, height)
+	_, err = c.GetBlockHashesByRange(context.Background(), 0, 5)
+	s.Error(err)
+
+	hash5 := s.chain[5].BlockHash()
+	blocks, err := c.GetBlocks(context.Background(), []*chainhash.Hash{&hash5})
+	s.Require().NoError(err)
+	s.EqualValues(-1, blocks[0].Confirmations())
+}
+
+func (s *BlkFileTestSuite) TestPruned() {
+	s.pruneHeight = 3
+	s.writeDataDir(nil)
+	c, err := New(s.dataDir, &chaincfg.RegressionNetParams)
+	s.Require().NoError(err)
+	defer c.Shutdown()
+
+	info, err := c.GetChainInfo(context.Background())
+	s.Require().NoError(err)
+	s.True(info.Pruned())
+	s.EqualValues(3, info.PruneHeight())
+	s.EqualValues(5, info.Blocks())
+
+	// Pruned blocks keep their hash and header but their data can't be read.
+	hashes, err := c.GetBlockHashesByRange(context.Background(), 0, 5)
+	s.Require().NoError(err)
+	headers, err := c.GetBlockHeaders(context.Background(), hashes)
+	s.Require().NoError(err)
+	s.EqualValues(5, headers[1].Confirmations())
+	_, err = c.GetBlocks(context.Background(), hashes[2:3])
+	var pruned ErrBlockPruned
+	s.Require().ErrorAs(err, &pruned)
+	s.Equal(NewErrBlockPruned(s.chain[2].BlockHash(), 2, 3), pruned)
+	blocks, err := c.GetBlocks(context.Background(), hashes[3:])
+	s.Require().NoError(err)
+	s.Len(blocks, 3)
+}
+
+func (s *BlkFileTestSuite) TestGetBlockHashesByRangeErrors() {
+	s.writeDataDir(nil)
+	c, err := New(s.dataDir, &chaincfg.RegressionNetParams)
+	s.Require().NoError(err)
+	defer c.Shutdown()
+
+	tests := []struct {
+		name     string
+		min, max int64
+	}{
+		{"reversed", 3, 2},
+		{"negative", -1, 2},
+		{"past_tip", 2, 6},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			_, err := c.GetBlockHashesByRange(context.Background(), tt.min, tt.max)
+			s.Error(err)
+		})
+	}
+}
+
+func (s *BlkFileTestSuite) TestNewErrors() {
+	_, err := New(s.dataDir, &chaincfg.RegressionNetParams)
+	s.Error(err, "missing block index")
+
+	s.writeDataDir(nil)
+	_, err = New(s.dataDir, &chaincfg.MainNetParams)
+	s.Error(err, "wrong network")
+
+	s.Require().NoError(os.RemoveAll(filepath.Join(s.dataDir, "chainstate")))
+	_, err = New(s.dataDir, &chaincfg.RegressionNetParams)
+	s.Error(err, "missing chainstate")
+
+	s.SetupTest()
+	s.best = s.headerOnly
+	s.writeDataDir(nil)
+	_, err = New(s.dataDir, &chaincfg.RegressionNetParams)
+	s.Error(err, "best block not on disk")
+
+	s.SetupTest()
+	s.pruneHeight = 2
+	s.writeDataDir(nil)
+	db, err := leveldb.OpenFile(filepath.Join(s.dataDir, "blocks", "index"), nil)
+	s.Require().NoError(err)
+	s.Require().NoError(db.Delete(prunedFlagKey, nil))
+	s.Require().NoError(db.Close())
+	_, err = New(s.dataDir, &chaincfg.RegressionNetParams)
+	s.ErrorContains(err, "isn't pruned")
+}
+
+func TestBlkFileTestSuite(t *testing.T) {
+	suite.Run(t, new(BlkFileTestSuite))
+}
+
+func TestReadVarInt(t *testing.T) {
+	// Examples from Bitcoin Core's serialize.h
+	tests := []struct {
+		encoded []byte
+		want    uint64
+	}{
+		{[]byte{0x00}, 0},
+		{[]byte{0x7f}, 127},
+		{[]byte{0x80, 0x00}, 128},
+		{[]byte{0x80, 0x7f}, 255},
+		{[]byte{0xfe, 0x7f}, 16383},
+		{[]byte{0xff, 0x00}, 16384},
+		{[]byte{0x82, 0xfe, 0x7f}, 65535},
+		{[]byte{0x8e, 0xfe, 0xfe, 0xff, 0x00}, 1 << 32},
+	}
+	for _, tt := range tests {
+		got, err := readVarInt(bytes.NewReader(tt.encoded))
+		if err != nil || got != tt.want {
+			t.Errorf("readVarInt(%x) = %d, %v; want %d", tt.encoded, got, err, tt.want)
+		}
+		if encoded := encodeVarInt(tt.want); !bytes.Equal(encoded, tt.encoded) {
+			t.Errorf("encodeVarInt(%d) = %x; want %x", tt.want, encoded, tt.encoded)
+		}
+	}
+	if _, err := readVarInt(bytes.NewReader([]byte{0x80})); err == nil {
+		t.Error("readVarInt of a truncated varint should fail")
+	}
+}
+
+// testBlock returns a block at height on top of prev. Blocks with a different nonce have different hashes.
+func testBlock(prev *wire.MsgBlock, height int64, nonce uint32) *wire.MsgBlock {
+	coinbaseScript, _ := txscript.NewScriptBuilder().AddInt64(height).AddInt64(int64(nonce)).Script()
+	pkScript, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(bytes.Repeat([]byte{byte(height)}, 20)).Script()
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), coinbaseScript, nil))
+	coinbase.AddTxOut(wire.NewTxOut(50*btcutil.SatoshiPerBitcoin, pkScript))
+
+	txs := []*btcutil.Tx{btcutil.NewTx(coinbase)}
+	merkles := blockchain.BuildMerkleTreeStore(txs, false)
+	msg := wire.NewMsgBlock(wire.NewBlockHeader(
+		wire.TxVersion,
+		&chainhash.Hash{},
+		merkles[len(merkles)-1],
+		chaincfg.RegressionNetParams.PowLimitBits,
+		nonce,
+	))
+	msg.Header.PrevBlock = prev.BlockHash()
+	msg.Header.Timestamp = prev.Header.Timestamp.Add(10 * time.Minute)
+	msg.AddTransaction(coinbase)
+	return msg
+}
+
+// encodeBlockIndex serializes a block index entry the same way Bitcoin Core does.
+func encodeBlockIndex(msg *wire.MsgBlock, height int64, status uint64, file int32, dataPos uint32) []byte {
+	var buf bytes.Buffer
+	buf.Write(encodeVarInt(259900))
+	buf.Write(encodeVarInt(uint64(height)))
+	buf.Write(encodeVarInt(status))
+	buf.Write(encodeVarInt(uint64(len(msg.Transactions))))
+	if status&(blockHaveData|blockHaveUndo) != 0 {
+		buf.Write(encodeVarInt(uint64(file)))
+	}
+	if status&blockHaveData != 0 {
+		buf.Write(encodeVarInt(uint64(dataPos)))
+	}
+	if status&blockHaveUndo != 0 {
+		buf.Write(encodeVarInt(0))
+	}
+	_ = msg.Header.Serialize(&buf)
+	return buf.Bytes()
+}
+
+func encodeVarInt(n uint64) []byte {
+	var tmp []byte
+	for {
+		b := byte(n & 0x7f)
+		if len(tmp) > 0 {
+			b |= 0x80
+		}
+		tmp = append(tmp, b)
+		if n <= 0x7f {
+			break
+		}
+		n = (n >> 7) - 1
+	}
+	for i, j := 0, len(tmp)-1; i < j; i, j = i+1, j-1 {
+		tmp[i], tmp[j] = tmp[j], tmp[i]
+	}
+	return tmp
+}
@@ -0,0 +1,81 @@
+package blkfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Keys of the chainstate database, see txdb.cpp in Bitcoin Core.
+const (
+	// chainstateBestBlockKey stores the hash of the block the UTXO set is up to date with.
+	chainstateBestBlockKey = 'B'
+	// chainstateHeadBlocksKey replaces chainstateBestBlockKey while the UTXO set is being flushed.
+	chainstateHeadBlocksKey = 'H'
+)
+
+// chainstateObfuscateKey is the key of the bytes XORed with every other value of the chainstate database.
+var chainstateObfuscateKey = []byte("\x0e\x00obfuscate_key")
+
+// readBestBlock returns the hash of the active chain's tip, which Bitcoin Core records in the LevelDB chainstate
+// database at path along with the UTXO set.
+func readBestBlock(path string) (chainhash.Hash, error) {
+	var best chainhash.Hash
+	db, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return best, fmt.Errorf("opening chainstate %s: %w", path, err)
+	}
+	defer db.Close()
+
+	value, err := db.Get([]byte{chainstateBestBlockKey}, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		if ok, _ := db.Has([]byte{chainstateHeadBlocksKey}, nil); ok {
+			return best, fmt.Errorf("chainstate %s was being flushed when the node stopped, "+
+				"start Bitcoin Core once to finish it", path)
+		}
+		return best, fmt.Errorf("chainstate %s has no best block", path)
+	}
+	if err != nil {
+		return best, fmt.Errorf("reading best block from chainstate %s: %w", path, err)
+	}
+	key, err := chainstateXORKey(db)
+	if err != nil {
+		return best, fmt.Errorf("reading chainstate %s obfuscation key: %w", path, err)
+	}
+	if len(value) != chainhash.HashSize {
+		return best, fmt.Errorf("best block of chainstate %s has %d bytes", path, len(value))
+	}
+	for i := range value {
+		if len(key) > 0 {
+			value[i] ^= key[i%len(key)]
+		}
+	}
+	copy(best[:], value)
+	return best, nil
+}
+
+// chainstateXORKey returns the key obfuscating the values of the chainstate database, or nil if they aren't.
+func chainstateXORKey(db *leveldb.DB) ([]byte, error) {
+	value, err := db.Get(chainstateObfuscateKey, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The key is serialized as a vector: its CompactSize length followed by its bytes.
+	r := bytes.NewReader(value)
+	size, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if size != uint64(r.Len()) {
+		return nil, fmt.Errorf("key of %d bytes holds %d bytes", size, r.Len())
+	}
+	return value[len(value)-int(size):], nil
+}
@@ -0,0 +1,26 @@
+package blkfile
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ErrBlockPruned is returned when a block of the active chain was deleted by a pruned node.
+type ErrBlockPruned struct {
+	hash        chainhash.Hash
+	height      int64
+	pruneHeight int64
+}
+
+// NewErrBlockPruned returns an ErrBlockPruned for the block hash at height, given the height of the first block
+// kept by the node.
+func NewErrBlockPruned(hash chainhash.Hash, height, pruneHeight int64) ErrBlockPruned {
+	return ErrBlockPruned{hash, height, pruneHeight}
+}
+
+// Error implements error.Error interface.
+func (e ErrBlockPruned) Error() string {
+	return fmt.Sprintf("block %s at height %d was pruned, the datadir only keeps blocks from height %d",
+		e.hash, e.height, e.pruneHeight)
+}
@@ -0,0 +1,203 @@
+package blkfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Block status flags stored in the block index, see BlockStatus in Bitcoin Core's chain.h.
+const (
+	blockValidTransactions = 3
+	blockValidMask         = 7
+	blockHaveData          = 8
+	blockHaveUndo          = 16
+	blockFailedValid       = 32
+	blockFailedChild       = 64
+)
+
+// blockIndexPrefix is the key prefix of block index entries, followed by the block hash.
+const blockIndexPrefix = 'b'
+
+// prunedFlagKey is the key of the block index flag set once the node deleted block files, see
+// BlockTreeDB::WriteFlag in Bitcoin Core. Flag names are serialized as strings prefixed by their CompactSize
+// length and values are '1' or '0'.
+var prunedFlagKey = []byte("F\x10prunedblockfiles")
+
+// blockIndex represents an entry of Bitcoin Core's block index (CDiskBlockIndex).
+type blockIndex struct {
+	hash    chainhash.Hash
+	height  int64
+	status  uint64
+	nTx     uint64
+	file    int32
+	dataPos uint32
+	header  wire.BlockHeader
+	parent  *blockIndex
+	work    *big.Int
+}
+
+// hasData returns true if the block is stored in a blk*.dat file and hasn't been found invalid.
+func (idx *blockIndex) hasData() bool {
+	return idx.status&blockHaveData != 0 &&
+		idx.status&(blockFailedValid|blockFailedChild) == 0 &&
+		idx.status&blockValidMask >= blockValidTransactions
+}
+
+// readBlockIndex reads every entry of the LevelDB block index at path, and whether the node pruned block files.
+func readBlockIndex(path string) (map[chainhash.Hash]*blockIndex, bool, error) {
+	db, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return nil, false, fmt.Errorf("opening block index %s: %w", path, err)
+	}
+	defer db.Close()
+
+	flag, err := db.Get(prunedFlagKey, nil)
+	if err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+		return nil, false, fmt.Errorf("reading pruned flag of block index %s: %w", path, err)
+	}
+	pruned := bytes.Equal(flag, []byte{'1'})
+
+	index := make(map[chainhash.Hash]*blockIndex)
+	iter := db.NewIterator(util.BytesPrefix([]byte{blockIndexPrefix}), nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != 1+chainhash.HashSize {
+			continue
+		}
+		var hash chainhash.Hash
+		copy(hash[:], key[1:])
+		entry, err := parseBlockIndex(hash, iter.Value())
+		if err != nil {
+			return nil, false, fmt.Errorf("parsing block index entry %s: %w", hash, err)
+		}
+		index[hash] = entry
+	}
+	if err := iter.Error(); err != nil {
+		return nil, false, fmt.Errorf("reading block index %s: %w", path, err)
+	}
+	return index, pruned, nil
+}
+
+// parseBlockIndex decodes a serialized CDiskBlockIndex.
+func parseBlockIndex(hash chainhash.Hash, value []byte) (*blockIndex, error) {
+	r := bytes.NewReader(value)
+	entry := &blockIndex{hash: hash}
+	// Client version
+	if _, err := readVarInt(r); err != nil {
+		return nil, err
+	}
+	height, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	entry.height = int64(height)
+	if entry.status, err = readVarInt(r); err != nil {
+		return nil, err
+	}
+	if entry.nTx, err = readVarInt(r); err != nil {
+		return nil, err
+	}
+	if entry.status&(blockHaveData|blockHaveUndo) != 0 {
+		file, err := readVarInt(r)
+		if err != nil {
+			return nil, err
+		}
+		entry.file = int32(file)
+	}
+	if entry.status&blockHaveData != 0 {
+		dataPos, err := readVarInt(r)
+		if err != nil {
+			return nil, err
+		}
+		entry.dataPos = uint32(dataPos)
+	}
+	if entry.status&blockHaveUndo != 0 {
+		// Undo position
+		if _, err := readVarInt(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := entry.header.Deserialize(r); err != nil {
+		return nil, err
+	}
+	if entry.header.BlockHash() != hash {
+		return nil, fmt.Errorf("header hash %s does not match key", entry.header.BlockHash())
+	}
+	return entry, nil
+}
+
+// readVarInt reads a variable length integer as serialized by Bitcoin Core's VARINT (not CompactSize).
+func readVarInt(r io.ByteReader) (uint64, error) {
+	var n uint64
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if n > (^uint64(0))>>7 {
+			return 0, errors.New("varint overflows uint64")
+		}
+		n = n<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			return n, nil
+		}
+		n++
+	}
+}
+
+// activeChain returns the blocks of the chain ending at best, the tip recorded in the chainstate, indexed by
+// height. Every block of the chain must be in the index but only the tip must be stored on disk: blocks of a
+// pruned node are checked by the caller.
+func activeChain(index map[chainhash.Hash]*blockIndex, best chainhash.Hash) ([]*blockIndex, error) {
+	tip, ok := index[best]
+	if !ok {
+		return nil, fmt.Errorf("best block %s of the chainstate is not in the block index", best)
+	}
+	if !tip.hasData() {
+		return nil, fmt.Errorf("best block %s of the chainstate is not available on disk", best)
+	}
+	chain := make([]*blockIndex, tip.height+1)
+	for entry := tip; ; entry = entry.parent {
+		chain[entry.height] = entry
+		if entry.height == 0 {
+			break
+		}
+		parent, ok := index[entry.header.PrevBlock]
+		if !ok || parent.height != entry.height-1 {
+			return nil, fmt.Errorf("parent %s of block %s at height %d is not in the block index",
+				entry.header.PrevBlock, entry.hash, entry.height)
+		}
+		entry.parent = parent
+	}
+	for _, entry := range chain {
+		entry.work = blockchain.CalcWork(entry.header.Bits)
+		if entry.parent != nil {
+			entry.work.Add(entry.work, entry.parent.work)
+		}
+	}
+	return chain, nil
+}
+
+// firstStoredBlock returns the height of the lowest block of chain from which every block up to the tip is
+// stored on disk, like Bitcoin Core's GetFirstStoredBlock.
+func firstStoredBlock(chain []*blockIndex) int64 {
+	height := int64(len(chain) - 1)
+	for height > 0 && chain[height-1].hasData() {
+		height--
+	}
+	return height
+}
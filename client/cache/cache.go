@@ -0,0 +1,381 @@
+// Package cache implements a client decorator that keeps fetched blocks in a directory on disk.
+package cache
+
+import (
+	"compress/gzip"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// DefaultMaxBytes is the default size limit of a cache directory.
+const DefaultMaxBytes = 10 << 30
+
+// blockFileExt is the extension of the files holding cached blocks.
+const blockFileExt = ".json.gz"
+
+// Config represents the settings of a Client.
+type Config struct {
+	// Dir is the directory holding the cached blocks. It is created if it doesn't exist.
+	Dir string
+	// MaxBytes is the total size of the cached blocks above which the least recently used blocks are evicted,
+	// 0 disables the limit.
+	MaxBytes int64
+}
+
+// Stats represents the number of blocks served by a Client.
+type Stats struct {
+	// Hits is the number of blocks or block headers read from the cache.
+	Hits uint64
+	// Misses is the number of blocks or block headers fetched from the wrapped client.
+	Misses uint64
+	// Evictions is the number of blocks removed from the cache to stay under the size limit.
+	Evictions uint64
+}
+
+// entry represents a cached block.
+type entry struct {
+	hash chainhash.Hash
+	size int64
+}
+
+// Client wraps a client.Client and keeps the blocks it returns in a content-addressed directory keyed by block
+// hash, so later calls for the same blocks don't reach the node. Blocks are stored gzipped in the JSON format
+// of getblock with verbosity = 2, or 3 if their prevouts were resolved, and the least recently used ones are
+// evicted when the directory grows over the size limit. The number of confirmations and the next block hash of a
+// cached block are the ones it had when it was fetched.
+//
+// Block hashes, counts and the chain state depend on the node's current chain and are never cached.
+type Client struct {
+	// Counters are accessed atomically and kept first for 64-bit alignment.
+	hits      uint64
+	misses    uint64
+	evictions uint64
+
+	client.Client
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *entry, most recently used first
+	entries map[chainhash.Hash]*list.Element
+}
+
+// New returns a client caching the blocks returned by c in config.Dir. Blocks already in the directory are
+// served from the start.
+func New(c client.Client, config Config) (*Client, error) {
+	if config.Dir == "" {
+		return nil, errors.New("cache directory must not be empty")
+	}
+	if config.MaxBytes < 0 {
+		return nil, fmt.Errorf("cache size limit (%d) must not be negative", config.MaxBytes)
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+	cache := &Client{
+		Client:   c,
+		dir:      config.Dir,
+		maxBytes: config.MaxBytes,
+		lru:      list.New(),
+		entries:  make(map[chainhash.Hash]*list.Element),
+	}
+	if err := cache.scan(); err != nil {
+		return nil, fmt.Errorf("reading cache directory: %w", err)
+	}
+	cache.mu.Lock()
+	cache.evict()
+	cache.mu.Unlock()
+	return cache, nil
+}
+
+// Stats returns the number of cache hits, misses and evictions so far.
+func (c *Client) Stats() Stats {
+	return Stats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+	}
+}
+
+// Size returns the total size in bytes of the cached blocks.
+func (c *Client) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// GetBlockHeaders returns block headers given a list/range of block hashes. The headers of cached blocks are
+// read from the cache, the others are fetched from the wrapped client.
+// Implements client.Client.
+func (c *Client) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
+	headers := make([]*types.BlockHeader, len(hashes))
+	var missing []int
+	for i, hash := range hashes {
+		if blk := c.load(hash); blk != nil {
+			headers[i] = blk.BlockHeader
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return headers, nil
+	}
+	fetched, err := c.Client.GetBlockHeaders(ctx, subset(hashes, missing))
+	if err != nil {
+		return nil, err
+	}
+	for i, header := range fetched {
+		headers[missing[i]] = header
+	}
+	return headers, nil
+}
+
+// GetBlocks returns blocks with transactions given a list/range of block hashes. Cached blocks are read from
+// the cache, the others are fetched from the wrapped client and added to the cache.
+// Implements client.Client.
+func (c *Client) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	blocks := make([]*types.Block, len(hashes))
+	var missing []int
+	for i, hash := range hashes {
+		if blk := c.load(hash); blk != nil {
+			blocks[i] = blk
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return blocks, nil
+	}
+	fetched, err := c.Client.GetBlocks(ctx, subset(hashes, missing))
+	if err != nil {
+		return nil, err
+	}
+	for i, blk := range fetched {
+		blocks[missing[i]] = blk
+		// A block that can't be cached is fetched again next time, which doesn't justify failing the call.
+		if err := c.store(hashes[missing[i]], blk); err != nil {
+			log.Printf("caching block %s: %v\n", blk, err)
+		}
+	}
+	return blocks, nil
+}
+
+// GetPrevouts returns the outputs at the given outpoints if the wrapped client can look them up. They aren't
+// cached.
+// Implements client.PrevoutClient.
+func (c *Client) GetPrevouts(ctx context.Context, outpoints []wire.OutPoint) ([]*types.Prevout, error) {
+	return client.GetPrevouts(ctx, c.Client, outpoints)
+}
+
+// GetMempool returns the transactions in the mempool if the wrapped client can fetch them. They aren't cached.
+// Implements client.MempoolClient.
+func (c *Client) GetMempool(ctx context.Context) ([]*types.MempoolTx, error) {
+	return client.GetMempool(ctx, c.Client)
+}
+
+// load returns the cached block with the given hash or nil if it isn't cached or can't be read.
+func (c *Client) load(hash *chainhash.Hash) *types.Block {
+	c.mu.Lock()
+	elem, ok := c.entries[*hash]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil
+	}
+
+	path := c.path(hash)
+	blk, err := readBlock(path)
+	if err == nil && blk.Hash() != hash.String() {
+		err = fmt.Errorf("file holds block %s", blk)
+	}
+	if err != nil {
+		log.Printf("reading cached block %s: %v\n", hash, err)
+		c.mu.Lock()
+		c.remove(elem)
+		c.mu.Unlock()
+		atomic.AddUint64(&c.misses, 1)
+		return nil
+	}
+	// The modification time orders blocks by use when the cache is opened again.
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	atomic.AddUint64(&c.hits, 1)
+	return blk
+}
+
+// store writes blk to the cache and evicts blocks if the cache grows over its size limit.
+func (c *Client) store(hash *chainhash.Hash, blk *types.Block) error {
+	if blk.Hash() != hash.String() {
+		return fmt.Errorf("requested block %s", hash)
+	}
+	path := c.path(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	size, err := writeBlock(path, blk)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[*hash]; ok {
+		// Another call stored the same block concurrently.
+		c.size -= elem.Value.(*entry).size
+		elem.Value.(*entry).size = size
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[*hash] = c.lru.PushFront(&entry{hash: *hash, size: size})
+	}
+	c.size += size
+	c.evict()
+	return nil
+}
+
+// evict removes the least recently used blocks until the cache is under its size limit. c.mu must be held.
+func (c *Client) evict() {
+	for c.maxBytes > 0 && c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+// remove deletes a cached block. c.mu must be held.
+func (c *Client) remove(elem *list.Element) {
+	e := elem.Value.(*entry)
+	if c.entries[e.hash] != elem {
+		// Already removed by a concurrent call.
+		return
+	}
+	if err := os.Remove(c.path(&e.hash)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("removing cached block %s: %v\n", e.hash, err)
+	}
+	c.lru.Remove(elem)
+	delete(c.entries, e.hash)
+	c.size -= e.size
+}
+
+// scan adds the blocks found in the cache directory, ordered by modification time, and removes leftover
+// temporary files.
+func (c *Client) scan() error {
+	type found struct {
+		entry
+		modTime time.Time
+	}
+	var blocks []found
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := d.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			return os.Remove(path)
+		}
+		if !strings.HasSuffix(name, blockFileExt) {
+			return nil
+		}
+		hash, err := chainhash.NewHashFromStr(strings.TrimSuffix(name, blockFileExt))
+		if err != nil || path != c.path(hash) {
+			// Not a cached block.
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, found{entry{*hash, info.Size()}, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].modTime.Before(blocks[j].modTime) })
+	for i := range blocks {
+		e := blocks[i].entry
+		c.entries[e.hash] = c.lru.PushFront(&e)
+		c.size += e.size
+	}
+	return nil
+}
+
+// path returns the file of a cached block. Blocks are spread over subdirectories named after the first two
+// hex digits of their hash.
+func (c *Client) path(hash *chainhash.Hash) string {
+	s := hash.String()
+	return filepath.Join(c.dir, s[:2], s+blockFileExt)
+}
+
+// subset returns the hashes at the given indices.
+func subset(hashes []*chainhash.Hash, indices []int) []*chainhash.Hash {
+	res := make([]*chainhash.Hash, len(indices))
+	for i, index := range indices {
+		res[i] = hashes[index]
+	}
+	return res
+}
+
+// readBlock decodes the block stored at path.
+func readBlock(path string) (*types.Block, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	blk := new(types.Block)
+	if err := json.NewDecoder(zr).Decode(blk); err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
+// writeBlock stores blk at path and returns the size of the file. The block is written to a temporary file
+// first so a crash never leaves a partial block behind.
+func writeBlock(path string, blk *types.Block) (int64, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	zw := gzip.NewWriter(f)
+	err = json.NewEncoder(zw).Encode(blk)
+	if err == nil {
+		err = zw.Close()
+	}
+	var size int64
+	if err == nil {
+		size, err = f.Seek(0, io.SeekCurrent)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return size, os.Rename(f.Name(), path)
+}
@@ -0,0 +1,307 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	_ client.Client        = (*Client)(nil)
+	_ client.PrevoutClient = (*Client)(nil)
+	_ client.MempoolClient = (*Client)(nil)
+)
+
+// chainClient serves a chain of blocks and counts the blocks and headers it returns.
+type chainClient struct {
+	blocks  []*types.Block
+	byHash  map[chainhash.Hash]*types.Block
+	fetched int
+}
+
+func newChainClient(n int) *chainClient {
+	c := &chainClient{byHash: make(map[chainhash.Hash]*types.Block)}
+	prev := chaincfg.RegressionNetParams.GenesisBlock
+	for height := int64(0); height < int64(n); height++ {
+		msg := prev
+		if height > 0 {
+			msg = testBlock(prev, height)
+		}
+		blk := types.NewBlockFromWire(msg, height, &chaincfg.RegressionNetParams)
+		c.blocks = append(c.blocks, blk)
+		c.byHash[msg.BlockHash()] = blk
+		prev = msg
+	}
+	return c
+}
+
+func (c *chainClient) GetBlockCount(ctx context.Context) (int64, error) {
+	return int64(len(c.blocks) - 1), nil
+}
+
+func (c *chainClient) GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error) {
+	tip := c.blocks[len(c.blocks)-1]
+	hash, err := chainhash.NewHashFromStr(tip.Hash())
+	return hash, tip.Height(), err
+}
+
+func (c *chainClient) GetChainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	tip := c.blocks[len(c.blocks)-1]
+	return types.NewChainInfo(btcjson.GetBlockChainInfoResult{
+		Chain:         "regtest",
+		Blocks:        int32(tip.Height()),
+		Headers:       int32(tip.Height()),
+		BestBlockHash: tip.Hash(),
+	}), nil
+}
+
+func (c *chainClient) GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error) {
+	hashes := make([]*chainhash.Hash, 0, maxBlockNumber-minBlockNumber+1)
+	for _, blk := range c.blocks[minBlockNumber : maxBlockNumber+1] {
+		hash, err := chainhash.NewHashFromStr(blk.Hash())
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+func (c *chainClient) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
+	blocks, err := c.GetBlocks(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	headers := make([]*types.BlockHeader, len(blocks))
+	for i, blk := range blocks {
+		headers[i] = blk.BlockHeader
+	}
+	return headers, nil
+}
+
+func (c *chainClient) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	blocks := make([]*types.Block, len(hashes))
+	for i, hash := range hashes {
+		blk, ok := c.byHash[*hash]
+		if !ok {
+			return nil, fmt.Errorf("block %s not found", hash)
+		}
+		blocks[i] = blk
+	}
+	c.fetched += len(hashes)
+	return blocks, nil
+}
+
+type CacheClientTestSuite struct {
+	suite.Suite
+	dir    string
+	inner  *chainClient
+	hashes []*chainhash.Hash
+}
+
+func (s *CacheClientTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.inner = newChainClient(10)
+	var err error
+	s.hashes, err = s.inner.GetBlockHashesByRange(context.Background(), 0, 9)
+	s.Require().NoError(err)
+}
+
+func (s *CacheClientTestSuite) newCache(maxBytes int64) *Client {
+	c, err := New(s.inner, Config{Dir: s.dir, MaxBytes: maxBytes})
+	s.Require().NoError(err)
+	return c
+}
+
+func (s *CacheClientTestSuite) TestGetBlocks() {
+	c := s.newCache(0)
+	blocks, err := c.GetBlocks(context.Background(), s.hashes[2:6])
+	s.Require().NoError(err)
+	s.Equal(4, s.inner.fetched)
+	s.Equal(Stats{Misses: 4}, c.Stats())
+
+	// Only the blocks that aren't cached yet are fetched and blocks come back in order.
+	s.inner.fetched = 0
+	all, err := c.GetBlocks(context.Background(), s.hashes)
+	s.Require().NoError(err)
+	s.Equal(6, s.inner.fetched)
+	s.Equal(Stats{Hits: 4, Misses: 10}, c.Stats())
+	for i, blk := range all {
+		s.Equal(s.hashes[i].String(), blk.Hash())
+		s.Equal(int64(i), blk.Height())
+	}
+	s.assertBlocksEqual(blocks, all[2:6])
+
+	// A new client serves the blocks left in the directory.
+	s.inner.fetched = 0
+	c = s.newCache(0)
+	s.Equal(c.Size(), dirSize(s.T(), s.dir))
+	cached, err := c.GetBlocks(context.Background(), s.hashes)
+	s.Require().NoError(err)
+	s.Zero(s.inner.fetched)
+	s.assertBlocksEqual(all, cached)
+}
+
+func (s *CacheClientTestSuite) TestGetBlockHeaders() {
+	c := s.newCache(0)
+	_, err := c.GetBlocks(context.Background(), s.hashes[:5])
+	s.Require().NoError(err)
+
+	s.inner.fetched = 0
+	headers, err := c.GetBlockHeaders(context.Background(), s.hashes)
+	s.Require().NoError(err)
+	s.Equal(5, s.inner.fetched)
+	for i, header := range headers {
+		s.Equal(s.inner.blocks[i].BlockHeader, header)
+	}
+}
+
+func (s *CacheClientTestSuite) TestEviction() {
+	sizer, err := New(s.inner, Config{Dir: s.T().TempDir()})
+	s.Require().NoError(err)
+	_, err = sizer.GetBlocks(context.Background(), s.hashes[9:])
+	s.Require().NoError(err)
+	blockSize := sizer.Size()
+
+	// Room for three blocks of about the same size.
+	c := s.newCache(blockSize*3 + blockSize/2)
+	_, err = c.GetBlocks(context.Background(), s.hashes[1:4])
+	s.Require().NoError(err)
+	s.Zero(c.Stats().Evictions)
+
+	// Block 1 is used again so block 2 is the least recently used one.
+	_, err = c.GetBlocks(context.Background(), s.hashes[1:2])
+	s.Require().NoError(err)
+	_, err = c.GetBlocks(context.Background(), s.hashes[4:5])
+	s.Require().NoError(err)
+	s.EqualValues(1, c.Stats().Evictions)
+	s.LessOrEqual(c.Size(), blockSize*3+blockSize/2)
+	s.Equal(c.Size(), dirSize(s.T(), s.dir))
+
+	s.inner.fetched = 0
+	_, err = c.GetBlocks(context.Background(), []*chainhash.Hash{s.hashes[1], s.hashes[3], s.hashes[4]})
+	s.Require().NoError(err)
+	s.Zero(s.inner.fetched)
+	_, err = c.GetBlocks(context.Background(), s.hashes[2:3])
+	s.Require().NoError(err)
+	s.Equal(1, s.inner.fetched)
+
+	// A smaller limit evicts blocks when the cache is opened.
+	c = s.newCache(blockSize + blockSize/2)
+	s.LessOrEqual(c.Size(), blockSize+blockSize/2)
+	s.Equal(c.Size(), dirSize(s.T(), s.dir))
+}
+
+func (s *CacheClientTestSuite) TestCorruptFile() {
+	c := s.newCache(0)
+	_, err := c.GetBlocks(context.Background(), s.hashes[:2])
+	s.Require().NoError(err)
+	s.Require().NoError(os.WriteFile(c.path(s.hashes[0]), []byte("garbage"), 0o644))
+	// Files that don't belong to the cache are ignored.
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, "README"), []byte("blocks"), 0o644))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, "partial.tmp"), []byte("{"), 0o644))
+
+	c = s.newCache(0)
+	s.NoFileExists(filepath.Join(s.dir, "partial.tmp"))
+	s.FileExists(filepath.Join(s.dir, "README"))
+	s.inner.fetched = 0
+	blocks, err := c.GetBlocks(context.Background(), s.hashes[:2])
+	s.Require().NoError(err)
+	s.Equal(1, s.inner.fetched)
+	s.Equal(s.hashes[0].String(), blocks[0].Hash())
+
+	// The block fetched again replaces the corrupt file.
+	s.inner.fetched = 0
+	_, err = c.GetBlocks(context.Background(), s.hashes[:1])
+	s.Require().NoError(err)
+	s.Zero(s.inner.fetched)
+}
+
+func (s *CacheClientTestSuite) TestPassThrough() {
+	c := s.newCache(0)
+	count, err := c.GetBlockCount(context.Background())
+	s.NoError(err)
+	s.EqualValues(9, count)
+	hashes, err := c.GetBlockHashesByRange(context.Background(), 0, 9)
+	s.NoError(err)
+	s.Equal(s.hashes, hashes)
+
+	_, err = c.GetBlocks(context.Background(), []*chainhash.Hash{{}})
+	s.Error(err)
+}
+
+func (s *CacheClientTestSuite) assertBlocksEqual(want, got []*types.Block) {
+	s.Require().Len(got, len(want))
+	for i := range want {
+		s.Equal(want[i].BlockHeader, got[i].BlockHeader)
+		s.Require().Len(got[i].Transactions(), len(want[i].Transactions()))
+		for j, tx := range want[i].Transactions() {
+			s.Equal(tx.Hex(), got[i].Transactions()[j].Hex())
+			s.Equal(tx.Vout(), got[i].Transactions()[j].Vout())
+		}
+	}
+}
+
+func TestCacheClientTestSuite(t *testing.T) {
+	suite.Run(t, new(CacheClientTestSuite))
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New(newChainClient(1), Config{}); err == nil {
+		t.Error("New without a directory should fail")
+	}
+	if _, err := New(newChainClient(1), Config{Dir: t.TempDir(), MaxBytes: -1}); err == nil {
+		t.Error("New with a negative size limit should fail")
+	}
+}
+
+// dirSize returns the total size of the files under dir.
+func dirSize(t *testing.T, dir string) int64 {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && filepath.Ext(path) == ".gz" {
+			size += info.Size()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return size
+}
+
+// testBlock returns a block with a coinbase transaction on top of prev.
+func testBlock(prev *wire.MsgBlock, height int64) *wire.MsgBlock {
+	coinbaseScript, _ := txscript.NewScriptBuilder().AddInt64(height).Script()
+	pkScript, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(make([]byte, 20)).Script()
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), coinbaseScript, nil))
+	coinbase.AddTxOut(wire.NewTxOut(50*btcutil.SatoshiPerBitcoin, pkScript))
+
+	merkles := blockchain.BuildMerkleTreeStore([]*btcutil.Tx{btcutil.NewTx(coinbase)}, false)
+	msg := wire.NewMsgBlock(wire.NewBlockHeader(
+		wire.TxVersion,
+		&chainhash.Hash{},
+		merkles[len(merkles)-1],
+		chaincfg.RegressionNetParams.PowLimitBits,
+		uint32(height),
+	))
+	msg.Header.PrevBlock = prev.BlockHash()
+	msg.Header.Timestamp = prev.Header.Timestamp.Add(10 * time.Minute)
+	msg.AddTransaction(coinbase)
+	return msg
+}
@@ -1,17 +1,63 @@
 package client
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/IlliniBlockchain/etl-bitcoin/types"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 )
 
 // Client represents a connection to a bitcoin node.
+//
+// Every method returns promptly once ctx is cancelled or its deadline passes, abandoning any request still in
+// flight, with an error wrapping ctx.Err().
 type Client interface {
+	// GetBlockCount returns the height of the most-work fully-validated chain.
+	GetBlockCount(ctx context.Context) (int64, error)
+	// GetBestBlock returns the hash and height of the tip of the most-work fully-validated chain.
+	GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error)
+	// GetChainInfo returns the state of the chain, e.g. its network and whether the node is still in initial
+	// block download.
+	GetChainInfo(ctx context.Context) (*types.ChainInfo, error)
 	// GetBlockHashesByRange returns block hashes from the server given a range (inclusive) of block numbers.
 	// Hashes are returned in order from `minBlockNumber` to `maxBlockNumber`
-	GetBlockHashesByRange(minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error)
+	GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error)
 	// GetBlockHeadersByRange returns block headers from the server given a list/range of block hashes.
-	GetBlockHeaders(hashes []*chainhash.Hash) ([]*types.BlockHeader, error)
+	GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error)
 	// GetBlocksByRange returns blocks with transactions from the server given a list/range of block hashes.
-	GetBlocks(hashes []*chainhash.Hash) ([]*types.Block, error)
+	GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error)
+}
+
+// PrevoutClient is implemented by clients able to look up the outputs spent by transaction inputs.
+type PrevoutClient interface {
+	// GetPrevouts returns the outputs at the given outpoints, along with the height of the blocks that created
+	// them, in the order of outpoints.
+	GetPrevouts(ctx context.Context, outpoints []wire.OutPoint) ([]*types.Prevout, error)
+}
+
+// GetPrevouts returns the outputs at the given outpoints if c implements PrevoutClient, or an error otherwise.
+func GetPrevouts(ctx context.Context, c Client, outpoints []wire.OutPoint) ([]*types.Prevout, error) {
+	pc, ok := c.(PrevoutClient)
+	if !ok {
+		return nil, fmt.Errorf("%T can't look up prevouts: %w", c, ErrUnsupported)
+	}
+	return pc.GetPrevouts(ctx, outpoints)
+}
+
+// MempoolClient is implemented by clients able to list the unconfirmed transactions in the mempool of a node.
+type MempoolClient interface {
+	// GetMempool returns the transactions in the mempool along with their mempool entries, ordered by the time
+	// they entered the mempool.
+	GetMempool(ctx context.Context) ([]*types.MempoolTx, error)
+}
+
+// GetMempool returns the transactions in the mempool if c implements MempoolClient, or an error otherwise.
+func GetMempool(ctx context.Context, c Client) ([]*types.MempoolTx, error) {
+	mc, ok := c.(MempoolClient)
+	if !ok {
+		return nil, fmt.Errorf("%T can't fetch the mempool: %w", c, ErrUnsupported)
+	}
+	return mc.GetMempool(ctx)
 }
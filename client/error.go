@@ -0,0 +1,7 @@
+package client
+
+import "errors"
+
+// ErrUnsupported is wrapped by the errors of calls a client can't serve at all, e.g. a fixture without the chain
+// info or a client unable to look up prevouts, as opposed to calls that failed.
+var ErrUnsupported = errors.New("unsupported by the client")
@@ -0,0 +1,389 @@
+// Package pool implements a client that spreads calls over several bitcoin nodes and fails over between them.
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/retry"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Default pool settings.
+const (
+	DefaultHealthCheckInterval = 30 * time.Second
+	DefaultMaxLag              = 2
+	DefaultCallTimeout         = 2 * time.Minute
+)
+
+// ErrNoNodes is returned when creating a pool without nodes.
+var ErrNoNodes = errors.New("pool needs at least one node")
+
+// ErrNodeTimeout is recorded for a node that didn't answer a call within the call timeout.
+var ErrNodeTimeout = errors.New("node did not answer in time")
+
+// Node represents a named bitcoin node of a pool.
+type Node struct {
+	Name   string
+	Client client.Client
+}
+
+// NodeStatus represents the state of a node as last seen by the pool.
+type NodeStatus struct {
+	Name string
+	// Healthy is false after the node failed a call with a transient error, until it passes a health check.
+	Healthy bool
+	// Height is the last block count reported by the node.
+	Height int64
+	// Behind is true when the node is more than the maximum lag behind the highest node.
+	Behind bool
+	// LastErr is the last error returned by the node.
+	LastErr error
+}
+
+// Config represents the settings of a pool.
+type Config struct {
+	// HealthCheckInterval is the time between two checks of every node in the background, 0 disables them.
+	HealthCheckInterval time.Duration
+	// MaxLag is the number of blocks a node may be behind the highest node before it stops receiving calls.
+	MaxLag int64
+	// CallTimeout is the time a node is given to answer a call before it is taken out of rotation and the call
+	// is failed over, 0 disables the timeout.
+	CallTimeout time.Duration
+}
+
+// DefaultConfig returns the pool settings used when no other value is given.
+func DefaultConfig() Config {
+	return Config{
+		HealthCheckInterval: DefaultHealthCheckInterval,
+		MaxLag:              DefaultMaxLag,
+		CallTimeout:         DefaultCallTimeout,
+	}
+}
+
+// node holds the state of a pool node. Its fields other than name and client are guarded by Client.mu.
+type node struct {
+	name    string
+	client  client.Client
+	healthy bool
+	height  int64
+	lastErr error
+}
+
+// Client represents a pool of bitcoin nodes. Calls are spread round-robin over the healthy nodes that are close
+// to the highest tip. When a node fails a call the next one is tried, and nodes failing with transient errors
+// (see retry.IsTransient) are taken out of rotation until they pass a health check.
+type Client struct {
+	next   uint64
+	nodes  []*node
+	config Config
+
+	mu  sync.Mutex
+	tip int64
+	// ctx is cancelled by Close to stop the background health checks.
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+// New creates a pool of nodes, checks their health and starts checking it in the background.
+// It fails if no node is healthy.
+func New(nodes []Node, config Config) (*Client, error) {
+	if len(nodes) == 0 {
+		return nil, ErrNoNodes
+	}
+	if config.MaxLag < 0 || config.CallTimeout < 0 {
+		return nil, fmt.Errorf("max lag (%d) and call timeout (%s) must not be negative", config.MaxLag, config.CallTimeout)
+	}
+	pool := &Client{
+		nodes:  make([]*node, len(nodes)),
+		config: config,
+	}
+	pool.ctx, pool.stop = context.WithCancel(context.Background())
+	for i, n := range nodes {
+		pool.nodes[i] = &node{name: n.Name, client: n.Client}
+	}
+	if _, err := pool.CheckHealth(pool.ctx); err != nil {
+		pool.stop()
+		return nil, err
+	}
+	if config.HealthCheckInterval > 0 {
+		pool.wg.Add(1)
+		go pool.healthCheckLoop()
+	}
+	return pool, nil
+}
+
+// Close stops the background health checks. It does not shut down the nodes' clients.
+func (pool *Client) Close() {
+	pool.stop()
+	pool.wg.Wait()
+}
+
+// Status returns the state of every node.
+func (pool *Client) Status() []NodeStatus {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	status := make([]NodeStatus, len(pool.nodes))
+	for i, n := range pool.nodes {
+		status[i] = NodeStatus{
+			Name:    n.name,
+			Healthy: n.healthy,
+			Height:  n.height,
+			Behind:  n.height < pool.tip-pool.config.MaxLag,
+			LastErr: n.lastErr,
+		}
+	}
+	return status
+}
+
+// CheckHealth asks every node for its block count, marks the nodes that answer as healthy and returns the
+// highest block count. Nodes that don't answer within the call timeout are marked as failed without waiting
+// for them any longer. It fails if no node answers. Nodes aren't marked as failed if ctx is done before they
+// answer.
+func (pool *Client) CheckHealth(ctx context.Context) (int64, error) {
+	type result struct {
+		i      int
+		height int64
+		err    error
+	}
+	callCtx, cancel := pool.callContext(ctx)
+	defer cancel()
+	// Buffered so nodes answering after the timeout don't block.
+	results := make(chan result, len(pool.nodes))
+	for i, n := range pool.nodes {
+		go func(i int, n *node) {
+			height, err := n.client.GetBlockCount(callCtx)
+			results <- result{i, height, err}
+		}(i, n)
+	}
+	heights := make([]int64, len(pool.nodes))
+	errs := make([]error, len(pool.nodes))
+	for i := range errs {
+		errs[i] = pool.timeoutErr()
+	}
+wait:
+	for answered := 0; answered < len(pool.nodes); answered++ {
+		select {
+		case res := <-results:
+			heights[res.i], errs[res.i] = res.height, res.err
+			if res.err != nil && callCtx.Err() != nil {
+				errs[res.i] = pool.timeoutErr()
+			}
+		case <-callCtx.Done():
+			break wait
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	var lastErr error
+	for i, n := range pool.nodes {
+		if errs[i] != nil {
+			pool.markFailed(n, errs[i], true)
+			lastErr = errs[i]
+			continue
+		}
+		if !n.healthy {
+			log.Printf("node %s is healthy at height %d\n", n.name, heights[i])
+		}
+		n.healthy = true
+		n.height = heights[i]
+		n.lastErr = nil
+	}
+	pool.updateTip()
+	for _, n := range pool.nodes {
+		if n.healthy {
+			return pool.tip, nil
+		}
+	}
+	return 0, fmt.Errorf("no healthy node: %w", lastErr)
+}
+
+// GetBlockCount returns the highest block count of the healthy nodes. Every node is asked so lagging nodes are
+// noticed as soon as possible.
+// Implements client.Client.
+func (pool *Client) GetBlockCount(ctx context.Context) (int64, error) {
+	return pool.CheckHealth(ctx)
+}
+
+// GetBestBlock returns the hash and height of the tip of a node at the highest known height.
+// Implements client.Client.
+func (pool *Client) GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error) {
+	var height int64
+	hash, err := do(ctx, pool, pool.tipHeight(), func(ctx context.Context, c client.Client) (hash *chainhash.Hash, err error) {
+		hash, height, err = c.GetBestBlock(ctx)
+		return hash, err
+	})
+	return hash, height, err
+}
+
+// GetChainInfo returns the state of the chain of a node at the highest known height.
+// Implements client.Client.
+func (pool *Client) GetChainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	return do(ctx, pool, pool.tipHeight(), func(ctx context.Context, c client.Client) (*types.ChainInfo, error) {
+		return c.GetChainInfo(ctx)
+	})
+}
+
+// GetBlockHashesByRange returns block hashes from a node given a range (inclusive) of block numbers.
+// Only nodes whose last known height includes the range are asked, unless none is.
+// Implements client.Client.
+func (pool *Client) GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error) {
+	return do(ctx, pool, maxBlockNumber, func(ctx context.Context, c client.Client) ([]*chainhash.Hash, error) {
+		return c.GetBlockHashesByRange(ctx, minBlockNumber, maxBlockNumber)
+	})
+}
+
+// GetBlockHeaders returns block headers from a node given a list/range of block hashes.
+// Implements client.Client.
+func (pool *Client) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
+	return do(ctx, pool, -1, func(ctx context.Context, c client.Client) ([]*types.BlockHeader, error) {
+		return c.GetBlockHeaders(ctx, hashes)
+	})
+}
+
+// GetBlocks returns blocks with transactions from a node given a list/range of block hashes.
+// Implements client.Client.
+func (pool *Client) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	return do(ctx, pool, -1, func(ctx context.Context, c client.Client) ([]*types.Block, error) {
+		return c.GetBlocks(ctx, hashes)
+	})
+}
+
+// GetPrevouts returns the outputs at the given outpoints from a node able to look them up.
+// Implements client.PrevoutClient.
+func (pool *Client) GetPrevouts(ctx context.Context, outpoints []wire.OutPoint) ([]*types.Prevout, error) {
+	return do(ctx, pool, -1, func(ctx context.Context, c client.Client) ([]*types.Prevout, error) {
+		return client.GetPrevouts(ctx, c, outpoints)
+	})
+}
+
+// GetMempool returns the transactions in the mempool of the first node able to fetch them. Nodes don't share
+// their mempools, so another node may be asked for the next snapshot.
+// Implements client.MempoolClient.
+func (pool *Client) GetMempool(ctx context.Context) ([]*types.MempoolTx, error) {
+	return do(ctx, pool, -1, func(ctx context.Context, c client.Client) ([]*types.MempoolTx, error) {
+		return client.GetMempool(ctx, c)
+	})
+}
+
+// do calls f with the clients of the candidate nodes in turn until one succeeds and returns the last error if
+// none does. Nodes are only candidates if their height is at least minHeight. Each call is given the call
+// timeout, and a node that exceeds it is taken out of rotation. No other node is tried once ctx is done, and
+// the node whose call was interrupted isn't held responsible.
+func do[T any](ctx context.Context, pool *Client, minHeight int64, f func(context.Context, client.Client) (T, error)) (T, error) {
+	var res T
+	var err error
+	for _, n := range pool.candidates(minHeight) {
+		callCtx, cancel := pool.callContext(ctx)
+		res, err = f(callCtx, n.client)
+		timedOut := callCtx.Err() != nil
+		cancel()
+		if err == nil {
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return res, err
+		}
+		down := retry.IsTransient(err)
+		if timedOut {
+			err, down = pool.timeoutErr(), true
+		}
+		pool.mu.Lock()
+		pool.markFailed(n, err, down)
+		pool.mu.Unlock()
+	}
+	return res, err
+}
+
+// callContext returns the context of a call to a node, which is done after the call timeout.
+func (pool *Client) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if pool.config.CallTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, pool.config.CallTimeout)
+}
+
+// timeoutErr returns the error recorded for a node that didn't answer within the call timeout.
+func (pool *Client) timeoutErr() error {
+	return fmt.Errorf("%w within %s", ErrNodeTimeout, pool.config.CallTimeout)
+}
+
+// candidates returns the nodes to try for a call, starting with the next node in the rotation. When no node is
+// healthy, up to date and at least at minHeight, every node is returned as a last resort.
+func (pool *Client) candidates(minHeight int64) []*node {
+	next := atomic.AddUint64(&pool.next, 1)
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	var eligible []*node
+	for _, n := range pool.nodes {
+		if n.healthy && n.height >= pool.tip-pool.config.MaxLag && n.height >= minHeight {
+			eligible = append(eligible, n)
+		}
+	}
+	if len(eligible) == 0 {
+		eligible = pool.nodes
+	}
+	start := int(next % uint64(len(eligible)))
+	candidates := make([]*node, len(eligible))
+	for i := range eligible {
+		candidates[i] = eligible[(start+i)%len(eligible)]
+	}
+	return candidates
+}
+
+// markFailed records an error returned by a node and takes it out of rotation if down is true.
+// pool.mu must be held.
+func (pool *Client) markFailed(n *node, err error, down bool) {
+	n.lastErr = err
+	if down && n.healthy {
+		log.Printf("node %s is unhealthy: %v\n", n.name, err)
+		n.healthy = false
+		pool.updateTip()
+	}
+}
+
+// tipHeight returns the highest height of the healthy nodes.
+func (pool *Client) tipHeight() int64 {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.tip
+}
+
+// updateTip sets the pool tip to the highest height of the healthy nodes. pool.mu must be held.
+func (pool *Client) updateTip() {
+	pool.tip = -1
+	for _, n := range pool.nodes {
+		if n.healthy && n.height > pool.tip {
+			pool.tip = n.height
+		}
+	}
+}
+
+func (pool *Client) healthCheckLoop() {
+	defer pool.wg.Done()
+	ticker := time.NewTicker(pool.config.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pool.ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := pool.CheckHealth(pool.ctx); err != nil && pool.ctx.Err() == nil {
+				log.Printf("pool health check: %v\n", err)
+			}
+		}
+	}
+}
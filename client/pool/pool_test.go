@@ -0,0 +1,336 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	_ client.Client        = (*Client)(nil)
+	_ client.PrevoutClient = (*Client)(nil)
+	_ client.MempoolClient = (*Client)(nil)
+)
+
+// fakeNode is a node at a given height that fails with err when it is set, or doesn't answer until the
+// context of the call is done when hang is set.
+type fakeNode struct {
+	mu     sync.Mutex
+	height int64
+	err    error
+	hang   bool
+	calls  int
+}
+
+func (n *fakeNode) set(height int64, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.height, n.err = height, err
+}
+
+func (n *fakeNode) setHang(hang bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.hang = hang
+}
+
+func (n *fakeNode) call(ctx context.Context) (int64, error) {
+	n.mu.Lock()
+	n.calls++
+	height, err, hang := n.height, n.err, n.hang
+	n.mu.Unlock()
+	if hang {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	return height, err
+}
+
+func (n *fakeNode) resetCalls() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls = 0
+}
+
+func (n *fakeNode) GetBlockCount(ctx context.Context) (int64, error) {
+	return n.call(ctx)
+}
+
+func (n *fakeNode) GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error) {
+	height, err := n.call(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &chainhash.Hash{}, height, nil
+}
+
+func (n *fakeNode) GetChainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	height, err := n.call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewChainInfo(btcjson.GetBlockChainInfoResult{Chain: "regtest", Blocks: int32(height), Headers: int32(height)}), nil
+}
+
+func (n *fakeNode) GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error) {
+	height, err := n.call(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if maxBlockNumber > height {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, "Block height out of range")
+	}
+	return make([]*chainhash.Hash, maxBlockNumber-minBlockNumber+1), nil
+}
+
+func (n *fakeNode) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
+	if _, err := n.call(ctx); err != nil {
+		return nil, err
+	}
+	return make([]*types.BlockHeader, len(hashes)), nil
+}
+
+func (n *fakeNode) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	if _, err := n.call(ctx); err != nil {
+		return nil, err
+	}
+	return make([]*types.Block, len(hashes)), nil
+}
+
+type PoolTestSuite struct {
+	suite.Suite
+	fakes []*fakeNode
+	pool  *Client
+}
+
+func (s *PoolTestSuite) SetupTest() {
+	s.fakes = []*fakeNode{{height: 100}, {height: 100}, {height: 100}}
+	nodes := make([]Node, len(s.fakes))
+	for i, fake := range s.fakes {
+		nodes[i] = Node{Name: string(rune('a' + i)), Client: fake}
+	}
+	var err error
+	s.pool, err = New(nodes, Config{MaxLag: 2})
+	s.Require().NoError(err)
+	s.resetCalls()
+}
+
+func (s *PoolTestSuite) TearDownTest() {
+	s.pool.Close()
+}
+
+func (s *PoolTestSuite) resetCalls() {
+	for _, fake := range s.fakes {
+		fake.resetCalls()
+	}
+}
+
+func (s *PoolTestSuite) calls() []int {
+	calls := make([]int, len(s.fakes))
+	for i, fake := range s.fakes {
+		fake.mu.Lock()
+		calls[i] = fake.calls
+		fake.mu.Unlock()
+	}
+	return calls
+}
+
+func (s *PoolTestSuite) TestLoadBalancing() {
+	for i := 0; i < 9; i++ {
+		_, err := s.pool.GetBlocks(context.Background(), make([]*chainhash.Hash, 1))
+		s.NoError(err)
+	}
+	s.Equal([]int{3, 3, 3}, s.calls())
+}
+
+func (s *PoolTestSuite) TestContextDone() {
+	// A call interrupted by its context doesn't fail over nor count against the node.
+	s.fakes[0].set(100, context.Canceled)
+	s.fakes[1].set(100, context.Canceled)
+	s.fakes[2].set(100, context.Canceled)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.pool.GetBlocks(ctx, make([]*chainhash.Hash, 1))
+	s.ErrorIs(err, context.Canceled)
+	s.Equal(1, s.calls()[0]+s.calls()[1]+s.calls()[2])
+	for _, status := range s.pool.Status() {
+		s.True(status.Healthy)
+	}
+	_, err = s.pool.CheckHealth(ctx)
+	s.ErrorIs(err, context.Canceled)
+	for _, status := range s.pool.Status() {
+		s.True(status.Healthy)
+	}
+}
+
+func (s *PoolTestSuite) TestFailover() {
+	s.fakes[1].set(100, io.ErrUnexpectedEOF)
+	for i := 0; i < 6; i++ {
+		_, err := s.pool.GetBlocks(context.Background(), make([]*chainhash.Hash, 1))
+		s.NoError(err)
+	}
+	// The failing node is called once, then left out of the rotation.
+	s.Equal(1, s.fakes[1].calls)
+	s.Equal(6, s.fakes[0].calls+s.fakes[2].calls)
+	status := s.pool.Status()
+	s.False(status[1].Healthy)
+	s.ErrorIs(status[1].LastErr, io.ErrUnexpectedEOF)
+
+	// A health check brings it back.
+	s.fakes[1].set(100, nil)
+	count, err := s.pool.CheckHealth(context.Background())
+	s.NoError(err)
+	s.EqualValues(100, count)
+	s.True(s.pool.Status()[1].Healthy)
+	s.Nil(s.pool.Status()[1].LastErr)
+}
+
+func (s *PoolTestSuite) TestPermanentErrorsKeepNodeHealthy() {
+	notFound := btcjson.NewRPCError(btcjson.ErrRPCBlockNotFound, "Block not found")
+	for _, fake := range s.fakes {
+		fake.set(100, notFound)
+	}
+	_, err := s.pool.GetBlockHeaders(context.Background(), make([]*chainhash.Hash, 1))
+	s.Equal(notFound, err)
+	s.Equal([]int{1, 1, 1}, s.calls())
+	for _, status := range s.pool.Status() {
+		s.True(status.Healthy)
+	}
+}
+
+func (s *PoolTestSuite) TestLaggingNodes() {
+	s.fakes[0].set(90, nil)
+	s.fakes[2].set(101, nil)
+	count, err := s.pool.GetBlockCount(context.Background())
+	s.NoError(err)
+	s.EqualValues(101, count)
+	s.True(s.pool.Status()[0].Behind)
+	s.False(s.pool.Status()[1].Behind)
+	s.resetCalls()
+
+	for i := 0; i < 4; i++ {
+		_, err := s.pool.GetBlocks(context.Background(), make([]*chainhash.Hash, 1))
+		s.NoError(err)
+	}
+	s.Equal([]int{0, 2, 2}, s.calls())
+	s.resetCalls()
+
+	// Only the highest node has the requested heights.
+	for i := 0; i < 3; i++ {
+		hashes, err := s.pool.GetBlockHashesByRange(context.Background(), 95, 101)
+		s.NoError(err)
+		s.Len(hashes, 7)
+	}
+	s.Equal([]int{0, 0, 3}, s.calls())
+	s.resetCalls()
+
+	// The chain state comes from the highest node.
+	_, height, err := s.pool.GetBestBlock(context.Background())
+	s.NoError(err)
+	s.EqualValues(101, height)
+	info, err := s.pool.GetChainInfo(context.Background())
+	s.NoError(err)
+	s.EqualValues(101, info.Blocks())
+	s.Equal([]int{0, 0, 2}, s.calls())
+}
+
+func (s *PoolTestSuite) TestAllNodesDown() {
+	for _, fake := range s.fakes {
+		fake.set(100, io.ErrUnexpectedEOF)
+	}
+	_, err := s.pool.GetBlocks(context.Background(), make([]*chainhash.Hash, 1))
+	s.ErrorIs(err, io.ErrUnexpectedEOF)
+	_, err = s.pool.GetBlockCount(context.Background())
+	s.ErrorIs(err, io.ErrUnexpectedEOF)
+
+	// Unhealthy nodes are still tried as a last resort.
+	s.fakes[2].set(100, nil)
+	s.resetCalls()
+	_, err = s.pool.GetBlocks(context.Background(), make([]*chainhash.Hash, 1))
+	s.NoError(err)
+	s.Equal(1, s.fakes[2].calls)
+}
+
+func (s *PoolTestSuite) TestBackgroundHealthCheck() {
+	s.pool.Close()
+	nodes := []Node{{"a", s.fakes[0]}, {"b", s.fakes[1]}}
+	var err error
+	s.pool, err = New(nodes, Config{HealthCheckInterval: 10 * time.Millisecond, MaxLag: 2})
+	s.Require().NoError(err)
+
+	s.fakes[1].set(100, errors.New("status code: 503, response: \"Work queue depth exceeded\""))
+	s.Eventually(func() bool { return !s.pool.Status()[1].Healthy }, time.Second, 5*time.Millisecond)
+	s.fakes[1].set(105, nil)
+	s.Eventually(func() bool { return s.pool.Status()[1].Healthy }, time.Second, 5*time.Millisecond)
+	s.Eventually(func() bool { return s.pool.Status()[0].Behind }, time.Second, 5*time.Millisecond)
+}
+
+func (s *PoolTestSuite) TestHangingNode() {
+	s.pool.Close()
+	nodes := make([]Node, len(s.fakes))
+	for i, fake := range s.fakes {
+		nodes[i] = Node{Name: string(rune('a' + i)), Client: fake}
+	}
+	var err error
+	s.pool, err = New(nodes, Config{MaxLag: 2, CallTimeout: 50 * time.Millisecond})
+	s.Require().NoError(err)
+
+	// A call sent to a node that doesn't answer fails over once the call timeout passes.
+	s.fakes[1].setHang(true)
+	for i := 0; i < 6; i++ {
+		_, err := s.pool.GetBlocks(context.Background(), make([]*chainhash.Hash, 1))
+		s.NoError(err)
+	}
+	status := s.pool.Status()
+	s.False(status[1].Healthy)
+	s.ErrorIs(status[1].LastErr, ErrNodeTimeout)
+
+	// Health checks don't wait for it and use the nodes that answered.
+	s.fakes[2].set(101, nil)
+	start := time.Now()
+	count, err := s.pool.GetBlockCount(context.Background())
+	s.NoError(err)
+	s.EqualValues(101, count)
+	s.Less(time.Since(start), time.Second)
+	s.False(s.pool.Status()[1].Healthy)
+
+	// It is back in rotation once it answers a health check again.
+	s.fakes[1].setHang(false)
+	_, err = s.pool.CheckHealth(context.Background())
+	s.NoError(err)
+	s.True(s.pool.Status()[1].Healthy)
+}
+
+func TestPoolTestSuite(t *testing.T) {
+	suite.Run(t, new(PoolTestSuite))
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New(nil, DefaultConfig()); !errors.Is(err, ErrNoNodes) {
+		t.Errorf("New without nodes = %v; want ErrNoNodes", err)
+	}
+	down := &fakeNode{err: io.ErrUnexpectedEOF}
+	if _, err := New([]Node{{"down", down}}, DefaultConfig()); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("New without healthy nodes = %v; want io.ErrUnexpectedEOF", err)
+	}
+	if _, err := New([]Node{{"a", &fakeNode{}}}, Config{MaxLag: -1}); err == nil {
+		t.Error("New with a negative max lag should fail")
+	}
+	hanging := &fakeNode{hang: true}
+	start := time.Now()
+	if _, err := New([]Node{{"hanging", hanging}}, Config{CallTimeout: 50 * time.Millisecond}); !errors.Is(err, ErrNodeTimeout) {
+		t.Errorf("New with a hanging node = %v; want ErrNodeTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("New with a hanging node took %s", elapsed)
+	}
+}
@@ -0,0 +1,25 @@
+package replay
+
+import (
+	"fmt"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+)
+
+// ErrNotRecorded is returned when a fixture doesn't hold the response to a call. It wraps client.ErrUnsupported.
+type ErrNotRecorded struct {
+	what string
+}
+
+// NewErrNotRecorded returns an ErrNotRecorded for a missing response described by what.
+func NewErrNotRecorded(what string) ErrNotRecorded {
+	return ErrNotRecorded{what}
+}
+
+// Error implements error.Error interface.
+func (e ErrNotRecorded) Error() string {
+	return fmt.Sprintf("%s not recorded in fixture", e.what)
+}
+
+// Unwrap returns client.ErrUnsupported.
+func (e ErrNotRecorded) Unwrap() error { return client.ErrUnsupported }
@@ -0,0 +1,201 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Recorder wraps a client.Client and records its successful responses into a fixture directory that can be
+// replayed with New. Errors are returned unchanged and never recorded.
+//
+// Headers and blocks are written as they are returned. The block count, chain state and block hashes are kept
+// in memory and written to chain.json by Close.
+type Recorder struct {
+	client.Client
+	dir string
+
+	mu    sync.Mutex
+	chain chain
+}
+
+// NewRecorder returns a client recording the responses of c into dir. Responses already recorded in dir are
+// kept, so several runs can add to the same fixture.
+func NewRecorder(c client.Client, dir string) (*Recorder, error) {
+	for _, subdir := range []string{headersDir, blocksDir} {
+		if err := os.MkdirAll(filepath.Join(dir, subdir), 0o755); err != nil {
+			return nil, fmt.Errorf("creating fixture directory: %w", err)
+		}
+	}
+	r := &Recorder{Client: c, dir: dir}
+	err := readJSON(filepath.Join(dir, chainFile), &r.chain)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading fixture: %w", err)
+	}
+	if r.chain.Hashes == nil {
+		r.chain.Hashes = make(map[int64]string)
+	}
+	return r, nil
+}
+
+// Close writes the recorded block count, chain state and block hashes to chain.json. The recorder can still be
+// used afterwards and closed again.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := writeJSON(filepath.Join(r.dir, chainFile), r.chain); err != nil {
+		return fmt.Errorf("recording chain: %w", err)
+	}
+	return nil
+}
+
+// GetBlockCount returns the height of the most-work fully-validated chain and records it.
+// Implements client.Client.
+func (r *Recorder) GetBlockCount(ctx context.Context) (int64, error) {
+	count, err := r.Client.GetBlockCount(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.updateChain(func(chain *chain) { chain.BlockCount = &count })
+	return count, nil
+}
+
+// GetBestBlock returns the hash and height of the tip of the most-work fully-validated chain and records them.
+// Implements client.Client.
+func (r *Recorder) GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error) {
+	hash, height, err := r.Client.GetBestBlock(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.updateChain(func(chain *chain) {
+		chain.BestBlock = &bestBlock{Hash: hash.String(), Height: height}
+	})
+	return hash, height, nil
+}
+
+// GetChainInfo returns the state of the chain and records it.
+// Implements client.Client.
+func (r *Recorder) GetChainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	info, err := r.Client.GetChainInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.updateChain(func(chain *chain) { chain.ChainInfo = info })
+	return info, nil
+}
+
+// GetBlockHashesByRange returns block hashes given a range (inclusive) of block numbers and records them.
+// Implements client.Client.
+func (r *Recorder) GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error) {
+	hashes, err := r.Client.GetBlockHashesByRange(ctx, minBlockNumber, maxBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	r.updateChain(func(chain *chain) {
+		for i, hash := range hashes {
+			chain.Hashes[minBlockNumber+int64(i)] = hash.String()
+		}
+	})
+	return hashes, nil
+}
+
+// GetBlockHeaders returns block headers given a list/range of block hashes and records them.
+// Implements client.Client.
+func (r *Recorder) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
+	headers, err := r.Client.GetBlockHeaders(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	for i, header := range headers {
+		if err := writeJSON(headerPath(r.dir, hashes[i]), header); err != nil {
+			return nil, fmt.Errorf("recording block header %s: %w", hashes[i], err)
+		}
+	}
+	return headers, nil
+}
+
+// GetBlocks returns blocks with transactions given a list/range of block hashes and records them.
+// Implements client.Client.
+func (r *Recorder) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	blocks, err := r.Client.GetBlocks(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	for i, blk := range blocks {
+		if err := writeJSON(blockPath(r.dir, hashes[i]), blk); err != nil {
+			return nil, fmt.Errorf("recording block %s: %w", hashes[i], err)
+		}
+	}
+	return blocks, nil
+}
+
+// GetPrevouts returns the outputs at the given outpoints if the wrapped client can look them up. They aren't
+// recorded: the blocks recorded afterwards hold them.
+// Implements client.PrevoutClient.
+func (r *Recorder) GetPrevouts(ctx context.Context, outpoints []wire.OutPoint) ([]*types.Prevout, error) {
+	return client.GetPrevouts(ctx, r.Client, outpoints)
+}
+
+// GetMempool returns the transactions in the mempool if the wrapped client can fetch them. They aren't
+// recorded since fixtures only hold the chain.
+// Implements client.MempoolClient.
+func (r *Recorder) GetMempool(ctx context.Context) ([]*types.MempoolTx, error) {
+	return client.GetMempool(ctx, r.Client)
+}
+
+// updateChain applies update to the recorded chain.
+func (r *Recorder) updateChain(update func(chain *chain)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	update(&r.chain)
+}
+
+// Write writes a fixture serving blocks as the whole chain of a node into dir, e.g. to replay generated
+// blocks. blocks must be ordered by height, the last one being the tip.
+func Write(dir string, blocks []*types.Block) error {
+	if len(blocks) == 0 {
+		return fmt.Errorf("no blocks to write")
+	}
+	for _, subdir := range []string{headersDir, blocksDir} {
+		if err := os.MkdirAll(filepath.Join(dir, subdir), 0o755); err != nil {
+			return fmt.Errorf("creating fixture directory: %w", err)
+		}
+	}
+	tip := blocks[len(blocks)-1]
+	count := tip.Height()
+	c := chain{
+		BlockCount: &count,
+		BestBlock:  &bestBlock{Hash: tip.Hash(), Height: tip.Height()},
+		ChainInfo: types.NewChainInfo(btcjson.GetBlockChainInfoResult{
+			Blocks:               int32(tip.Height()),
+			Headers:              int32(tip.Height()),
+			BestBlockHash:        tip.Hash(),
+			VerificationProgress: 1,
+		}),
+		Hashes: make(map[int64]string, len(blocks)),
+	}
+	for _, blk := range blocks {
+		hash, err := chainhash.NewHashFromStr(blk.Hash())
+		if err != nil {
+			return err
+		}
+		if err := writeJSON(blockPath(dir, hash), blk); err != nil {
+			return fmt.Errorf("writing block %s: %w", hash, err)
+		}
+		c.Hashes[blk.Height()] = blk.Hash()
+	}
+	if err := writeJSON(filepath.Join(dir, chainFile), c); err != nil {
+		return fmt.Errorf("writing chain: %w", err)
+	}
+	return nil
+}
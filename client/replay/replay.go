@@ -0,0 +1,206 @@
+// Package replay implements a client recording the responses of a bitcoin node into a fixture directory and a
+// client serving them back, so tests can run offline against realistic data.
+//
+// A fixture directory holds:
+//
+//	chain.json            the block count, best block, chain info and the block hashes by height
+//	headers/<hash>.json   block headers, encoded like getblock with verbosity = 1 without the transaction ids
+//	blocks/<hash>.json    blocks, encoded like getblock with verbosity = 2
+//
+// Responses are recorded per block rather than per call, so a replayed fixture can serve batches of any size.
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// Fixture file and directory names.
+const (
+	chainFile  = "chain.json"
+	headersDir = "headers"
+	blocksDir  = "blocks"
+)
+
+// chain represents the content of chain.json.
+type chain struct {
+	// BlockCount is the last block count returned by the node, nil if it was never asked.
+	BlockCount *int64 `json:"block_count,omitempty"`
+	// BestBlock is the last best block returned by the node, nil if it was never asked.
+	BestBlock *bestBlock `json:"best_block,omitempty"`
+	// ChainInfo is the last chain info returned by the node, nil if it was never asked.
+	ChainInfo *types.ChainInfo `json:"chain_info,omitempty"`
+	// Hashes maps block heights to block hashes.
+	Hashes map[int64]string `json:"hashes"`
+}
+
+// bestBlock represents a best block recorded in chain.json.
+type bestBlock struct {
+	Hash   string `json:"hash"`
+	Height int64  `json:"height"`
+}
+
+// Client serves the responses recorded in a fixture directory.
+type Client struct {
+	dir   string
+	chain chain
+}
+
+// New returns a client replaying the fixture in dir.
+func New(dir string) (*Client, error) {
+	c := &Client{dir: dir}
+	if err := readJSON(filepath.Join(dir, chainFile), &c.chain); err != nil {
+		return nil, fmt.Errorf("reading fixture: %w", err)
+	}
+	return c, nil
+}
+
+// GetBlockCount returns the recorded block count.
+// Implements client.Client.
+func (c *Client) GetBlockCount(ctx context.Context) (int64, error) {
+	if c.chain.BlockCount == nil {
+		return 0, NewErrNotRecorded("block count")
+	}
+	return *c.chain.BlockCount, nil
+}
+
+// GetBestBlock returns the recorded best block.
+// Implements client.Client.
+func (c *Client) GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error) {
+	if c.chain.BestBlock == nil {
+		return nil, 0, NewErrNotRecorded("best block")
+	}
+	hash, err := chainhash.NewHashFromStr(c.chain.BestBlock.Hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	return hash, c.chain.BestBlock.Height, nil
+}
+
+// GetChainInfo returns the recorded chain info.
+// Implements client.Client.
+func (c *Client) GetChainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	if c.chain.ChainInfo == nil {
+		return nil, NewErrNotRecorded("chain info")
+	}
+	return c.chain.ChainInfo, nil
+}
+
+// GetBlockHashesByRange returns the recorded block hashes given a range (inclusive) of block numbers.
+// Implements client.Client.
+func (c *Client) GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error) {
+	if minBlockNumber > maxBlockNumber {
+		return nil, fmt.Errorf("minBlockNumber (%d) must be less than or equal to maxBlockNumber (%d)", minBlockNumber, maxBlockNumber)
+	}
+	hashes := make([]*chainhash.Hash, 0, maxBlockNumber-minBlockNumber+1)
+	for height := minBlockNumber; height <= maxBlockNumber; height++ {
+		s, ok := c.chain.Hashes[height]
+		if !ok {
+			return nil, NewErrNotRecorded(fmt.Sprintf("hash of block %d", height))
+		}
+		hash, err := chainhash.NewHashFromStr(s)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// GetBlockHeaders returns the recorded block headers given a list/range of block hashes. The header of a
+// recorded block is returned if the header itself wasn't recorded.
+// Implements client.Client.
+func (c *Client) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
+	headers := make([]*types.BlockHeader, len(hashes))
+	for i, hash := range hashes {
+		header := new(types.BlockHeader)
+		err := readJSON(headerPath(c.dir, hash), header)
+		if errors.Is(err, fs.ErrNotExist) {
+			var blk *types.Block
+			if blk, err = c.getBlock(hash); err == nil {
+				header = blk.BlockHeader
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		headers[i] = header
+	}
+	return headers, nil
+}
+
+// GetBlocks returns the recorded blocks given a list/range of block hashes.
+// Implements client.Client.
+func (c *Client) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	blocks := make([]*types.Block, len(hashes))
+	for i, hash := range hashes {
+		blk, err := c.getBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+		blocks[i] = blk
+	}
+	return blocks, nil
+}
+
+func (c *Client) getBlock(hash *chainhash.Hash) (*types.Block, error) {
+	blk := new(types.Block)
+	err := readJSON(blockPath(c.dir, hash), blk)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, NewErrNotRecorded(fmt.Sprintf("block %s", hash))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
+func headerPath(dir string, hash *chainhash.Hash) string {
+	return filepath.Join(dir, headersDir, hash.String()+".json")
+}
+
+func blockPath(dir string, hash *chainhash.Hash) string {
+	return filepath.Join(dir, blocksDir, hash.String()+".json")
+}
+
+// readJSON decodes the JSON file at path into v.
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSON encodes v as indented JSON into the file at path. The file is replaced atomically so a fixture
+// is never left with a partial file.
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,333 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	_ client.Client = (*Client)(nil)
+	_ client.Client = (*Recorder)(nil)
+
+	_ client.PrevoutClient = (*Recorder)(nil)
+	_ client.MempoolClient = (*Recorder)(nil)
+)
+
+// chainClient serves a chain of regtest blocks.
+type chainClient struct {
+	blocks []*types.Block
+	byHash map[chainhash.Hash]*types.Block
+}
+
+func newChainClient(n int) *chainClient {
+	c := &chainClient{byHash: make(map[chainhash.Hash]*types.Block)}
+	prev := chaincfg.RegressionNetParams.GenesisBlock
+	for height := int64(0); height < int64(n); height++ {
+		msg := prev
+		if height > 0 {
+			msg = testBlock(prev, height)
+		}
+		blk := types.NewBlockFromWire(msg, height, &chaincfg.RegressionNetParams)
+		c.blocks = append(c.blocks, blk)
+		c.byHash[msg.BlockHash()] = blk
+		prev = msg
+	}
+	return c
+}
+
+func (c *chainClient) GetBlockCount(ctx context.Context) (int64, error) {
+	return int64(len(c.blocks) - 1), nil
+}
+
+func (c *chainClient) GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error) {
+	tip := c.blocks[len(c.blocks)-1]
+	hash, err := chainhash.NewHashFromStr(tip.Hash())
+	return hash, tip.Height(), err
+}
+
+func (c *chainClient) GetChainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	tip := c.blocks[len(c.blocks)-1]
+	return types.NewChainInfo(btcjson.GetBlockChainInfoResult{
+		Chain:                "regtest",
+		Blocks:               int32(tip.Height()),
+		Headers:              int32(tip.Height()),
+		BestBlockHash:        tip.Hash(),
+		VerificationProgress: 1,
+	}), nil
+}
+
+func (c *chainClient) GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error) {
+	if maxBlockNumber >= int64(len(c.blocks)) {
+		return nil, fmt.Errorf("block %d not found", maxBlockNumber)
+	}
+	hashes := make([]*chainhash.Hash, 0, maxBlockNumber-minBlockNumber+1)
+	for _, blk := range c.blocks[minBlockNumber : maxBlockNumber+1] {
+		hash, err := chainhash.NewHashFromStr(blk.Hash())
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+func (c *chainClient) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
+	blocks, err := c.GetBlocks(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	headers := make([]*types.BlockHeader, len(blocks))
+	for i, blk := range blocks {
+		headers[i] = blk.BlockHeader
+	}
+	return headers, nil
+}
+
+func (c *chainClient) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	blocks := make([]*types.Block, len(hashes))
+	for i, hash := range hashes {
+		blk, ok := c.byHash[*hash]
+		if !ok {
+			return nil, fmt.Errorf("block %s not found", hash)
+		}
+		blocks[i] = blk
+	}
+	return blocks, nil
+}
+
+type ReplayTestSuite struct {
+	suite.Suite
+	dir      string
+	chain    *chainClient
+	recorder *Recorder
+}
+
+func (s *ReplayTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.chain = newChainClient(10)
+	var err error
+	s.recorder, err = NewRecorder(s.chain, s.dir)
+	s.Require().NoError(err)
+}
+
+// replay closes the recorder and returns a client replaying what it recorded.
+func (s *ReplayTestSuite) replay() *Client {
+	s.Require().NoError(s.recorder.Close())
+	c, err := New(s.dir)
+	s.Require().NoError(err)
+	return c
+}
+
+func (s *ReplayTestSuite) TestRecordAndReplay() {
+	count, err := s.recorder.GetBlockCount(context.Background())
+	s.Require().NoError(err)
+	hashes, err := s.recorder.GetBlockHashesByRange(context.Background(), 0, 5)
+	s.Require().NoError(err)
+	blocks, err := s.recorder.GetBlocks(context.Background(), hashes[:4])
+	s.Require().NoError(err)
+	headers, err := s.recorder.GetBlockHeaders(context.Background(), hashes[4:])
+	s.Require().NoError(err)
+
+	c := s.replay()
+	replayedCount, err := c.GetBlockCount(context.Background())
+	s.NoError(err)
+	s.Equal(count, replayedCount)
+
+	// Batches don't need to match the recorded calls.
+	replayedHashes, err := c.GetBlockHashesByRange(context.Background(), 2, 5)
+	s.NoError(err)
+	s.Equal(hashes[2:], replayedHashes)
+	replayedBlocks, err := c.GetBlocks(context.Background(), hashes[1:3])
+	s.Require().NoError(err)
+	for i, blk := range replayedBlocks {
+		want := blocks[i+1]
+		s.Equal(want.BlockHeader, blk.BlockHeader)
+		s.Require().Len(blk.Transactions(), len(want.Transactions()))
+		for j, tx := range want.Transactions() {
+			s.Equal(tx.Hex(), blk.Transactions()[j].Hex())
+			s.Equal(tx.Vin(), blk.Transactions()[j].Vin())
+			s.Equal(tx.Vout(), blk.Transactions()[j].Vout())
+		}
+	}
+
+	// Headers are served from recorded headers or blocks.
+	replayedHeaders, err := c.GetBlockHeaders(context.Background(), hashes[3:])
+	s.Require().NoError(err)
+	s.Equal(blocks[3].BlockHeader, replayedHeaders[0])
+	s.Equal(headers, replayedHeaders[1:])
+}
+
+func (s *ReplayTestSuite) TestRecordChainState() {
+	hash, height, err := s.recorder.GetBestBlock(context.Background())
+	s.Require().NoError(err)
+	info, err := s.recorder.GetChainInfo(context.Background())
+	s.Require().NoError(err)
+
+	c := s.replay()
+	replayedHash, replayedHeight, err := c.GetBestBlock(context.Background())
+	s.NoError(err)
+	s.Equal(hash, replayedHash)
+	s.Equal(height, replayedHeight)
+	replayedInfo, err := c.GetChainInfo(context.Background())
+	s.NoError(err)
+	s.Equal(info, replayedInfo)
+}
+
+func (s *ReplayTestSuite) TestNotRecorded() {
+	hashes, err := s.recorder.GetBlockHashesByRange(context.Background(), 0, 1)
+	s.Require().NoError(err)
+	_, err = s.recorder.GetBlocks(context.Background(), hashes[:1])
+	s.Require().NoError(err)
+
+	c := s.replay()
+	var notRecorded ErrNotRecorded
+	_, err = c.GetBlockCount(context.Background())
+	s.ErrorAs(err, &notRecorded)
+	_, _, err = c.GetBestBlock(context.Background())
+	s.ErrorAs(err, &notRecorded)
+	_, err = c.GetChainInfo(context.Background())
+	s.ErrorAs(err, &notRecorded)
+	s.ErrorIs(err, client.ErrUnsupported)
+	_, err = c.GetBlockHashesByRange(context.Background(), 1, 2)
+	s.ErrorAs(err, &notRecorded)
+	_, err = c.GetBlocks(context.Background(), hashes)
+	s.ErrorAs(err, &notRecorded)
+	_, err = c.GetBlockHeaders(context.Background(), hashes)
+	s.ErrorAs(err, &notRecorded)
+	_, err = c.GetBlockHashesByRange(context.Background(), 1, 0)
+	s.Error(err)
+}
+
+func (s *ReplayTestSuite) TestRecordErrors() {
+	_, err := s.recorder.GetBlockHashesByRange(context.Background(), 5, 10)
+	s.Error(err)
+	_, err = s.recorder.GetBlocks(context.Background(), []*chainhash.Hash{{}})
+	s.Error(err)
+
+	_, err = s.replay().GetBlockHashesByRange(context.Background(), 5, 5)
+	s.ErrorAs(err, new(ErrNotRecorded))
+	entries, err := os.ReadDir(filepath.Join(s.dir, blocksDir))
+	s.NoError(err)
+	s.Empty(entries)
+}
+
+func (s *ReplayTestSuite) TestRecordAppends() {
+	_, err := s.recorder.GetBlockHashesByRange(context.Background(), 0, 2)
+	s.Require().NoError(err)
+	s.Require().NoError(s.recorder.Close())
+
+	s.recorder, err = NewRecorder(s.chain, s.dir)
+	s.Require().NoError(err)
+	_, err = s.recorder.GetBlockHashesByRange(context.Background(), 3, 4)
+	s.Require().NoError(err)
+
+	hashes, err := s.replay().GetBlockHashesByRange(context.Background(), 0, 4)
+	s.NoError(err)
+	s.Len(hashes, 5)
+}
+
+func (s *ReplayTestSuite) TestChainWrittenOnClose() {
+	_, err := s.recorder.GetBlockCount(context.Background())
+	s.Require().NoError(err)
+	_, err = New(s.dir)
+	s.ErrorIs(err, fs.ErrNotExist)
+
+	count, err := s.replay().GetBlockCount(context.Background())
+	s.NoError(err)
+	s.EqualValues(9, count)
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	chain := newChainClient(5)
+	if err := Write(dir, chain.blocks); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	hash, height, err := c.GetBestBlock(ctx)
+	if err != nil || hash.String() != chain.blocks[4].Hash() || height != 4 {
+		t.Errorf("GetBestBlock() = %v, %d, %v, want %s, 4", hash, height, err, chain.blocks[4].Hash())
+	}
+	info, err := c.GetChainInfo(ctx)
+	if err != nil || info.Blocks() != 4 || info.BestBlockHash() != chain.blocks[4].Hash() {
+		t.Errorf("GetChainInfo() = %v, %v, want the tip of the chain", info, err)
+	}
+	hashes, err := c.GetBlockHashesByRange(ctx, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := c.GetBlocks(ctx, hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, blk := range blocks {
+		if blk.Hash() != chain.blocks[i].Hash() || blk.Height() != int64(i) {
+			t.Errorf("block %d = %s at height %d, want %s", i, blk.Hash(), blk.Height(), chain.blocks[i].Hash())
+		}
+	}
+	if err := Write(t.TempDir(), nil); err == nil {
+		t.Error("Write without blocks should fail")
+	}
+}
+
+func TestReplayTestSuite(t *testing.T) {
+	suite.Run(t, new(ReplayTestSuite))
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New(t.TempDir()); err == nil {
+		t.Error("New without chain.json should fail")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, chainFile), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(dir); err == nil {
+		t.Error("New with an invalid chain.json should fail")
+	}
+	if _, err := NewRecorder(newChainClient(1), dir); err == nil {
+		t.Error("NewRecorder with an invalid chain.json should fail")
+	}
+}
+
+// testBlock returns a block with a coinbase transaction on top of prev.
+func testBlock(prev *wire.MsgBlock, height int64) *wire.MsgBlock {
+	coinbaseScript, _ := txscript.NewScriptBuilder().AddInt64(height).Script()
+	pkScript, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(make([]byte, 20)).Script()
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), coinbaseScript, nil))
+	coinbase.AddTxOut(wire.NewTxOut(50*btcutil.SatoshiPerBitcoin, pkScript))
+
+	merkles := blockchain.BuildMerkleTreeStore([]*btcutil.Tx{btcutil.NewTx(coinbase)}, false)
+	msg := wire.NewMsgBlock(wire.NewBlockHeader(
+		wire.TxVersion,
+		&chainhash.Hash{},
+		merkles[len(merkles)-1],
+		chaincfg.RegressionNetParams.PowLimitBits,
+		uint32(height),
+	))
+	msg.Header.PrevBlock = prev.BlockHash()
+	msg.Header.Timestamp = prev.Header.Timestamp.Add(10 * time.Minute)
+	msg.AddTransaction(coinbase)
+	return msg
+}
@@ -0,0 +1,23 @@
+package rest
+
+import "fmt"
+
+// ErrStatus is returned when the server answers a request with an unexpected HTTP status.
+type ErrStatus struct {
+	path       string
+	statusCode int
+	message    string
+}
+
+// NewErrStatus returns an ErrStatus for a request to path.
+func NewErrStatus(path string, statusCode int, message string) ErrStatus {
+	return ErrStatus{path, statusCode, message}
+}
+
+// StatusCode returns the HTTP status code of the response.
+func (e ErrStatus) StatusCode() int { return e.statusCode }
+
+// Error implements error.Error interface.
+func (e ErrStatus) Error() string {
+	return fmt.Sprintf("rest request %s failed with status %d: %s", e.path, e.statusCode, e.message)
+}
@@ -0,0 +1,259 @@
+// Package rest implements a client for the REST interface of Bitcoin Core (started with `-rest`).
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MaxHeaders is the maximum number of headers Bitcoin Core returns from a single `/rest/headers` request.
+const MaxHeaders = 2000
+
+// Client represents a connection to the REST interface of a bitcoin node.
+//
+// The REST interface needs no credentials and serves serialized blocks, which is much cheaper for the node
+// than rendering verbose JSON. Requests use the `?count=` form of `/rest/headers` added in Bitcoin Core 24.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	params     *chaincfg.Params
+}
+
+// New creates a client for the REST interface at host, e.g. `localhost:8332` or `https://node:8332`.
+// The scheme defaults to http. If httpClient is nil, http.DefaultClient is used.
+func New(host string, httpClient *http.Client, params *chaincfg.Params) (*Client, error) {
+	if host == "" {
+		return nil, fmt.Errorf("host must not be empty")
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(host, "/") + "/rest",
+		httpClient: httpClient,
+		params:     params,
+	}, nil
+}
+
+// Shutdown closes idle connections to the node.
+func (client *Client) Shutdown() {
+	client.httpClient.CloseIdleConnections()
+}
+
+// GetBlockCount returns the height of the most-work fully-validated chain.
+func (client *Client) GetBlockCount(ctx context.Context) (int64, error) {
+	info, err := client.GetChainInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return info.Blocks(), nil
+}
+
+// GetBestBlock returns the hash and height of the tip of the most-work fully-validated chain.
+func (client *Client) GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error) {
+	info, err := client.GetChainInfo(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	hash, err := chainhash.NewHashFromStr(info.BestBlockHash())
+	if err != nil {
+		return nil, 0, err
+	}
+	return hash, info.Blocks(), nil
+}
+
+// GetChainInfo returns the state of the chain, e.g. its network and whether the node is still in initial
+// block download.
+func (client *Client) GetChainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	info := new(types.ChainInfo)
+	if err := client.getJSON(ctx, "/chaininfo.json", info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// GetBlockHashesByRange returns block hashes from the server given a range (inclusive) of block numbers.
+// Hashes are returned in order from `minBlockNumber` to `maxBlockNumber`
+func (client *Client) GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error) {
+	if minBlockNumber > maxBlockNumber {
+		return nil, fmt.Errorf(
+			"minBlockNumber (%d) must be less than or equal to maxBlockNumber (%d)",
+			minBlockNumber,
+			maxBlockNumber,
+		)
+	}
+	raw, err := client.get(ctx, fmt.Sprintf("/blockhashbyheight/%d.bin", minBlockNumber))
+	if err != nil {
+		return nil, err
+	}
+	start, err := chainhash.NewHash(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decoding hash of block %d: %w", minBlockNumber, err)
+	}
+
+	// The following hashes are computed from the headers of the active chain starting at the first block.
+	// Each chunk after the first starts at the last header of the previous one, which is skipped.
+	nBlocks := maxBlockNumber - minBlockNumber + 1
+	hashes := make([]*chainhash.Hash, 0, nBlocks)
+	skip := int64(0)
+	for int64(len(hashes)) < nBlocks {
+		count := nBlocks - int64(len(hashes)) + skip
+		if count > MaxHeaders {
+			count = MaxHeaders
+		}
+		headers, err := client.getHeaders(ctx, start, count)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(headers)) < count {
+			return nil, fmt.Errorf("block %d is above the chain tip (%d)",
+				maxBlockNumber, minBlockNumber+int64(len(hashes)+len(headers))-skip-1)
+		}
+		for _, header := range headers[skip:] {
+			hash := header.BlockHash()
+			hashes = append(hashes, &hash)
+		}
+		start = hashes[len(hashes)-1]
+		skip = 1
+	}
+	return hashes, nil
+}
+
+// GetBlockHeaders returns block headers from the server given a list/range of block hashes.
+func (client *Client) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
+	results, err := client.getHeadersVerbose(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	blockHeaders := make([]*types.BlockHeader, len(results))
+	for i, result := range results {
+		blockHeaders[i] = types.NewBlockHeader(result)
+	}
+	return blockHeaders, nil
+}
+
+// GetBlocks returns blocks with transactions from the server given a list/range of block hashes.
+// Blocks are downloaded in their serialized form and decoded by the client.
+func (client *Client) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	// Serialized blocks don't include their height, which is found in the headers.
+	headers, err := client.getHeadersVerbose(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]*types.Block, len(hashes))
+	for i, hash := range hashes {
+		raw, err := client.get(ctx, "/block/"+hash.String()+".bin")
+		if err != nil {
+			return nil, err
+		}
+		var msg wire.MsgBlock
+		if err := msg.Deserialize(bytes.NewReader(raw)); err != nil {
+			return nil, fmt.Errorf("decoding block %s: %w", hash, err)
+		}
+		if msg.BlockHash() != *hash {
+			return nil, fmt.Errorf("server returned block %s instead of %s", msg.BlockHash(), hash)
+		}
+		result := types.BlockVerboseFromWire(&msg, int64(headers[i].Height), client.params)
+		result.Confirmations = headers[i].Confirmations
+		result.NextHash = headers[i].NextHash
+		blocks[i] = types.NewBlock(result)
+	}
+	return blocks, nil
+}
+
+// getHeaders returns up to count serialized headers of the active chain starting at the block with the given hash.
+func (client *Client) getHeaders(ctx context.Context, hash *chainhash.Hash, count int64) ([]*wire.BlockHeader, error) {
+	raw, err := client.get(ctx, fmt.Sprintf("/headers/%s.bin?count=%d", hash, count))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw)%wire.MaxBlockHeaderPayload != 0 {
+		return nil, fmt.Errorf("headers response has invalid length %d", len(raw))
+	}
+	r := bytes.NewReader(raw)
+	headers := make([]*wire.BlockHeader, len(raw)/wire.MaxBlockHeaderPayload)
+	for i := range headers {
+		headers[i] = &wire.BlockHeader{}
+		if err := headers[i].Deserialize(r); err != nil {
+			return nil, fmt.Errorf("decoding header: %w", err)
+		}
+	}
+	return headers, nil
+}
+
+// getHeadersVerbose returns the JSON headers of the given blocks. Consecutive blocks of the active chain are
+// requested together.
+func (client *Client) getHeadersVerbose(ctx context.Context, hashes []*chainhash.Hash) ([]btcjson.GetBlockHeaderVerboseResult, error) {
+	results := make([]btcjson.GetBlockHeaderVerboseResult, 0, len(hashes))
+	for len(results) < len(hashes) {
+		rest := hashes[len(results):]
+		count := len(rest)
+		if count > MaxHeaders {
+			count = MaxHeaders
+		}
+		var chunk []btcjson.GetBlockHeaderVerboseResult
+		if err := client.getJSON(ctx, fmt.Sprintf("/headers/%s.json?count=%d", rest[0], count), &chunk); err != nil {
+			return nil, err
+		}
+		if len(chunk) == 0 {
+			return nil, fmt.Errorf("block %s not found", rest[0])
+		}
+		// Keep the headers matching the requested hashes, the rest of the chunk follows the active chain instead.
+		n := 0
+		for n < len(chunk) && n < count && chunk[n].Hash == rest[n].String() {
+			results = append(results, chunk[n])
+			n++
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("server returned header %s instead of %s", chunk[0].Hash, rest[0])
+		}
+	}
+	return results, nil
+}
+
+// getJSON requests path and decodes the JSON response into v.
+func (client *Client) getJSON(ctx context.Context, path string, v interface{}) error {
+	raw, err := client.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("decoding response of %s: %w", path, err)
+	}
+	return nil
+}
+
+// get requests path relative to the REST endpoint and returns the response body.
+func (client *Client) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, client.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response of %s: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, NewErrStatus(path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
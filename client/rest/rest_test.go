@@ -0,0 +1,382 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/suite"
+)
+
+var _ client.Client = (*Client)(nil)
+
+// testServer is a stand-in for the REST interface of Bitcoin Core serving a fixed chain.
+type testServer struct {
+	chain    []*wire.MsgBlock
+	blocks   map[chainhash.Hash]*wire.MsgBlock
+	heights  map[chainhash.Hash]int
+	requests int
+}
+
+func newTestServer(chain []*wire.MsgBlock, stale ...*wire.MsgBlock) *testServer {
+	srv := &testServer{
+		chain:   chain,
+		blocks:  make(map[chainhash.Hash]*wire.MsgBlock),
+		heights: make(map[chainhash.Hash]int),
+	}
+	for height, msg := range chain {
+		srv.blocks[msg.BlockHash()] = msg
+		srv.heights[msg.BlockHash()] = height
+	}
+	for _, msg := range stale {
+		srv.blocks[msg.BlockHash()] = msg
+		srv.heights[msg.BlockHash()] = srv.heights[msg.Header.PrevBlock] + 1
+	}
+	return srv
+}
+
+func (srv *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.requests++
+	path := strings.TrimPrefix(r.URL.Path, "/rest/")
+	switch {
+	case path == "chaininfo.json":
+		srv.writeJSON(w, map[string]interface{}{
+			"chain":                "regtest",
+			"blocks":               len(srv.chain) - 1,
+			"headers":              len(srv.chain) + 99,
+			"bestblockhash":        srv.chain[len(srv.chain)-1].BlockHash().String(),
+			"verificationprogress": 0.95,
+			"initialblockdownload": true,
+			"pruned":               false,
+		})
+	case strings.HasPrefix(path, "blockhashbyheight/"):
+		height, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path, "blockhashbyheight/"), ".bin"))
+		if err != nil || height < 0 || height >= len(srv.chain) {
+			http.Error(w, "Block height out of range", http.StatusNotFound)
+			return
+		}
+		hash := srv.chain[height].BlockHash()
+		w.Write(hash[:])
+	case strings.HasPrefix(path, "headers/"):
+		srv.serveHeaders(w, r, strings.TrimPrefix(path, "headers/"))
+	case strings.HasPrefix(path, "block/") && strings.HasSuffix(path, ".bin"):
+		msg, ok := srv.lookup(strings.TrimSuffix(strings.TrimPrefix(path, "block/"), ".bin"))
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		msg.Serialize(w)
+	default:
+		http.Error(w, "Invalid URI format", http.StatusNotFound)
+	}
+}
+
+func (srv *testServer) serveHeaders(w http.ResponseWriter, r *http.Request, path string) {
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count < 1 || count > MaxHeaders {
+		http.Error(w, "Header count is invalid or out of acceptable range", http.StatusBadRequest)
+		return
+	}
+	ext := path[strings.LastIndex(path, ".")+1:]
+	msg, ok := srv.lookup(strings.TrimSuffix(path, "."+ext))
+	if !ok {
+		srv.writeJSON(w, []interface{}{})
+		return
+	}
+	// Headers follow the active chain after the requested block.
+	headers := []*wire.MsgBlock{msg}
+	height := srv.heights[msg.BlockHash()]
+	if height < len(srv.chain) && srv.chain[height] == msg {
+		for h := height + 1; h < len(srv.chain) && len(headers) < count; h++ {
+			headers = append(headers, srv.chain[h])
+		}
+	}
+	switch ext {
+	case "bin":
+		for _, header := range headers {
+			header.Header.Serialize(w)
+		}
+	case "json":
+		results := make([]map[string]interface{}, len(headers))
+		for i, header := range headers {
+			results[i] = srv.headerJSON(header)
+		}
+		srv.writeJSON(w, results)
+	}
+}
+
+func (srv *testServer) headerJSON(msg *wire.MsgBlock) map[string]interface{} {
+	height := srv.heights[msg.BlockHash()]
+	result := map[string]interface{}{
+		"hash":          msg.BlockHash().String(),
+		"confirmations": -1,
+		"height":        height,
+		"version":       msg.Header.Version,
+		"versionHex":    fmt.Sprintf("%08x", msg.Header.Version),
+		"merkleroot":    msg.Header.MerkleRoot.String(),
+		"time":          msg.Header.Timestamp.Unix(),
+		"nonce":         msg.Header.Nonce,
+		"bits":          fmt.Sprintf("%08x", msg.Header.Bits),
+	}
+	if height > 0 {
+		result["previousblockhash"] = msg.Header.PrevBlock.String()
+	}
+	if height < len(srv.chain) && srv.chain[height] == msg {
+		result["confirmations"] = len(srv.chain) - height
+		if height+1 < len(srv.chain) {
+			result["nextblockhash"] = srv.chain[height+1].BlockHash().String()
+		}
+	}
+	return result
+}
+
+func (srv *testServer) lookup(hashStr string) (*wire.MsgBlock, bool) {
+	hash, err := chainhash.NewHashFromStr(hashStr)
+	if err != nil {
+		return nil, false
+	}
+	msg, ok := srv.blocks[*hash]
+	return msg, ok
+}
+
+func (srv *testServer) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+type RESTClientTestSuite struct {
+	suite.Suite
+	chain   []*wire.MsgBlock
+	stale   *wire.MsgBlock
+	srv     *testServer
+	httpSrv *httptest.Server
+	client  *Client
+}
+
+func (s *RESTClientTestSuite) SetupSuite() {
+	// Long enough to need more than one headers request.
+	s.chain = []*wire.MsgBlock{chaincfg.RegressionNetParams.GenesisBlock}
+	for height := int64(1); height <= MaxHeaders+100; height++ {
+		s.chain = append(s.chain, testBlock(s.chain[height-1], height, 0))
+	}
+	s.stale = testBlock(s.chain[9], 10, 1)
+}
+
+func (s *RESTClientTestSuite) SetupTest() {
+	s.srv = newTestServer(s.chain, s.stale)
+	s.httpSrv = httptest.NewServer(s.srv)
+	var err error
+	s.client, err = New(s.httpSrv.URL, nil, &chaincfg.RegressionNetParams)
+	s.Require().NoError(err)
+}
+
+func (s *RESTClientTestSuite) TearDownTest() {
+	s.client.Shutdown()
+	s.httpSrv.Close()
+}
+
+func (s *RESTClientTestSuite) TestGetBlockCount() {
+	count, err := s.client.GetBlockCount(context.Background())
+	s.NoError(err)
+	s.EqualValues(len(s.chain)-1, count)
+}
+
+func (s *RESTClientTestSuite) TestGetBestBlock() {
+	hash, height, err := s.client.GetBestBlock(context.Background())
+	s.NoError(err)
+	s.Equal(s.chain[len(s.chain)-1].BlockHash(), *hash)
+	s.EqualValues(len(s.chain)-1, height)
+}
+
+func (s *RESTClientTestSuite) TestGetChainInfo() {
+	info, err := s.client.GetChainInfo(context.Background())
+	s.Require().NoError(err)
+	s.Equal("regtest", info.Chain())
+	s.EqualValues(len(s.chain)-1, info.Blocks())
+	s.EqualValues(len(s.chain)+99, info.Headers())
+	s.Equal(s.chain[len(s.chain)-1].BlockHash().String(), info.BestBlockHash())
+	s.Equal(0.95, info.VerificationProgress())
+	s.True(info.InitialBlockDownload())
+	s.False(info.Pruned())
+}
+
+func (s *RESTClientTestSuite) TestGetBlockHashesByRange() {
+	tests := []struct {
+		name         string
+		min, max     int64
+		wantRequests int
+	}{
+		{"single", 5, 5, 2},
+		{"genesis", 0, 10, 2},
+		{"max_headers", 0, MaxHeaders - 1, 2},
+		{"chunked", 3, MaxHeaders + 50, 3},
+		{"tip", int64(len(s.chain)) - 3, int64(len(s.chain)) - 1, 2},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.srv.requests = 0
+			hashes, err := s.client.GetBlockHashesByRange(context.Background(), tt.min, tt.max)
+			s.Require().NoError(err)
+			s.Require().Len(hashes, int(tt.max-tt.min+1))
+			for i, hash := range hashes {
+				s.Equal(s.chain[tt.min+int64(i)].BlockHash(), *hash)
+			}
+			s.Equal(tt.wantRequests, s.srv.requests)
+		})
+	}
+}
+
+func (s *RESTClientTestSuite) TestGetBlockHashesByRangeErrors() {
+	tests := []struct {
+		name     string
+		min, max int64
+	}{
+		{"reversed", 3, 2},
+		{"start_above_tip", int64(len(s.chain)), int64(len(s.chain)) + 1},
+		{"end_above_tip", 10, int64(len(s.chain))},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			_, err := s.client.GetBlockHashesByRange(context.Background(), tt.min, tt.max)
+			s.Error(err)
+		})
+	}
+
+	_, err := s.client.GetBlockHashesByRange(context.Background(), -1, 2)
+	var statusErr ErrStatus
+	s.ErrorAs(err, &statusErr)
+	s.Equal(http.StatusNotFound, statusErr.StatusCode())
+}
+
+func (s *RESTClientTestSuite) TestGetBlockHeaders() {
+	hashes := s.hashes(0, 2, 1, 10, 11)
+	headers, err := s.client.GetBlockHeaders(context.Background(), hashes)
+	s.Require().NoError(err)
+	s.Require().Len(headers, len(hashes))
+	for i, header := range headers {
+		height := s.srv.heights[*hashes[i]]
+		s.Equal(hashes[i].String(), header.Hash())
+		s.EqualValues(height, header.Height())
+		s.EqualValues(len(s.chain)-height, header.Confirmations())
+		s.Equal(s.chain[height+1].BlockHash().String(), header.NextHash())
+	}
+}
+
+func (s *RESTClientTestSuite) TestGetBlocks() {
+	staleHash := s.stale.BlockHash()
+	hashes := append(s.hashes(8, 9, 10), &staleHash)
+	blocks, err := s.client.GetBlocks(context.Background(), hashes)
+	s.Require().NoError(err)
+	s.Require().Len(blocks, len(hashes))
+	for i, block := range blocks[:3] {
+		msg := s.chain[8+i]
+		s.Equal(msg.BlockHash().String(), block.Hash())
+		s.EqualValues(8+i, block.Height())
+		s.EqualValues(len(s.chain)-8-i, block.Confirmations())
+		s.Equal(s.chain[9+i].BlockHash().String(), block.NextHash())
+		s.Require().Len(block.Transactions(), len(msg.Transactions))
+		s.Equal(msg.Transactions[0].TxHash().String(), block.Transactions()[0].TxID())
+	}
+	s.Equal(staleHash.String(), blocks[3].Hash())
+	s.EqualValues(10, blocks[3].Height())
+	s.EqualValues(-1, blocks[3].Confirmations())
+
+	unknown := chainhash.Hash{1}
+	_, err = s.client.GetBlocks(context.Background(), []*chainhash.Hash{&unknown})
+	s.Error(err)
+}
+
+func (s *RESTClientTestSuite) hashes(heights ...int) []*chainhash.Hash {
+	hashes := make([]*chainhash.Hash, len(heights))
+	for i, height := range heights {
+		hash := s.chain[height].BlockHash()
+		hashes[i] = &hash
+	}
+	return hashes
+}
+
+func TestRESTClientTestSuite(t *testing.T) {
+	suite.Run(t, new(RESTClientTestSuite))
+}
+
+func TestCancel(t *testing.T) {
+	release := make(chan struct{})
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer httpSrv.Close()
+	defer close(release)
+	c, err := New(httpSrv.URL, nil, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetBlockCount(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetBlockCount() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		host    string
+		want    string
+		wantErr bool
+	}{
+		{"localhost:8332", "http://localhost:8332/rest", false},
+		{"https://node:8332/", "https://node:8332/rest", false},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		c, err := New(tt.host, nil, &chaincfg.MainNetParams)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("New(%q) should fail", tt.host)
+			}
+			continue
+		}
+		if err != nil || c.baseURL != tt.want {
+			t.Errorf("New(%q) = %v, %v; want %s", tt.host, c, err, tt.want)
+		}
+	}
+}
+
+// testBlock returns a block at height on top of prev. Blocks with a different nonce have different hashes.
+func testBlock(prev *wire.MsgBlock, height int64, nonce uint32) *wire.MsgBlock {
+	coinbaseScript, _ := txscript.NewScriptBuilder().AddInt64(height).AddInt64(int64(nonce)).Script()
+	pkScript, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(bytes.Repeat([]byte{byte(height)}, 20)).Script()
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), coinbaseScript, nil))
+	coinbase.AddTxOut(wire.NewTxOut(50*btcutil.SatoshiPerBitcoin, pkScript))
+
+	merkles := blockchain.BuildMerkleTreeStore([]*btcutil.Tx{btcutil.NewTx(coinbase)}, false)
+	msg := wire.NewMsgBlock(wire.NewBlockHeader(
+		wire.TxVersion,
+		&chainhash.Hash{},
+		merkles[len(merkles)-1],
+		chaincfg.RegressionNetParams.PowLimitBits,
+		nonce,
+	))
+	msg.Header.PrevBlock = prev.BlockHash()
+	msg.Header.Timestamp = prev.Header.Timestamp.Add(10 * time.Minute)
+	msg.AddTransaction(coinbase)
+	return msg
+}
@@ -0,0 +1,26 @@
+package retry
+
+import "fmt"
+
+// ErrRetriesExhausted is returned when a call still fails with a transient error after every retry.
+type ErrRetriesExhausted struct {
+	op       string
+	attempts int
+	err      error
+}
+
+// NewErrRetriesExhausted returns an ErrRetriesExhausted for the last error of op.
+func NewErrRetriesExhausted(op string, attempts int, err error) ErrRetriesExhausted {
+	return ErrRetriesExhausted{op, attempts, err}
+}
+
+// Attempts returns the number of times the call was made.
+func (e ErrRetriesExhausted) Attempts() int { return e.attempts }
+
+// Error implements error.Error interface.
+func (e ErrRetriesExhausted) Error() string {
+	return fmt.Sprintf("%s failed after %d attempts: %v", e.op, e.attempts, e.err)
+}
+
+// Unwrap returns the error of the last attempt.
+func (e ErrRetriesExhausted) Unwrap() error { return e.err }
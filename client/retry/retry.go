@@ -0,0 +1,209 @@
+// Package retry implements a client decorator that retries calls failing with transient errors.
+package retry
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Default retry settings.
+const (
+	DefaultMaxRetries     = 5
+	DefaultInitialBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff     = 30 * time.Second
+)
+
+// Config represents the retry policy of a Client.
+type Config struct {
+	// MaxRetries is the number of times a call is retried before giving up.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry. It doubles with every retry up to MaxBackoff.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between two attempts.
+	MaxBackoff time.Duration
+	// IsTransient decides which errors are retried. IsTransient (the function) is used if nil.
+	IsTransient func(err error) bool
+}
+
+// DefaultConfig returns the retry policy used when no other value is given.
+func DefaultConfig() Config {
+	return Config{
+		MaxRetries:     DefaultMaxRetries,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+	}
+}
+
+// Stats represents the number of calls made through a Client.
+type Stats struct {
+	// Calls is the number of calls made to the client, not counting retries.
+	Calls uint64
+	// Retries is the number of times a call was retried after a transient error.
+	Retries uint64
+	// Failures is the number of calls that returned an error, either permanent or after exhausting retries.
+	Failures uint64
+}
+
+// Client wraps a client.Client and retries calls that fail with transient errors using exponential backoff
+// with jitter. Permanent errors (e.g. an invalid block height) are returned immediately, and so are errors
+// of calls whose context is done: a deadline exceeded by the caller isn't worth retrying.
+type Client struct {
+	// Counters are accessed atomically and kept first for 64-bit alignment.
+	calls    uint64
+	retries  uint64
+	failures uint64
+	// reached is set to 1 once a call succeeded.
+	reached uint32
+
+	client.Client
+	config Config
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+// New returns a client retrying the calls made to c according to config.
+func New(c client.Client, config Config) *Client {
+	if config.IsTransient == nil {
+		config.IsTransient = IsTransient
+	}
+	return &Client{
+		Client: c,
+		config: config,
+		sleep:  sleep,
+	}
+}
+
+// Stats returns the number of calls and retries made so far.
+func (c *Client) Stats() Stats {
+	return Stats{
+		Calls:    atomic.LoadUint64(&c.calls),
+		Retries:  atomic.LoadUint64(&c.retries),
+		Failures: atomic.LoadUint64(&c.failures),
+	}
+}
+
+// GetBlockCount returns the height of the most-work fully-validated chain.
+// Implements client.Client.
+func (c *Client) GetBlockCount(ctx context.Context) (int64, error) {
+	return do(ctx, c, "GetBlockCount", func() (int64, error) {
+		return c.Client.GetBlockCount(ctx)
+	})
+}
+
+// GetBestBlock returns the hash and height of the tip of the most-work fully-validated chain.
+// Implements client.Client.
+func (c *Client) GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error) {
+	var height int64
+	hash, err := do(ctx, c, "GetBestBlock", func() (hash *chainhash.Hash, err error) {
+		hash, height, err = c.Client.GetBestBlock(ctx)
+		return hash, err
+	})
+	return hash, height, err
+}
+
+// GetChainInfo returns the state of the chain.
+// Implements client.Client.
+func (c *Client) GetChainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	return do(ctx, c, "GetChainInfo", func() (*types.ChainInfo, error) {
+		return c.Client.GetChainInfo(ctx)
+	})
+}
+
+// GetBlockHashesByRange returns block hashes from the server given a range (inclusive) of block numbers.
+// Implements client.Client.
+func (c *Client) GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error) {
+	return do(ctx, c, "GetBlockHashesByRange", func() ([]*chainhash.Hash, error) {
+		return c.Client.GetBlockHashesByRange(ctx, minBlockNumber, maxBlockNumber)
+	})
+}
+
+// GetBlockHeaders returns block headers from the server given a list/range of block hashes.
+// Implements client.Client.
+func (c *Client) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
+	return do(ctx, c, "GetBlockHeaders", func() ([]*types.BlockHeader, error) {
+		return c.Client.GetBlockHeaders(ctx, hashes)
+	})
+}
+
+// GetBlocks returns blocks with transactions from the server given a list/range of block hashes.
+// Implements client.Client.
+func (c *Client) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	return do(ctx, c, "GetBlocks", func() ([]*types.Block, error) {
+		return c.Client.GetBlocks(ctx, hashes)
+	})
+}
+
+// GetPrevouts returns the outputs at the given outpoints if the wrapped client can look them up.
+// Implements client.PrevoutClient.
+func (c *Client) GetPrevouts(ctx context.Context, outpoints []wire.OutPoint) ([]*types.Prevout, error) {
+	return do(ctx, c, "GetPrevouts", func() ([]*types.Prevout, error) {
+		return client.GetPrevouts(ctx, c.Client, outpoints)
+	})
+}
+
+// GetMempool returns the transactions in the mempool if the wrapped client can fetch them.
+// Implements client.MempoolClient.
+func (c *Client) GetMempool(ctx context.Context) ([]*types.MempoolTx, error) {
+	return do(ctx, c, "GetMempool", func() ([]*types.MempoolTx, error) {
+		return client.GetMempool(ctx, c.Client)
+	})
+}
+
+// do calls f until it succeeds, fails with a permanent error, runs out of retries or ctx is done.
+func do[T any](ctx context.Context, c *Client, op string, f func() (T, error)) (T, error) {
+	atomic.AddUint64(&c.calls, 1)
+	for attempt := 0; ; attempt++ {
+		res, err := f()
+		if err == nil {
+			atomic.StoreUint32(&c.reached, 1)
+			return res, nil
+		}
+		// A node that was never reached likely isn't listening at the address, e.g. a wrong port.
+		unreachable := atomic.LoadUint32(&c.reached) == 0 && isConnRefused(err)
+		if ctx.Err() != nil || unreachable || !c.config.IsTransient(err) {
+			atomic.AddUint64(&c.failures, 1)
+			return res, err
+		}
+		if attempt >= c.config.MaxRetries {
+			atomic.AddUint64(&c.failures, 1)
+			return res, NewErrRetriesExhausted(op, attempt+1, err)
+		}
+		delay := c.backoff(attempt)
+		log.Printf("%s failed (attempt %d of %d), retrying in %s: %v\n", op, attempt+1, c.config.MaxRetries+1, delay, err)
+		atomic.AddUint64(&c.retries, 1)
+		if err := c.sleep(ctx, delay); err != nil {
+			atomic.AddUint64(&c.failures, 1)
+			return res, err
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done, in which case it returns ctx.Err().
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoff returns the delay before retrying after the given attempt (starting at 0). The delay grows
+// exponentially and is randomized between half and all of its value so clients don't retry in lockstep.
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := float64(c.config.InitialBackoff) * math.Pow(2, float64(attempt))
+	if maxDelay := float64(c.config.MaxBackoff); delay > maxDelay {
+		delay = maxDelay
+	}
+	return time.Duration(delay/2 + rand.Float64()*delay/2)
+}
@@ -0,0 +1,279 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/rest"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	_ client.Client        = (*Client)(nil)
+	_ client.PrevoutClient = (*Client)(nil)
+	_ client.MempoolClient = (*Client)(nil)
+)
+
+// flakyClient fails with the queued errors before succeeding.
+type flakyClient struct {
+	errs  []error
+	calls int
+}
+
+func (c *flakyClient) next() error {
+	c.calls++
+	if len(c.errs) == 0 {
+		return nil
+	}
+	err := c.errs[0]
+	c.errs = c.errs[1:]
+	return err
+}
+
+func (c *flakyClient) GetBlockCount(ctx context.Context) (int64, error) {
+	if err := c.next(); err != nil {
+		return 0, err
+	}
+	return 10, nil
+}
+
+func (c *flakyClient) GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error) {
+	if err := c.next(); err != nil {
+		return nil, 0, err
+	}
+	return &chainhash.Hash{}, 10, nil
+}
+
+func (c *flakyClient) GetChainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	if err := c.next(); err != nil {
+		return nil, err
+	}
+	return types.NewChainInfo(btcjson.GetBlockChainInfoResult{Chain: "regtest", Blocks: 10}), nil
+}
+
+func (c *flakyClient) GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error) {
+	if err := c.next(); err != nil {
+		return nil, err
+	}
+	return make([]*chainhash.Hash, maxBlockNumber-minBlockNumber+1), nil
+}
+
+func (c *flakyClient) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
+	if err := c.next(); err != nil {
+		return nil, err
+	}
+	return make([]*types.BlockHeader, len(hashes)), nil
+}
+
+func (c *flakyClient) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	if err := c.next(); err != nil {
+		return nil, err
+	}
+	return make([]*types.Block, len(hashes)), nil
+}
+
+func (c *flakyClient) GetPrevouts(ctx context.Context, outpoints []wire.OutPoint) ([]*types.Prevout, error) {
+	if err := c.next(); err != nil {
+		return nil, err
+	}
+	return make([]*types.Prevout, len(outpoints)), nil
+}
+
+type RetryClientTestSuite struct {
+	suite.Suite
+	inner  *flakyClient
+	client *Client
+	delays []time.Duration
+}
+
+func (s *RetryClientTestSuite) SetupTest() {
+	s.inner = &flakyClient{}
+	s.client = New(s.inner, Config{MaxRetries: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+	s.delays = nil
+	s.client.sleep = func(ctx context.Context, d time.Duration) error {
+		s.delays = append(s.delays, d)
+		return ctx.Err()
+	}
+}
+
+func (s *RetryClientTestSuite) TestRetriesTransientErrors() {
+	timeout := &url.Error{Op: "Post", URL: "http://node", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}
+	s.inner.errs = []error{timeout, errors.New("status code: 503, response: \"Work queue depth exceeded\"")}
+
+	hashes, err := s.client.GetBlockHashesByRange(context.Background(), 1, 3)
+	s.NoError(err)
+	s.Len(hashes, 3)
+	s.Equal(3, s.inner.calls)
+	s.Equal(Stats{Calls: 1, Retries: 2}, s.client.Stats())
+	s.Require().Len(s.delays, 2)
+	s.InDelta(75*time.Millisecond, s.delays[0], float64(25*time.Millisecond))
+	s.InDelta(150*time.Millisecond, s.delays[1], float64(50*time.Millisecond))
+}
+
+func (s *RetryClientTestSuite) TestGetBestBlock() {
+	s.inner.errs = []error{errors.New("status code: 503, response: \"Work queue depth exceeded\"")}
+
+	hash, height, err := s.client.GetBestBlock(context.Background())
+	s.NoError(err)
+	s.NotNil(hash)
+	s.EqualValues(10, height)
+	s.Equal(2, s.inner.calls)
+	s.Equal(Stats{Calls: 1, Retries: 1}, s.client.Stats())
+}
+
+func (s *RetryClientTestSuite) TestGetPrevouts() {
+	s.inner.errs = []error{errors.New("status code: 503, response: \"Work queue depth exceeded\"")}
+
+	prevouts, err := s.client.GetPrevouts(context.Background(), make([]wire.OutPoint, 2))
+	s.NoError(err)
+	s.Len(prevouts, 2)
+	s.Equal(2, s.inner.calls)
+
+	// Clients unable to look up prevouts fail without retrying.
+	_, err = New(struct{ client.Client }{s.inner}, DefaultConfig()).GetPrevouts(context.Background(), nil)
+	s.ErrorContains(err, "can't look up prevouts")
+	s.Equal(2, s.inner.calls)
+}
+
+func (s *RetryClientTestSuite) TestPermanentErrors() {
+	invalidHeight := btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, "Block height out of range")
+	s.inner.errs = []error{invalidHeight}
+
+	_, err := s.client.GetBlocks(context.Background(), make([]*chainhash.Hash, 2))
+	s.Equal(invalidHeight, err)
+	s.Equal(1, s.inner.calls)
+	s.Empty(s.delays)
+	s.Equal(Stats{Calls: 1, Failures: 1}, s.client.Stats())
+}
+
+func (s *RetryClientTestSuite) TestConnectionRefused() {
+	refused := &url.Error{Op: "Post", URL: "http://node", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+
+	// Before the node was reached, a refused connection means nothing listens at the address.
+	s.inner.errs = []error{refused}
+	_, err := s.client.GetBlockCount(context.Background())
+	s.ErrorIs(err, syscall.ECONNREFUSED)
+	s.Equal(1, s.inner.calls)
+	s.Empty(s.delays)
+
+	// Once it was reached, the node may be restarting.
+	_, err = s.client.GetBlockCount(context.Background())
+	s.NoError(err)
+	s.inner.errs = []error{refused}
+	_, err = s.client.GetBlockCount(context.Background())
+	s.NoError(err)
+	s.Equal(4, s.inner.calls)
+	s.Len(s.delays, 1)
+}
+
+func (s *RetryClientTestSuite) TestRetriesExhausted() {
+	for i := 0; i < 10; i++ {
+		s.inner.errs = append(s.inner.errs, io.ErrUnexpectedEOF)
+	}
+	_, err := s.client.GetBlockCount(context.Background())
+	var exhausted ErrRetriesExhausted
+	s.Require().ErrorAs(err, &exhausted)
+	s.Equal(4, exhausted.Attempts())
+	s.ErrorIs(err, io.ErrUnexpectedEOF)
+	s.Equal(4, s.inner.calls)
+	s.Equal(Stats{Calls: 1, Retries: 3, Failures: 1}, s.client.Stats())
+
+	// The next call starts over.
+	s.inner.errs = nil
+	count, err := s.client.GetBlockCount(context.Background())
+	s.NoError(err)
+	s.EqualValues(10, count)
+	s.Equal(Stats{Calls: 2, Retries: 3, Failures: 1}, s.client.Stats())
+}
+
+func (s *RetryClientTestSuite) TestContextDone() {
+	s.inner.errs = []error{io.ErrUnexpectedEOF, io.ErrUnexpectedEOF}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.client.GetBlocks(ctx, make([]*chainhash.Hash, 2))
+	s.ErrorIs(err, io.ErrUnexpectedEOF)
+	s.Equal(1, s.inner.calls)
+	s.Equal(Stats{Calls: 1, Failures: 1}, s.client.Stats())
+
+	// The backoff is interrupted as well.
+	s.inner.errs = []error{io.ErrUnexpectedEOF}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	s.client.sleep = sleep
+	s.client.config.InitialBackoff = time.Minute
+	_, err = s.client.GetBlocks(ctx, make([]*chainhash.Hash, 2))
+	s.ErrorIs(err, context.DeadlineExceeded)
+	s.Equal(Stats{Calls: 2, Retries: 1, Failures: 2}, s.client.Stats())
+}
+
+func (s *RetryClientTestSuite) TestBackoff() {
+	for attempt := 0; attempt < 10; attempt++ {
+		want := 100 * time.Millisecond << attempt
+		if want > time.Second {
+			want = time.Second
+		}
+		for i := 0; i < 20; i++ {
+			delay := s.client.backoff(attempt)
+			s.GreaterOrEqual(delay, want/2)
+			s.LessOrEqual(delay, want)
+		}
+	}
+}
+
+func TestRetryClientTestSuite(t *testing.T) {
+	suite.Run(t, new(RetryClientTestSuite))
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"timeout", &url.Error{Op: "Post", URL: "http://node", Err: timeoutError{}}, true},
+		{"connection_reset", fmt.Errorf("reading: %w", syscall.ECONNRESET), true},
+		{"connection_refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{"unexpected_eof", io.ErrUnexpectedEOF, true},
+		{"no_such_host", &url.Error{Op: "Post", URL: "http://node", Err: &net.OpError{
+			Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "node", IsNotFound: true}}}, false},
+		{"host_unreachable", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.EHOSTUNREACH}, false},
+		{"address_not_available", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.EADDRNOTAVAIL}, false},
+		{"deadline_exceeded", context.DeadlineExceeded, true},
+		{"canceled", context.Canceled, false},
+		{"work_queue_depth", errors.New(`status code: 503, response: "Work queue depth exceeded"`), true},
+		{"unauthorized", errors.New(`status code: 401, response: ""`), false},
+		{"warmup", btcjson.NewRPCError(btcjson.ErrRPCInWarmup, "Loading block index..."), true},
+		{"invalid_height", btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, "Block height out of range"), false},
+		{"block_not_found", btcjson.NewRPCError(btcjson.ErrRPCBlockNotFound, "Block not found"), false},
+		{"rest_unavailable", rest.NewErrStatus("/block/00.bin", 503, "Service Unavailable"), true},
+		{"rest_not_found", rest.NewErrStatus("/blockhashbyheight/9.bin", 404, "Block height out of range"), false},
+		{"client_shutdown", rpcclient.ErrClientShutdown, false},
+		{"other", errors.New("minBlockNumber (3) must be less than or equal to maxBlockNumber (2)"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsTransient(tt.err))
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,80 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"syscall"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+// statusCodeError is implemented by errors carrying the HTTP status of a response, e.g. rest.ErrStatus.
+type statusCodeError interface {
+	StatusCode() int
+}
+
+// rpcStatusPattern matches the error btcd's rpcclient returns for HTTP responses that aren't JSON-RPC, such as
+// bitcoind's `503 Work queue depth exceeded`.
+var rpcStatusPattern = regexp.MustCompile(`^status code: (\d+),`)
+
+// IsTransient reports whether err is likely to go away when the call is retried: timeouts, dropped or refused
+// connections, an overloaded or warming up node. Every other error is permanent, including RPC errors such as an
+// invalid block height or an unknown block, and network errors such as an unknown host. Client also treats refused
+// connections as permanent until the node was first reached, since the address is then likely wrong.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, rpcclient.ErrClientShutdown) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var rpcErr *btcjson.RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code == btcjson.ErrRPCInWarmup
+	}
+	var statusErr statusCodeError
+	if errors.As(err, &statusErr) {
+		return isTransientStatus(statusErr.StatusCode())
+	}
+	if match := rpcStatusPattern.FindStringSubmatch(err.Error()); match != nil {
+		code, _ := strconv.Atoi(match[1])
+		return isTransientStatus(code)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isConnRefused reports whether err is a refused connection.
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// isTransientStatus reports whether an HTTP status means the server may accept the same request later.
+func isTransientStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -1,34 +1,235 @@
 package rpcclient
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
 )
 
+// maxBatchRequests is the maximum number of requests of a JSON-RPC batch sent by lookups of unbounded size.
+var maxBatchRequests = 500
+
 // RPCClient represents a JSON RPC connection to a bitcoin node.
+//
+// A batch rpcclient.Client queues requests until they are sent, so it can't be shared between goroutines.
+// RPCClient instead hands out batch clients from a pool, which allows one batch per connection in flight.
+// The batch clients are never exposed, so every request goes through the pool.
+//
+// rpcclient.Client doesn't take contexts, so a batch whose context is done is abandoned: its batch client is
+// shut down and replaced in the pool, and the response of the node is discarded whenever it arrives.
 type RPCClient struct {
-	*rpcclient.Client
+	config  *rpcclient.ConnConfig
+	batches chan *rpcclient.Client
+
+	mu    sync.Mutex
+	conns []*rpcclient.Client
+	// rawBlocksParams is set when blocks are fetched serialized and decoded by the client.
+	rawBlocksParams *chaincfg.Params
+	// prevouts is set when verbose blocks are fetched with the prevouts of their inputs.
+	prevouts bool
 }
 
 // New acts as a default constructor for our RPCClient extending functionality of btcd/rpcclient.Client
 func New(config *rpcclient.ConnConfig, ntfnHandlers *rpcclient.NotificationHandlers) (*RPCClient, error) {
-	internal_client, err := rpcclient.NewBatch(config)
-	if err != nil {
-		return nil, err
+	return NewWithConns(config, 1)
+}
+
+// NewWithConns creates an RPCClient that sends up to `conns` batches to the server concurrently.
+func NewWithConns(config *rpcclient.ConnConfig, conns int) (*RPCClient, error) {
+	if conns < 1 {
+		return nil, fmt.Errorf("conns (%d) must be positive", conns)
 	}
 	client := RPCClient{
-		internal_client,
+		config:  config,
+		batches: make(chan *rpcclient.Client, conns),
+	}
+	for i := 0; i < conns; i++ {
+		internal_client, err := rpcclient.NewBatch(config)
+		if err != nil {
+			client.Shutdown()
+			return nil, err
+		}
+		client.conns = append(client.conns, internal_client)
+		client.batches <- internal_client
 	}
 	return &client, nil
 }
 
+// EnableRawBlocks makes GetBlocks fetch serialized blocks (`getblock` with verbosity = 0) and decode them instead
+// of asking the server to render them as JSON, which is much cheaper for both sides. Output addresses are encoded
+// for the network described by params. It must be called before the client is used.
+func (client *RPCClient) EnableRawBlocks(params *chaincfg.Params) {
+	client.rawBlocksParams = params
+}
+
+// EnablePrevouts makes GetBlocks fetch verbose blocks with the outputs spent by their inputs (`getblock` with
+// verbosity = 3), given by Bitcoin Core since v23. Older nodes answer with verbosity = 2, leaving the prevouts to
+// GetPrevouts. It has no effect on serialized blocks. It must be called before the client is used.
+func (client *RPCClient) EnablePrevouts() {
+	client.prevouts = true
+}
+
+// Shutdown shuts down every connection of the client.
+func (client *RPCClient) Shutdown() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	for _, conn := range client.conns {
+		conn.Shutdown()
+	}
+}
+
+// acquire takes a batch client from the pool, waiting until one is available or ctx is done.
+func (client *RPCClient) acquire(ctx context.Context) (*rpcclient.Client, error) {
+	select {
+	case batch := <-client.batches:
+		return batch, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release returns a batch client to the pool.
+func (client *RPCClient) release(batch *rpcclient.Client) {
+	client.batches <- batch
+}
+
+// send sends the requests queued on batch and releases it. If ctx is done before the node responds, the batch
+// client is shut down and replaced with a new one, and ctx.Err() is returned.
+func (client *RPCClient) send(ctx context.Context, batch *rpcclient.Client) error {
+	if err := ctx.Err(); err != nil {
+		client.release(batch)
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- batch.Send()
+	}()
+	select {
+	case err := <-done:
+		client.release(batch)
+		return err
+	case <-ctx.Done():
+		client.replace(batch)
+		return ctx.Err()
+	}
+}
+
+// sendChunked sends n requests in JSON-RPC batches of at most maxBatchRequests requests, so that large lookups
+// stay within the limits of the node and responses aren't all buffered at once. For each batch, queue is called
+// to queue each request on the batch client and, once the batch was sent, receive is called for each request.
+func (client *RPCClient) sendChunked(ctx context.Context, n int, queue func(batch *rpcclient.Client, i int), receive func(i int) error) error {
+	for start := 0; start < n; start += maxBatchRequests {
+		end := start + maxBatchRequests
+		if end > n {
+			end = n
+		}
+		batch, err := client.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		for i := start; i < end; i++ {
+			queue(batch, i)
+		}
+		if err := client.send(ctx, batch); err != nil {
+			return err
+		}
+		for i := start; i < end; i++ {
+			if err := receive(i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// replace shuts down an abandoned batch client and puts a new one in the pool in its place.
+func (client *RPCClient) replace(batch *rpcclient.Client) {
+	batch.Shutdown()
+	newBatch, err := rpcclient.NewBatch(client.config)
+	if err != nil {
+		// Creating a HTTP POST mode client doesn't connect, so this only fails on an invalid config, which
+		// would have failed in NewWithConns. Keep the old client in the pool so it isn't depleted.
+		log.Printf("replacing abandoned rpc connection: %v\n", err)
+		client.release(batch)
+		return
+	}
+	client.mu.Lock()
+	for i, conn := range client.conns {
+		if conn == batch {
+			client.conns[i] = newBatch
+		}
+	}
+	client.mu.Unlock()
+	client.release(newBatch)
+}
+
+// GetBlockCount returns the height of the most-work fully-validated chain.
+func (client *RPCClient) GetBlockCount(ctx context.Context) (int64, error) {
+	batch, err := client.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	req := batch.GetBlockCountAsync()
+	if err := client.send(ctx, batch); err != nil {
+		return 0, err
+	}
+	return req.Receive()
+}
+
+// GetBestBlock returns the hash and height of the tip of the most-work fully-validated chain. Both are taken
+// from a single `getblockchaininfo` call so they are consistent even if a block is connected meanwhile.
+func (client *RPCClient) GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error) {
+	info, err := client.GetChainInfo(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	hash, err := chainhash.NewHashFromStr(info.BestBlockHash())
+	if err != nil {
+		return nil, 0, err
+	}
+	return hash, info.Blocks(), nil
+}
+
+// GetChainInfo returns the state of the chain, e.g. its network and whether the node is still in initial
+// block download.
+func (client *RPCClient) GetChainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	batch, err := client.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// rpcclient.FutureGetBlockChainInfoResult asks the node for its version to decode soft forks, which would
+	// wait forever on a batch client, so the result is decoded here.
+	req := batch.RawRequestAsync("getblockchaininfo", nil)
+	if err := client.send(ctx, batch); err != nil {
+		return nil, err
+	}
+	res, err := req.Receive()
+	if err != nil {
+		return nil, err
+	}
+	info := new(types.ChainInfo)
+	if err := json.Unmarshal(res, info); err != nil {
+		return nil, fmt.Errorf("decoding getblockchaininfo result: %w", err)
+	}
+	return info, nil
+}
+
 // GetBlockHashesByRange returns block hashes from the server given a range (inclusive) of block numbers.
 // Hashes are returned in order from `minBlockNumber` to `maxBlockNumber`
-func (client *RPCClient) GetBlockHashesByRange(minBlockNumber, maxBlockNumber int64) (hashes []*chainhash.Hash, err error) {
+func (client *RPCClient) GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) (hashes []*chainhash.Hash, err error) {
 	if minBlockNumber > maxBlockNumber {
 		log.Printf("minBlockNumber: %d\tmaxBlockNumber: %d\n", minBlockNumber, maxBlockNumber)
 		return nil, fmt.Errorf(
@@ -38,14 +239,20 @@ func (client *RPCClient) GetBlockHashesByRange(minBlockNumber, maxBlockNumber in
 		)
 	}
 	nBlocks := maxBlockNumber - minBlockNumber + 1
+	batch, err := client.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	// Queue block hash requests
 	hashReqs := make([]rpcclient.FutureGetBlockHashResult, nBlocks)
 	for i := range hashReqs {
-		hashReqs[i] = client.GetBlockHashAsync(minBlockNumber + int64(i))
+		hashReqs[i] = batch.GetBlockHashAsync(minBlockNumber + int64(i))
 	}
 	// Send
-	client.Send()
+	if err := client.send(ctx, batch); err != nil {
+		return nil, err
+	}
 	// Receive block hash requests
 	blockHashes := make([]*chainhash.Hash, nBlocks)
 	for i, req := range hashReqs {
@@ -59,14 +266,21 @@ func (client *RPCClient) GetBlockHashesByRange(minBlockNumber, maxBlockNumber in
 }
 
 // GetBlockHeadersByRange returns block headers from the server given a list/range of block hashes.
-func (client *RPCClient) GetBlockHeaders(hashes []*chainhash.Hash) (blockHeaders []*types.BlockHeader, err error) {
+func (client *RPCClient) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) (blockHeaders []*types.BlockHeader, err error) {
+	batch, err := client.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Queue block requests
 	blockReqs := make([]rpcclient.FutureGetBlockHeaderVerboseResult, len(hashes))
 	for i, blockHash := range hashes {
-		blockReqs[i] = client.GetBlockHeaderVerboseAsync(blockHash)
+		blockReqs[i] = batch.GetBlockHeaderVerboseAsync(blockHash)
 	}
 	// Send
-	client.Send()
+	if err := client.send(ctx, batch); err != nil {
+		return nil, err
+	}
 	// Receive block requests
 	blockHeaders = make([]*types.BlockHeader, len(hashes))
 	for i, req := range blockReqs {
@@ -80,22 +294,228 @@ func (client *RPCClient) GetBlockHeaders(hashes []*chainhash.Hash) (blockHeaders
 }
 
 // GetBlocksByRange returns blocks with transactions from the server given a list/range of block hashes.
-func (client *RPCClient) GetBlocks(hashes []*chainhash.Hash) (blocks []*types.Block, err error) {
-	// Queue block requests
-	blockReqs := make([]rpcclient.FutureGetBlockVerboseTxResult, len(hashes))
+func (client *RPCClient) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) (blocks []*types.Block, err error) {
+	if client.rawBlocksParams != nil {
+		return client.getRawBlocks(ctx, hashes)
+	}
+	batch, err := client.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Queue block requests. rpcclient.FutureGetBlockVerboseTxResult decodes the result into btcjson types, which
+	// drop the `address` field of outputs returned by Bitcoin Core since v22, so the result is decoded here.
+	verbosity := json.RawMessage("2")
+	if client.prevouts {
+		verbosity = json.RawMessage("3")
+	}
+	blockReqs := make([]rpcclient.FutureRawResult, len(hashes))
 	for i, blockHash := range hashes {
-		blockReqs[i] = client.GetBlockVerboseTxAsync(blockHash)
+		hash := json.RawMessage(strconv.Quote(blockHash.String()))
+		blockReqs[i] = batch.RawRequestAsync("getblock", []json.RawMessage{hash, verbosity})
 	}
 	// Send
-	client.Send()
+	if err := client.send(ctx, batch); err != nil {
+		return nil, err
+	}
 	// Receive block requests
 	blocks = make([]*types.Block, len(hashes))
 	for i, req := range blockReqs {
-		block, err := req.Receive()
+		res, err := req.Receive()
 		if err != nil {
 			return nil, err
 		}
-		blocks[i] = types.NewBlock(*block)
+		blocks[i] = new(types.Block)
+		if err := json.Unmarshal(res, blocks[i]); err != nil {
+			return nil, fmt.Errorf("decoding getblock result: %w", err)
+		}
 	}
 	return blocks, nil
 }
+
+// getRawBlocks returns blocks decoded from their serialized form given a list/range of block hashes.
+// Fields that depend on the chain (height, confirmations, next hash) are taken from the block headers.
+func (client *RPCClient) getRawBlocks(ctx context.Context, hashes []*chainhash.Hash) (blocks []*types.Block, err error) {
+	batch, err := client.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Queue header and block requests
+	headerReqs := make([]rpcclient.FutureGetBlockHeaderVerboseResult, len(hashes))
+	blockReqs := make([]rpcclient.FutureGetBlockResult, len(hashes))
+	for i, blockHash := range hashes {
+		headerReqs[i] = batch.GetBlockHeaderVerboseAsync(blockHash)
+		blockReqs[i] = batch.GetBlockAsync(blockHash)
+	}
+	// Send
+	if err := client.send(ctx, batch); err != nil {
+		return nil, err
+	}
+	// Receive header and block requests
+	blocks = make([]*types.Block, len(hashes))
+	for i := range hashes {
+		header, err := headerReqs[i].Receive()
+		if err != nil {
+			return nil, err
+		}
+		msg, err := blockReqs[i].Receive()
+		if err != nil {
+			return nil, err
+		}
+		block := types.BlockVerboseFromWire(msg, int64(header.Height), client.rawBlocksParams)
+		block.Confirmations = header.Confirmations
+		block.NextHash = header.NextHash
+		blocks[i] = types.NewBlock(block)
+	}
+	return blocks, nil
+}
+
+// GetPrevouts returns the outputs at the given outpoints, along with the height of the blocks that created them,
+// in the order of outpoints. The transactions creating them are fetched with `getrawtransaction`, which needs the
+// node to be started with `-txindex`. Implements client.PrevoutClient.
+func (client *RPCClient) GetPrevouts(ctx context.Context, outpoints []wire.OutPoint) ([]*types.Prevout, error) {
+	if len(outpoints) == 0 {
+		return nil, nil
+	}
+	// Request each distinct transaction
+	txs := make(map[chainhash.Hash]*types.Transaction)
+	txids := make([]chainhash.Hash, 0, len(outpoints))
+	for _, outpoint := range outpoints {
+		if _, ok := txs[outpoint.Hash]; !ok {
+			txs[outpoint.Hash] = nil
+			txids = append(txids, outpoint.Hash)
+		}
+	}
+	txReqs := make([]rpcclient.FutureRawResult, len(txids))
+	err := client.sendChunked(ctx, len(txids), func(batch *rpcclient.Client, i int) {
+		txid := json.RawMessage(strconv.Quote(txids[i].String()))
+		txReqs[i] = batch.RawRequestAsync("getrawtransaction", []json.RawMessage{txid, json.RawMessage("true")})
+	}, func(i int) error {
+		res, err := txReqs[i].Receive()
+		txReqs[i] = nil
+		var rpcErr *btcjson.RPCError
+		if errors.As(err, &rpcErr) && rpcErr.Code == btcjson.ErrRPCNoTxInfo {
+			return fmt.Errorf("getting transaction %s (is the node running with -txindex?): %w", txids[i], err)
+		}
+		if err != nil {
+			return err
+		}
+		tx := new(types.Transaction)
+		if err := json.Unmarshal(res, tx); err != nil {
+			return fmt.Errorf("decoding getrawtransaction result: %w", err)
+		}
+		if tx.BlockHash() == "" {
+			return fmt.Errorf("transaction %s isn't confirmed", txids[i])
+		}
+		txs[txids[i]] = tx
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Request the header of each distinct block to get the heights of the transactions
+	heights := make(map[string]int64)
+	blockHashes := make([]*chainhash.Hash, 0)
+	for _, txid := range txids {
+		if _, ok := heights[txs[txid].BlockHash()]; ok {
+			continue
+		}
+		hash, err := chainhash.NewHashFromStr(txs[txid].BlockHash())
+		if err != nil {
+			return nil, err
+		}
+		heights[txs[txid].BlockHash()] = 0
+		blockHashes = append(blockHashes, hash)
+	}
+	headerReqs := make([]rpcclient.FutureGetBlockHeaderVerboseResult, len(blockHashes))
+	err = client.sendChunked(ctx, len(blockHashes), func(batch *rpcclient.Client, i int) {
+		headerReqs[i] = batch.GetBlockHeaderVerboseAsync(blockHashes[i])
+	}, func(i int) error {
+		header, err := headerReqs[i].Receive()
+		if err != nil {
+			return err
+		}
+		heights[blockHashes[i].String()] = int64(header.Height)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prevouts := make([]*types.Prevout, len(outpoints))
+	for i, outpoint := range outpoints {
+		tx := txs[outpoint.Hash]
+		if outpoint.Index >= uint32(len(tx.Vout())) {
+			return nil, fmt.Errorf("transaction %s has no output %d", outpoint.Hash, outpoint.Index)
+		}
+		prevouts[i] = types.NewPrevout(tx.Vout()[outpoint.Index], heights[tx.BlockHash()], tx.IsCoinbase())
+	}
+	return prevouts, nil
+}
+
+// GetMempool returns the transactions in the mempool of the node along with their mempool entries, ordered by the
+// time they entered the mempool. The entries are listed with `getrawmempool` and the transactions fetched with
+// `getrawtransaction`, which serves unconfirmed transactions without `-txindex`. Transactions leaving the mempool
+// in between are left out. Implements client.MempoolClient.
+func (client *RPCClient) GetMempool(ctx context.Context) ([]*types.MempoolTx, error) {
+	batch, err := client.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// rpcclient.FutureGetRawMempoolVerboseResult decodes the entries into btcjson types, which drop the ancestor
+	// and descendant statistics, so the result is decoded here.
+	mempoolReq := batch.RawRequestAsync("getrawmempool", []json.RawMessage{json.RawMessage("true")})
+	if err := client.send(ctx, batch); err != nil {
+		return nil, err
+	}
+	res, err := mempoolReq.Receive()
+	if err != nil {
+		return nil, err
+	}
+	snapshotTime := time.Now().Unix()
+	var entries map[string]types.MempoolEntryResult
+	if err := json.Unmarshal(res, &entries); err != nil {
+		return nil, fmt.Errorf("decoding getrawmempool result: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	// Queue a transaction request per entry
+	txids := make([]string, 0, len(entries))
+	for txid := range entries {
+		txids = append(txids, txid)
+	}
+	sort.Strings(txids)
+	txReqs := make([]rpcclient.FutureRawResult, len(txids))
+	txs := make([]*types.MempoolTx, 0, len(txids))
+	err = client.sendChunked(ctx, len(txids), func(batch *rpcclient.Client, i int) {
+		txReqs[i] = batch.RawRequestAsync("getrawtransaction", []json.RawMessage{json.RawMessage(strconv.Quote(txids[i])), json.RawMessage("true")})
+	}, func(i int) error {
+		res, err := txReqs[i].Receive()
+		txReqs[i] = nil
+		var rpcErr *btcjson.RPCError
+		if errors.As(err, &rpcErr) && rpcErr.Code == btcjson.ErrRPCNoTxInfo {
+			// Mined or evicted since the mempool was listed.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		tx := new(types.Transaction)
+		if err := json.Unmarshal(res, tx); err != nil {
+			return fmt.Errorf("decoding getrawtransaction result: %w", err)
+		}
+		if tx.BlockHash() == "" {
+			txs = append(txs, types.NewMempoolTx(tx, entries[txids[i]], snapshotTime))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].FirstSeen() < txs[j].FirstSeen() })
+	return txs, nil
+}
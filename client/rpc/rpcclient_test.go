@@ -1,35 +1,60 @@
 package rpcclient
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/IlliniBlockchain/etl-bitcoin/chaingen"
 	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/rpc/rpctest"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
-var _ client.Client = (*RPCClient)(nil)
+var (
+	_ client.Client        = (*RPCClient)(nil)
+	_ client.PrevoutClient = (*RPCClient)(nil)
+	_ client.MempoolClient = (*RPCClient)(nil)
+)
 
-func GetTestRPCClient() (*RPCClient, error) {
-	connCfg := &rpcclient.ConnConfig{
+// GetTestConnConfig returns the settings used to connect to the regtest node started by `make test.integration`.
+func GetTestConnConfig() *rpcclient.ConnConfig {
+	return &rpcclient.ConnConfig{
 		Host:         "localhost:18443", // regtest
 		User:         "test",
 		Pass:         "test",
 		HTTPPostMode: true, // Bitcoin core only supports HTTP POST mode
 		DisableTLS:   true, // Bitcoin core does not provide TLS by default
 	}
-	client, err := New(connCfg, nil)
-	return client, err
+}
+
+func GetTestRPCClient() (*RPCClient, error) {
+	return New(GetTestConnConfig(), nil)
 }
 
 type RPCClientTestSuite struct {
 	suite.Suite
-	Client      *RPCClient
+	// Server is the in-process node the suite runs against, or nil to use the regtest node of GetTestRPCClient.
+	Server *rpctest.Server
+	Client *RPCClient
+	// Node is a plain btcd batch client connected to the same node, used to prepare and cross-check the chain.
+	Node        *rpcclient.Client
 	WalletName  string
 	Address     btcutil.Address
 	BlockCount  int64
@@ -37,10 +62,27 @@ type RPCClientTestSuite struct {
 }
 
 func (suite *RPCClientTestSuite) SetupSuite() {
-	// Initialize client
-	client, err := GetTestRPCClient()
-	assert.NoError(suite.T(), err)
-	suite.Client = client
+	config := GetTestConnConfig()
+	if suite.Server != nil {
+		config = suite.Server.ConnConfig()
+	}
+	node, err := rpcclient.NewBatch(config)
+	suite.Require().NoError(err)
+	suite.Node = node
+
+	if suite.Server != nil {
+		suite.Client = suite.newClient()
+		count, err := suite.Client.GetBlockCount(context.Background())
+		suite.Require().NoError(err)
+		suite.BlockCount = count
+		suite.BlockHashes, err = suite.Client.GetBlockHashesByRange(context.Background(), 0, count)
+		suite.Require().NoError(err)
+		return
+	}
+
+	// Initialize clients
+	suite.Client = suite.newClient()
+	client := suite.Node
 
 	// Create wallet
 	suite.WalletName = "testwallet"
@@ -72,8 +114,25 @@ func (suite *RPCClientTestSuite) SetupSuite() {
 	suite.BlockHashes = append([]*chainhash.Hash{genBlockHash}, hashes...)
 }
 
+func (suite *RPCClientTestSuite) TearDownSuite() {
+	suite.Client.Shutdown()
+	suite.Node.Shutdown()
+}
+
+// newClient returns a new client connected to the node of the suite.
+func (suite *RPCClientTestSuite) newClient() *RPCClient {
+	if suite.Server != nil {
+		client, err := New(suite.Server.ConnConfig(), nil)
+		suite.Require().NoError(err)
+		return client
+	}
+	client, err := GetTestRPCClient()
+	suite.Require().NoError(err)
+	return client
+}
+
 func (suite *RPCClientTestSuite) TestSanityBlockCount() {
-	client := suite.Client
+	client := suite.Node
 	blockCountReq := client.GetBlockCountAsync()
 	client.Send()
 	blockCount, err := blockCountReq.Receive()
@@ -81,6 +140,28 @@ func (suite *RPCClientTestSuite) TestSanityBlockCount() {
 	assert.EqualValues(suite.T(), suite.BlockCount, blockCount)
 }
 
+func (suite *RPCClientTestSuite) TestGetBlockCount() {
+	blockCount, err := suite.Client.GetBlockCount(context.Background())
+	assert.NoError(suite.T(), err)
+	assert.EqualValues(suite.T(), suite.BlockCount, blockCount)
+}
+
+func (suite *RPCClientTestSuite) TestGetBestBlock() {
+	hash, height, err := suite.Client.GetBestBlock(context.Background())
+	suite.Require().NoError(err)
+	suite.Equal(suite.BlockCount, height)
+	suite.Equal(suite.BlockHashes[suite.BlockCount], hash)
+}
+
+func (suite *RPCClientTestSuite) TestGetChainInfo() {
+	info, err := suite.Client.GetChainInfo(context.Background())
+	suite.Require().NoError(err)
+	suite.Equal("regtest", info.Chain())
+	suite.Equal(suite.BlockCount, info.Blocks())
+	suite.Equal(suite.BlockHashes[suite.BlockCount].String(), info.BestBlockHash())
+	suite.GreaterOrEqual(info.Headers(), info.Blocks())
+}
+
 type RangeArgs struct {
 	minBlockNumber int64
 	maxBlockNumber int64
@@ -183,7 +264,7 @@ func (suite *RPCClientTestSuite) TestGetHashesByRange() {
 	tests := GetHashTestTable(suite)
 	for _, tt := range tests {
 		suite.Run(tt.name, func() {
-			hashes, err := suite.Client.GetBlockHashesByRange(tt.args.minBlockNumber, tt.args.maxBlockNumber)
+			hashes, err := suite.Client.GetBlockHashesByRange(context.Background(), tt.args.minBlockNumber, tt.args.maxBlockNumber)
 			if tt.wantErr {
 				assert.Error(suite.T(), err)
 				return
@@ -198,7 +279,7 @@ func (suite *RPCClientTestSuite) TestGetBlockHeaders() {
 	tests := GetBlockHashTestTable(suite)
 	for _, tt := range tests {
 		suite.Run(tt.name, func() {
-			blockHeaders, err := suite.Client.GetBlockHeaders(tt.args)
+			blockHeaders, err := suite.Client.GetBlockHeaders(context.Background(), tt.args)
 			if tt.wantErr {
 				assert.Error(suite.T(), err)
 				return
@@ -220,7 +301,7 @@ func (suite *RPCClientTestSuite) TestGetBlocks() {
 	tests := GetBlockHashTestTable(suite)
 	for _, tt := range tests {
 		suite.Run(tt.name, func() {
-			blocks, err := suite.Client.GetBlocks(tt.args)
+			blocks, err := suite.Client.GetBlocks(context.Background(), tt.args)
 			if tt.wantErr {
 				assert.Error(suite.T(), err)
 				return
@@ -238,9 +319,436 @@ func (suite *RPCClientTestSuite) TestGetBlocks() {
 	}
 }
 
+func (suite *RPCClientTestSuite) TestGetRawBlocks() {
+	rawClient := suite.newClient()
+	defer rawClient.Shutdown()
+	rawClient.EnableRawBlocks(&chaincfg.RegressionNetParams)
+
+	want, err := suite.Client.GetBlocks(context.Background(), suite.BlockHashes)
+	suite.Require().NoError(err)
+	got, err := rawClient.GetBlocks(context.Background(), suite.BlockHashes)
+	suite.Require().NoError(err)
+	assertBlocksEqual(suite.T(), want, got)
+}
+
+// IntegrationEnv is the environment variable enabling the tests against the regtest node of GetTestRPCClient,
+// which `make test.integration` starts in docker.
+const IntegrationEnv = "ETL_BITCOIN_INTEGRATION"
+
 func TestRPCClientTestSuite(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping RPCClientTestSuite in short mode.")
+	if os.Getenv(IntegrationEnv) == "" {
+		t.Skipf("skipping RPCClientTestSuite: set %s=1 to run it against a regtest node", IntegrationEnv)
 	}
 	suite.Run(t, new(RPCClientTestSuite))
 }
+
+func TestRPCClientFakeNodeTestSuite(t *testing.T) {
+	server := rpctest.NewServer(&chaincfg.RegressionNetParams, rpctest.NewChain(&chaincfg.RegressionNetParams, 20, 2))
+	defer server.Close()
+	suite.Run(t, &RPCClientTestSuite{Server: server})
+}
+
+// coreFixtureHeight is the height of the block recorded in testdata as returned by Bitcoin Core 22. Its outputs pay
+// to the P2PKH, P2SH, P2WPKH, P2WSH and P2TR scripts of the BIP 173 and BIP 350 test vectors, and to a bare public
+// key, a bare multisig and OP_RETURN, which have no address. Its inputs spend P2PKH, P2SH multisig, P2WPKH,
+// P2SH-P2WPKH, P2TR and P2WSH outputs.
+const coreFixtureHeight = 800000
+
+func TestGetBlocksMatchesCoreFixture(t *testing.T) {
+	srv, hash := newFixtureServer(t, coreFixtureHeight)
+	defer srv.Close()
+	config := &rpcclient.ConnConfig{
+		Host:         strings.TrimPrefix(srv.URL, "http://"),
+		User:         rpctest.User,
+		Pass:         rpctest.Pass,
+		HTTPPostMode: true,
+		DisableTLS:   true,
+	}
+	verboseClient, err := New(config, nil)
+	assert.NoError(t, err)
+	defer verboseClient.Shutdown()
+	rawClient, err := New(config, nil)
+	assert.NoError(t, err)
+	defer rawClient.Shutdown()
+	rawClient.EnableRawBlocks(&chaincfg.MainNetParams)
+
+	want, err := verboseClient.GetBlocks(context.Background(), []*chainhash.Hash{hash})
+	assert.NoError(t, err)
+	if assert.Len(t, want, 1) {
+		var addresses [][]string
+		for _, tx := range want[0].Transactions() {
+			for _, vout := range tx.Vout() {
+				addresses = append(addresses, vout.ScriptPubKey().Addresses)
+			}
+		}
+		assert.Equal(t, [][]string{
+			{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+			nil,
+			{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+			{"3P14159f73E4gFr7JterCCQh9QjiTjiZrG"},
+			nil,
+			nil,
+			{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+			{"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3"},
+			{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0"},
+			nil,
+		}, addresses)
+	}
+	got, err := rawClient.GetBlocks(context.Background(), []*chainhash.Hash{hash})
+	assert.NoError(t, err)
+	assertBlocksEqual(t, want, got)
+}
+
+func TestGetBlocksPrevoutsMatchCoreFixture(t *testing.T) {
+	srv, hash := newFixtureServer(t, coreFixtureHeight)
+	defer srv.Close()
+	client, err := New(&rpcclient.ConnConfig{
+		Host:         strings.TrimPrefix(srv.URL, "http://"),
+		User:         rpctest.User,
+		Pass:         rpctest.Pass,
+		HTTPPostMode: true,
+		DisableTLS:   true,
+	}, nil)
+	assert.NoError(t, err)
+	defer client.Shutdown()
+	client.EnablePrevouts()
+
+	blocks, err := client.GetBlocks(context.Background(), []*chainhash.Hash{hash})
+	assert.NoError(t, err)
+	if !assert.Len(t, blocks, 1) {
+		return
+	}
+	type prevout struct {
+		Address   string
+		Height    int64
+		Value     btcutil.Amount
+		Generated bool
+	}
+	var prevouts []prevout
+	for _, tx := range blocks[0].Transactions() {
+		for _, in := range tx.Vin() {
+			if p := in.Prevout(); p != nil {
+				prevouts = append(prevouts, prevout{p.Address(&chaincfg.MainNetParams), p.Height(), p.Value(), p.Generated()})
+			} else {
+				assert.True(t, in.IsCoinbase())
+			}
+		}
+	}
+	assert.Equal(t, []prevout{
+		{"19JPuQpddNuivYwQk2meWxSxp54EKj2YXC", 799000, 100_000_000, false},
+		{"3JCRGxJcRPJmTkYhX2eEAXcqcWHB7hUds5", 799500, 50_000_000, false},
+		{"bc1q220wzsl85hgw02zzzzepgzskn2k2nxumhc020w", 799900, 40_000_000, false},
+		{"3FPx99CDYpb6vY4KxsqbopTS3LAyHsd6PB", 799990, 30_000_000, false},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", 699000, 20_000_000, true},
+		{"bc1qa5ywwmk9rakhfpgp5mxyqgl4vph6tcjmjdx0v4s3e6kdg5zg4cfq9rj254", 799999, 10_000_000, false},
+	}, prevouts)
+}
+
+func TestGetPrevouts(t *testing.T) {
+	config := chaingen.DefaultConfig()
+	generated, err := chaingen.Generate(config, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := make([]*wire.MsgBlock, len(generated))
+	for i, blk := range generated {
+		chain[i] = blk.MsgBlock
+	}
+	srv := rpctest.NewServer(config.Params, chain)
+	defer srv.Close()
+	client := newTestServerClient(t, srv)
+	defer client.Shutdown()
+	client.EnablePrevouts()
+
+	// The prevouts looked up with getrawtransaction are the ones given by getblock with verbosity 3.
+	hash := chain[len(chain)-1].BlockHash()
+	blocks, err := client.GetBlocks(context.Background(), []*chainhash.Hash{&hash})
+	assert.NoError(t, err)
+	var outpoints []wire.OutPoint
+	var want []*types.Prevout
+	for _, tx := range blocks[0].Transactions()[1:] {
+		for _, in := range tx.Vin() {
+			outpoint, err := in.OutPoint()
+			assert.NoError(t, err)
+			outpoints = append(outpoints, outpoint)
+			want = append(want, in.Prevout())
+		}
+	}
+	assert.NotEmpty(t, outpoints)
+	_, err = client.GetPrevouts(context.Background(), outpoints)
+	assert.ErrorContains(t, err, "-txindex")
+
+	srv.SetTxIndex(true)
+	got, err := client.GetPrevouts(context.Background(), outpoints)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// Large lookups are split into several batches.
+	defer func(n int) { maxBatchRequests = n }(maxBatchRequests)
+	maxBatchRequests = 2
+	txids := make(map[chainhash.Hash]struct{})
+	heights := make(map[int64]struct{})
+	for i, outpoint := range outpoints {
+		txids[outpoint.Hash] = struct{}{}
+		heights[want[i].Height()] = struct{}{}
+	}
+	requests := srv.Requests()
+	got, err = client.GetPrevouts(context.Background(), outpoints)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, (len(txids)+1)/2+(len(heights)+1)/2, srv.Requests()-requests)
+}
+
+func TestGetMempool(t *testing.T) {
+	config := chaingen.DefaultConfig()
+	config.CoinbaseMaturity = 1
+	generated, err := chaingen.Generate(config, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := make([]*wire.MsgBlock, len(generated)-1)
+	for i := range chain {
+		chain[i] = generated[i].MsgBlock
+	}
+	srv := rpctest.NewServer(config.Params, chain)
+	defer srv.Close()
+	client := newTestServerClient(t, srv)
+	defer client.Shutdown()
+
+	txs, err := client.GetMempool(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, txs)
+
+	// The transactions of the last block wait in the mempool, in the order they entered it.
+	mempool := generated[10].Transactions[1:]
+	srv.SetMempool(mempool)
+	txs, err = client.GetMempool(context.Background())
+	assert.NoError(t, err)
+	if !assert.Len(t, txs, len(mempool)) {
+		return
+	}
+	var fees btcutil.Amount
+	for i, tx := range txs {
+		assert.Equal(t, mempool[i].TxHash().String(), tx.TxID())
+		assert.Empty(t, tx.BlockHash())
+		assert.Equal(t, chain[9].Header.Timestamp.Unix()+int64(i), tx.FirstSeen())
+		assert.Positive(t, tx.AncestorCount())
+		assert.Positive(t, tx.DescendantCount())
+		assert.InDelta(t, float64(tx.Fee())/float64(tx.VSize()), tx.FeeRate(), 1e-9)
+		fees += tx.Fee()
+	}
+	assert.Equal(t, btcutil.Amount(generated[10].Fees), fees)
+
+	// Large mempools are fetched in several batches.
+	defer func(n int) { maxBatchRequests = n }(maxBatchRequests)
+	maxBatchRequests = 2
+	requests := srv.Requests()
+	chunked, err := client.GetMempool(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, chunked, len(mempool))
+	assert.Equal(t, 1+(len(mempool)+1)/2, srv.Requests()-requests)
+}
+
+func TestCancel(t *testing.T) {
+	srv, hashes := newTestServer(3, 1)
+	defer srv.Close()
+	client := newTestServerClient(t, srv)
+	defer client.Shutdown()
+
+	// A batch in flight is abandoned once its context is done.
+	srv.SetLatency(time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.GetBlocks(ctx, hashes)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	// Calls made with a done context don't reach the node.
+	requests := srv.Requests()
+	_, err = client.GetBlockCount(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, requests, srv.Requests())
+
+	// The abandoned connection was replaced.
+	srv.SetLatency(0)
+	blocks, err := client.GetBlocks(context.Background(), hashes)
+	assert.NoError(t, err)
+	assert.Len(t, blocks, len(hashes))
+	count, err := client.GetBlockCount(context.Background())
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(hashes), count)
+}
+
+// BenchmarkGetBlocks compares fetching blocks as verbose JSON with fetching them serialized. The test server
+// renders each response once, so only the transfer and decoding done by the client are measured.
+func BenchmarkGetBlocks(b *testing.B) {
+	srv, hashes := newTestServer(10, 2000)
+	defer srv.Close()
+	// Warm up the server's responses.
+	warmup := newTestServerClient(b, srv)
+	for _, raw := range []bool{false, true} {
+		if raw {
+			warmup.EnableRawBlocks(&chaincfg.RegressionNetParams)
+		}
+		if _, err := warmup.GetBlocks(context.Background(), hashes); err != nil {
+			b.Fatal(err)
+		}
+	}
+	warmup.Shutdown()
+
+	for _, mode := range []string{"verbose", "raw"} {
+		b.Run(mode, func(b *testing.B) {
+			client := newTestServerClient(b, srv)
+			defer client.Shutdown()
+			if mode == "raw" {
+				client.EnableRawBlocks(&chaincfg.RegressionNetParams)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.GetBlocks(context.Background(), hashes); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N*len(hashes))/b.Elapsed().Seconds(), "blocks/s")
+		})
+	}
+}
+
+func assertBlocksEqual(t testing.TB, want, got []*types.Block) {
+	if !assert.Len(t, got, len(want)) {
+		return
+	}
+	for i := range want {
+		assert.Equal(t, want[i].Hash(), got[i].Hash())
+		assert.Equal(t, want[i].Height(), got[i].Height())
+		assert.Equal(t, want[i].Confirmations(), got[i].Confirmations())
+		assert.Equal(t, want[i].NextHash(), got[i].NextHash())
+		assert.Equal(t, want[i].PreviousHash(), got[i].PreviousHash())
+		assert.Equal(t, want[i].Size(), got[i].Size())
+		assert.Equal(t, want[i].StrippedSize(), got[i].StrippedSize())
+		assert.Equal(t, want[i].Weight(), got[i].Weight())
+		assert.Equal(t, want[i].Bits(), got[i].Bits())
+		assert.Equal(t, want[i].Time(), got[i].Time())
+		wantTxs, gotTxs := want[i].Transactions(), got[i].Transactions()
+		if !assert.Len(t, gotTxs, len(wantTxs)) {
+			continue
+		}
+		for j := range wantTxs {
+			assert.Equal(t, wantTxs[j].Hex(), gotTxs[j].Hex())
+			assert.Equal(t, wantTxs[j].TxID(), gotTxs[j].TxID())
+			assert.Equal(t, wantTxs[j].Hash(), gotTxs[j].Hash())
+			assert.Equal(t, wantTxs[j].VSize(), gotTxs[j].VSize())
+			assert.Equal(t, wantTxs[j].Weight(), gotTxs[j].Weight())
+			assert.Equal(t, len(wantTxs[j].Vin()), len(gotTxs[j].Vin()))
+			for k, vin := range wantTxs[j].Vin() {
+				assert.Equal(t, vin.Coinbase(), gotTxs[j].Vin()[k].Coinbase())
+				assert.Equal(t, vin.TxID(), gotTxs[j].Vin()[k].TxID())
+				assert.Equal(t, vin.Vout(), gotTxs[j].Vin()[k].Vout())
+				assert.Equal(t, vin.ScriptSig(), gotTxs[j].Vin()[k].ScriptSig())
+				assert.Equal(t, vin.Witness(), gotTxs[j].Vin()[k].Witness())
+			}
+			assert.Equal(t, len(wantTxs[j].Vout()), len(gotTxs[j].Vout()))
+			for k, vout := range wantTxs[j].Vout() {
+				assert.Equal(t, vout.Value(), gotTxs[j].Vout()[k].Value())
+				assert.Equal(t, vout.ScriptPubKey(), gotTxs[j].Vout()[k].ScriptPubKey())
+			}
+		}
+	}
+}
+
+// newTestServer starts an in-process node serving nBlocks blocks with nTxs transactions each on top of the
+// regtest genesis block and returns the hashes of these blocks.
+func newTestServer(nBlocks, nTxs int) (*rpctest.Server, []*chainhash.Hash) {
+	chain := rpctest.NewChain(&chaincfg.RegressionNetParams, nBlocks, nTxs)
+	hashes := make([]*chainhash.Hash, nBlocks)
+	for i, msg := range chain[1:] {
+		hash := msg.BlockHash()
+		hashes[i] = &hash
+	}
+	return rpctest.NewServer(&chaincfg.RegressionNetParams, chain), hashes
+}
+
+func newTestServerClient(t testing.TB, srv *rpctest.Server) *RPCClient {
+	client, err := New(srv.ConnConfig(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// newFixtureServer starts a JSON-RPC server answering getblock and getblockheader for the block at height recorded
+// in testdata: block_<height>.json and block_header_<height>.json are the verbose results of Bitcoin Core,
+// block_<height>_v3.json the result of getblock with verbosity 3 and block_<height>.hex the serialized block. It
+// returns the server and the hash of the block.
+func newFixtureServer(t testing.TB, height int64) (*httptest.Server, *chainhash.Hash) {
+	readFile := func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join("testdata", fmt.Sprintf(name, height)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	block, blockV3, header := readFile("block_%d.json"), readFile("block_%d_v3.json"), readFile("block_header_%d.json")
+	raw, err := json.Marshal(strings.TrimSpace(string(readFile("block_%d.hex"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Hash string `json:"hash"`
+	}
+	if err := json.Unmarshal(header, &result); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := chainhash.NewHashFromStr(result.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type request struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+		ID     json.RawMessage   `json:"id"`
+	}
+	type response struct {
+		Result json.RawMessage   `json:"result"`
+		Error  *btcjson.RPCError `json:"error"`
+		ID     json.RawMessage   `json:"id"`
+	}
+	call := func(req request) response {
+		var reqHash string
+		if len(req.Params) == 0 || json.Unmarshal(req.Params[0], &reqHash) != nil || reqHash != result.Hash {
+			return response{Error: btcjson.NewRPCError(btcjson.ErrRPCBlockNotFound, "Block not found"), ID: req.ID}
+		}
+		verbosity := "1"
+		if len(req.Params) > 1 {
+			verbosity = string(req.Params[1])
+		}
+		switch {
+		case req.Method == "getblockheader" && verbosity != "false":
+			return response{Result: header, ID: req.ID}
+		case req.Method == "getblock" && verbosity == "0":
+			return response{Result: raw, ID: req.ID}
+		case req.Method == "getblock" && verbosity == "2":
+			return response{Result: block, ID: req.ID}
+		case req.Method == "getblock" && verbosity == "3":
+			return response{Result: blockV3, ID: req.ID}
+		}
+		return response{Error: btcjson.NewRPCError(btcjson.ErrRPCMethodNotFound.Code, "Method not found"), ID: req.ID}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []request
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resps := make([]response, len(reqs))
+		for i, req := range reqs {
+			resps[i] = call(req)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resps)
+	}))
+	return srv, hash
+}
@@ -0,0 +1,62 @@
+package rpctest
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// NewChain returns a chain of nBlocks blocks on top of the genesis block of params, each with a coinbase and
+// nTxs segwit transactions. The genesis block is the first block returned.
+func NewChain(params *chaincfg.Params, nBlocks, nTxs int) []*wire.MsgBlock {
+	chain := []*wire.MsgBlock{params.GenesisBlock}
+	for i := 0; i < nBlocks; i++ {
+		chain = append(chain, NewBlock(params, chain[i], int64(i+1), nTxs, 0))
+	}
+	return chain
+}
+
+// NewBlock returns a block at the given height on top of prev, with a coinbase and nTxs segwit transactions.
+// Blocks built on the same parent with different nonces are different, which allows building forks.
+func NewBlock(params *chaincfg.Params, prev *wire.MsgBlock, height int64, nTxs int, nonce uint32) *wire.MsgBlock {
+	pkScript := func(seed int) []byte {
+		script, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(bytes.Repeat([]byte{byte(seed)}, 20)).Script()
+		return script
+	}
+	coinbaseScript, _ := txscript.NewScriptBuilder().AddInt64(height).AddInt64(int64(nonce)).Script()
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), coinbaseScript, nil))
+	coinbase.AddTxOut(wire.NewTxOut(50*btcutil.SatoshiPerBitcoin, pkScript(0)))
+	txs := []*btcutil.Tx{btcutil.NewTx(coinbase)}
+
+	for i := 0; i < nTxs; i++ {
+		tx := wire.NewMsgTx(2)
+		prevOut := chainhash.DoubleHashH([]byte{byte(height), byte(height >> 8), byte(i), byte(i >> 8)})
+		witness := wire.TxWitness{bytes.Repeat([]byte{0x30}, 72), bytes.Repeat([]byte{0x02}, 33)}
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevOut, 0), nil, witness))
+		tx.AddTxOut(wire.NewTxOut(int64(i+1)*1000, pkScript(i)))
+		tx.AddTxOut(wire.NewTxOut(int64(i+1)*2000, pkScript(i+1)))
+		txs = append(txs, btcutil.NewTx(tx))
+	}
+
+	merkles := blockchain.BuildMerkleTreeStore(txs, false)
+	msg := wire.NewMsgBlock(wire.NewBlockHeader(
+		wire.TxVersion,
+		&chainhash.Hash{},
+		merkles[len(merkles)-1],
+		params.PowLimitBits,
+		nonce,
+	))
+	msg.Header.PrevBlock = prev.BlockHash()
+	msg.Header.Timestamp = prev.Header.Timestamp.Add(10 * time.Minute)
+	for _, tx := range txs {
+		msg.AddTransaction(tx.MsgTx())
+	}
+	return msg
+}
@@ -0,0 +1,793 @@
+// Package rpctest implements an in-process stand-in for the bitcoind JSON-RPC server, so RPC clients and whole
+// pipelines can be tested without running a node.
+//
+// The server answers the read-only chain methods used by the exporter (getblockcount, getbestblockhash,
+// getblockchaininfo, getblockhash, getblockheader, getblock with verbosity 0 to 3, getrawtransaction and
+// getrawmempool) for a chain of blocks and a mempool given by the test, in single or batch requests, with HTTP basic
+// authentication. Responses follow Bitcoin Core, including its error codes and HTTP statuses.
+package rpctest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// medianTimeBlocks is the number of blocks whose median timestamp is the median time of the tip.
+const medianTimeBlocks = 11
+
+// Credentials accepted by a Server.
+const (
+	User = "rpctest"
+	Pass = "rpctest"
+)
+
+// block represents a block known by the server.
+type block struct {
+	msg    *wire.MsgBlock
+	height int64
+}
+
+// mempoolTx represents an unconfirmed transaction in the mempool of the server.
+type mempoolTx struct {
+	msg *wire.MsgTx
+	// time is the time the transaction entered the mempool and height the height of the tip at that time.
+	time   int64
+	height int64
+}
+
+// txLocation represents the position of a transaction of the active chain.
+type txLocation struct {
+	blk   *block
+	index int
+}
+
+// Server is a JSON-RPC server serving a chain of blocks over HTTP.
+type Server struct {
+	// Counters are accessed atomically and kept first for 64-bit alignment.
+	requests uint64
+	calls    uint64
+
+	srv    *httptest.Server
+	params *chaincfg.Params
+	// closing is closed by Close to release delayed requests.
+	closing chan struct{}
+
+	mu      sync.RWMutex
+	latency time.Duration
+	blocks  map[chainhash.Hash]*block
+	chain   []*chainhash.Hash // active chain by height
+	// headers is the height of the best header while the server pretends to be in initial block download.
+	headers int64
+	// txs indexes the transactions of the active chain by txid.
+	txs map[chainhash.Hash]txLocation
+	// txIndex is set when getrawtransaction finds the transactions of the chain, like with `-txindex`.
+	txIndex bool
+	// legacyVerbosity is set when getblock answers verbosity 3 like verbosity 2, like Bitcoin Core before v23.
+	legacyVerbosity bool
+	// mempool holds the unconfirmed transactions by txid.
+	mempool map[chainhash.Hash]*mempoolTx
+	// results caches rendered results until the chain changes.
+	results map[string]json.RawMessage
+}
+
+// NewServer starts a server for the chain made of blocks, starting with the genesis block at height 0. Output
+// addresses are encoded for the network described by params. The server must be closed after use.
+func NewServer(params *chaincfg.Params, blocks []*wire.MsgBlock) *Server {
+	s := &Server{
+		params:  params,
+		closing: make(chan struct{}),
+		blocks:  make(map[chainhash.Hash]*block),
+		txs:     make(map[chainhash.Hash]txLocation),
+		mempool: make(map[chainhash.Hash]*mempoolTx),
+	}
+	s.SetChain(blocks)
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	close(s.closing)
+	s.srv.Close()
+}
+
+// Host returns the address of the server (host:port).
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.srv.URL, "http://")
+}
+
+// ConnConfig returns the settings used to connect to the server with a btcd rpcclient.
+func (s *Server) ConnConfig() *rpcclient.ConnConfig {
+	return &rpcclient.ConnConfig{
+		Host:         s.Host(),
+		User:         User,
+		Pass:         Pass,
+		HTTPPostMode: true,
+		DisableTLS:   true,
+	}
+}
+
+// Requests returns the number of HTTP requests received so far. A batch counts as one request.
+func (s *Server) Requests() int {
+	return int(atomic.LoadUint64(&s.requests))
+}
+
+// Calls returns the number of JSON-RPC calls received so far, counting every call of a batch.
+func (s *Server) Calls() int {
+	return int(atomic.LoadUint64(&s.calls))
+}
+
+// SetLatency delays every HTTP request by d, e.g. to test clients giving up on a slow node.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetChain replaces the active chain with blocks, starting at height 0. Blocks of the previous chain that are
+// not part of the new one are still served as stale blocks, like after a chain reorganization.
+func (s *Server) SetChain(blocks []*wire.MsgBlock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chain = s.chain[:0]
+	s.txs = make(map[chainhash.Hash]txLocation)
+	s.appendBlocks(blocks)
+}
+
+// SetSyncing makes the server report that it is in initial block download with headers up to the given height,
+// until the active chain reaches it.
+func (s *Server) SetSyncing(headers int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.headers = headers
+	s.results = make(map[string]json.RawMessage)
+}
+
+// SetTxIndex makes getrawtransaction find the transactions of the active chain, like a node started with
+// `-txindex`. It is disabled by default, like in Bitcoin Core.
+func (s *Server) SetTxIndex(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.txIndex = enabled
+	s.results = make(map[string]json.RawMessage)
+}
+
+// SetLegacyVerbosity makes getblock answer verbosity 3 like verbosity 2, without the prevouts of inputs, like
+// Bitcoin Core before v23.
+func (s *Server) SetLegacyVerbosity(legacy bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.legacyVerbosity = legacy
+	s.results = make(map[string]json.RawMessage)
+}
+
+// SetMempool replaces the transactions of the mempool with txs. They enter the mempool one second apart in the
+// given order, starting at the time of the tip, and leave it once a block including them is added to the chain.
+// Their inputs must spend outputs of the active chain or of transactions before them.
+func (s *Server) SetMempool(txs []*wire.MsgTx) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tip := s.blocks[*s.chain[len(s.chain)-1]]
+	s.mempool = make(map[chainhash.Hash]*mempoolTx, len(txs))
+	for i, tx := range txs {
+		s.mempool[tx.TxHash()] = &mempoolTx{tx, tip.msg.Header.Timestamp.Unix() + int64(i), tip.height}
+	}
+	s.results = make(map[string]json.RawMessage)
+}
+
+// AddBlocks extends the active chain with blocks.
+func (s *Server) AddBlocks(blocks ...*wire.MsgBlock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.appendBlocks(blocks)
+}
+
+// appendBlocks adds blocks on top of the active chain. s.mu must be held.
+func (s *Server) appendBlocks(blocks []*wire.MsgBlock) {
+	for _, msg := range blocks {
+		hash := msg.BlockHash()
+		blk := &block{msg: msg, height: int64(len(s.chain))}
+		s.blocks[hash] = blk
+		s.chain = append(s.chain, &hash)
+		for i, tx := range msg.Transactions {
+			s.txs[tx.TxHash()] = txLocation{blk, i}
+			delete(s.mempool, tx.TxHash())
+		}
+	}
+	s.results = make(map[string]json.RawMessage)
+}
+
+// request represents a JSON-RPC request.
+type request struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// response represents a JSON-RPC response.
+type response struct {
+	Result json.RawMessage   `json:"result"`
+	Error  *btcjson.RPCError `json:"error"`
+	ID     json.RawMessage   `json:"id"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddUint64(&s.requests, 1)
+	if user, pass, ok := r.BasicAuth(); !ok || user != User || pass != Pass {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	s.mu.RLock()
+	latency := s.latency
+	s.mu.RUnlock()
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		}
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "JSONRPC server handles only POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusInternalServerError, response{Error: btcjson.NewRPCError(btcjson.ErrRPCParse.Code, "Parse error")})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var reqs []request
+		if err := json.Unmarshal(body, &reqs); err != nil {
+			writeJSON(w, http.StatusInternalServerError, response{Error: btcjson.NewRPCError(btcjson.ErrRPCParse.Code, "Parse error")})
+			return
+		}
+		// Errors of batched calls are reported in their responses only.
+		resps := make([]response, len(reqs))
+		for i, req := range reqs {
+			resps[i] = s.call(req)
+		}
+		writeJSON(w, http.StatusOK, resps)
+		return
+	}
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, http.StatusInternalServerError, response{Error: btcjson.NewRPCError(btcjson.ErrRPCParse.Code, "Parse error")})
+		return
+	}
+	resp := s.call(req)
+	status := http.StatusOK
+	if resp.Error != nil {
+		status = http.StatusInternalServerError
+		if resp.Error.Code == btcjson.ErrRPCMethodNotFound.Code {
+			status = http.StatusNotFound
+		}
+	}
+	writeJSON(w, status, resp)
+}
+
+// call answers a single JSON-RPC request.
+func (s *Server) call(req request) response {
+	atomic.AddUint64(&s.calls, 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result, err := s.result(req)
+	if err != nil {
+		return response{Error: err, ID: req.ID}
+	}
+	return response{Result: result, ID: req.ID}
+}
+
+// result returns the result of a request, rendering it only once for a given chain. s.mu must be held.
+func (s *Server) result(req request) (json.RawMessage, *btcjson.RPCError) {
+	key := req.Method
+	for _, param := range req.Params {
+		key += " " + string(bytes.TrimSpace(param))
+	}
+	if result, ok := s.results[key]; ok {
+		return result, nil
+	}
+	v, rpcErr := s.dispatch(req)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	result, err := json.Marshal(v)
+	if err != nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInternal.Code, err.Error())
+	}
+	s.results[key] = result
+	return result, nil
+}
+
+// dispatch computes the result of a request. s.mu must be held.
+func (s *Server) dispatch(req request) (interface{}, *btcjson.RPCError) {
+	switch req.Method {
+	case "getblockcount":
+		return len(s.chain) - 1, nil
+	case "getbestblockhash":
+		return s.chain[len(s.chain)-1].String(), nil
+	case "getblockchaininfo":
+		return s.blockchainInfo(), nil
+	case "getblockhash":
+		var height int64
+		if err := param(req.Params, 0, &height); err != nil {
+			return nil, err
+		}
+		if height < 0 || height >= int64(len(s.chain)) {
+			return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, "Block height out of range")
+		}
+		return s.chain[height].String(), nil
+	case "getblockheader":
+		blk, err := s.lookup(req.Params)
+		if err != nil {
+			return nil, err
+		}
+		verbose := true
+		if err := param(req.Params, 1, &verbose); err != nil {
+			return nil, err
+		}
+		if !verbose {
+			var buf bytes.Buffer
+			if err := blk.msg.Header.Serialize(&buf); err != nil {
+				return nil, btcjson.NewRPCError(btcjson.ErrRPCInternal.Code, err.Error())
+			}
+			return hex.EncodeToString(buf.Bytes()), nil
+		}
+		header := types.BlockHeaderVerboseFromWire(&blk.msg.Header, blk.height)
+		header.Confirmations, header.NextHash = s.chainInfo(blk)
+		return header, nil
+	case "getblock":
+		blk, err := s.lookup(req.Params)
+		if err != nil {
+			return nil, err
+		}
+		verbosity, err := verbosityParam(req.Params)
+		if err != nil {
+			return nil, err
+		}
+		switch verbosity {
+		case 0:
+			var buf bytes.Buffer
+			if err := blk.msg.Serialize(&buf); err != nil {
+				return nil, btcjson.NewRPCError(btcjson.ErrRPCInternal.Code, err.Error())
+			}
+			return hex.EncodeToString(buf.Bytes()), nil
+		case 1:
+			verbose := types.BlockVerboseFromWire(blk.msg, blk.height, s.params)
+			txids := make([]string, len(verbose.Tx))
+			for i, tx := range verbose.Tx {
+				txids[i] = tx.Txid
+			}
+			res := btcjson.GetBlockVerboseResult{
+				Hash:         verbose.Hash,
+				StrippedSize: verbose.StrippedSize,
+				Size:         verbose.Size,
+				Weight:       verbose.Weight,
+				Height:       verbose.Height,
+				Version:      verbose.Version,
+				VersionHex:   verbose.VersionHex,
+				MerkleRoot:   verbose.MerkleRoot,
+				Tx:           txids,
+				Time:         verbose.Time,
+				Nonce:        verbose.Nonce,
+				Bits:         verbose.Bits,
+				Difficulty:   verbose.Difficulty,
+				PreviousHash: verbose.PreviousHash,
+			}
+			res.Confirmations, res.NextHash = s.chainInfo(blk)
+			return res, nil
+		default:
+			verbose := types.BlockVerboseFromWire(blk.msg, blk.height, s.params)
+			verbose.Confirmations, verbose.NextHash = s.chainInfo(blk)
+			var v interface{} = verbose
+			if verbosity >= 3 && !s.legacyVerbosity {
+				v = s.withPrevouts(types.NewBlock(verbose))
+			}
+			res, err := coreJSON(v)
+			if err != nil {
+				return nil, btcjson.NewRPCError(btcjson.ErrRPCInternal.Code, err.Error())
+			}
+			return res, nil
+		}
+	case "getrawtransaction":
+		var txidStr string
+		if err := param(req.Params, 0, &txidStr); err != nil {
+			return nil, err
+		}
+		txid, err := chainhash.NewHashFromStr(txidStr)
+		if err != nil || len(txidStr) != 2*chainhash.HashSize {
+			return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, "txid must be hexadecimal string")
+		}
+		// Unconfirmed transactions are found without -txindex.
+		loc, ok := s.txs[*txid]
+		unconfirmed, inMempool := s.mempool[*txid]
+		if !inMempool && (!ok || !s.txIndex) {
+			return nil, btcjson.NewRPCError(btcjson.ErrRPCNoTxInfo, "No such mempool or blockchain transaction. "+
+				"Use gettransaction for wallet transactions.")
+		}
+		verbosity, rpcErr := verbosityParam(req.Params)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		var tx *wire.MsgTx
+		if inMempool {
+			tx = unconfirmed.msg
+		} else {
+			tx = loc.blk.msg.Transactions[loc.index]
+		}
+		if verbosity == 0 {
+			var buf bytes.Buffer
+			if err := tx.Serialize(&buf); err != nil {
+				return nil, btcjson.NewRPCError(btcjson.ErrRPCInternal.Code, err.Error())
+			}
+			return hex.EncodeToString(buf.Bytes()), nil
+		}
+		res := types.TxRawResultFromWire(tx, s.params)
+		if !inMempool {
+			confirmations, _ := s.chainInfo(loc.blk)
+			res.BlockHash = s.chain[loc.blk.height].String()
+			res.Confirmations = uint64(confirmations)
+			res.Time = loc.blk.msg.Header.Timestamp.Unix()
+			res.Blocktime = res.Time
+		}
+		v, err := coreJSON(res)
+		if err != nil {
+			return nil, btcjson.NewRPCError(btcjson.ErrRPCInternal.Code, err.Error())
+		}
+		return v, nil
+	case "getrawmempool":
+		var verbose bool
+		if len(req.Params) > 0 {
+			if err := param(req.Params, 0, &verbose); err != nil {
+				return nil, err
+			}
+		}
+		if !verbose {
+			txids := make([]string, 0, len(s.mempool))
+			for txid := range s.mempool {
+				txids = append(txids, txid.String())
+			}
+			sort.Strings(txids)
+			return txids, nil
+		}
+		entries := make(map[string]types.MempoolEntryResult, len(s.mempool))
+		for txid := range s.mempool {
+			entries[txid.String()] = s.mempoolEntry(txid)
+		}
+		return entries, nil
+	default:
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCMethodNotFound.Code, "Method not found")
+	}
+}
+
+// mempoolEntry returns the entry of an unconfirmed transaction as listed by getrawmempool. s.mu must be held.
+func (s *Server) mempoolEntry(txid chainhash.Hash) types.MempoolEntryResult {
+	tx := s.mempool[txid]
+	entry := types.MempoolEntryResult{
+		VSize:       int32(vsize(tx.msg)),
+		Weight:      int32(weight(tx.msg)),
+		Time:        tx.time,
+		Height:      tx.height,
+		WTxID:       tx.msg.WitnessHash().String(),
+		Depends:     []string{},
+		SpentBy:     []string{},
+		Replaceable: signalsReplacement(tx.msg),
+	}
+	fee := s.fee(tx.msg)
+	entry.Fees = &types.Fees{Base: fee.ToBTC(), Modified: fee.ToBTC()}
+
+	// Ancestors and descendants include the transaction itself.
+	parents := func(txid chainhash.Hash) []chainhash.Hash {
+		var hashes []chainhash.Hash
+		for _, in := range s.mempool[txid].msg.TxIn {
+			if _, ok := s.mempool[in.PreviousOutPoint.Hash]; ok {
+				hashes = append(hashes, in.PreviousOutPoint.Hash)
+			}
+		}
+		return hashes
+	}
+	children := func(txid chainhash.Hash) []chainhash.Hash {
+		var hashes []chainhash.Hash
+		for hash, other := range s.mempool {
+			for _, in := range other.msg.TxIn {
+				if in.PreviousOutPoint.Hash == txid {
+					hashes = append(hashes, hash)
+					break
+				}
+			}
+		}
+		return hashes
+	}
+	for _, parent := range uniqueHashes(parents(txid)) {
+		entry.Depends = append(entry.Depends, parent.String())
+	}
+	for _, child := range uniqueHashes(children(txid)) {
+		entry.SpentBy = append(entry.SpentBy, child.String())
+	}
+	sort.Strings(entry.Depends)
+	sort.Strings(entry.SpentBy)
+	var ancestorFees, descendantFees btcutil.Amount
+	for hash := range s.related(txid, parents) {
+		related := s.mempool[hash].msg
+		entry.AncestorCount++
+		entry.AncestorSize += vsize(related)
+		ancestorFees += s.fee(related)
+		entry.Replaceable = entry.Replaceable || signalsReplacement(related)
+	}
+	for hash := range s.related(txid, children) {
+		related := s.mempool[hash].msg
+		entry.DescendantCount++
+		entry.DescendantSize += vsize(related)
+		descendantFees += s.fee(related)
+	}
+	entry.Fees.Ancestor, entry.Fees.Descendant = ancestorFees.ToBTC(), descendantFees.ToBTC()
+	return entry
+}
+
+// related returns the unconfirmed transactions reachable from txid through next, including txid.
+func (s *Server) related(txid chainhash.Hash, next func(chainhash.Hash) []chainhash.Hash) map[chainhash.Hash]struct{} {
+	seen := map[chainhash.Hash]struct{}{txid: {}}
+	queue := []chainhash.Hash{txid}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		for _, other := range next(hash) {
+			if _, ok := seen[other]; !ok {
+				seen[other] = struct{}{}
+				queue = append(queue, other)
+			}
+		}
+	}
+	return seen
+}
+
+// fee returns the fee paid by an unconfirmed transaction. Inputs spending unknown outputs are counted as zero.
+// s.mu must be held.
+func (s *Server) fee(tx *wire.MsgTx) btcutil.Amount {
+	var fee int64
+	for _, in := range tx.TxIn {
+		prev := in.PreviousOutPoint
+		var prevTx *wire.MsgTx
+		if loc, ok := s.txs[prev.Hash]; ok {
+			prevTx = loc.blk.msg.Transactions[loc.index]
+		} else if unconfirmed, ok := s.mempool[prev.Hash]; ok {
+			prevTx = unconfirmed.msg
+		}
+		if prevTx != nil && int(prev.Index) < len(prevTx.TxOut) {
+			fee += prevTx.TxOut[prev.Index].Value
+		}
+	}
+	for _, out := range tx.TxOut {
+		fee -= out.Value
+	}
+	return btcutil.Amount(fee)
+}
+
+// weight returns the weight of a transaction as defined by BIP 141.
+func weight(tx *wire.MsgTx) int64 {
+	return int64(tx.SerializeSizeStripped()*(blockchain.WitnessScaleFactor-1) + tx.SerializeSize())
+}
+
+// vsize returns the virtual size of a transaction, its weight divided by 4 rounded up.
+func vsize(tx *wire.MsgTx) int64 {
+	return (weight(tx) + blockchain.WitnessScaleFactor - 1) / blockchain.WitnessScaleFactor
+}
+
+// signalsReplacement returns whether a transaction opts in to replacement as defined by BIP 125.
+func signalsReplacement(tx *wire.MsgTx) bool {
+	for _, in := range tx.TxIn {
+		if in.Sequence < wire.MaxTxInSequenceNum-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueHashes returns hashes without duplicates.
+func uniqueHashes(hashes []chainhash.Hash) []chainhash.Hash {
+	seen := make(map[chainhash.Hash]struct{}, len(hashes))
+	unique := hashes[:0]
+	for _, hash := range hashes {
+		if _, ok := seen[hash]; !ok {
+			seen[hash] = struct{}{}
+			unique = append(unique, hash)
+		}
+	}
+	return unique
+}
+
+// blockchainInfo returns the result of getblockchaininfo. s.mu must be held.
+func (s *Server) blockchainInfo() btcjson.GetBlockChainInfoResult {
+	tip := s.blocks[*s.chain[len(s.chain)-1]]
+	headers := tip.height
+	if s.headers > headers {
+		headers = s.headers
+	}
+	work := new(big.Int)
+	timestamps := make([]int64, 0, medianTimeBlocks)
+	for height := len(s.chain) - 1; height >= 0; height-- {
+		header := &s.blocks[*s.chain[height]].msg.Header
+		work.Add(work, blockchain.CalcWork(header.Bits))
+		if len(timestamps) < medianTimeBlocks {
+			timestamps = append(timestamps, header.Timestamp.Unix())
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return btcjson.GetBlockChainInfoResult{
+		Chain:                types.ChainName(s.params),
+		Blocks:               int32(tip.height),
+		Headers:              int32(headers),
+		BestBlockHash:        s.chain[tip.height].String(),
+		Difficulty:           types.BlockHeaderVerboseFromWire(&tip.msg.Header, tip.height).Difficulty,
+		MedianTime:           timestamps[len(timestamps)/2],
+		VerificationProgress: float64(tip.height+1) / float64(headers+1),
+		InitialBlockDownload: tip.height < headers,
+		ChainWork:            fmt.Sprintf("%064x", work),
+	}
+}
+
+// lookup returns the block whose hash is the first parameter. s.mu must be held.
+func (s *Server) lookup(params []json.RawMessage) (*block, *btcjson.RPCError) {
+	var hashStr string
+	if err := param(params, 0, &hashStr); err != nil {
+		return nil, err
+	}
+	if len(hashStr) != 2*chainhash.HashSize {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter,
+			fmt.Sprintf("blockhash must be of length 64 (not %d, for '%s')", len(hashStr), hashStr))
+	}
+	hash, err := chainhash.NewHashFromStr(hashStr)
+	if err != nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, "blockhash must be hexadecimal string")
+	}
+	blk, ok := s.blocks[*hash]
+	if !ok {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCBlockNotFound, "Block not found")
+	}
+	return blk, nil
+}
+
+// chainInfo returns the number of confirmations and the next block hash of blk. Blocks off the active chain
+// have -1 confirmations like in Bitcoin Core. s.mu must be held.
+func (s *Server) chainInfo(blk *block) (int64, string) {
+	tip := int64(len(s.chain)) - 1
+	if blk.height > tip || *s.chain[blk.height] != blk.msg.BlockHash() {
+		return -1, ""
+	}
+	if blk.height == tip {
+		return 1, ""
+	}
+	return tip - blk.height + 1, s.chain[blk.height+1].String()
+}
+
+// withPrevouts returns blk with the outputs spent by its inputs, as returned by getblock with verbosity = 3.
+// Inputs spending outputs unknown to the server are left without prevout. s.mu must be held.
+func (s *Server) withPrevouts(blk *types.Block) *types.Block {
+	for _, tx := range blk.Transactions() {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Vin() {
+			outPoint, err := in.OutPoint()
+			if err != nil {
+				continue
+			}
+			loc, ok := s.txs[outPoint.Hash]
+			if !ok {
+				continue
+			}
+			prevTx := types.NewTransaction(types.TxRawResultFromWire(loc.blk.msg.Transactions[loc.index], s.params))
+			if outPoint.Index < uint32(len(prevTx.Vout())) {
+				in.SetPrevout(types.NewPrevout(prevTx.Vout()[outPoint.Index], loc.blk.height, loc.index == 0))
+			}
+		}
+	}
+	return blk
+}
+
+// coreJSON renders a result like Bitcoin Core does since v22, which gives the address of an output script in a
+// singular `address` field instead of the `addresses` and `reqSigs` of btcjson.
+func coreJSON(v interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&res); err != nil {
+		return nil, err
+	}
+	coreScripts(res)
+	return json.Marshal(res)
+}
+
+// coreScripts moves the addresses of every `scriptPubKey` object found in v to a singular `address` field.
+func coreScripts(v interface{}) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, elem := range v {
+			coreScripts(elem)
+		}
+	case map[string]interface{}:
+		for key, elem := range v {
+			script, ok := elem.(map[string]interface{})
+			if key != "scriptPubKey" || !ok {
+				coreScripts(elem)
+				continue
+			}
+			if addresses, ok := script["addresses"].([]interface{}); ok && len(addresses) == 1 {
+				script["address"] = addresses[0]
+			}
+			delete(script, "addresses")
+			delete(script, "reqSigs")
+		}
+	}
+}
+
+// param decodes the i-th parameter into v. v is left unchanged when the parameter is missing or null.
+func param(params []json.RawMessage, i int, v interface{}) *btcjson.RPCError {
+	if i >= len(params) {
+		if i == 0 {
+			return btcjson.NewRPCError(btcjson.ErrRPCInvalidParams.Code, "Missing required parameter")
+		}
+		return nil
+	}
+	if string(bytes.TrimSpace(params[i])) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params[i], v); err != nil {
+		return btcjson.NewRPCError(btcjson.ErrRPCType, fmt.Sprintf("Invalid parameter %d: %v", i+1, err))
+	}
+	return nil
+}
+
+// verbosityParam returns the verbosity of getblock, given either as a number or as a boolean.
+func verbosityParam(params []json.RawMessage) (int, *btcjson.RPCError) {
+	verbosity := 1
+	if len(params) > 1 {
+		var verbose bool
+		if json.Unmarshal(params[1], &verbose) == nil {
+			if verbose {
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if err := param(params, 1, &verbosity); err != nil {
+		return 0, err
+	}
+	return verbosity, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,336 @@
+package rpctest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/chaingen"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/suite"
+)
+
+type ServerTestSuite struct {
+	suite.Suite
+	chain  []*wire.MsgBlock
+	server *Server
+	client *rpcclient.Client
+}
+
+func (s *ServerTestSuite) SetupTest() {
+	s.chain = NewChain(&chaincfg.RegressionNetParams, 5, 3)
+	s.server = NewServer(&chaincfg.RegressionNetParams, s.chain)
+	var err error
+	s.client, err = rpcclient.New(s.server.ConnConfig(), nil)
+	s.Require().NoError(err)
+}
+
+func (s *ServerTestSuite) TearDownTest() {
+	s.client.Shutdown()
+	s.server.Close()
+}
+
+func (s *ServerTestSuite) TestChainMethods() {
+	count, err := s.client.GetBlockCount()
+	s.NoError(err)
+	s.EqualValues(5, count)
+	best, err := s.client.GetBestBlockHash()
+	s.NoError(err)
+	s.Equal(s.chain[5].BlockHash(), *best)
+	hash, err := s.client.GetBlockHash(2)
+	s.NoError(err)
+	s.Equal(s.chain[2].BlockHash(), *hash)
+
+	_, err = s.client.GetBlockHash(6)
+	s.Equal(btcjson.ErrRPCInvalidParameter, rpcErrorCode(err))
+}
+
+func (s *ServerTestSuite) TestGetBlockChainInfo() {
+	var info btcjson.GetBlockChainInfoResult
+	res, err := s.client.RawRequest("getblockchaininfo", nil)
+	s.Require().NoError(err)
+	s.Require().NoError(json.Unmarshal(res, &info))
+	s.Equal("regtest", info.Chain)
+	s.EqualValues(5, info.Blocks)
+	s.EqualValues(5, info.Headers)
+	s.Equal(s.chain[5].BlockHash().String(), info.BestBlockHash)
+	s.Equal(s.chain[3].Header.Timestamp.Unix(), info.MedianTime)
+	s.Equal(1.0, info.VerificationProgress)
+	s.False(info.InitialBlockDownload)
+	s.Len(info.ChainWork, 64)
+
+	s.server.SetSyncing(11)
+	res, err = s.client.RawRequest("getblockchaininfo", nil)
+	s.Require().NoError(err)
+	s.Require().NoError(json.Unmarshal(res, &info))
+	s.EqualValues(5, info.Blocks)
+	s.EqualValues(11, info.Headers)
+	s.Equal(0.5, info.VerificationProgress)
+	s.True(info.InitialBlockDownload)
+}
+
+func (s *ServerTestSuite) TestGetBlockHeader() {
+	hash := s.chain[2].BlockHash()
+	header, err := s.client.GetBlockHeaderVerbose(&hash)
+	s.Require().NoError(err)
+	s.Equal(hash.String(), header.Hash)
+	s.EqualValues(2, header.Height)
+	s.EqualValues(4, header.Confirmations)
+	s.Equal(s.chain[1].BlockHash().String(), header.PreviousHash)
+	s.Equal(s.chain[3].BlockHash().String(), header.NextHash)
+
+	raw, err := s.client.GetBlockHeader(&hash)
+	s.Require().NoError(err)
+	s.Equal(s.chain[2].Header, *raw)
+}
+
+func (s *ServerTestSuite) TestGetBlock() {
+	hash := s.chain[5].BlockHash()
+	raw, err := s.client.GetBlock(&hash)
+	s.Require().NoError(err)
+	s.Equal(s.chain[5].BlockHash(), raw.BlockHash())
+	s.Len(raw.Transactions, 4)
+
+	verbose, err := s.client.GetBlockVerbose(&hash)
+	s.Require().NoError(err)
+	s.EqualValues(5, verbose.Height)
+	s.EqualValues(1, verbose.Confirmations)
+	s.Empty(verbose.NextHash)
+	s.Len(verbose.Tx, 4)
+	s.Equal(s.chain[5].Transactions[0].TxHash().String(), verbose.Tx[0])
+
+	verboseTx, err := s.client.GetBlockVerboseTx(&hash)
+	s.Require().NoError(err)
+	s.Len(verboseTx.Tx, 4)
+	s.Equal(s.chain[5].Transactions[3].TxHash().String(), verboseTx.Tx[3].Txid)
+	s.Equal(verbose.Hash, verboseTx.Hash)
+
+	var missing = s.chain[0].BlockHash()
+	missing[0] ^= 1
+	_, err = s.client.GetBlockVerbose(&missing)
+	s.Equal(btcjson.ErrRPCBlockNotFound, rpcErrorCode(err))
+}
+
+func (s *ServerTestSuite) TestGetBlockPrevouts() {
+	// The first transaction of a new block spends the coinbase of block 1.
+	msg := NewBlock(&chaincfg.RegressionNetParams, s.chain[5], 6, 2, 0)
+	coinbaseHash := s.chain[1].Transactions[0].TxHash()
+	msg.Transactions[1].TxIn[0].PreviousOutPoint = *wire.NewOutPoint(&coinbaseHash, 0)
+	s.server.AddBlocks(msg)
+	hash := msg.BlockHash()
+	getBlock := func() *types.Block {
+		res, err := s.client.RawRequest("getblock", []json.RawMessage{
+			json.RawMessage(`"` + hash.String() + `"`), json.RawMessage("3"),
+		})
+		s.Require().NoError(err)
+		s.NotContains(string(res), `"addresses"`)
+		blk := new(types.Block)
+		s.Require().NoError(json.Unmarshal(res, blk))
+		return blk
+	}
+
+	txs := getBlock().Transactions()
+	s.Nil(txs[0].Vin()[0].Prevout())
+	prevout := txs[1].Vin()[0].Prevout()
+	s.Require().NotNil(prevout)
+	s.EqualValues(1, prevout.Height())
+	s.True(prevout.Generated())
+	s.Equal(btcutil.Amount(50*btcutil.SatoshiPerBitcoin), prevout.Value())
+	coinbase := types.NewBlockFromWire(s.chain[1], 1, &chaincfg.RegressionNetParams).Transactions()[0]
+	s.Equal(coinbase.Vout()[0].ScriptPubKey(), prevout.ScriptPubKey())
+	s.NotEmpty(prevout.Address(&chaincfg.RegressionNetParams))
+	// The other input spends an output the server doesn't know.
+	s.Nil(txs[2].Vin()[0].Prevout())
+
+	// Bitcoin Core before v23 answers verbosity 3 like verbosity 2.
+	s.server.SetLegacyVerbosity(true)
+	s.Nil(getBlock().Transactions()[1].Vin()[0].Prevout())
+}
+
+func (s *ServerTestSuite) TestGetRawTransaction() {
+	txid := s.chain[3].Transactions[2].TxHash()
+	_, err := s.client.GetRawTransactionVerbose(&txid)
+	s.Equal(btcjson.ErrRPCNoTxInfo, rpcErrorCode(err))
+
+	s.server.SetTxIndex(true)
+	tx, err := s.client.GetRawTransaction(&txid)
+	s.Require().NoError(err)
+	s.Equal(txid, *tx.Hash())
+	res, err := s.client.RawRequest("getrawtransaction", []json.RawMessage{
+		json.RawMessage(`"` + txid.String() + `"`), json.RawMessage("true"),
+	})
+	s.Require().NoError(err)
+	verbose := new(types.Transaction)
+	s.Require().NoError(json.Unmarshal(res, verbose))
+	s.Equal(txid.String(), verbose.TxID())
+	s.Equal(s.chain[3].BlockHash().String(), verbose.BlockHash())
+	s.EqualValues(3, verbose.Confirmations())
+	s.Len(verbose.Vout()[0].ScriptPubKey().Addresses, 1)
+
+	missing := txid
+	missing[0] ^= 1
+	_, err = s.client.GetRawTransactionVerbose(&missing)
+	s.Equal(btcjson.ErrRPCNoTxInfo, rpcErrorCode(err))
+}
+
+func (s *ServerTestSuite) TestGetRawMempool() {
+	config := chaingen.DefaultConfig()
+	config.CoinbaseMaturity = 1
+	generated, err := chaingen.Generate(config, 10)
+	s.Require().NoError(err)
+	chain := make([]*wire.MsgBlock, len(generated)-1)
+	for i := range chain {
+		chain[i] = generated[i].MsgBlock
+	}
+	// The transactions of the last block wait in the mempool.
+	s.server.SetChain(chain)
+	s.server.SetMempool(generated[10].Transactions[1:])
+
+	txids, err := s.client.GetRawMempool()
+	s.Require().NoError(err)
+	s.Len(txids, len(generated[10].Transactions)-1)
+	res, err := s.client.RawRequest("getrawmempool", []json.RawMessage{json.RawMessage("true")})
+	s.Require().NoError(err)
+	var entries map[string]types.MempoolEntryResult
+	s.Require().NoError(json.Unmarshal(res, &entries))
+	s.Len(entries, len(txids))
+	var fees btcutil.Amount
+	var ancestors, descendants int64
+	for _, entry := range entries {
+		fee, err := btcutil.NewAmount(entry.Fees.Base)
+		s.Require().NoError(err)
+		fees += fee
+		s.Positive(entry.VSize)
+		s.EqualValues(9, entry.Height)
+		s.Equal(len(entry.Depends) == 0, entry.AncestorCount == 1)
+		ancestors += entry.AncestorCount
+		descendants += entry.DescendantCount
+	}
+	s.Equal(btcutil.Amount(generated[10].Fees), fees)
+	// Each pair of an ancestor and a descendant is counted once in both directions.
+	s.Equal(ancestors, descendants)
+
+	// Unconfirmed transactions are found without -txindex.
+	txid := generated[10].Transactions[1].TxHash()
+	tx, err := s.client.GetRawTransactionVerbose(&txid)
+	s.Require().NoError(err)
+	s.Empty(tx.BlockHash)
+
+	// Transactions leave the mempool once mined.
+	s.server.AddBlocks(generated[10].MsgBlock)
+	txids, err = s.client.GetRawMempool()
+	s.Require().NoError(err)
+	s.Empty(txids)
+}
+
+func (s *ServerTestSuite) TestBatch() {
+	batch, err := rpcclient.NewBatch(s.server.ConnConfig())
+	s.Require().NoError(err)
+	defer batch.Shutdown()
+
+	hashReqs := make([]rpcclient.FutureGetBlockHashResult, 7)
+	for i := range hashReqs {
+		hashReqs[i] = batch.GetBlockHashAsync(int64(i))
+	}
+	s.Require().NoError(batch.Send())
+	for i, req := range hashReqs {
+		hash, err := req.Receive()
+		if i < len(s.chain) {
+			s.NoError(err)
+			s.Equal(s.chain[i].BlockHash(), *hash)
+		} else {
+			s.Equal(btcjson.ErrRPCInvalidParameter, rpcErrorCode(err))
+		}
+	}
+	s.Equal(1, s.server.Requests())
+	s.Equal(7, s.server.Calls())
+}
+
+func (s *ServerTestSuite) TestReorg() {
+	fork := []*wire.MsgBlock{s.chain[0], s.chain[1], s.chain[2]}
+	for height := int64(3); height <= 6; height++ {
+		fork = append(fork, NewBlock(&chaincfg.RegressionNetParams, fork[height-1], height, 1, 1))
+	}
+	staleHash := s.chain[4].BlockHash()
+	header, err := s.client.GetBlockHeaderVerbose(&staleHash)
+	s.Require().NoError(err)
+	s.EqualValues(2, header.Confirmations)
+
+	s.server.SetChain(fork)
+	count, err := s.client.GetBlockCount()
+	s.NoError(err)
+	s.EqualValues(6, count)
+	header, err = s.client.GetBlockHeaderVerbose(&staleHash)
+	s.Require().NoError(err)
+	s.EqualValues(-1, header.Confirmations)
+	s.Empty(header.NextHash)
+	forkHash := s.chain[2].BlockHash()
+	header, err = s.client.GetBlockHeaderVerbose(&forkHash)
+	s.Require().NoError(err)
+	s.Equal(fork[3].BlockHash().String(), header.NextHash)
+
+	s.server.AddBlocks(NewBlock(&chaincfg.RegressionNetParams, fork[6], 7, 0, 1))
+	count, err = s.client.GetBlockCount()
+	s.NoError(err)
+	s.EqualValues(7, count)
+}
+
+func (s *ServerTestSuite) TestHTTP() {
+	post := func(user, body string) (*http.Response, map[string]json.RawMessage) {
+		req, err := http.NewRequest(http.MethodPost, "http://"+s.server.Host(), strings.NewReader(body))
+		s.Require().NoError(err)
+		req.SetBasicAuth(user, Pass)
+		resp, err := http.DefaultClient.Do(req)
+		s.Require().NoError(err)
+		defer resp.Body.Close()
+		var res map[string]json.RawMessage
+		json.NewDecoder(resp.Body).Decode(&res)
+		return resp, res
+	}
+
+	resp, _ := post("intruder", `{"method":"getblockcount","params":[],"id":1}`)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+
+	resp, res := post(User, `{"method":"getblockcount","params":[],"id":1}`)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.JSONEq(`5`, string(res["result"]))
+	s.JSONEq(`1`, string(res["id"]))
+
+	resp, res = post(User, `{"method":"getblock","params":["00"],"id":2}`)
+	s.Equal(http.StatusInternalServerError, resp.StatusCode)
+	s.Contains(string(res["error"]), `"code":-8`)
+
+	resp, _ = post(User, `{"method":"stop","params":[],"id":3}`)
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+
+	// Verbosity can also be given as a boolean.
+	hash := s.chain[1].BlockHash().String()
+	_, res = post(User, `{"method":"getblock","params":["`+hash+`",false],"id":4}`)
+	var rawHex string
+	s.Require().NoError(json.Unmarshal(res["result"], &rawHex))
+	raw, err := hex.DecodeString(rawHex)
+	s.Require().NoError(err)
+	var msg wire.MsgBlock
+	s.Require().NoError(msg.Deserialize(bytes.NewReader(raw)))
+	s.Equal(s.chain[1].BlockHash(), msg.BlockHash())
+}
+
+func TestServerTestSuite(t *testing.T) {
+	suite.Run(t, new(ServerTestSuite))
+}
+
+// rpcErrorCode returns the code of a JSON-RPC error, or 0 if err isn't one.
+func rpcErrorCode(err error) btcjson.RPCErrorCode {
+	if rpcErr, ok := err.(*btcjson.RPCError); ok {
+		return rpcErr.Code
+	}
+	return 0
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client/cache"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/pool"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/retry"
+	"github.com/IlliniBlockchain/etl-bitcoin/database"
+	"github.com/IlliniBlockchain/etl-bitcoin/database/csv/neo4j_csv"
+	"github.com/IlliniBlockchain/etl-bitcoin/loader"
+	"github.com/btcsuite/btcd/chaincfg"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is prepended to a flag's name to find the environment variable that sets it.
+// e.g. the flag `--rpc-host` can be set through `ETL_BITCOIN_RPC_HOST`.
+const EnvPrefix = "ETL_BITCOIN_"
+
+// backend represents a database backend.
+type backend struct {
+	open database.DBConstructor
+	// options returns the options supported by the backend, each mapped to a value of its type.
+	options func() database.DBOptions
+}
+
+// backends maps database backend names to their constructors.
+var backends = map[string]backend{
+	"neo4j_csv": {neo4j_csv.NewDatabase, neo4j_csv.Options},
+}
+
+// Client names accepted by --client.
+const (
+	ClientRPC     = "rpc"
+	ClientREST    = "rest"
+	ClientBlkFile = "blkfile"
+	ClientReplay  = "replay"
+)
+
+// clientNames lists the supported clients.
+var clientNames = []string{ClientBlkFile, ClientReplay, ClientREST, ClientRPC}
+
+// networks maps network names to their parameters.
+var networks = map[string]*chaincfg.Params{
+	chaincfg.MainNetParams.Name:       &chaincfg.MainNetParams,
+	chaincfg.TestNet3Params.Name:      &chaincfg.TestNet3Params,
+	chaincfg.RegressionNetParams.Name: &chaincfg.RegressionNetParams,
+	chaincfg.SigNetParams.Name:        &chaincfg.SigNetParams,
+}
+
+// Config represents the settings shared by all commands.
+type Config struct {
+	// Client selects where blocks are read from.
+	Client  string        `yaml:"client"`
+	Network string        `yaml:"network"`
+	RPC     RPCConfig     `yaml:"rpc"`
+	BlkFile BlkFileConfig `yaml:"blkfile"`
+	Retry   RetryConfig   `yaml:"retry"`
+	Pool    PoolConfig    `yaml:"pool"`
+	Cache   CacheConfig   `yaml:"cache"`
+	Fixture FixtureConfig `yaml:"fixture"`
+	DB      DBConfig      `yaml:"db"`
+	Loader  LoaderConfig  `yaml:"loader"`
+}
+
+// RPCConfig represents the settings used to connect to a bitcoin node. The REST client uses the same settings
+// since Bitcoin Core serves its REST interface on the RPC port.
+type RPCConfig struct {
+	// Host is the address of the node, or a comma separated list of nodes that are used as a pool.
+	Host string `yaml:"host"`
+	User string `yaml:"user"`
+	Pass string `yaml:"pass"`
+	TLS  bool   `yaml:"tls"`
+	// Conns is the number of connections used to send batches concurrently.
+	Conns int `yaml:"conns"`
+	// RawBlocks makes the RPC client fetch serialized blocks and decode them itself.
+	RawBlocks bool `yaml:"raw_blocks"`
+}
+
+// BlkFileConfig represents the settings used to read blocks from the files of a stopped Bitcoin Core node.
+type BlkFileConfig struct {
+	// DataDir is the datadir of the network, e.g. `~/.bitcoin` for mainnet or `~/.bitcoin/regtest` for regtest.
+	DataDir string `yaml:"datadir"`
+}
+
+// RetryConfig represents how client calls failing with transient errors are retried.
+type RetryConfig struct {
+	// MaxRetries is the number of times a call is retried, 0 disables retries.
+	MaxRetries     int           `yaml:"max_retries"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+// PoolConfig represents how calls are spread over several nodes when more than one host is given.
+type PoolConfig struct {
+	// HealthInterval is the time between two health checks of every node, 0 disables background checks.
+	HealthInterval time.Duration `yaml:"health_interval"`
+	// MaxLag is the number of blocks a node may be behind the others before it stops receiving calls.
+	MaxLag int64 `yaml:"max_lag"`
+	// CallTimeout is the time a node is given to answer a call before the call is sent to another node,
+	// 0 disables the timeout.
+	CallTimeout time.Duration `yaml:"call_timeout"`
+}
+
+// CacheConfig represents the settings of the on-disk block cache.
+type CacheConfig struct {
+	// Dir is the directory holding the cached blocks, the cache is disabled when empty.
+	Dir string `yaml:"dir"`
+	// MaxMB is the size in MiB above which the least recently used blocks are evicted, 0 disables the limit.
+	MaxMB int64 `yaml:"max_mb"`
+}
+
+// FixtureConfig represents the settings used to record node responses into a fixture or replay them.
+type FixtureConfig struct {
+	// Dir is the fixture directory replayed by the replay client. With other clients, their responses are
+	// recorded into it unless it is empty.
+	Dir string `yaml:"dir"`
+}
+
+// DBConfig represents the settings used to construct a database connection.
+type DBConfig struct {
+	Backend string     `yaml:"backend"`
+	Out     string     `yaml:"out"`
+	Options optionsMap `yaml:"options"`
+}
+
+// LoaderConfig represents the settings used to construct a loader manager.
+type LoaderConfig struct {
+	// Prevouts makes the loader resolve the output spent by each input, like the "prevouts" loader option.
+	Prevouts bool       `yaml:"prevouts"`
+	Options  optionsMap `yaml:"options"`
+}
+
+// DefaultConfig returns the configuration used when no other value is given.
+func DefaultConfig() *Config {
+	return &Config{
+		Client:  ClientRPC,
+		Network: chaincfg.MainNetParams.Name,
+		RPC: RPCConfig{
+			Host:  "localhost:8332",
+			Conns: loader.DefaultMaxWorkers,
+		},
+		Retry: RetryConfig{
+			MaxRetries:     retry.DefaultMaxRetries,
+			InitialBackoff: retry.DefaultInitialBackoff,
+			MaxBackoff:     retry.DefaultMaxBackoff,
+		},
+		Pool: PoolConfig{
+			HealthInterval: pool.DefaultHealthCheckInterval,
+			MaxLag:         pool.DefaultMaxLag,
+			CallTimeout:    pool.DefaultCallTimeout,
+		},
+		Cache: CacheConfig{
+			MaxMB: cache.DefaultMaxBytes >> 20,
+		},
+		DB: DBConfig{
+			Backend: "neo4j_csv",
+			Options: make(optionsMap),
+		},
+		Loader: LoaderConfig{
+			Options: make(optionsMap),
+		},
+	}
+}
+
+// LoadFile merges the YAML config file at path into cfg.
+func (cfg *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	if cfg.DB.Options == nil {
+		cfg.DB.Options = make(optionsMap)
+	}
+	if cfg.Loader.Options == nil {
+		cfg.Loader.Options = make(optionsMap)
+	}
+	return nil
+}
+
+// BindFlags defines flags on fs that write into cfg. The current values of cfg are used as defaults.
+func (cfg *Config) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.Client, "client", cfg.Client, "where blocks are read from ("+strings.Join(clientNames, ", ")+")")
+	fs.StringVar(&cfg.Network, "network", cfg.Network, "bitcoin network ("+strings.Join(networkNames(), ", ")+")")
+	fs.StringVar(&cfg.RPC.Host, "rpc-host", cfg.RPC.Host, "bitcoin node RPC address (host:port), comma separated to spread calls over several nodes")
+	fs.StringVar(&cfg.RPC.User, "rpc-user", cfg.RPC.User, "bitcoin node RPC username")
+	fs.StringVar(&cfg.RPC.Pass, "rpc-pass", cfg.RPC.Pass, "bitcoin node RPC password")
+	fs.BoolVar(&cfg.RPC.TLS, "rpc-tls", cfg.RPC.TLS, "connect to the bitcoin node over TLS")
+	fs.IntVar(&cfg.RPC.Conns, "rpc-conns", cfg.RPC.Conns, "number of concurrent connections to the bitcoin node")
+	fs.BoolVar(&cfg.RPC.RawBlocks, "rpc-raw-blocks", cfg.RPC.RawBlocks, "fetch serialized blocks over RPC instead of verbose JSON")
+	fs.StringVar(&cfg.BlkFile.DataDir, "datadir", cfg.BlkFile.DataDir, "Bitcoin Core datadir read by the blkfile client")
+	fs.IntVar(&cfg.Retry.MaxRetries, "retry-max", cfg.Retry.MaxRetries, "number of times a client call failing with a transient error is retried (0 disables retries)")
+	fs.DurationVar(&cfg.Retry.InitialBackoff, "retry-backoff", cfg.Retry.InitialBackoff, "delay before the first retry, doubled after every retry")
+	fs.DurationVar(&cfg.Retry.MaxBackoff, "retry-max-backoff", cfg.Retry.MaxBackoff, "maximum delay between retries")
+	fs.DurationVar(&cfg.Pool.HealthInterval, "pool-health-interval", cfg.Pool.HealthInterval, "time between health checks of the nodes when several hosts are given (0 disables them)")
+	fs.Int64Var(&cfg.Pool.MaxLag, "pool-max-lag", cfg.Pool.MaxLag, "number of blocks a node may be behind the others before it stops receiving calls")
+	fs.DurationVar(&cfg.Pool.CallTimeout, "pool-call-timeout", cfg.Pool.CallTimeout, "time a node is given to answer before the call is sent to another node (0 disables it)")
+	fs.StringVar(&cfg.Cache.Dir, "cache-dir", cfg.Cache.Dir, "directory caching fetched blocks across runs (disabled when empty)")
+	fs.Int64Var(&cfg.Cache.MaxMB, "cache-max-mb", cfg.Cache.MaxMB, "size in MiB of the block cache above which blocks are evicted (0 disables the limit)")
+	fs.StringVar(&cfg.Fixture.Dir, "fixture-dir", cfg.Fixture.Dir, "fixture directory read by the replay client, or where the responses of other clients are recorded")
+	fs.StringVar(&cfg.DB.Backend, "db", cfg.DB.Backend, "database backend ("+strings.Join(backendNames(), ", ")+")")
+	fs.StringVar(&cfg.DB.Out, "out", cfg.DB.Out, "output directory for file based database backends")
+	fs.Var(cfg.DB.Options, "db-opt", "database option as key=value (repeatable)")
+	fs.BoolVar(&cfg.Loader.Prevouts, "prevouts", cfg.Loader.Prevouts, "resolve the output spent by each input (over RPC, needs Bitcoin Core 23 or -txindex)")
+	fs.Var(cfg.Loader.Options, "loader-opt", "loader option as key=value (repeatable)")
+}
+
+// Validate checks that cfg describes a usable configuration.
+func (cfg *Config) Validate() error {
+	if _, ok := networks[cfg.Network]; !ok {
+		return fmt.Errorf("unknown network %q (available: %s)", cfg.Network, strings.Join(networkNames(), ", "))
+	}
+	switch cfg.Client {
+	case ClientRPC, ClientREST:
+		for _, host := range cfg.RPC.Hosts() {
+			if host == "" {
+				return errors.New("rpc host must not be empty (set --rpc-host or " + envName("rpc-host") + ")")
+			}
+		}
+		if cfg.RPC.Conns < 1 {
+			return fmt.Errorf("rpc conns must be positive (got %d)", cfg.RPC.Conns)
+		}
+	case ClientBlkFile:
+		if cfg.BlkFile.DataDir == "" {
+			return errors.New("the blkfile client requires a datadir (set --datadir or " + envName("datadir") + ")")
+		}
+	case ClientReplay:
+		if cfg.Fixture.Dir == "" {
+			return errors.New("the replay client requires a fixture directory (set --fixture-dir or " + envName("fixture-dir") + ")")
+		}
+	default:
+		return fmt.Errorf("unknown client %q (available: %s)", cfg.Client, strings.Join(clientNames, ", "))
+	}
+	if cfg.Retry.MaxRetries < 0 {
+		return fmt.Errorf("retry max must not be negative (got %d)", cfg.Retry.MaxRetries)
+	}
+	if cfg.Retry.MaxRetries > 0 && (cfg.Retry.InitialBackoff <= 0 || cfg.Retry.MaxBackoff < cfg.Retry.InitialBackoff) {
+		return fmt.Errorf("retry backoff (%s) must be positive and at most the max backoff (%s)",
+			cfg.Retry.InitialBackoff, cfg.Retry.MaxBackoff)
+	}
+	if cfg.Pool.HealthInterval < 0 || cfg.Pool.MaxLag < 0 || cfg.Pool.CallTimeout < 0 {
+		return fmt.Errorf("pool health interval (%s), max lag (%d) and call timeout (%s) must not be negative",
+			cfg.Pool.HealthInterval, cfg.Pool.MaxLag, cfg.Pool.CallTimeout)
+	}
+	if cfg.Cache.MaxMB < 0 {
+		return fmt.Errorf("cache max mb must not be negative (got %d)", cfg.Cache.MaxMB)
+	}
+	if _, ok := backends[cfg.DB.Backend]; !ok {
+		return fmt.Errorf("unknown database backend %q (available: %s)", cfg.DB.Backend, strings.Join(backendNames(), ", "))
+	}
+	if _, err := cfg.DBOptions(); err != nil {
+		return err
+	}
+	if _, err := cfg.LoaderOptions(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Hosts returns the addresses of the nodes listed in Host.
+func (rpcCfg RPCConfig) Hosts() []string {
+	hosts := strings.Split(rpcCfg.Host, ",")
+	for i, host := range hosts {
+		hosts[i] = strings.TrimSpace(host)
+	}
+	return hosts
+}
+
+// DBOptions returns the options passed to the database constructor. Options given as strings are parsed as the
+// type the backend declares for them. The output directory and network are passed unless given as options.
+func (cfg *Config) DBOptions() (database.DBOptions, error) {
+	opts, err := database.ParseOpts(database.DBOptions(cfg.DB.Options), backends[cfg.DB.Backend].options())
+	if err != nil {
+		return nil, fmt.Errorf("%s database: %w", cfg.DB.Backend, err)
+	}
+	if _, ok := opts["dir"]; !ok && cfg.DB.Out != "" {
+		opts["dir"] = cfg.DB.Out
+	}
+	if _, ok := opts["network"]; !ok {
+		opts["network"] = cfg.Network
+	}
+	return opts, nil
+}
+
+// LoaderOptions returns the options passed to the loader manager. Options given as strings are parsed as the
+// type the loader declares for them.
+func (cfg *Config) LoaderOptions() (loader.LoaderOptions, error) {
+	opts, err := database.ParseOpts(database.DBOptions(cfg.Loader.Options), database.DBOptions(loader.Options()))
+	if err != nil {
+		return nil, fmt.Errorf("loader: %w", err)
+	}
+	if cfg.Loader.Prevouts {
+		opts["prevouts"] = true
+	}
+	return loader.LoaderOptions(opts), nil
+}
+
+// Prevouts reports whether the loader resolves the output spent by each input, with --prevouts or the
+// "prevouts" loader option.
+func (cfg *Config) Prevouts() bool {
+	opts, err := cfg.LoaderOptions()
+	if err != nil {
+		return false
+	}
+	prevouts, _ := loader.GetOpt(opts, "prevouts", false)
+	return prevouts
+}
+
+// parseArgs builds a Config from defaults, the config file, environment variables and args in increasing order
+// of precedence. bind may define additional command specific flags on the flag set.
+func parseArgs(name string, args []string, bind func(fs *flag.FlagSet)) (*Config, error) {
+	// First pass only looks for the config file so its values can be overridden by the environment and flags.
+	configPath := os.Getenv(envName("config"))
+	pre := newFlagSet(name, DefaultConfig(), bind, &configPath)
+	pre.SetOutput(io.Discard)
+	if err := pre.Parse(args); err != nil {
+		// Report parse errors with the real flag set below.
+		configPath = os.Getenv(envName("config"))
+	}
+
+	cfg := DefaultConfig()
+	if configPath != "" {
+		if err := cfg.LoadFile(configPath); err != nil {
+			return nil, err
+		}
+	}
+	fs := newFlagSet(name, cfg, bind, &configPath)
+	if err := applyEnv(fs); err != nil {
+		return nil, err
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func newFlagSet(name string, cfg *Config, bind func(fs *flag.FlagSet), configPath *string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(configPath, "config", *configPath, "path to a YAML config file")
+	cfg.BindFlags(fs)
+	if bind != nil {
+		bind(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: etl-bitcoin %s [flags]\n\nFlags:\n", name)
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nEvery flag can also be set through an environment variable, e.g. --rpc-host as %s.\n", envName("rpc-host"))
+	}
+	return fs
+}
+
+// applyEnv sets every flag in fs that has a matching environment variable.
+func applyEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" {
+			return
+		}
+		if val, ok := os.LookupEnv(envName(f.Name)); ok {
+			if setErr := fs.Set(f.Name, val); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %w", val, envName(f.Name), setErr)
+			}
+		}
+	})
+	return err
+}
+
+// envName returns the environment variable corresponding to a flag.
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// NetworkParams returns the parameters of the configured network.
+func (cfg *Config) NetworkParams() *chaincfg.Params {
+	return networks[cfg.Network]
+}
+
+func networkNames() []string {
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func backendNames() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// optionsMap is a map of arbitrary options that can be set from YAML or as repeated key=value flags. Values
+// given as flags are kept as strings and parsed once the type of the option is known, see Config.DBOptions.
+type optionsMap map[string]interface{}
+
+// String implements flag.Value.
+func (opts optionsMap) String() string {
+	keys := make([]string, 0, len(opts))
+	for key := range opts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%v", key, opts[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Set implements flag.Value. It accepts one or more comma separated key=value pairs.
+func (opts optionsMap) Set(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		key, val, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("option %q must be of the form key=value", pair)
+		}
+		opts[key] = strings.TrimSpace(val)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/database"
+	"github.com/IlliniBlockchain/etl-bitcoin/loader"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    *Config
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: DefaultConfig(),
+		},
+		{
+			name: "config_file",
+			args: []string{"--config", "testdata/config.yml"},
+			want: &Config{
+				Client:  ClientRPC,
+				Network: "mainnet",
+				RPC:     RPCConfig{Host: "node:18443", User: "test", Pass: "test", Conns: 4},
+				DB:      DBConfig{Backend: "neo4j_csv", Out: "./data", Options: optionsMap{"maxWorkers": 4}},
+				Retry:   RetryConfig{MaxRetries: 3, InitialBackoff: time.Second, MaxBackoff: time.Minute},
+				Pool:    PoolConfig{HealthInterval: 10 * time.Second, MaxLag: 5, CallTimeout: time.Minute},
+				Cache:   CacheConfig{Dir: "./cache", MaxMB: 512},
+				Loader:  LoaderConfig{Options: optionsMap{"batchSize": 100}},
+			},
+		},
+		{
+			name: "env_overrides_config_file",
+			args: []string{"--config", "testdata/config.yml"},
+			env:  map[string]string{"ETL_BITCOIN_RPC_HOST": "env:8332", "ETL_BITCOIN_DB_OPT": "maxWorkers=2,blocks=b.csv"},
+			want: &Config{
+				Client:  ClientRPC,
+				Network: "mainnet",
+				RPC:     RPCConfig{Host: "env:8332", User: "test", Pass: "test", Conns: 4},
+				DB:      DBConfig{Backend: "neo4j_csv", Out: "./data", Options: optionsMap{"maxWorkers": "2", "blocks": "b.csv"}},
+				Retry:   RetryConfig{MaxRetries: 3, InitialBackoff: time.Second, MaxBackoff: time.Minute},
+				Pool:    PoolConfig{HealthInterval: 10 * time.Second, MaxLag: 5, CallTimeout: time.Minute},
+				Cache:   CacheConfig{Dir: "./cache", MaxMB: 512},
+				Loader:  LoaderConfig{Options: optionsMap{"batchSize": 100}},
+			},
+		},
+		{
+			name: "flags_override_env",
+			args: []string{"--rpc-host", "flag:8332", "--rpc-raw-blocks", "--prevouts", "--loader-opt", "batchSize=10"},
+			env:  map[string]string{"ETL_BITCOIN_RPC_HOST": "env:8332", "ETL_BITCOIN_CONFIG": "testdata/config.yml"},
+			want: &Config{
+				Client:  ClientRPC,
+				Network: "mainnet",
+				RPC:     RPCConfig{Host: "flag:8332", User: "test", Pass: "test", Conns: 4, RawBlocks: true},
+				DB:      DBConfig{Backend: "neo4j_csv", Out: "./data", Options: optionsMap{"maxWorkers": 4}},
+				Retry:   RetryConfig{MaxRetries: 3, InitialBackoff: time.Second, MaxBackoff: time.Minute},
+				Pool:    PoolConfig{HealthInterval: 10 * time.Second, MaxLag: 5, CallTimeout: time.Minute},
+				Cache:   CacheConfig{Dir: "./cache", MaxMB: 512},
+				Loader:  LoaderConfig{Prevouts: true, Options: optionsMap{"batchSize": "10"}},
+			},
+		},
+		{
+			name: "blkfile_client",
+			args: []string{"--client", "blkfile", "--datadir", "/data/regtest", "--network", "regtest"},
+			want: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Client = ClientBlkFile
+				cfg.Network = "regtest"
+				cfg.BlkFile.DataDir = "/data/regtest"
+				return cfg
+			}(),
+		},
+		{
+			name: "node_pool",
+			args: []string{"--rpc-host", "node1:8332, node2:8332", "--pool-max-lag", "0"},
+			want: func() *Config {
+				cfg := DefaultConfig()
+				cfg.RPC.Host = "node1:8332, node2:8332"
+				cfg.Pool.MaxLag = 0
+				return cfg
+			}(),
+		},
+		{
+			name: "block_cache",
+			args: []string{"--cache-dir", "/tmp/blocks", "--cache-max-mb", "0"},
+			want: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Cache = CacheConfig{Dir: "/tmp/blocks"}
+				return cfg
+			}(),
+		},
+		{
+			name:    "negative_cache_max_mb",
+			args:    []string{"--cache-max-mb", "-1"},
+			wantErr: true,
+		},
+		{
+			name: "replay_client",
+			args: []string{"--client", "replay", "--fixture-dir", "testdata/fixture"},
+			want: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Client = ClientReplay
+				cfg.Fixture.Dir = "testdata/fixture"
+				return cfg
+			}(),
+		},
+		{
+			name:    "replay_client_without_fixture",
+			args:    []string{"--client", "replay"},
+			wantErr: true,
+		},
+		{
+			name:    "empty_pool_host",
+			args:    []string{"--rpc-host", "node1:8332,"},
+			wantErr: true,
+		},
+		{
+			name:    "negative_pool_max_lag",
+			args:    []string{"--pool-max-lag", "-1"},
+			wantErr: true,
+		},
+		{
+			name:    "negative_pool_call_timeout",
+			args:    []string{"--pool-call-timeout", "-1s"},
+			wantErr: true,
+		},
+		{
+			name:    "rest_client_without_host",
+			args:    []string{"--client", "rest", "--rpc-host", ""},
+			wantErr: true,
+		},
+		{
+			name:    "blkfile_client_without_datadir",
+			args:    []string{"--client", "blkfile"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown_client",
+			args:    []string{"--client", "electrum"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown_network",
+			args:    []string{"--network", "litecoin"},
+			wantErr: true,
+		},
+		{
+			name: "retries_disabled",
+			args: []string{"--retry-max", "0", "--retry-backoff", "0s"},
+			want: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Retry.MaxRetries = 0
+				cfg.Retry.InitialBackoff = 0
+				return cfg
+			}(),
+		},
+		{
+			name:    "invalid_retry_backoff",
+			args:    []string{"--retry-backoff", "1m", "--retry-max-backoff", "1s"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown_backend",
+			args:    []string{"--db", "mongo"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid_conns",
+			args:    []string{"--rpc-conns", "0"},
+			wantErr: true,
+		},
+		{
+			name:    "missing_config_file",
+			args:    []string{"--config", "testdata/missing.yml"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid_option",
+			args:    []string{"--db-opt", "maxWorkers"},
+			wantErr: true,
+		},
+		{
+			name:    "unexpected_argument",
+			args:    []string{"extra"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, val := range tt.env {
+				t.Setenv(key, val)
+			}
+			got, err := parseArgs("test", tt.args, nil)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseArgsCommandFlags(t *testing.T) {
+	args := &exportArgs{from: 0, to: -1}
+	t.Setenv("ETL_BITCOIN_FROM", "5")
+	_, err := parseArgs("export", []string{"--to", "10", "--resume"}, args.bind)
+	assert.NoError(t, err)
+	assert.Equal(t, &exportArgs{from: 5, to: 10, resume: true}, args)
+
+	_, err = parseArgs("export", []string{"-h"}, args.bind)
+	assert.ErrorIs(t, err, flag.ErrHelp)
+}
+
+func TestExportArgsValidate(t *testing.T) {
+	assert.NoError(t, (&exportArgs{from: 0, to: 100}).validate())
+	assert.Error(t, (&exportArgs{from: -1, to: 100}).validate())
+	assert.Error(t, (&exportArgs{from: 0, to: -1}).validate())
+	assert.Error(t, (&exportArgs{from: 10, to: 5}).validate())
+}
+
+func TestFollowArgsValidate(t *testing.T) {
+	assert.NoError(t, (&followArgs{confirmations: 6, pollInterval: time.Second}).validate())
+	assert.Error(t, (&followArgs{confirmations: -1, pollInterval: time.Second}).validate())
+	assert.Error(t, (&followArgs{confirmations: 6, pollInterval: 0}).validate())
+}
+
+func TestMempoolArgsValidate(t *testing.T) {
+	assert.NoError(t, (&mempoolArgs{interval: time.Minute}).validate())
+	assert.NoError(t, (&mempoolArgs{interval: time.Minute, snapshots: 3}).validate())
+	assert.Error(t, (&mempoolArgs{interval: 0}).validate())
+	assert.Error(t, (&mempoolArgs{interval: time.Minute, snapshots: -1}).validate())
+}
+
+func TestRPCConfigHosts(t *testing.T) {
+	assert.Equal(t, []string{"localhost:8332"}, RPCConfig{Host: "localhost:8332"}.Hosts())
+	assert.Equal(t, []string{"node1:8332", "node2:8332"}, RPCConfig{Host: "node1:8332, node2:8332"}.Hosts())
+}
+
+func TestConfigDBOptions(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DB.Out = "data"
+	cfg.DB.Options["maxWorkers"] = 2
+	opts, err := cfg.DBOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, database.DBOptions{"dir": "data", "maxWorkers": 2, "network": "mainnet"}, opts)
+
+	cfg.DB.Options["dir"] = "other"
+	cfg.Network = "regtest"
+	opts, err = cfg.DBOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, database.DBOptions{"dir": "other", "maxWorkers": 2, "network": "regtest"}, opts)
+}
+
+func TestConfigOptionsParsedByType(t *testing.T) {
+	cfg, err := parseArgs("test", []string{
+		"--db-opt", "maxWorkers=2,blocks=2023,addressIndex=true",
+		"--loader-opt", "resume=1,batchSize=10",
+	}, nil)
+	assert.NoError(t, err)
+	dbOpts, err := cfg.DBOptions()
+	assert.NoError(t, err)
+	// Values that look like numbers or booleans stay strings for string options.
+	assert.Equal(t, database.DBOptions{"maxWorkers": 2, "blocks": "2023", "addressIndex": "true", "network": "mainnet"}, dbOpts)
+	loaderOpts, err := cfg.LoaderOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, loader.LoaderOptions{"resume": true, "batchSize": 10}, loaderOpts)
+
+	_, err = parseArgs("test", []string{"--loader-opt", "batchSize=ten"}, nil)
+	assert.ErrorContains(t, err, `invalid value "ten" for option "batchSize"`)
+	_, err = parseArgs("test", []string{"--db-opt", "maxWorker=2"}, nil)
+	assert.ErrorContains(t, err, `unknown option "maxWorker"`)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/loader"
+)
+
+// exportArgs represents the flags specific to the export command.
+type exportArgs struct {
+	from   int64
+	to     int64
+	resume bool
+}
+
+func (args *exportArgs) bind(fs *flag.FlagSet) {
+	fs.Int64Var(&args.from, "from", args.from, "first block height to export")
+	fs.Int64Var(&args.to, "to", args.to, "last block height to export (inclusive)")
+	fs.BoolVar(&args.resume, "resume", args.resume, "skip blocks already in the database instead of refusing to export them again")
+}
+
+func (args *exportArgs) validate() error {
+	if args.from < 0 {
+		return fmt.Errorf("--from must not be negative (got %d)", args.from)
+	}
+	if args.to < 0 {
+		return fmt.Errorf("--to is required")
+	}
+	if args.to < args.from {
+		return fmt.Errorf("--to (%d) must be greater than or equal to --from (%d)", args.to, args.from)
+	}
+	return nil
+}
+
+// runExport exports a range of blocks from a bitcoin node into a database.
+func runExport(argv []string) error {
+	args := &exportArgs{from: 0, to: -1}
+	cfg, err := parseArgs("export", argv, args.bind)
+	if err != nil {
+		return err
+	}
+	if err := args.validate(); err != nil {
+		return err
+	}
+
+	if args.resume {
+		cfg.Loader.Options["resume"] = true
+	}
+
+	// An interrupt stops the pipeline: batches being fetched are dropped and committed batches are kept.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	p, err := openPipeline(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	log.Printf("exporting blocks %d to %d into %s", args.from, args.to, cfg.DB.Backend)
+	err = p.loader.SendInput(loader.BlockRange{Start: args.from, End: args.to})
+	// The first error is reported: a failed close after a failed export is a consequence of it.
+	if closeErr := p.close(); err == nil {
+		err = closeErr
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted, export again with --resume to continue: %w", ctx.Err())
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/chaingen"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/rpc/rpctest"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunExport(t *testing.T) {
+	chain := rpctest.NewChain(&chaincfg.RegressionNetParams, 12, 3)
+	node1 := rpctest.NewServer(&chaincfg.RegressionNetParams, chain)
+	defer node1.Close()
+	node2 := rpctest.NewServer(&chaincfg.RegressionNetParams, chain)
+	defer node2.Close()
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"rpc", []string{"--rpc-host", node1.Host()}},
+		{"rpc_raw_blocks", []string{"--rpc-host", node1.Host(), "--rpc-raw-blocks"}},
+		{"pool", []string{"--rpc-host", node1.Host() + "," + node2.Host(), "--pool-health-interval", "0"}},
+	}
+	outputs := make([]map[string][]string, len(tests))
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := t.TempDir()
+			args := append([]string{
+				"--network", "regtest",
+				"--rpc-user", rpctest.User,
+				"--rpc-pass", rpctest.Pass,
+				"--from", "0",
+				"--to", "12",
+				"--out", out,
+				"--loader-opt", "batchSize=5",
+			}, tt.args...)
+			require.NoError(t, runExport(args))
+			outputs[i] = readDir(t, out)
+
+			assert.Len(t, outputs[i]["blocks.csv"], 1+13)
+			assert.Contains(t, strings.Join(outputs[i]["blocks.csv"], "\n"), chain[12].BlockHash().String())
+			assert.Contains(t, strings.Join(outputs[i]["transactions.csv"], "\n"), chain[7].Transactions[2].TxHash().String())
+		})
+	}
+	// Every client produces the same database, though rows may be written in a different order.
+	for i := range tests[1:] {
+		assert.Equal(t, outputs[0], outputs[i+1], tests[i+1].name)
+	}
+}
+
+func TestRunExportPrevouts(t *testing.T) {
+	generated, err := chaingen.Generate(chaingen.DefaultConfig(), 110)
+	require.NoError(t, err)
+	chain := make([]*wire.MsgBlock, len(generated))
+	for i, blk := range generated {
+		chain[i] = blk.MsgBlock
+	}
+	node := rpctest.NewServer(&chaincfg.RegressionNetParams, chain)
+	defer node.Close()
+	args := []string{
+		"--network", "regtest",
+		"--rpc-host", node.Host(),
+		"--rpc-user", rpctest.User,
+		"--rpc-pass", rpctest.Pass,
+		"--retry-max", "0",
+		"--from", "0",
+		"--to", "110",
+		"--prevouts",
+	}
+
+	// Prevouts are given with the blocks by nodes since Bitcoin Core 23.
+	require.NoError(t, runExport(append(args, "--out", t.TempDir())))
+
+	// Older nodes need -txindex to look them up.
+	node.SetLegacyVerbosity(true)
+	err = runExport(append(args, "--out", t.TempDir()))
+	assert.ErrorContains(t, err, "-txindex")
+	node.SetTxIndex(true)
+	require.NoError(t, runExport(append(args, "--out", t.TempDir())))
+}
+
+func TestRunExportInterrupted(t *testing.T) {
+	node := rpctest.NewServer(&chaincfg.RegressionNetParams, rpctest.NewChain(&chaincfg.RegressionNetParams, 12, 1))
+	defer node.Close()
+	node.SetLatency(time.Minute)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runExport([]string{
+			"--network", "regtest",
+			"--rpc-host", node.Host(),
+			"--rpc-user", rpctest.User,
+			"--rpc-pass", rpctest.Pass,
+			"--retry-max", "0",
+			"--from", "0",
+			"--to", "12",
+			"--out", t.TempDir(),
+		})
+	}()
+	// The signal is only sent once the export is waiting for the node, so that it is caught by runExport.
+	require.Eventually(t, func() bool { return node.Requests() > 0 }, 10*time.Second, time.Millisecond)
+	self, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, self.Signal(os.Interrupt))
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.ErrorContains(t, err, "--resume")
+	case <-time.After(10 * time.Second):
+		t.Fatal("export wasn't interrupted")
+	}
+}
+
+// readDir returns the lines of the files in dir by name, sorted. Directories such as the address index of the
+// neo4j_csv database are skipped.
+func readDir(t *testing.T, dir string) map[string][]string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	files := make(map[string][]string, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		require.NoError(t, err)
+		lines := strings.FieldsFunc(string(data), func(r rune) bool { return r == '\r' || r == '\n' })
+		sort.Strings(lines)
+		files[entry.Name()] = lines
+	}
+	return files
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// followArgs represents the flags specific to the follow command.
+type followArgs struct {
+	confirmations int64
+	pollInterval  time.Duration
+}
+
+func (args *followArgs) bind(fs *flag.FlagSet) {
+	fs.Int64Var(&args.confirmations, "confirmations", args.confirmations, "number of blocks a block must be buried under before it is loaded")
+	fs.DurationVar(&args.pollInterval, "poll-interval", args.pollInterval, "how often the node is polled for new blocks")
+}
+
+func (args *followArgs) validate() error {
+	if args.confirmations < 0 {
+		return fmt.Errorf("--confirmations must not be negative (got %d)", args.confirmations)
+	}
+	if args.pollInterval <= 0 {
+		return fmt.Errorf("--poll-interval must be positive (got %v)", args.pollInterval)
+	}
+	return nil
+}
+
+// runFollow loads new blocks into a database as they are mined until interrupted.
+func runFollow(argv []string) error {
+	args := &followArgs{confirmations: 6, pollInterval: 30 * time.Second}
+	cfg, err := parseArgs("follow", argv, args.bind)
+	if err != nil {
+		return err
+	}
+	if err := args.validate(); err != nil {
+		return err
+	}
+
+	p, err := openPipeline(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("following chain tip from block %d with %d confirmations into %s", p.loader.NextHeight(), args.confirmations, cfg.DB.Backend)
+	err = p.loader.Follow(ctx, args.confirmations, args.pollInterval)
+	if err == nil {
+		log.Printf("stopping: committing blocks in progress")
+	}
+	if closeErr := p.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -1,39 +1,57 @@
 package main
 
 import (
-	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-
-	rpc "github.com/IlliniBlockchain/etl-bitcoin/client/rpc"
-	"github.com/IlliniBlockchain/etl-bitcoin/database/csv/neo4j_csv"
-	"github.com/IlliniBlockchain/etl-bitcoin/loader"
-	rpcclient "github.com/btcsuite/btcd/rpcclient"
+	"os"
 )
 
+// command represents a subcommand of the etl-bitcoin CLI.
+type command struct {
+	name  string
+	short string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"export", "export a range of blocks from a bitcoin node into a database", runExport},
+	{"follow", "load new blocks into a database as they are mined until interrupted", runFollow},
+	{"mempool", "load snapshots of the mempool of a bitcoin node into a database", runMempool},
+}
+
 func main() {
-	client, err := rpc.New(&rpcclient.ConnConfig{
-		Host:         "localhost:18443",
-		User:         "test",
-		Pass:         "test",
-		HTTPPostMode: true, // Bitcoin core only supports HTTP POST mode
-		DisableTLS:   true, // Bitcoin core does not provide TLS by default
-	}, nil)
-	if err != nil {
-		log.Fatal(err)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
 	}
-	defer client.Shutdown()
-
-	db, err := neo4j_csv.NewDatabase(context.Background(), nil)
-	if err != nil {
-		log.Fatal(err)
+	name, args := os.Args[1], os.Args[2:]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
 	}
-	defer db.Close()
-
-	loaderManager, err := loader.NewLoaderManager(context.Background(), client, db, nil)
-	if err != nil {
-		log.Fatal(err)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			log.Fatalf("%s: %v", name, err)
+		}
+		return
 	}
-	defer loaderManager.Close()
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
 
-	loaderManager.SendInput(loader.BlockRange{Start: 0, End: 100}, nil)
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: etl-bitcoin <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'etl-bitcoin <command> -h' for the flags of a command.\n")
 }
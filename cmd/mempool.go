@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// mempoolArgs represents the flags specific to the mempool command.
+type mempoolArgs struct {
+	interval  time.Duration
+	snapshots int
+}
+
+func (args *mempoolArgs) bind(fs *flag.FlagSet) {
+	fs.DurationVar(&args.interval, "interval", args.interval, "how often the mempool is snapshotted")
+	fs.IntVar(&args.snapshots, "snapshots", args.snapshots, "number of snapshots to take (0: until interrupted)")
+}
+
+func (args *mempoolArgs) validate() error {
+	if args.interval <= 0 {
+		return fmt.Errorf("--interval must be positive (got %v)", args.interval)
+	}
+	if args.snapshots < 0 {
+		return fmt.Errorf("--snapshots must not be negative (got %d)", args.snapshots)
+	}
+	return nil
+}
+
+// runMempool loads snapshots of the node's mempool into a database until interrupted.
+func runMempool(argv []string) error {
+	args := &mempoolArgs{interval: time.Minute}
+	cfg, err := parseArgs("mempool", argv, args.bind)
+	if err != nil {
+		return err
+	}
+	if err := args.validate(); err != nil {
+		return err
+	}
+
+	p, err := openPipeline(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("snapshotting mempool every %v into %s", args.interval, cfg.DB.Backend)
+	err = p.loader.SnapshotMempool(ctx, args.interval, args.snapshots)
+	if closeErr := p.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/chaingen"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/rpc/rpctest"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMempool(t *testing.T) {
+	config := chaingen.DefaultConfig()
+	config.CoinbaseMaturity = 1
+	generated, err := chaingen.Generate(config, 10)
+	require.NoError(t, err)
+	chain := make([]*wire.MsgBlock, len(generated)-1)
+	for i := range chain {
+		chain[i] = generated[i].MsgBlock
+	}
+	// The transactions of the last generated block wait in the mempool.
+	node := rpctest.NewServer(&chaincfg.RegressionNetParams, chain)
+	defer node.Close()
+	mempool := generated[10].Transactions[1:]
+	node.SetMempool(mempool)
+
+	out := t.TempDir()
+	require.NoError(t, runMempool([]string{
+		"--network", "regtest",
+		"--rpc-host", node.Host(),
+		"--rpc-user", rpctest.User,
+		"--rpc-pass", rpctest.Pass,
+		"--interval", "10ms",
+		"--snapshots", "2",
+		"--out", out,
+	}))
+	files := readDir(t, out)
+	assert.Len(t, files["mempool.csv"], 1+2*len(mempool))
+	rows := strings.Join(files["mempool.csv"], "\n")
+	for _, tx := range mempool {
+		assert.Equal(t, 2, strings.Count(rows, tx.TxHash().String()+","), tx.TxHash())
+	}
+	// Unconfirmed transactions aren't loaded as part of a block.
+	assert.Empty(t, files["transactions.csv"])
+}
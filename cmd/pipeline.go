@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/blkfile"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/cache"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/pool"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/replay"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/rest"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/retry"
+	rpc "github.com/IlliniBlockchain/etl-bitcoin/client/rpc"
+	"github.com/IlliniBlockchain/etl-bitcoin/database"
+	"github.com/IlliniBlockchain/etl-bitcoin/loader"
+	rpcclient "github.com/btcsuite/btcd/rpcclient"
+)
+
+// pipeline holds the client, database and loader manager used by a command.
+type pipeline struct {
+	client   client.Client
+	shutdown func()
+	retry    *retry.Client
+	cache    *cache.Client
+	recorder *replay.Recorder
+	db       database.Database
+	loader   *loader.LoaderManager
+}
+
+// openPipeline connects to the bitcoin node and database described by cfg and starts a loader manager.
+func openPipeline(ctx context.Context, cfg *Config) (*pipeline, error) {
+	dbOpts, err := cfg.DBOptions()
+	if err != nil {
+		return nil, err
+	}
+	loaderOpts, err := cfg.LoaderOptions()
+	if err != nil {
+		return nil, err
+	}
+	p := &pipeline{}
+	p.client, p.shutdown, err = newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Retry.MaxRetries > 0 {
+		p.retry = retry.New(p.client, retry.Config{
+			MaxRetries:     cfg.Retry.MaxRetries,
+			InitialBackoff: cfg.Retry.InitialBackoff,
+			MaxBackoff:     cfg.Retry.MaxBackoff,
+		})
+		p.client = p.retry
+	}
+	// The cache wraps the retrying client so cached blocks are served without any call to the node.
+	if cfg.Cache.Dir != "" {
+		p.cache, err = cache.New(p.client, cache.Config{Dir: cfg.Cache.Dir, MaxBytes: cfg.Cache.MaxMB << 20})
+		if err != nil {
+			p.shutdown()
+			return nil, err
+		}
+		p.client = p.cache
+	}
+	// The recorder comes last so blocks served by the cache are recorded too.
+	if cfg.Client != ClientReplay && cfg.Fixture.Dir != "" {
+		p.recorder, err = replay.NewRecorder(p.client, cfg.Fixture.Dir)
+		if err != nil {
+			p.shutdown()
+			return nil, err
+		}
+		p.client = p.recorder
+	}
+	p.db, err = backends[cfg.DB.Backend].open(ctx, dbOpts)
+	if err != nil {
+		p.shutdown()
+		return nil, fmt.Errorf("opening %s database: %w", cfg.DB.Backend, err)
+	}
+	p.loader, err = loader.NewLoaderManager(ctx, p.client, p.db, loaderOpts)
+	if err != nil {
+		p.db.Close()
+		p.shutdown()
+		return nil, err
+	}
+	return p, nil
+}
+
+// close waits for the loader manager to commit everything sent to it and closes all connections.
+// It returns the first error encountered.
+func (p *pipeline) close() error {
+	err := p.loader.Close()
+	if dbErr := p.db.Close(); err == nil && dbErr != nil {
+		err = fmt.Errorf("closing database: %w", dbErr)
+	}
+	if p.recorder != nil {
+		if recErr := p.recorder.Close(); err == nil && recErr != nil {
+			err = fmt.Errorf("closing fixture: %w", recErr)
+		}
+	}
+	p.shutdown()
+	if p.retry != nil {
+		stats := p.retry.Stats()
+		log.Printf("client calls: %d, retries: %d, failures: %d\n", stats.Calls, stats.Retries, stats.Failures)
+	}
+	if p.cache != nil {
+		stats := p.cache.Stats()
+		log.Printf("block cache hits: %d, misses: %d, evictions: %d, size: %d MiB\n",
+			stats.Hits, stats.Misses, stats.Evictions, p.cache.Size()>>20)
+	}
+	return err
+}
+
+// newClient connects to the bitcoin node described by cfg, or to a pool of nodes when several hosts are given.
+// The returned function shuts the client down.
+func newClient(cfg *Config) (client.Client, func(), error) {
+	if cfg.Client == ClientBlkFile {
+		blkClient, err := blkfile.New(cfg.BlkFile.DataDir, cfg.NetworkParams())
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening datadir %s: %w", cfg.BlkFile.DataDir, err)
+		}
+		return blkClient, blkClient.Shutdown, nil
+	}
+	if cfg.Client == ClientReplay {
+		replayClient, err := replay.New(cfg.Fixture.Dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return replayClient, func() {}, nil
+	}
+	hosts := cfg.RPC.Hosts()
+	if len(hosts) == 1 {
+		return newNodeClient(cfg, hosts[0])
+	}
+	nodes := make([]pool.Node, 0, len(hosts))
+	shutdowns := make([]func(), 0, len(hosts))
+	shutdown := func() {
+		for _, f := range shutdowns {
+			f()
+		}
+	}
+	for _, host := range hosts {
+		c, f, err := newNodeClient(cfg, host)
+		if err != nil {
+			shutdown()
+			return nil, nil, err
+		}
+		nodes = append(nodes, pool.Node{Name: host, Client: c})
+		shutdowns = append(shutdowns, f)
+	}
+	poolClient, err := pool.New(nodes, pool.Config{
+		HealthCheckInterval: cfg.Pool.HealthInterval,
+		MaxLag:              cfg.Pool.MaxLag,
+		CallTimeout:         cfg.Pool.CallTimeout,
+	})
+	if err != nil {
+		shutdown()
+		return nil, nil, fmt.Errorf("connecting to %s: %w", cfg.RPC.Host, err)
+	}
+	return poolClient, func() {
+		poolClient.Close()
+		shutdown()
+	}, nil
+}
+
+// newNodeClient connects to the node at host with the REST or RPC client selected by cfg.
+func newNodeClient(cfg *Config, host string) (client.Client, func(), error) {
+	if cfg.Client == ClientREST {
+		scheme := "http://"
+		if cfg.RPC.TLS {
+			scheme = "https://"
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = cfg.RPC.Conns
+		restClient, err := rest.New(scheme+host, &http.Client{Transport: transport}, cfg.NetworkParams())
+		if err != nil {
+			return nil, nil, err
+		}
+		return restClient, restClient.Shutdown, nil
+	}
+	rpcClient, err := rpc.NewWithConns(&rpcclient.ConnConfig{
+		Host:         host,
+		User:         cfg.RPC.User,
+		Pass:         cfg.RPC.Pass,
+		HTTPPostMode: true,         // Bitcoin core only supports HTTP POST mode
+		DisableTLS:   !cfg.RPC.TLS, // Bitcoin core does not provide TLS by default
+	}, cfg.RPC.Conns)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connecting to %s: %w", host, err)
+	}
+	if cfg.RPC.RawBlocks {
+		rpcClient.EnableRawBlocks(cfg.NetworkParams())
+	}
+	if cfg.Prevouts() {
+		rpcClient.EnablePrevouts()
+	}
+	return rpcClient, rpcClient.Shutdown, nil
+}
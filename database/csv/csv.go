@@ -117,14 +117,11 @@ func (db *CSVDatabase) insert(msg *CSVInsertMsg) error {
 		return err
 	}
 
-	records := make([][]string, 0, len(msg.records)+1)
-	if !csvFile.hasHeader {
-		records = append(records, msg.records[0].Headers())
-	}
+	records := make([][]string, 0, len(msg.records))
 	for _, record := range msg.records {
 		records = append(records, record.Row())
 	}
-	if err := csvFile.writeAll(records); err != nil {
+	if err := csvFile.writeAll(msg.records[0].Headers(), records); err != nil {
 		return err
 	}
 	return nil
@@ -140,6 +137,25 @@ func (db *CSVDatabase) read(msg *CSVReadMsg) error {
 	return err
 }
 
+func (db *CSVDatabase) delete(msg *CSVDeleteMsg) error {
+	csvFile, err := db.loadFile(msg.FileKey())
+	if err != nil {
+		return err
+	}
+
+	msg.Deleted, err = csvFile.deleteWhere(msg.match)
+	return err
+}
+
+func (db *CSVDatabase) scan(msg *CSVScanMsg) error {
+	csvFile, err := db.loadFile(msg.FileKey())
+	if err != nil {
+		return err
+	}
+
+	return csvFile.scan(msg.fn)
+}
+
 func (db *CSVDatabase) csvWorker() error {
 	for msg := range db.msgs {
 		switch msg := msg.(type) {
@@ -147,6 +163,10 @@ func (db *CSVDatabase) csvWorker() error {
 			msg.finish(db.insert(msg))
 		case *CSVReadMsg:
 			msg.finish(db.read(msg))
+		case *CSVDeleteMsg:
+			msg.finish(db.delete(msg))
+		case *CSVScanMsg:
+			msg.finish(db.scan(msg))
 		default:
 			return fmt.Errorf("unknown message type %T", msg)
 		}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"math"
 	"os"
+	"path/filepath"
 	"sync"
 )
 
@@ -54,13 +55,17 @@ func (cf *csvFile) close() error {
 	return cf.f.Close()
 }
 
-func (cf *csvFile) writeAll(records [][]string) error {
+// writeAll appends records to the file, preceded by header if the file is empty.
+func (cf *csvFile) writeAll(header []string, records [][]string) error {
 	cf.mu.Lock()
 	defer cf.mu.Unlock()
 	f, err := cf.file()
 	if err != nil {
 		return err
 	}
+	if !cf.hasHeader {
+		records = append([][]string{header}, records...)
+	}
 	w := csv.NewWriter(f)
 	w.UseCRLF = true
 	if err := w.WriteAll(records); err != nil {
@@ -153,3 +158,109 @@ func (cf *csvFile) setLine(line int) error {
 	cf.lastLinePos = r.InputOffset()
 	return nil
 }
+
+// scan calls fn with every record (excluding the header) in order until it returns false.
+func (cf *csvFile) scan(fn func(record []string) bool) error {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	f, err := cf.file()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// The cached position of sequential reads is lost by reading from the start.
+	cf.lastLineRead = 0
+	cf.lastLinePos = 0
+
+	r := csv.NewReader(f)
+	r.ReuseRecord = true
+	for line := 0; ; line++ {
+		record, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if line == 0 && cf.hasHeader {
+			continue
+		}
+		if !fn(record) {
+			return nil
+		}
+	}
+}
+
+// deleteWhere removes every record (excluding the header) for which match returns true by rewriting the file.
+// It returns the number of deleted records.
+func (cf *csvFile) deleteWhere(match func(record []string) bool) (int, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	f, err := cf.file()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cf.filePath), filepath.Base(cf.filePath)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	// CreateTemp creates the file with mode 0600: the rewritten file keeps the mode of the original.
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return 0, err
+	}
+
+	r := csv.NewReader(f)
+	w := csv.NewWriter(tmp)
+	w.UseCRLF = true
+	deleted := 0
+	for line := 0; ; line++ {
+		record, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, err
+		}
+		if (line > 0 || !cf.hasHeader) && match(record) {
+			deleted++
+			continue
+		}
+		if err := w.Write(record); err != nil {
+			return 0, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return 0, err
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	// Swap the rewritten file in and reopen it.
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	cf.f = nil
+	cf.lastLineRead = 0
+	cf.lastLinePos = 0
+	if err := os.Rename(tmp.Name(), cf.filePath); err != nil {
+		return 0, err
+	}
+	_, err = cf.file()
+	return deleted, err
+}
@@ -83,3 +83,36 @@ func NewCSVReadMsg(fileKey string, line, limit int) *CSVReadMsg {
 		limit:  limit,
 	}
 }
+
+// CSVDeleteMsg represents a message to delete the records of a CSV file matching a predicate.
+type CSVDeleteMsg struct {
+	CSVMsg
+	match func(record []string) bool
+	// Deleted is the number of records deleted.
+	Deleted int
+}
+
+// NewCSVDeleteMsg creates a new `CSVDeleteMsg`. Records (excluding the header) for which match
+// returns true are deleted.
+func NewCSVDeleteMsg(fileKey string, match func(record []string) bool) *CSVDeleteMsg {
+	return &CSVDeleteMsg{
+		CSVMsg: NewBaseCSVMsg(fileKey),
+		match:  match,
+	}
+}
+
+// CSVScanMsg represents a message to read the records of a CSV file one at a time, without loading the file
+// into memory.
+type CSVScanMsg struct {
+	CSVMsg
+	fn func(record []string) bool
+}
+
+// NewCSVScanMsg creates a new `CSVScanMsg`. fn is called with every record (excluding the header) in order
+// until it returns false. The record is reused between calls so it must be copied to be retained.
+func NewCSVScanMsg(fileKey string, fn func(record []string) bool) *CSVScanMsg {
+	return &CSVScanMsg{
+		CSVMsg: NewBaseCSVMsg(fileKey),
+		fn:     fn,
+	}
+}
@@ -259,6 +259,64 @@ func (s *CSVDatabaseTestSuite) TestSequentialRead() {
 	s.Equal([][]string{testRow2.Row()}, msg2.Records)
 }
 
+func (s *CSVDatabaseTestSuite) TestDelete() {
+	s.NoError(s.db.SendMsg(NewCSVInsertMsg("basic_test", []CSVRecord{testRow1, testRow2})))
+
+	deleteMsg := NewCSVDeleteMsg("basic_test", func(record []string) bool {
+		return record[0] == "1"
+	})
+	s.NoError(s.db.SendMsg(deleteMsg))
+	s.Equal(1, deleteMsg.Deleted)
+
+	readMsg := NewCSVReadMsg("basic_test", 0, 0)
+	s.NoError(s.db.SendMsg(readMsg))
+	s.Equal([][]string{testRow2.Row()}, readMsg.Records)
+
+	// Appending after a delete keeps the header and the remaining records.
+	s.NoError(s.db.SendMsg(NewCSVInsertMsg("basic_test", []CSVRecord{testRow1})))
+	readMsg = NewCSVReadMsg("basic_test", 0, 0)
+	s.NoError(s.db.SendMsg(readMsg))
+	s.Equal([][]string{testRow2.Row(), testRow1.Row()}, readMsg.Records)
+
+	// The rewritten file keeps the mode of the original.
+	s.NoError(os.Chmod("./testdata/basic_test.csv", 0644))
+	s.NoError(s.db.SendMsg(NewCSVDeleteMsg("basic_test", func(record []string) bool {
+		return record[0] == "1"
+	})))
+	info, err := os.Stat("./testdata/basic_test.csv")
+	s.NoError(err)
+	s.Equal(os.FileMode(0644), info.Mode().Perm())
+
+	s.Error(s.db.SendMsg(NewCSVDeleteMsg("no_table", func([]string) bool { return true })))
+}
+
+func (s *CSVDatabaseTestSuite) TestScan() {
+	s.NoError(s.db.SendMsg(NewCSVInsertMsg("basic_test", []CSVRecord{testRow1, testRow2, testRow1})))
+
+	records := make([][]string, 0)
+	scanMsg := NewCSVScanMsg("basic_test", func(record []string) bool {
+		records = append(records, append([]string(nil), record...))
+		return true
+	})
+	s.NoError(s.db.SendMsg(scanMsg))
+	s.Equal([][]string{testRow1.Row(), testRow2.Row(), testRow1.Row()}, records)
+
+	// The scan stops once fn returns false.
+	scanned := 0
+	s.NoError(s.db.SendMsg(NewCSVScanMsg("basic_test", func(record []string) bool {
+		scanned++
+		return record[0] != testRow2.Row()[0]
+	})))
+	s.Equal(2, scanned)
+
+	// Sequential reads still work after a scan.
+	readMsg := NewCSVReadMsg("basic_test", 2, 1)
+	s.NoError(s.db.SendMsg(readMsg))
+	s.Equal([][]string{testRow2.Row()}, readMsg.Records)
+
+	s.Error(s.db.SendMsg(NewCSVScanMsg("no_table", func([]string) bool { return true })))
+}
+
 func TestCSVDatabaseTestSuite(t *testing.T) {
 	suite.Run(t, new(CSVDatabaseTestSuite))
 }
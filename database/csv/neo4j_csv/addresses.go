@@ -0,0 +1,199 @@
+package neo4j_csv
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// addressSetSizeKey stores the size of the addresses file covered by an addressSet. Addresses never start
+// with a zero byte so it can't collide with them.
+var addressSetSizeKey = []byte("\x00size")
+
+// addressSet is the set of addresses already written to the addresses file, so that every address node is
+// written once across transactions and runs as required by `neo4j-admin import`. It is persisted in a LevelDB
+// database along with the size of the addresses file it covers. Rows appended to the file after that size,
+// e.g. because the process died between writing the file and updating the set, are added back when the set
+// is opened.
+//
+// The LevelDB database is only opened once the set is first used, so databases that are only read don't
+// create it.
+type addressSet struct {
+	csvPath string
+	dbPath  string
+	// mu is held from checking addresses to recording them once they are written.
+	mu sync.Mutex
+	db *leveldb.DB
+}
+
+// newAddressSet returns the address set stored at dbPath for the addresses file at csvPath.
+func newAddressSet(csvPath, dbPath string) *addressSet {
+	return &addressSet{csvPath: csvPath, dbPath: dbPath}
+}
+
+// open opens the underlying database if needed and brings it up to date with the addresses file. set.mu must
+// be held.
+func (set *addressSet) open() error {
+	if set.db != nil {
+		return nil
+	}
+	db, err := leveldb.OpenFile(set.dbPath, nil)
+	if err != nil {
+		return err
+	}
+	set.db = db
+	if err := set.sync(); err != nil {
+		set.db = nil
+		db.Close()
+		return err
+	}
+	return nil
+}
+
+// close closes the underlying database if it was opened.
+func (set *addressSet) close() error {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if set.db == nil {
+		return nil
+	}
+	err := set.db.Close()
+	set.db = nil
+	return err
+}
+
+// sync adds the addresses of the rows appended to the addresses file since the set was last updated. The set
+// is rebuilt from scratch if the file shrank, e.g. because it was replaced.
+func (set *addressSet) sync() error {
+	covered, err := set.coveredSize()
+	if err != nil {
+		return err
+	}
+	size, err := fileSize(set.csvPath)
+	if err != nil {
+		return err
+	}
+	if size == covered {
+		return nil
+	}
+	if size < covered {
+		if err := set.clear(); err != nil {
+			return err
+		}
+		covered = 0
+	}
+
+	f, err := os.Open(set.csvPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(covered, io.SeekStart); err != nil {
+		return err
+	}
+	r := csv.NewReader(f)
+	r.ReuseRecord = true
+	batch := new(leveldb.Batch)
+	for first := covered == 0; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// The first row of the file is the header.
+		if first || len(record) == 0 {
+			continue
+		}
+		batch.Put([]byte(record[0]), nil)
+	}
+	batch.Put(addressSetSizeKey, sizeValue(size))
+	return set.db.Write(batch, nil)
+}
+
+// missing returns the addresses that aren't in the set, sorted. set.mu must be held.
+func (set *addressSet) missing(addresses map[string]struct{}) ([]string, error) {
+	if err := set.open(); err != nil {
+		return nil, err
+	}
+	missing := make([]string, 0, len(addresses))
+	for address := range addresses {
+		ok, err := set.db.Has([]byte(address), nil)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			missing = append(missing, address)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// add records addresses that were written to the addresses file along with its new size. set.mu must be held.
+func (set *addressSet) add(addresses []string) error {
+	if err := set.open(); err != nil {
+		return err
+	}
+	size, err := fileSize(set.csvPath)
+	if err != nil {
+		return err
+	}
+	batch := new(leveldb.Batch)
+	for _, address := range addresses {
+		batch.Put([]byte(address), nil)
+	}
+	batch.Put(addressSetSizeKey, sizeValue(size))
+	return set.db.Write(batch, nil)
+}
+
+// coveredSize returns the size of the addresses file covered by the set.
+func (set *addressSet) coveredSize() (int64, error) {
+	value, err := set.db.Get(addressSetSizeKey, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(value)), nil
+}
+
+// clear removes every address from the set.
+func (set *addressSet) clear() error {
+	iter := set.db.NewIterator(nil, nil)
+	defer iter.Release()
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return set.db.Write(batch, nil)
+}
+
+// fileSize returns the size of the file at path, or 0 if it doesn't exist.
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func sizeValue(size int64) []byte {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(size))
+	return value
+}
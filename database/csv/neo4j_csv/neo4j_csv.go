@@ -2,12 +2,17 @@ package neo4j_csv
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 
 	"github.com/IlliniBlockchain/etl-bitcoin/database"
 	"github.com/IlliniBlockchain/etl-bitcoin/database/csv"
 	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
 var (
@@ -16,6 +21,7 @@ var (
 	TxKey      = "transactions"
 	OutputKey  = "outputs"
 	AddressKey = "addresses"
+	MempoolKey = "mempool"
 
 	// Relationships
 	ChainKey    = "chain"    // Block --> Block
@@ -24,65 +30,321 @@ var (
 	InKey       = "in"       // Output -> Tx
 	OutKey      = "out"      // Tx -----> Output
 	LockedKey   = "locked"   // Output -> Address
+	MultisigKey = "multisig" // Output -> Address
 
-	fileKeys = []string{BlockKey, TxKey, OutputKey, AddressKey, ChainKey, CoinbaseKey, IncludeKey, InKey, OutKey, LockedKey}
+	fileKeys = []string{BlockKey, TxKey, OutputKey, AddressKey, MempoolKey, ChainKey, CoinbaseKey, IncludeKey, InKey, OutKey, LockedKey, MultisigKey}
 )
 
 // Database is a database.Database implementation that writes to CSV files formatted for Neo4j.
 type Database struct {
 	*csv.CSVDatabase
+	// addresses is the set of addresses already written, shared by every transaction.
+	addresses *addressSet
+	// btcValues adds a column with the amounts formatted in BTC.
+	btcValues bool
+	// params are the parameters of the network of the blocks, which set their subsidy.
+	params *chaincfg.Params
+}
+
+// Options returns the options supported by NewDatabase, each mapped to a value of its type.
+func Options() database.DBOptions {
+	opts := database.DBOptions{"dir": "", "maxWorkers": 0, "addressIndex": "", "btcValues": false, "network": ""}
+	for _, fileKey := range fileKeys {
+		opts[fileKey] = ""
+	}
+	return opts
 }
 
 // NewDatabase creates a new Neo4j CSV Database.
 //
+// Supported options, besides the file path of each file key:
+//   - "dir" (string): directory against which relative file paths are resolved.
+//   - "maxWorkers" (int): number of files written concurrently. Defaults to the number of CPUs.
+//   - "addressIndex" (string): LevelDB database recording the addresses already written, so that each one is
+//     written once. Defaults to the addresses file path with a ".idx" suffix.
+//   - "btcValues" (bool): besides amounts in satoshis, write them in BTC with 8 decimals in a `valueBTC` column
+//     of outputs and a `feeBTC` column of mempool transactions.
+//   - "network" (string): network of the blocks, which sets the subsidy of their coinbase pseudo-outputs, e.g.
+//     "mainnet" or "regtest". Defaults to mainnet.
+//
 // Implements database.DBConstructor.
 func NewDatabase(ctx context.Context, opts database.DBOptions) (database.Database, error) {
+	// Relative file paths are resolved against dir when it is provided.
+	dir, err := database.GetOpt(opts, "dir", "")
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
 	filePaths := make(map[string]string)
 	for _, fileKey := range fileKeys {
 		filePath, err := database.GetOpt(opts, fileKey, fileKey+".csv")
 		if err != nil {
 			return nil, err
 		}
+		if dir != "" && !filepath.IsAbs(filePath) {
+			filePath = filepath.Join(dir, filePath)
+		}
 		filePaths[fileKey] = filePath
 	}
 	maxWorkers, err := database.GetOpt(opts, "maxWorkers", runtime.NumCPU())
 	if err != nil {
 		return nil, err
 	}
+	addressIndex, err := database.GetOpt(opts, "addressIndex", filePaths[AddressKey]+".idx")
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" && !filepath.IsAbs(addressIndex) {
+		addressIndex = filepath.Join(dir, addressIndex)
+	}
+	btcValues, err := database.GetOpt(opts, "btcValues", false)
+	if err != nil {
+		return nil, err
+	}
+	network, err := database.GetOpt(opts, "network", chaincfg.MainNetParams.Name)
+	if err != nil {
+		return nil, err
+	}
+	params, ok := types.NetworkParams(network)
+	if !ok {
+		return nil, fmt.Errorf("unknown network %q", network)
+	}
 	csvDB, err := csv.NewCSVDatabase(ctx, filePaths, maxWorkers)
 	if err != nil {
 		return nil, err
 	}
-	return &Database{csvDB}, nil
+	return &Database{csvDB, newAddressSet(filePaths[AddressKey], addressIndex), btcValues, params}, nil
+}
+
+// Close closes the CSV files and the address index.
+//
+// Implements database.Database.
+func (db *Database) Close() error {
+	err := db.CSVDatabase.Close()
+	if closeErr := db.addresses.close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
-// LastBlockNumber returns the height of the last block in the database.
+// LastBlockNumber returns the height of the last block in the database or -1 if it has no blocks.
 //
 // Implements database.Database.
 func (db *Database) LastBlockNumber() (int64, error) {
+	_, height, err := db.lastBlock()
+	return height, err
+}
+
+// BlockHash returns the hash of the block at the given height.
+//
+// Implements database.Database.
+func (db *Database) BlockHash(height int64) (string, error) {
+	_, lastHeight, err := db.lastBlock()
+	if err != nil {
+		return "", err
+	}
+	if height < 0 || height > lastHeight {
+		return "", database.NewErrBlockNotFound(height)
+	}
+
+	// Blocks are committed in order, so without gaps the block is found by its offset to the last block.
+	blockRead := csv.NewCSVReadMsg(BlockKey, -int(lastHeight-height+1), 1)
+	if err := db.SendMsg(blockRead); err != nil {
+		return "", err
+	}
+	if len(blockRead.Records) == 1 {
+		hash, blockHeight, err := parseBlockRecord(blockRead.Records[0])
+		if err != nil {
+			return "", err
+		}
+		if blockHeight == height {
+			return hash, nil
+		}
+	}
+
+	// Fall back to scanning the blocks until the block is found.
+	var hash string
+	var scanErr error
+	blocksScan := csv.NewCSVScanMsg(BlockKey, func(record []string) bool {
+		recordHash, blockHeight, err := parseBlockRecord(record)
+		if err != nil {
+			scanErr = err
+			return false
+		}
+		if blockHeight == height {
+			hash = recordHash
+			return false
+		}
+		return true
+	})
+	if err := db.SendMsg(blocksScan); err != nil {
+		return "", err
+	}
+	if scanErr != nil {
+		return "", scanErr
+	}
+	if hash == "" {
+		return "", database.NewErrBlockNotFound(height)
+	}
+	return hash, nil
+}
+
+// RemoveBlocksAbove removes every block above the given height along with their transactions,
+// outputs and relationships. Addresses are kept since they may be referenced by other outputs.
+//
+// The rows to remove are derived from the blocks above height and their include relationships, which are
+// removed last, so a removal interrupted e.g. by a crash is completed by calling RemoveBlocksAbove again.
+//
+// Implements database.Database.
+func (db *Database) RemoveBlocksAbove(height int64) error {
+	blocks := make(map[string]struct{})
+	txs := make(map[string]struct{})
+	relationHeaders := csvChainRelation{}.Headers()
+
+	var scanErr error
+	blocksScan := csv.NewCSVScanMsg(BlockKey, func(record []string) bool {
+		hash, blockHeight, err := parseBlockRecord(record)
+		if err != nil {
+			scanErr = err
+			return false
+		}
+		if blockHeight > height {
+			blocks[hash] = struct{}{}
+		}
+		return true
+	})
+	if err := db.SendMsg(blocksScan); err != nil {
+		return err
+	}
+	if scanErr != nil {
+		return scanErr
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	includeScan := csv.NewCSVScanMsg(IncludeKey, func(record []string) bool {
+		if inSet(blocks, relationHeaders, record, ":END_ID") {
+			txID, _ := csv.GetRowField(relationHeaders, record, ":START_ID")
+			txs[txID] = struct{}{}
+		}
+		return true
+	})
+	if err := db.SendMsg(includeScan); err != nil {
+		return err
+	}
+
+	// Include relationships and blocks are deleted last since the other rows are found through them.
+	deletes := []*csv.CSVDeleteMsg{
+		csv.NewCSVDeleteMsg(ChainKey, func(record []string) bool {
+			return inSet(blocks, relationHeaders, record, ":START_ID")
+		}),
+		csv.NewCSVDeleteMsg(CoinbaseKey, func(record []string) bool {
+			return inSet(blocks, relationHeaders, record, ":START_ID")
+		}),
+		csv.NewCSVDeleteMsg(TxKey, func(record []string) bool {
+			return inSet(txs, csvTransaction{}.Headers(), record, "txID:id")
+		}),
+		csv.NewCSVDeleteMsg(OutputKey, func(record []string) bool {
+			outputID, _ := csv.GetRowField(csvVout{btcValues: db.btcValues}.Headers(), record, "outputID:id")
+			return isRemovedOutput(blocks, txs, outputID)
+		}),
+		csv.NewCSVDeleteMsg(InKey, func(record []string) bool {
+			return inSet(txs, csvInRelation{}.Headers(), record, ":END_ID")
+		}),
+		csv.NewCSVDeleteMsg(OutKey, func(record []string) bool {
+			return inSet(txs, relationHeaders, record, ":START_ID")
+		}),
+		csv.NewCSVDeleteMsg(LockedKey, func(record []string) bool {
+			outputID, _ := csv.GetRowField(relationHeaders, record, ":START_ID")
+			return isRemovedOutput(blocks, txs, outputID)
+		}),
+		csv.NewCSVDeleteMsg(MultisigKey, func(record []string) bool {
+			return inSet(txs, csvMultisigRelation{}.Headers(), record, "txID")
+		}),
+		csv.NewCSVDeleteMsg(IncludeKey, func(record []string) bool {
+			return inSet(blocks, relationHeaders, record, ":END_ID")
+		}),
+		csv.NewCSVDeleteMsg(BlockKey, func(record []string) bool {
+			return inSet(blocks, csvBlockHeader{}.Headers(), record, "blockID:id")
+		}),
+	}
+	for _, msg := range deletes {
+		if err := db.SendMsg(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lastBlock returns the hash and height of the last block in the database or -1 if it has no blocks.
+func (db *Database) lastBlock() (string, int64, error) {
 	lastBlockRead := csv.NewCSVReadMsg(BlockKey, -1, 1)
 	if err := db.SendMsg(lastBlockRead); err != nil {
-		return 0, err
+		return "", 0, err
 	}
 	if len(lastBlockRead.Records) == 0 {
-		return 0, nil
+		return "", -1, nil
+	}
+	return parseBlockRecord(lastBlockRead.Records[0])
+}
+
+// parseBlockRecord returns the hash and height of a row of the blocks file.
+func parseBlockRecord(record []string) (string, int64, error) {
+	headers := csvBlockHeader{}.Headers()
+	hash, err := csv.GetRowField(headers, record, "blockID:id")
+	if err != nil {
+		return "", 0, err
 	}
-	blockHeightStr, err := csv.GetRowField(csvBlockHeader{}.Headers(), lastBlockRead.Records[0], "height:int")
+	blockHeightStr, err := csv.GetRowField(headers, record, "height:int")
 	if err != nil {
-		return 0, err
+		return "", 0, err
 	}
 	blockHeight, err := strconv.ParseInt(blockHeightStr, 10, 64)
 	if err != nil {
-		return 0, err
+		return "", 0, err
 	}
-	return blockHeight, nil
+	return hash, blockHeight, nil
+}
+
+// inSet returns whether the field key of record is in set.
+func inSet(set map[string]struct{}, headers, record []string, key string) bool {
+	field, err := csv.GetRowField(headers, record, key)
+	if err != nil {
+		return false
+	}
+	_, ok := set[field]
+	return ok
+}
+
+// isRemovedOutput returns whether an output ID belongs to a removed transaction or block coinbase.
+func isRemovedOutput(blocks, txs map[string]struct{}, output string) bool {
+	i := strings.LastIndex(output, "_")
+	if i < 0 {
+		return false
+	}
+	id, suffix := output[:i], output[i+1:]
+	if suffix == "coinbase" {
+		_, ok := blocks[id]
+		return ok
+	}
+	_, ok := txs[id]
+	return ok
 }
 
 // NewDBTx creates a new database transaction.
 //
 // Implements database.Database.
 func (db *Database) NewDBTx() (database.DBTx, error) {
-	dbTx := &DBTx{db: db, data: make(map[string][]csv.CSVRecord), addresses: make(map[string]struct{})}
+	dbTx := &DBTx{
+		db:        db,
+		data:      make(map[string][]csv.CSVRecord),
+		addresses: make(map[string]struct{}),
+		coinbases: make(map[string]*csvCoinbaseVout),
+	}
 	for _, fileKey := range fileKeys {
 		dbTx.data[fileKey] = make([]csv.CSVRecord, 0)
 	}
@@ -95,14 +357,24 @@ type DBTx struct {
 
 	data      map[string][]csv.CSVRecord
 	addresses map[string]struct{}
+	// coinbases are the coinbase pseudo-outputs of the blocks added, by block hash.
+	coinbases map[string]*csvCoinbaseVout
 }
 
-// Commit commits the transaction.
+// Commit commits the transaction. Addresses already written by an earlier transaction aren't written again.
 //
 // Implements database.DBTx.
 func (dbTx DBTx) Commit() error {
+	set := dbTx.db.addresses
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
 	// Add addresses
-	for address := range dbTx.addresses {
+	addresses, err := set.missing(dbTx.addresses)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
 		dbTx.data[AddressKey] = append(dbTx.data[AddressKey], csvAddress{address})
 	}
 
@@ -113,10 +385,15 @@ func (dbTx DBTx) Commit() error {
 		}
 		msgs = append(msgs, csv.NewCSVInsertMsg(fileKey, records))
 	}
-	return dbTx.db.SendMsgs(msgs)
+	if err := dbTx.db.SendMsgs(msgs); err != nil {
+		return err
+	}
+	return set.add(addresses)
 }
 
-// AddBlockHeader processes a block header for a database.
+// AddBlockHeader processes a block header for a database, along with its coinbase pseudo-output: the input of
+// the coinbase transaction, worth the subsidy and fees of the block. The fees are only known if the coinbase
+// transaction of the block is added to the same database transaction.
 //
 // Implements database.DBTx.
 func (dbTx DBTx) AddBlockHeader(bh *types.BlockHeader) {
@@ -125,7 +402,9 @@ func (dbTx DBTx) AddBlockHeader(bh *types.BlockHeader) {
 		// Genesis block has no parent
 		dbTx.data[ChainKey] = append(dbTx.data[ChainKey], csvChainRelation{bh})
 	}
-	dbTx.data[OutputKey] = append(dbTx.data[OutputKey], csvCoinbaseVout{bh})
+	coinbase := &csvCoinbaseVout{BlockHeader: bh, params: dbTx.db.params, btcValues: dbTx.db.btcValues}
+	dbTx.coinbases[bh.Hash()] = coinbase
+	dbTx.data[OutputKey] = append(dbTx.data[OutputKey], coinbase)
 	dbTx.data[CoinbaseKey] = append(dbTx.data[CoinbaseKey], csvCoinbaseRelation{bh})
 }
 
@@ -137,19 +416,54 @@ func (dbTx DBTx) AddTransaction(tx *types.Transaction) {
 	dbTx.data[IncludeKey] = append(dbTx.data[IncludeKey], csvIncludeRelation{tx})
 
 	if tx.Vin()[0].IsCoinbase() {
+		if coinbase, ok := dbTx.coinbases[tx.BlockHash()]; ok {
+			coinbase.block = tx.Block()
+		}
 		dbTx.data[InKey] = append(dbTx.data[InKey], csvCoinbaseInRelation{tx})
 	} else {
 		for _, input := range tx.Vin() {
 			dbTx.data[InKey] = append(dbTx.data[InKey], csvInRelation{input, tx})
+			if multisig := input.Multisig(); multisig != nil {
+				dbTx.addMultisig(outputID(input.TxID(), input.Vout()), tx, multisig)
+			}
 		}
 	}
 
 	for _, output := range tx.Vout() {
-		dbTx.data[OutputKey] = append(dbTx.data[OutputKey], csvVout{output, tx})
+		dbTx.data[OutputKey] = append(dbTx.data[OutputKey], csvVout{output, tx, dbTx.db.btcValues})
 		dbTx.data[OutKey] = append(dbTx.data[OutKey], csvOutRelation{output, tx})
-		for _, address := range output.ScriptPubKey().Addresses {
+		if address := output.Address(dbTx.db.params); address != "" {
 			dbTx.addresses[address] = struct{}{}
 			dbTx.data[LockedKey] = append(dbTx.data[LockedKey], csvLockedRelation{output, tx, address})
 		}
+		if multisig := output.Multisig(); multisig != nil {
+			dbTx.addMultisig(outputID(tx.TxID(), output.N()), tx, multisig)
+		}
+	}
+}
+
+// addMultisig links an output to the addresses of the keys of the multisig script revealed by tx: the bare
+// multisig script of an output of tx, or the redeem or witness script of an output spent by tx.
+func (dbTx DBTx) addMultisig(outputID string, tx *types.Transaction, multisig *types.Multisig) {
+	for i, address := range multisig.Addresses(dbTx.db.params) {
+		if address == "" {
+			continue
+		}
+		dbTx.addresses[address] = struct{}{}
+		dbTx.data[MultisigKey] = append(dbTx.data[MultisigKey], csvMultisigRelation{
+			outputID: outputID,
+			tx:       tx,
+			multisig: multisig,
+			index:    i,
+			address:  address,
+		})
 	}
 }
+
+// AddMempoolTx processes an unconfirmed transaction seen in a snapshot of the mempool for a database. Each
+// snapshot adds a row for each of its transactions, identified by the transaction id and the snapshot time.
+//
+// Implements database.DBTx.
+func (dbTx DBTx) AddMempoolTx(tx *types.MempoolTx) {
+	dbTx.data[MempoolKey] = append(dbTx.data[MempoolKey], csvMempoolTx{tx, dbTx.db.btcValues})
+}
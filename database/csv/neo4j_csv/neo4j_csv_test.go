@@ -7,7 +7,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/IlliniBlockchain/etl-bitcoin/chaingen"
 	"github.com/IlliniBlockchain/etl-bitcoin/database"
+	"github.com/IlliniBlockchain/etl-bitcoin/database/csv"
 	"github.com/IlliniBlockchain/etl-bitcoin/types"
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/stretchr/testify/assert"
@@ -34,7 +36,7 @@ func TestDatabase_LastBlockNumber(t *testing.T) {
 		{
 			name: "no_records",
 			opts: map[string]interface{}{"blocks": "testdata/empty_test.csv"},
-			want: 0,
+			want: -1,
 		},
 		{
 			name:    "no_block_height",
@@ -59,6 +61,92 @@ func TestDatabase_LastBlockNumber(t *testing.T) {
 	assert.NoError(t, cleanTestFiles())
 }
 
+var testBlockHeaders = []btcjson.GetBlockVerboseTxResult{
+	{
+		Hash:       "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+		Height:     0,
+		Time:       1231469664,
+		Size:       0,
+		Difficulty: 0.0,
+		Nonce:      0,
+	},
+	{
+		Hash:         "00000000839a8e6886ab5951d76f411475428afc90947ee320161bbf18eb6048",
+		Height:       1,
+		Time:         1231469665,
+		Size:         0,
+		Difficulty:   0.0,
+		Nonce:        0,
+		PreviousHash: "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+	},
+	{
+		Hash:         "000000006a625f06636b8bb6ac7b960a8d03705d1ace08b1a19da3fdcc99ddbd",
+		Height:       2,
+		Time:         1231469666,
+		Size:         0,
+		Difficulty:   0.0,
+		Nonce:        0,
+		PreviousHash: "00000000839a8e6886ab5951d76f411475428afc90947ee320161bbf18eb6048",
+	},
+}
+
+var testTransactions = []btcjson.TxRawResult{
+	{
+		Txid:      "9b0fc92260312ce44e74ef369f5c66bbb85848f2eddd5a7a1cde251e54ccfdd5",
+		Size:      134,
+		Time:      1231469666,
+		LockTime:  0,
+		BlockHash: "000000006a625f06636b8bb6ac7b960a8d03705d1ace08b1a19da3fdcc99ddbd",
+		Vin: []btcjson.Vin{
+			{
+				Coinbase: "04ffff001d010b",
+				Sequence: 4294967295,
+			},
+		},
+		Vout: []btcjson.Vout{
+			{
+				Value: 50,
+				N:     0,
+				ScriptPubKey: btcjson.ScriptPubKeyResult{
+					Asm:  "047211a824f55b505228e4c3d5194c1fcfaa15a456abdf37f9b9d97a4040afc073dee6c89064984f03385237d92167c13e236446b417ab79a0fcae412ae3316b77 OP_CHECKSIG",
+					Hex:  "41047211a824f55b505228e4c3d5194c1fcfaa15a456abdf37f9b9d97a4040afc073dee6c89064984f03385237d92167c13e236446b417ab79a0fcae412ae3316b77ac",
+					Type: "pubkey",
+				},
+			},
+		},
+	},
+	{
+		Txid:      "cc455ae816e6cdafdb58d54e35d4f46d860047458eacf1c7405dc634631c570d",
+		Size:      1963,
+		Time:      1231469666,
+		LockTime:  0,
+		BlockHash: "000000006a625f06636b8bb6ac7b960a8d03705d1ace08b1a19da3fdcc99ddbd",
+		Vin: []btcjson.Vin{
+			{
+				Txid: "3ead633462a2c980020ffae61d7ccecdc23fda54c022352ea337939da4646c37",
+				Vout: 0,
+				ScriptSig: &btcjson.ScriptSig{
+					Asm: "304402200b78e195f1eb150a52ade3e1e0c593b2534ed3bf4236de4fedb5c8fe7171f3bf02202d63b6c3bd58aa91183a50afb445561854b4bebb6977500f85e61a75b0aa7403[ALL] 02f3ae2c5c5c9616f9e27df9b823af2c748564203afc240a43b8f054dab83c7139",
+					Hex: "47304402200b78e195f1eb150a52ade3e1e0c593b2534ed3bf4236de4fedb5c8fe7171f3bf02202d63b6c3bd58aa91183a50afb445561854b4bebb6977500f85e61a75b0aa7403012102f3ae2c5c5c9616f9e27df9b823af2c748564203afc240a43b8f054dab83c7139",
+				},
+				Sequence: 4294967295,
+			},
+		},
+		Vout: []btcjson.Vout{
+			{
+				Value: 0.0001,
+				N:     0,
+				ScriptPubKey: btcjson.ScriptPubKeyResult{
+					Asm:       "OP_DUP OP_HASH160 8d1ec2350813b2a071353e16b41e884647405d3d OP_EQUALVERIFY OP_CHECKSIG",
+					Hex:       "76a9148d1ec2350813b2a071353e16b41e884647405d3d88ac",
+					Addresses: []string{"1DsB8CHc7fa87GUm6qs6YGoCRgQpBo2TJZ"},
+					Type:      "pubkeyhash",
+				},
+			},
+		},
+	},
+}
+
 type DBTxTestSuite struct {
 	suite.Suite
 	db   database.Database
@@ -84,35 +172,6 @@ func (s *DBTxTestSuite) TearDownTest() {
 }
 
 func (s *DBTxTestSuite) TestDBTx_AddBlockHeader() {
-	testBlockHeaders := []btcjson.GetBlockVerboseTxResult{
-		{
-			Hash:       "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
-			Height:     0,
-			Time:       1231469664,
-			Size:       0,
-			Difficulty: 0.0,
-			Nonce:      0,
-		},
-		{
-			Hash:         "00000000839a8e6886ab5951d76f411475428afc90947ee320161bbf18eb6048",
-			Height:       1,
-			Time:         1231469665,
-			Size:         0,
-			Difficulty:   0.0,
-			Nonce:        0,
-			PreviousHash: "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
-		},
-		{
-			Hash:         "000000006a625f06636b8bb6ac7b960a8d03705d1ace08b1a19da3fdcc99ddbd",
-			Height:       2,
-			Time:         1231469666,
-			Size:         0,
-			Difficulty:   0.0,
-			Nonce:        0,
-			PreviousHash: "00000000839a8e6886ab5951d76f411475428afc90947ee320161bbf18eb6048",
-		},
-	}
-
 	for _, rawBlockHeader := range testBlockHeaders {
 		blockHeader := types.NewBlockHeaderFromVerboseTx(rawBlockHeader)
 		s.dbTx.AddBlockHeader(blockHeader)
@@ -124,62 +183,6 @@ func (s *DBTxTestSuite) TestDBTx_AddBlockHeader() {
 }
 
 func (s *DBTxTestSuite) TestDBTx_AddTransaction() {
-	testTransactions := []btcjson.TxRawResult{
-		{
-			Txid:      "9b0fc92260312ce44e74ef369f5c66bbb85848f2eddd5a7a1cde251e54ccfdd5",
-			Size:      134,
-			Time:      1231469666,
-			LockTime:  0,
-			BlockHash: "000000006a625f06636b8bb6ac7b960a8d03705d1ace08b1a19da3fdcc99ddbd",
-			Vin: []btcjson.Vin{
-				{
-					Coinbase: "04ffff001d010b",
-					Sequence: 4294967295,
-				},
-			},
-			Vout: []btcjson.Vout{
-				{
-					Value: 50,
-					N:     0,
-					ScriptPubKey: btcjson.ScriptPubKeyResult{
-						Asm:  "047211a824f55b505228e4c3d5194c1fcfaa15a456abdf37f9b9d97a4040afc073dee6c89064984f03385237d92167c13e236446b417ab79a0fcae412ae3316b77 OP_CHECKSIG",
-						Hex:  "41047211a824f55b505228e4c3d5194c1fcfaa15a456abdf37f9b9d97a4040afc073dee6c89064984f03385237d92167c13e236446b417ab79a0fcae412ae3316b77ac",
-						Type: "pubkey",
-					},
-				},
-			},
-		},
-		{
-			Txid:      "cc455ae816e6cdafdb58d54e35d4f46d860047458eacf1c7405dc634631c570d",
-			Size:      1963,
-			Time:      1231469666,
-			LockTime:  0,
-			BlockHash: "000000006a625f06636b8bb6ac7b960a8d03705d1ace08b1a19da3fdcc99ddbd",
-			Vin: []btcjson.Vin{
-				{
-					Txid: "3ead633462a2c980020ffae61d7ccecdc23fda54c022352ea337939da4646c37",
-					Vout: 0,
-					ScriptSig: &btcjson.ScriptSig{
-						Asm: "304402200b78e195f1eb150a52ade3e1e0c593b2534ed3bf4236de4fedb5c8fe7171f3bf02202d63b6c3bd58aa91183a50afb445561854b4bebb6977500f85e61a75b0aa7403[ALL] 02f3ae2c5c5c9616f9e27df9b823af2c748564203afc240a43b8f054dab83c7139",
-						Hex: "47304402200b78e195f1eb150a52ade3e1e0c593b2534ed3bf4236de4fedb5c8fe7171f3bf02202d63b6c3bd58aa91183a50afb445561854b4bebb6977500f85e61a75b0aa7403012102f3ae2c5c5c9616f9e27df9b823af2c748564203afc240a43b8f054dab83c7139",
-					},
-					Sequence: 4294967295,
-				},
-			},
-			Vout: []btcjson.Vout{
-				{
-					Value: 0.0001,
-					N:     0,
-					ScriptPubKey: btcjson.ScriptPubKeyResult{
-						Asm:       "OP_DUP OP_HASH160 8d1ec2350813b2a071353e16b41e884647405d3d OP_EQUALVERIFY OP_CHECKSIG",
-						Hex:       "76a9148d1ec2350813b2a071353e16b41e884647405d3d88ac",
-						Addresses: []string{"1DsB8CHc7fa87GUm6qs6YGoCRgQpBo2TJZ"},
-						Type:      "pubkeyhash",
-					},
-				},
-			},
-		},
-	}
 	for _, rawTx := range testTransactions {
 		tx := types.NewTransaction(rawTx)
 		s.dbTx.AddTransaction(tx)
@@ -195,6 +198,261 @@ func (s *DBTxTestSuite) TestDBTx_AddTransaction() {
 
 }
 
+func (s *DBTxTestSuite) TestDBTx_AddMempoolTx() {
+	entry := types.MempoolEntryResult{
+		VSize:           226,
+		Time:            1700000000,
+		Height:          800000,
+		AncestorCount:   2,
+		DescendantCount: 1,
+		Fees:            &types.Fees{Base: 0.0000452},
+	}
+	s.dbTx.AddMempoolTx(types.NewMempoolTx(types.NewTransaction(testTransactions[1]), entry, 1700000060))
+	s.NoError(s.dbTx.Commit())
+	mempool, err := os.ReadFile("testdata/mempool_test.csv")
+	s.NoError(err)
+	s.Equal("mempoolTxID:id,txID,snapshotTime:int,firstSeen:int,height:int,vsize:int,weight:int,"+
+		"feeRate:double,ancestorCount:int,descendantCount:int,fee:long\r\n"+
+		testTransactions[1].Txid+"_1700000060,"+testTransactions[1].Txid+",1700000060,1700000000,800000,226,0,"+
+		"20,2,1,4520\r\n", string(mempool))
+	// Unconfirmed transactions aren't in the block graph.
+	s.Equal(0, s.recordCounts()[TxKey])
+}
+
+func (s *DBTxTestSuite) TestDBTx_AddMultisig() {
+	const (
+		compressed   = "02f3ae2c5c5c9616f9e27df9b823af2c748564203afc240a43b8f054dab83c7139"
+		uncompressed = "047211a824f55b505228e4c3d5194c1fcfaa15a456abdf37f9b9d97a4040afc073dee6c89064984f03385237d92167c13e236446b417ab79a0fcae412ae3316b77"
+		sig          = "304402200b78e195f1eb150a52ade3e1e0c593b2534ed3bf4236de4fedb5c8fe7171f3bf02202d63b6c3bd58aa91183a50afb445561854b4bebb6977500f85e61a75b0aa740301"
+	)
+	// The input redeems a 1-of-2 P2SH multisig script and the output is a bare 1-of-1 multisig script.
+	redeemScript := "5121" + compressed + "41" + uncompressed + "52ae"
+	tx := testTransactions[1]
+	tx.Vin = []btcjson.Vin{{
+		Txid:      testTransactions[1].Vin[0].Txid,
+		Vout:      1,
+		ScriptSig: &btcjson.ScriptSig{Hex: "0047" + sig + "4c67" + redeemScript},
+		Sequence:  4294967295,
+	}}
+	tx.Vout = []btcjson.Vout{{
+		Value:        0.0001,
+		ScriptPubKey: btcjson.ScriptPubKeyResult{Hex: "5121" + compressed + "51ae", Type: "multisig"},
+	}}
+	s.dbTx.AddBlockHeader(types.NewBlockHeaderFromVerboseTx(testBlockHeaders[2]))
+	s.dbTx.AddTransaction(types.NewTransaction(tx))
+	s.NoError(s.dbTx.Commit())
+
+	multisig, err := os.ReadFile("testdata/multisig_test.csv")
+	s.NoError(err)
+	spent := tx.Vin[0].Txid + "_1"
+	s.Equal(":START_ID,:END_ID,txID,pubKey,index:int,m:int,n:int\r\n"+
+		spent+",1QgTYzMYqStzZBQx8gguYaJQMjFRbagbh,"+tx.Txid+","+compressed+",0,1,2\r\n"+
+		spent+",1HLoD9E4SDFFPDiYfNYnkBLQ85Y51J3Zb1,"+tx.Txid+","+uncompressed+",1,1,2\r\n"+
+		tx.Txid+"_0,1QgTYzMYqStzZBQx8gguYaJQMjFRbagbh,"+tx.Txid+","+compressed+",0,1,1\r\n", string(multisig))
+	addresses, err := os.ReadFile("testdata/addresses_test.csv")
+	s.NoError(err)
+	s.Contains(string(addresses), "1QgTYzMYqStzZBQx8gguYaJQMjFRbagbh")
+	s.Contains(string(addresses), "1HLoD9E4SDFFPDiYfNYnkBLQ85Y51J3Zb1")
+
+	// The relationships are removed along with the transaction revealing the scripts.
+	s.NoError(s.db.RemoveBlocksAbove(1))
+	msg := csv.NewCSVReadMsg(MultisigKey, 0, 0)
+	s.NoError(s.db.(*Database).SendMsg(msg))
+	s.Empty(msg.Records)
+}
+
+func (s *DBTxTestSuite) TestDBTx_AddCoinbaseOutput() {
+	block, err := types.NewBlockHeaderFromVerboseTx(testBlockHeaders[2]).WithTransactions(testTransactions)
+	s.Require().NoError(err)
+	coinbaseID := block.Hash() + "_coinbase"
+
+	// Without the coinbase transaction, the value is the subsidy.
+	s.dbTx.AddBlockHeader(types.NewBlockHeaderFromVerboseTx(testBlockHeaders[1]))
+	// Without prevouts, the fees are the value claimed by the coinbase above the subsidy.
+	s.dbTx.AddBlockHeader(block.BlockHeader)
+	for _, tx := range block.Transactions() {
+		s.dbTx.AddTransaction(tx)
+	}
+	s.NoError(s.dbTx.Commit())
+	// With prevouts, they are the fees paid by the transactions of the block.
+	s.dbTx, err = s.db.NewDBTx()
+	s.Require().NoError(err)
+	txs := block.Transactions()
+	txs[1].Vin()[0].SetPrevout(types.NewPrevoutFromScript(30000, nil, "nonstandard", nil, 1, false))
+	s.dbTx.AddBlockHeader(block.BlockHeader)
+	s.dbTx.AddTransaction(txs[0])
+	s.NoError(s.dbTx.Commit())
+
+	outputs, err := os.ReadFile("testdata/outputs_test.csv")
+	s.NoError(err)
+	s.Contains(string(outputs), testBlockHeaders[1].Hash+"_coinbase,0,Coinbase,5000000000\r\n")
+	s.Contains(string(outputs), coinbaseID+",0,Coinbase,5000000000\r\n")
+	s.Contains(string(outputs), coinbaseID+",0,Coinbase,5000020000\r\n")
+	in, err := os.ReadFile("testdata/in_test.csv")
+	s.NoError(err)
+	s.Contains(string(in), coinbaseID+","+testTransactions[0].Txid)
+}
+
+func (s *DBTxTestSuite) TestDBTx_SpentAt() {
+	tx := types.NewTransaction(testTransactions[1])
+	prevout := types.NewPrevoutFromScript(30000, nil, "nonstandard", nil, 1, false)
+	prevout.SetSpentAt(2, tx.TxID())
+	tx.Vin()[0].SetPrevout(prevout)
+	s.dbTx.AddTransaction(tx)
+	s.NoError(s.dbTx.Commit())
+
+	in, err := os.ReadFile("testdata/in_test.csv")
+	s.NoError(err)
+	s.Contains(string(in), ":START_ID,:END_ID,spendType,spentHeight:int,spentTxid\r\n")
+	s.Contains(string(in), ","+tx.TxID()+",NonStandard,2,"+tx.TxID()+"\r\n")
+}
+
+func (s *DBTxTestSuite) TestDBTx_BTCValues() {
+	s.NoError(s.db.Close())
+	opts := make(map[string]interface{})
+	for _, fileKey := range fileKeys {
+		opts[fileKey] = filepath.Join("testdata", fileKey+"_test.csv")
+	}
+	opts["btcValues"] = true
+	var err error
+	s.db, err = NewDatabase(context.Background(), opts)
+	s.Require().NoError(err)
+	s.dbTx, err = s.db.NewDBTx()
+	s.Require().NoError(err)
+
+	for _, rawTx := range testTransactions {
+		s.dbTx.AddTransaction(types.NewTransaction(rawTx))
+	}
+	s.NoError(s.dbTx.Commit())
+	outputs, err := os.ReadFile("testdata/outputs_test.csv")
+	s.NoError(err)
+	s.Equal("outputID:id,index:int,:LABEL,value:long,valueBTC\r\n"+
+		testTransactions[0].Txid+"_0,0,P2PK,5000000000,50.00000000\r\n"+
+		testTransactions[1].Txid+"_0,0,P2PKH,10000,0.00010000\r\n", string(outputs))
+}
+
+func (s *DBTxTestSuite) TestDatabase_RemoveBlocksAbove() {
+	for _, rawBlockHeader := range testBlockHeaders {
+		s.dbTx.AddBlockHeader(types.NewBlockHeaderFromVerboseTx(rawBlockHeader))
+	}
+	for _, rawTx := range testTransactions {
+		s.dbTx.AddTransaction(types.NewTransaction(rawTx))
+	}
+	s.NoError(s.dbTx.Commit())
+
+	for i, rawBlockHeader := range testBlockHeaders {
+		hash, err := s.db.BlockHash(int64(i))
+		s.NoError(err)
+		s.Equal(rawBlockHeader.Hash, hash)
+	}
+	_, err := s.db.BlockHash(3)
+	s.ErrorAs(err, &database.ErrBlockNotFound{})
+
+	// Removing blocks above the last block is a no-op.
+	s.NoError(s.db.RemoveBlocksAbove(2))
+	s.Equal(map[string]int{BlockKey: 3, TxKey: 2, OutputKey: 5, IncludeKey: 2, InKey: 2, OutKey: 2, LockedKey: 2, ChainKey: 2, CoinbaseKey: 3}, s.recordCounts())
+
+	// Block 2 includes every transaction.
+	s.NoError(s.db.RemoveBlocksAbove(1))
+	s.Equal(map[string]int{BlockKey: 2, TxKey: 0, OutputKey: 2, IncludeKey: 0, InKey: 0, OutKey: 0, LockedKey: 0, ChainKey: 1, CoinbaseKey: 2}, s.recordCounts())
+	last, err := s.db.LastBlockNumber()
+	s.NoError(err)
+	s.EqualValues(1, last)
+	hash, err := s.db.BlockHash(1)
+	s.NoError(err)
+	s.Equal(testBlockHeaders[1].Hash, hash)
+}
+
+func (s *DBTxTestSuite) TestDatabase_RemoveBlocksAboveInterrupted() {
+	for _, rawBlockHeader := range testBlockHeaders {
+		s.dbTx.AddBlockHeader(types.NewBlockHeaderFromVerboseTx(rawBlockHeader))
+	}
+	for _, rawTx := range testTransactions {
+		s.dbTx.AddTransaction(types.NewTransaction(rawTx))
+	}
+	s.NoError(s.dbTx.Commit())
+
+	// A removal interrupted after deleting the transactions of block 2 is completed by the next one.
+	db := s.db.(*Database)
+	s.NoError(db.SendMsg(csv.NewCSVDeleteMsg(TxKey, func([]string) bool { return true })))
+	s.NoError(s.db.RemoveBlocksAbove(1))
+	s.Equal(map[string]int{BlockKey: 2, TxKey: 0, OutputKey: 2, IncludeKey: 0, InKey: 0, OutKey: 0, LockedKey: 0, ChainKey: 1, CoinbaseKey: 2}, s.recordCounts())
+
+	// So is a removal interrupted before deleting the blocks.
+	s.NoError(db.SendMsg(csv.NewCSVDeleteMsg(ChainKey, func([]string) bool { return true })))
+	s.NoError(db.SendMsg(csv.NewCSVDeleteMsg(CoinbaseKey, func(record []string) bool {
+		return inSet(map[string]struct{}{testBlockHeaders[1].Hash: {}}, csvChainRelation{}.Headers(), record, ":START_ID")
+	})))
+	s.NoError(s.db.RemoveBlocksAbove(0))
+	s.Equal(map[string]int{BlockKey: 1, TxKey: 0, OutputKey: 1, IncludeKey: 0, InKey: 0, OutKey: 0, LockedKey: 0, ChainKey: 0, CoinbaseKey: 1}, s.recordCounts())
+}
+
+func (s *DBTxTestSuite) TestDatabase_BlockHashWithGap() {
+	// Blocks 0 and 2 without block 1, so block 0 isn't found by its offset to the last block.
+	s.dbTx.AddBlockHeader(types.NewBlockHeaderFromVerboseTx(testBlockHeaders[0]))
+	s.dbTx.AddBlockHeader(types.NewBlockHeaderFromVerboseTx(testBlockHeaders[2]))
+	s.NoError(s.dbTx.Commit())
+
+	hash, err := s.db.BlockHash(0)
+	s.NoError(err)
+	s.Equal(testBlockHeaders[0].Hash, hash)
+	_, err = s.db.BlockHash(1)
+	s.ErrorAs(err, &database.ErrBlockNotFound{})
+}
+
+func TestDatabase_AddressesWrittenOnce(t *testing.T) {
+	dir := t.TempDir()
+	// Both transactions of testTransactions pay to the same address in the second one.
+	load := func(db database.Database, tx btcjson.TxRawResult) {
+		dbTx, err := db.NewDBTx()
+		assert.NoError(t, err)
+		dbTx.AddTransaction(types.NewTransaction(tx))
+		assert.NoError(t, dbTx.Commit())
+	}
+	tx := testTransactions[1]
+	otherTx := tx
+	otherTx.Txid = "0000000000000000000000000000000000000000000000000000000000000001"
+
+	db, err := NewDatabase(context.Background(), database.DBOptions{"dir": dir})
+	assert.NoError(t, err)
+	load(db, tx)
+	load(db, otherTx)
+	assert.NoError(t, db.Close())
+
+	// The set of written addresses survives restarts.
+	db, err = NewDatabase(context.Background(), database.DBOptions{"dir": dir})
+	assert.NoError(t, err)
+	load(db, tx)
+	assert.NoError(t, db.Close())
+
+	addresses, err := os.ReadFile(filepath.Join(dir, "addresses.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "addressID:id\r\n1DsB8CHc7fa87GUm6qs6YGoCRgQpBo2TJZ\r\n", string(addresses))
+	locked, err := os.ReadFile(filepath.Join(dir, "locked.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(locked), "\n"), string(locked))
+
+	// Addresses written to the file but not recorded in the index, e.g. after a crash, are recovered.
+	assert.NoError(t, os.RemoveAll(filepath.Join(dir, "addresses.csv.idx")))
+	db, err = NewDatabase(context.Background(), database.DBOptions{"dir": dir})
+	assert.NoError(t, err)
+	load(db, otherTx)
+	assert.NoError(t, db.Close())
+	addresses, err = os.ReadFile(filepath.Join(dir, "addresses.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(addresses), "\n"))
+}
+
+func (s *DBTxTestSuite) recordCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, fileKey := range []string{BlockKey, TxKey, OutputKey, IncludeKey, InKey, OutKey, LockedKey, ChainKey, CoinbaseKey} {
+		msg := csv.NewCSVReadMsg(fileKey, 0, 0)
+		s.NoError(s.db.(*Database).SendMsg(msg))
+		counts[fileKey] = len(msg.Records)
+	}
+	return counts
+}
+
 func TestDBTxTestSuite(t *testing.T) {
 	suite.Run(t, new(DBTxTestSuite))
 }
@@ -213,12 +471,49 @@ func cleanTestFiles() error {
 		return err
 	}
 	for _, file := range files {
-		if !strings.HasSuffix(file.Name(), "_test.csv") {
+		if !strings.HasSuffix(file.Name(), "_test.csv") && !strings.HasSuffix(file.Name(), "_test.csv.idx") {
 			continue
 		}
-		if err := os.Remove(filepath.Join("testdata", file.Name())); err != nil {
+		if err := os.RemoveAll(filepath.Join("testdata", file.Name())); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+func BenchmarkDBTx(b *testing.B) {
+	config := chaingen.DefaultConfig()
+	config.CoinbaseMaturity = 1
+	config.TxsPerBlock = 100
+	generated, err := chaingen.Generate(config, 100)
+	if err != nil {
+		b.Fatal(err)
+	}
+	blocks := make([]*types.Block, len(generated))
+	for i, blk := range generated {
+		blocks[i] = blk.Block()
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db, err := NewDatabase(context.Background(), database.DBOptions{"dir": b.TempDir()})
+		if err != nil {
+			b.Fatal(err)
+		}
+		dbTx, err := db.NewDBTx()
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, blk := range blocks {
+			dbTx.AddBlockHeader(blk.BlockHeader)
+			for _, tx := range blk.Transactions() {
+				dbTx.AddTransaction(tx)
+			}
+		}
+		if err := dbTx.Commit(); err != nil {
+			b.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
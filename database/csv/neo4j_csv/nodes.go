@@ -4,6 +4,8 @@ import (
 	"strconv"
 
 	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
 type csvBlockHeader struct {
@@ -54,41 +56,94 @@ func (tx csvTransaction) Row() []string {
 	}
 }
 
+// outputID returns the ID of output n of transaction txid, used by the output node and by every relationship to it.
+func outputID(txid string, n uint32) string {
+	return txid + "_" + strconv.FormatUint(uint64(n), 10)
+}
+
+// coinbaseOutputID returns the ID of the pseudo-output of a block spent by its coinbase transaction.
+func coinbaseOutputID(blockHash string) string {
+	return blockHash + "_coinbase"
+}
+
 type csvVout struct {
 	*types.Vout
 	tx *types.Transaction
+	// btcValues adds the value formatted in BTC.
+	btcValues bool
 }
 
 func (vout csvVout) Headers() []string {
-	return []string{
+	headers := []string{
 		"outputID:id",
 		"index:int",
-		"value:double",
+		":LABEL",
+		"value:long",
+	}
+	if vout.btcValues {
+		headers = append(headers, "valueBTC")
 	}
+	return headers
 }
 
 func (vout csvVout) Row() []string {
-	return []string{
-		vout.tx.TxID() + "_" + strconv.FormatInt(int64(vout.N()), 10),
+	return amountRow([]string{
+		outputID(vout.tx.TxID(), vout.N()),
 		strconv.FormatInt(int64(vout.N()), 10),
-		strconv.FormatFloat(vout.Value(), 'f', -1, 64),
-	}
+		vout.ScriptClass().String(),
+	}, vout.Value(), vout.btcValues)
 }
 
+// csvCoinbaseVout is the pseudo-output of a block spent by its coinbase transaction.
 type csvCoinbaseVout struct {
 	*types.BlockHeader
+	// block is set when the coinbase transaction of the block is added, so that its fees are known.
+	block     *types.Block
+	params    *chaincfg.Params
+	btcValues bool
 }
 
-func (bh csvCoinbaseVout) Headers() []string {
-	return csvVout{}.Headers()
+func (bh *csvCoinbaseVout) Headers() []string {
+	return csvVout{btcValues: bh.btcValues}.Headers()
 }
 
-func (bh csvCoinbaseVout) Row() []string {
-	return []string{
-		bh.Hash() + "_coinbase",
+func (bh *csvCoinbaseVout) Row() []string {
+	return amountRow([]string{
+		coinbaseOutputID(bh.Hash()),
 		"0",
-		strconv.FormatFloat(bh.Reward(), 'f', -1, 64),
+		// The pseudo-output has no script to classify.
+		"Coinbase",
+	}, bh.value(), bh.btcValues)
+}
+
+// value returns the subsidy of the block plus its fees. Without the prevouts of its inputs, the fees are the part
+// of the value of the coinbase outputs above the subsidy, which misses the fees a miner didn't claim. Without its
+// coinbase transaction, the value is the subsidy.
+func (bh *csvCoinbaseVout) value() btcutil.Amount {
+	subsidy := bh.Subsidy(bh.params)
+	if bh.block == nil {
+		return subsidy
+	}
+	if reward, ok := bh.block.Reward(bh.params); ok {
+		return reward
+	}
+	var claimed btcutil.Amount
+	for _, out := range bh.block.Transactions()[0].Vout() {
+		claimed += out.Value()
+	}
+	if claimed < subsidy {
+		return subsidy
 	}
+	return claimed
+}
+
+// amountRow appends an amount in satoshis to row, followed by the amount formatted in BTC if btc is set.
+func amountRow(row []string, amount btcutil.Amount, btc bool) []string {
+	row = append(row, strconv.FormatInt(int64(amount), 10))
+	if btc {
+		row = append(row, types.FormatBTC(amount))
+	}
+	return row
 }
 
 type csvAddress struct {
@@ -106,3 +161,43 @@ func (addr csvAddress) Row() []string {
 		addr.address,
 	}
 }
+
+type csvMempoolTx struct {
+	*types.MempoolTx
+	btcValues bool
+}
+
+func (tx csvMempoolTx) Headers() []string {
+	headers := []string{
+		"mempoolTxID:id",
+		"txID",
+		"snapshotTime:int",
+		"firstSeen:int",
+		"height:int",
+		"vsize:int",
+		"weight:int",
+		"feeRate:double",
+		"ancestorCount:int",
+		"descendantCount:int",
+		"fee:long",
+	}
+	if tx.btcValues {
+		headers = append(headers, "feeBTC")
+	}
+	return headers
+}
+
+func (tx csvMempoolTx) Row() []string {
+	return amountRow([]string{
+		tx.TxID() + "_" + strconv.FormatInt(tx.SnapshotTime(), 10),
+		tx.TxID(),
+		strconv.FormatInt(tx.SnapshotTime(), 10),
+		strconv.FormatInt(tx.FirstSeen(), 10),
+		strconv.FormatInt(tx.EntryHeight(), 10),
+		strconv.FormatInt(int64(tx.VSize()), 10),
+		strconv.FormatInt(int64(tx.Weight()), 10),
+		strconv.FormatFloat(tx.FeeRate(), 'f', -1, 64),
+		strconv.FormatInt(tx.AncestorCount(), 10),
+		strconv.FormatInt(tx.DescendantCount(), 10),
+	}, tx.Fee(), tx.btcValues)
+}
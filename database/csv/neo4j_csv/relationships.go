@@ -38,7 +38,7 @@ func (bh csvCoinbaseRelation) Headers() []string {
 func (bh csvCoinbaseRelation) Row() []string {
 	return []string{
 		bh.Hash(),
-		bh.Hash() + "_coinbase",
+		coinbaseOutputID(bh.Hash()),
 	}
 }
 
@@ -69,13 +69,26 @@ func (in csvInRelation) Headers() []string {
 	return []string{
 		":START_ID",
 		":END_ID",
+		"spendType",
+		"spentHeight:int",
+		"spentTxid",
 	}
 }
 
 func (in csvInRelation) Row() []string {
+	// The block and transaction spending the output are known once the UTXO set has connected the block.
+	spentHeight, spentTxID := "", ""
+	if prevout := in.Prevout(); prevout != nil {
+		if height, txid, ok := prevout.SpentAt(); ok {
+			spentHeight, spentTxID = strconv.FormatInt(height, 10), txid
+		}
+	}
 	return []string{
-		in.TxID() + strconv.FormatInt(int64(in.Vout()), 10),
+		outputID(in.TxID(), in.Vout()),
 		in.tx.TxID(),
+		in.SpendType().String(),
+		spentHeight,
+		spentTxID,
 	}
 }
 
@@ -89,8 +102,11 @@ func (tx csvCoinbaseInRelation) Headers() []string {
 
 func (tx csvCoinbaseInRelation) Row() []string {
 	return []string{
-		tx.BlockHash() + "_coinbase",
+		coinbaseOutputID(tx.BlockHash()),
 		tx.TxID(),
+		"",
+		"",
+		"",
 	}
 }
 
@@ -109,7 +125,7 @@ func (out csvOutRelation) Headers() []string {
 func (out csvOutRelation) Row() []string {
 	return []string{
 		out.tx.TxID(),
-		out.tx.TxID() + "_" + strconv.FormatInt(int64(out.N()), 10),
+		outputID(out.tx.TxID(), out.N()),
 	}
 }
 
@@ -128,7 +144,43 @@ func (out csvLockedRelation) Headers() []string {
 
 func (out csvLockedRelation) Row() []string {
 	return []string{
-		out.tx.TxID() + "_" + strconv.FormatInt(int64(out.N()), 10),
+		outputID(out.tx.TxID(), out.N()),
 		out.address,
 	}
 }
+
+// csvMultisigRelation links an output locked by a multisig script to the address of one of its keys.
+type csvMultisigRelation struct {
+	outputID string
+	// tx is the transaction revealing the script: the one creating a bare multisig output, or spending a P2SH or
+	// P2WSH output.
+	tx       *types.Transaction
+	multisig *types.Multisig
+	// index is the position of the key in the script.
+	index   int
+	address string
+}
+
+func (rel csvMultisigRelation) Headers() []string {
+	return []string{
+		":START_ID",
+		":END_ID",
+		"txID",
+		"pubKey",
+		"index:int",
+		"m:int",
+		"n:int",
+	}
+}
+
+func (rel csvMultisigRelation) Row() []string {
+	return []string{
+		rel.outputID,
+		rel.address,
+		rel.tx.TxID(),
+		rel.multisig.PubKeys[rel.index],
+		strconv.Itoa(rel.index),
+		strconv.Itoa(rel.multisig.Required),
+		strconv.Itoa(rel.multisig.N()),
+	}
+}
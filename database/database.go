@@ -2,14 +2,22 @@ package database
 
 import (
 	"context"
+	"strconv"
+	"time"
 
 	"github.com/IlliniBlockchain/etl-bitcoin/types"
 )
 
 // Database represents a database connection.
 type Database interface {
-	// LastBlockNumber returns the block height of the last block committed to the database.
+	// LastBlockNumber returns the block height of the last block committed to the database or -1 if no block
+	// has been committed yet.
 	LastBlockNumber() (int64, error)
+	// BlockHash returns the hash of the committed block at the given height or ErrBlockNotFound.
+	BlockHash(height int64) (string, error)
+	// RemoveBlocksAbove removes every block above the given height from the database along with the
+	// transactions they include. Used to roll back blocks orphaned by a chain reorganization.
+	RemoveBlocksAbove(height int64) error
 	// NewDBTx returns a new DBTx.
 	NewDBTx() (DBTx, error)
 	// Close closes the database connection. Only callable once.
@@ -22,6 +30,9 @@ type DBTx interface {
 	AddBlockHeader(blockheaders *types.BlockHeader)
 	// AddTransaction adds transaction data to this database transaction.
 	AddTransaction(tx *types.Transaction)
+	// AddMempoolTx adds an unconfirmed transaction seen in a snapshot of the mempool to this database
+	// transaction, with its fee rate, ancestor and descendant counts and first-seen time.
+	AddMempoolTx(tx *types.MempoolTx)
 	// Commit commits this database transaction to a database.
 	Commit() error
 }
@@ -44,3 +55,47 @@ func GetOpt[T any](opts DBOptions, key string, def T) (T, error) {
 	}
 	return val, nil
 }
+
+// ParseOpts returns a copy of opts where the options given as strings, e.g. on the command line, are parsed as the
+// type of the option with the same key in declared. Options of other types are copied as is and checked by
+// GetOpt. Options missing from declared are refused with ErrUnknownOption.
+func ParseOpts(opts, declared DBOptions) (DBOptions, error) {
+	parsed := make(DBOptions, len(opts))
+	for key, opt := range opts {
+		decl, ok := declared[key]
+		if !ok {
+			return nil, ErrUnknownOption{key}
+		}
+		s, ok := opt.(string)
+		if !ok {
+			parsed[key] = opt
+			continue
+		}
+		val, err := parseOpt(s, decl)
+		if err != nil {
+			return nil, ErrInvalidOptionValue{key, s, decl, err}
+		}
+		parsed[key] = val
+	}
+	return parsed, nil
+}
+
+// parseOpt parses s as the type of decl.
+func parseOpt(s string, decl interface{}) (interface{}, error) {
+	switch decl.(type) {
+	case string:
+		return s, nil
+	case bool:
+		return strconv.ParseBool(s)
+	case int:
+		return strconv.Atoi(s)
+	case int64:
+		return strconv.ParseInt(s, 10, 64)
+	case float64:
+		return strconv.ParseFloat(s, 64)
+	case time.Duration:
+		return time.ParseDuration(s)
+	default:
+		return nil, ErrInvalidOptionType{s, decl}
+	}
+}
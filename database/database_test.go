@@ -57,3 +57,15 @@ func TestGetOpt(t *testing.T) {
 		})
 	}
 }
+
+func TestParseOpts(t *testing.T) {
+	declared := DBOptions{"path": "", "workers": 0, "resume": false}
+	opts, err := ParseOpts(DBOptions{"path": "1", "workers": "4", "resume": true}, declared)
+	assert.NoError(t, err)
+	assert.Equal(t, DBOptions{"path": "1", "workers": 4, "resume": true}, opts)
+
+	_, err = ParseOpts(DBOptions{"workers": "four"}, declared)
+	assert.ErrorAs(t, err, new(ErrInvalidOptionValue))
+	_, err = ParseOpts(DBOptions{"worker": "4"}, declared)
+	assert.ErrorAs(t, err, new(ErrUnknownOption))
+}
@@ -12,3 +12,46 @@ type ErrInvalidOptionType struct {
 func (e ErrInvalidOptionType) Error() string {
 	return fmt.Sprintf("invalid option type %T (expected %T)", e.gotT, e.expectedT)
 }
+
+// ErrUnknownOption is returned when an option isn't supported.
+type ErrUnknownOption struct {
+	key string
+}
+
+// Error implements error.Error interface.
+func (e ErrUnknownOption) Error() string {
+	return fmt.Sprintf("unknown option %q", e.key)
+}
+
+// ErrInvalidOptionValue is returned when an option given as a string can't be parsed as its type.
+type ErrInvalidOptionValue struct {
+	key       string
+	value     string
+	expectedT interface{}
+	err       error
+}
+
+// Error implements error.Error interface.
+func (e ErrInvalidOptionValue) Error() string {
+	return fmt.Sprintf("invalid value %q for option %q (expected %T): %v", e.value, e.key, e.expectedT, e.err)
+}
+
+// Unwrap returns the parsing error.
+func (e ErrInvalidOptionValue) Unwrap() error {
+	return e.err
+}
+
+// ErrBlockNotFound is returned when a block is not in the database.
+type ErrBlockNotFound struct {
+	height int64
+}
+
+// NewErrBlockNotFound returns an ErrBlockNotFound for the block at the given height.
+func NewErrBlockNotFound(height int64) ErrBlockNotFound {
+	return ErrBlockNotFound{height}
+}
+
+// Error implements error.Error interface.
+func (e ErrBlockNotFound) Error() string {
+	return fmt.Sprintf("block %d not found in database", e.height)
+}
@@ -0,0 +1,96 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLoaderClosed is returned when sending input to a LoaderManager that has been closed.
+var ErrLoaderClosed = errors.New("loader manager is closed")
+
+// ErrRangeOverlap is returned when a block range overlaps blocks that were already loaded.
+type ErrRangeOverlap struct {
+	blockRange BlockRange
+	nextHeight int64
+}
+
+// Error implements error.Error interface.
+func (e ErrRangeOverlap) Error() string {
+	return fmt.Sprintf(
+		"block range %d-%d overlaps blocks already loaded up to %d (use resume mode to skip them)",
+		e.blockRange.Start,
+		e.blockRange.End,
+		e.nextHeight-1,
+	)
+}
+
+// ErrReorg is returned when a block does not build on the block loaded before it.
+type ErrReorg struct {
+	height       int64
+	previousHash string
+	tipHash      string
+}
+
+// Error implements error.Error interface.
+func (e ErrReorg) Error() string {
+	return fmt.Sprintf(
+		"chain reorganization detected at block %d: previous hash %s does not match loaded block %s",
+		e.height,
+		e.previousHash,
+		e.tipHash,
+	)
+}
+
+// ErrReorgTooDeep is returned when no fork point is found within the maximum reorg depth.
+type ErrReorgTooDeep struct {
+	tipHeight     int64
+	maxReorgDepth int64
+}
+
+// Error implements error.Error interface.
+func (e ErrReorgTooDeep) Error() string {
+	return fmt.Sprintf(
+		"no fork point found within %d blocks of block %d",
+		e.maxReorgDepth,
+		e.tipHeight,
+	)
+}
+
+// ErrRangeBeyondTip is returned when a block range ends above the tip of the client's chain.
+type ErrRangeBeyondTip struct {
+	blockRange BlockRange
+	tipHeight  int64
+	// syncing is true when the node is still in initial block download.
+	syncing  bool
+	progress float64
+}
+
+// Error implements error.Error interface.
+func (e ErrRangeBeyondTip) Error() string {
+	msg := fmt.Sprintf(
+		"block range %d-%d ends above the chain tip at block %d",
+		e.blockRange.Start,
+		e.blockRange.End,
+		e.tipHeight,
+	)
+	if e.syncing {
+		msg += fmt.Sprintf(" (node is in initial block download, %.2f%% verified)", 100*e.progress)
+	}
+	return msg
+}
+
+// ErrRangePruned is returned when a block range starts below the first block kept by a pruned node.
+type ErrRangePruned struct {
+	blockRange  BlockRange
+	pruneHeight int64
+}
+
+// Error implements error.Error interface.
+func (e ErrRangePruned) Error() string {
+	return fmt.Sprintf(
+		"block range %d-%d starts below block %d, the first block kept by the pruned node",
+		e.blockRange.Start,
+		e.blockRange.End,
+		e.pruneHeight,
+	)
+}
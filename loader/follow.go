@@ -0,0 +1,73 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+)
+
+// Follow loads new blocks as they are added to the client's chain until ctx is cancelled, starting after the
+// last block loaded. Blocks are only loaded once they have `confirmations` blocks on top of them, and the
+// client is polled for new blocks every `pollInterval`. The state of the chain is fetched once per poll and
+// every range sent until the next poll is checked against it.
+//
+// Follow returns nil when ctx is cancelled. Batches already sent are committed by Close.
+func (loader *LoaderManager) Follow(ctx context.Context, confirmations int64, pollInterval time.Duration) error {
+	if confirmations < 0 {
+		return fmt.Errorf("confirmations (%d) must not be negative", confirmations)
+	}
+	if pollInterval <= 0 {
+		return fmt.Errorf("poll interval (%v) must be positive", pollInterval)
+	}
+	// Catch up in steps that fit in the pipeline so cancellation is noticed while far behind the tip.
+	maxStep := loader.batchSize * int64(cap(loader.window))
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		blockCount, info, err := loader.poll(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		target := blockCount - confirmations
+		for next := loader.NextHeight(); next <= target; next = loader.NextHeight() {
+			end := target
+			if end-next+1 > maxStep {
+				end = next + maxStep - 1
+			}
+			if err := loader.sendInput(BlockRange{Start: next, End: end}, info); err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-loader.ctx.Done():
+			return loader.ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll returns the height of the client's tip along with the state of its chain, which is nil if the client
+// doesn't know it. The height is then asked separately.
+func (loader *LoaderManager) poll(ctx context.Context) (int64, *types.ChainInfo, error) {
+	info, err := loader.chainInfo(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	if info != nil {
+		return info.Blocks(), info, nil
+	}
+	blockCount, err := loader.client.GetBlockCount(ctx)
+	return blockCount, nil, err
+}
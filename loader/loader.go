@@ -2,10 +2,14 @@ package loader
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"sync"
 
 	"github.com/IlliniBlockchain/etl-bitcoin/client"
 	"github.com/IlliniBlockchain/etl-bitcoin/database"
+	"github.com/IlliniBlockchain/etl-bitcoin/loader/utxo"
 	"github.com/IlliniBlockchain/etl-bitcoin/types"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"golang.org/x/sync/errgroup"
@@ -13,8 +17,8 @@ import (
 
 // ILoaderManager outlines an interface for a loader manager.
 type ILoaderManager interface {
-	SendInput(BlockRange, database.DBTx)
-	Close()
+	SendInput(BlockRange) error
+	Close() error
 }
 
 // LoaderManager stores state for managing loaders for loading data from a `Client` to
@@ -24,66 +28,330 @@ type LoaderManager struct {
 	db      database.Database
 	inputCh chan *LoaderMsg[BlockRange]
 
-	ctx      context.Context
-	stopOnce sync.Once
-	g        *errgroup.Group
+	// resume skips blocks that were already loaded instead of refusing ranges overlapping them.
+	resume bool
+	// syncing is true while the client's node was last seen in initial block download.
+	syncing bool
+	// nextHeight is the height of the first block that has not been loaded or sent to the pipeline.
+	nextHeight int64
+	closed     bool
+	mu         sync.Mutex
+
+	// batchSize is the maximum number of blocks fetched and committed together.
+	batchSize int64
+	// seq is the sequence number of the next batch sent to the pipeline.
+	seq uint64
+	// window limits the number of batches in the pipeline at once.
+	window chan struct{}
+
+	// tip is the last block loaded into the database. Only accessed by the sink.
+	tip           chainTip
+	maxReorgDepth int64
+
+	// utxos is the UTXO set resolving the prevouts of inputs, if enabled. Only accessed by the sink until the
+	// pipeline stops.
+	utxos *utxo.Set
+	// utxoSnapshot is the file the UTXO set is written to when the manager is closed, if set.
+	utxoSnapshot string
+
+	ctx       context.Context
+	stopOnce  sync.Once
+	closeOnce sync.Once
+	g         *errgroup.Group
 }
 
 // LoaderMsg stores state for data being passed through loaders.
 type LoaderMsg[T any] struct {
+	seq        uint64
 	blockRange BlockRange
 	dbTx       database.DBTx
 	data       T
 }
 
 // LoaderOptions represents a map of arbitrary options when constructing a LoaderManager.
+//
+// Supported options:
+//   - "resume" (bool): skip blocks already committed to the database instead of refusing overlapping ranges.
+//   - "batchSize" (int): maximum number of blocks requested from the client and committed in one database
+//     transaction. Defaults to DefaultBatchSize.
+//   - "maxWorkers" (int): number of batches fetched from the client concurrently. Defaults to DefaultMaxWorkers.
+//   - "maxReorgDepth" (int): maximum number of blocks rolled back when the chain is reorganized. Defaults to
+//     DefaultMaxReorgDepth.
+//   - "prevouts" (bool): resolve the output spent by each input before loading it, see types.Vin.Prevout. Outputs
+//     not given with the blocks are looked up with the client, which must implement client.PrevoutClient.
+//   - "utxoDir" (string): directory of a UTXO set kept up to date with the blocks loaded, see utxo.Set. It
+//     resolves the prevouts of inputs without the client, but requires loading blocks from the genesis block.
+//   - "utxoSnapshot" (string): file the UTXO set is restored from when "utxoDir" doesn't exist yet, and written to
+//     when the manager is closed.
 type LoaderOptions map[string]interface{}
 
+const (
+	DefaultBatchSize  = 100
+	DefaultMaxWorkers = 4
+)
+
+// Options returns the options supported by NewLoaderManager, each mapped to a value of its type.
+func Options() LoaderOptions {
+	return LoaderOptions{"resume": false, "batchSize": 0, "maxWorkers": 0, "maxReorgDepth": 0, "prevouts": false,
+		"utxoDir": "", "utxoSnapshot": ""}
+}
+
+// GetOpt returns the value of the option with the given key. If the option is not set, the default value is returned.
+func GetOpt[T any](opts LoaderOptions, key string, def T) (T, error) {
+	return database.GetOpt(database.DBOptions(opts), key, def)
+}
+
+// BlockRange represents a range (inclusive) of block heights.
 type BlockRange struct {
 	Start int64
 	End   int64
 }
 
+// Split splits the block range into consecutive ranges of at most size blocks.
+func (br BlockRange) Split(size int64) []BlockRange {
+	if size <= 0 || br.End < br.Start {
+		return []BlockRange{br}
+	}
+	ranges := make([]BlockRange, 0, (br.End-br.Start)/size+1)
+	for start := br.Start; start <= br.End; start += size {
+		end := start + size - 1
+		if end > br.End {
+			end = br.End
+		}
+		ranges = append(ranges, BlockRange{start, end})
+	}
+	return ranges
+}
+
 // NewLoaderManager creates a new LoaderManager and initiates goroutines for the loaders in a pipeline.
 func NewLoaderManager(ctx context.Context, client client.Client, db database.Database, opts LoaderOptions) (*LoaderManager, error) {
+	resume, err := GetOpt(opts, "resume", false)
+	if err != nil {
+		return nil, err
+	}
+	batchSize, err := GetOpt(opts, "batchSize", DefaultBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	maxWorkers, err := GetOpt(opts, "maxWorkers", DefaultMaxWorkers)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize <= 0 || maxWorkers <= 0 {
+		return nil, fmt.Errorf("batchSize (%d) and maxWorkers (%d) must be positive", batchSize, maxWorkers)
+	}
+	maxReorgDepth, err := GetOpt(opts, "maxReorgDepth", DefaultMaxReorgDepth)
+	if err != nil {
+		return nil, err
+	}
+	prevouts, err := GetOpt(opts, "prevouts", false)
+	if err != nil {
+		return nil, err
+	}
+	utxoDir, err := GetOpt(opts, "utxoDir", "")
+	if err != nil {
+		return nil, err
+	}
+	utxoSnapshot, err := GetOpt(opts, "utxoSnapshot", "")
+	if err != nil {
+		return nil, err
+	}
+	lastBlockNumber, err := db.LastBlockNumber()
+	if err != nil {
+		return nil, err
+	}
+	tip := chainTip{height: lastBlockNumber}
+	if lastBlockNumber >= 0 {
+		if tip.hash, err = db.BlockHash(lastBlockNumber); err != nil {
+			return nil, err
+		}
+	}
+	var utxos *utxo.Set
+	if utxoDir != "" {
+		// The set is a batch ahead of the database if committing it failed, and committed blocks may be rolled
+		// back by a reorg, so it keeps enough undo records for both.
+		undoDepth := int64(maxReorgDepth + batchSize)
+		if utxos, err = openUTXOSet(utxoDir, utxoSnapshot, undoDepth, tip); err != nil {
+			return nil, err
+		}
+	}
+
 	// initialize struct
 	g, ctx := errgroup.WithContext(ctx)
 	inputCh := make(chan *LoaderMsg[BlockRange])
 	loader := &LoaderManager{
-		client:  client,
-		db:      db,
-		inputCh: inputCh,
-		ctx:     ctx,
-		g:       g,
+		client:        client,
+		db:            db,
+		inputCh:       inputCh,
+		resume:        resume,
+		nextHeight:    lastBlockNumber + 1,
+		batchSize:     int64(batchSize),
+		window:        make(chan struct{}, 2*maxWorkers),
+		tip:           tip,
+		maxReorgDepth: int64(maxReorgDepth),
+		utxos:         utxos,
+		utxoSnapshot:  utxoSnapshot,
+		ctx:           ctx,
+		g:             g,
 	}
 
 	// loaders
-	blockRangeLoader := NewLoader(client, inputCh, blockRangeHandler)
+	blockRangeLoader := NewLoader(ctx, client, inputCh, blockRangeHandler, maxWorkers)
 	g.Go(blockRangeLoader.Run)
-	blockHashLoader := NewLoader(client, blockRangeLoader.Dst(), blockHashHandler)
+	blockHashLoader := NewLoader(ctx, client, blockRangeLoader.Dst(), blockHashHandler, maxWorkers)
 	g.Go(blockHashLoader.Run)
-	blockLoader := NewLoaderSink(blockHashLoader.Dst(), blockHandler)
+	blocks := blockHashLoader.Dst()
+	if prevouts {
+		prevoutLoader := NewLoader(ctx, client, blocks, prevoutHandler, maxWorkers)
+		g.Go(prevoutLoader.Run)
+		blocks = prevoutLoader.Dst()
+	}
+	blockLoader := NewLoaderSink(ctx, blocks, loader.blockSinkHandler, loader.window)
 	g.Go(blockLoader.Run)
 
 	return loader, nil
 }
 
-// Close gracefully shuts down all loader processes.
+// Close gracefully shuts down all loader processes after every input has been committed, then closes the UTXO
+// set. It returns the first error encountered by any loader, including errors committing to the database.
 func (loader *LoaderManager) Close() error {
 	loader.stopOnce.Do(func() {
+		loader.mu.Lock()
+		defer loader.mu.Unlock()
+		loader.closed = true
 		close(loader.inputCh)
 	})
-	return loader.g.Wait()
+	err := loader.g.Wait()
+	loader.closeOnce.Do(func() {
+		if closeErr := loader.closeUTXOSet(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+// NextHeight returns the height of the first block that has not been loaded or sent to the pipeline.
+func (loader *LoaderManager) NextHeight() int64 {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	return loader.nextHeight
+}
+
+// SendInput starts the given parameters on the first stage of the loader pipeline. The range is split into
+// batches of at most batchSize blocks which are fetched concurrently. Each batch is loaded into a new database
+// transaction which is committed once the last stage has processed it, in the order of the block heights.
+//
+// Ranges overlapping blocks that were already loaded are refused with ErrRangeOverlap, unless the manager
+// is in resume mode in which case the loaded blocks are skipped. Before any block is sent, the range is checked
+// against the state of the client's chain: ranges ending above its tip are refused with ErrRangeBeyondTip and
+// ranges starting below the blocks kept by a pruned node with ErrRangePruned.
+func (loader *LoaderManager) SendInput(blockRange BlockRange) error {
+	return loader.sendInput(blockRange, nil)
+}
+
+// sendInput implements SendInput, checking the range against info or, if info is nil, against the chain info
+// fetched from the client.
+func (loader *LoaderManager) sendInput(blockRange BlockRange, info *types.ChainInfo) error {
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	if loader.closed {
+		return ErrLoaderClosed
+	}
+	if blockRange.Start < 0 || blockRange.End < blockRange.Start {
+		return fmt.Errorf("invalid block range %d-%d", blockRange.Start, blockRange.End)
+	}
+	if blockRange.Start < loader.nextHeight {
+		if !loader.resume {
+			return ErrRangeOverlap{blockRange, loader.nextHeight}
+		}
+		if blockRange.End < loader.nextHeight {
+			log.Printf("skipping blocks %d to %d: already loaded\n", blockRange.Start, blockRange.End)
+			return nil
+		}
+		log.Printf("resuming at block %d: blocks %d to %d already loaded\n", loader.nextHeight, blockRange.Start, loader.nextHeight-1)
+		blockRange.Start = loader.nextHeight
+	}
+	if err := loader.checkRange(blockRange, info); err != nil {
+		return err
+	}
+	for _, batch := range blockRange.Split(loader.batchSize) {
+		if err := loader.sendBatch(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRange makes sure the client can serve every block of blockRange according to info, which is fetched from
+// the client if nil. The check is skipped if the client can't tell the state of its chain. It logs when the
+// client's node enters or leaves initial block download, since its tip may then be far behind the network.
+// loader.mu must be held.
+func (loader *LoaderManager) checkRange(blockRange BlockRange, info *types.ChainInfo) error {
+	if info == nil {
+		var err error
+		if info, err = loader.chainInfo(loader.ctx); err != nil || info == nil {
+			return err
+		}
+	}
+	if info.InitialBlockDownload() != loader.syncing {
+		loader.syncing = info.InitialBlockDownload()
+		if loader.syncing {
+			log.Printf("node is in initial block download: %d of %d blocks (%.2f%% verified)\n",
+				info.Blocks(), info.Headers(), 100*info.VerificationProgress())
+		} else {
+			log.Printf("node finished initial block download at block %d\n", info.Blocks())
+		}
+	}
+	if blockRange.End > info.Blocks() {
+		return ErrRangeBeyondTip{blockRange, info.Blocks(), info.InitialBlockDownload(), info.VerificationProgress()}
+	}
+	if info.Pruned() && blockRange.Start < info.PruneHeight() {
+		return ErrRangePruned{blockRange, info.PruneHeight()}
+	}
+	return nil
+}
+
+// chainInfo returns the state of the client's chain, or nil if the client doesn't know it (client.ErrUnsupported),
+// e.g. a replay fixture recorded without it.
+func (loader *LoaderManager) chainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	info, err := loader.client.GetChainInfo(ctx)
+	if errors.Is(err, client.ErrUnsupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting chain info: %w", err)
+	}
+	return info, nil
 }
 
-// SendInput starts the given parameters on the first stage of the loader pipeline.
-func (loader *LoaderManager) SendInput(blockRange BlockRange, dbTx database.DBTx) {
+// sendBatch sends a single batch to the pipeline once there is room for it.
+func (loader *LoaderManager) sendBatch(blockRange BlockRange) error {
+	select {
+	case loader.window <- struct{}{}:
+	case <-loader.ctx.Done():
+		return loader.ctx.Err()
+	}
+	// The slot is freed once the batch is committed, or right away if the batch doesn't enter the pipeline.
+	dbTx, err := loader.db.NewDBTx()
+	if err != nil {
+		<-loader.window
+		return err
+	}
 	msg := &LoaderMsg[BlockRange]{
+		loader.seq,
 		blockRange,
 		dbTx,
 		blockRange,
 	}
-	loader.inputCh <- msg
+	select {
+	case loader.inputCh <- msg:
+	case <-loader.ctx.Done():
+		<-loader.window
+		return loader.ctx.Err()
+	}
+	loader.seq++
+	loader.nextHeight = blockRange.End + 1
+	return nil
 }
 
 // ILoader is a simple interface for loaders.
@@ -94,27 +362,37 @@ type ILoader interface {
 // Loader is the go to loader for an inidividual stage in the pipeline
 // extracting data from an RPC client to a database. It stores state and
 // uses the function f to transform data coming from a src channel to send
-// to a dst channel.
+// to a dst channel. Messages are transformed by up to `workers` goroutines
+// at once, so they may leave the loader out of order.
 type Loader[S, D any] struct {
-	client client.Client
-	src    <-chan *LoaderMsg[S]
-	dst    chan *LoaderMsg[D]
-	f      LoaderFunc[S, D]
+	ctx     context.Context
+	client  client.Client
+	src     <-chan *LoaderMsg[S]
+	dst     chan *LoaderMsg[D]
+	f       LoaderFunc[S, D]
+	workers int
 }
 
-type LoaderFunc[S, D any] func(client.Client, *LoaderMsg[S]) (*LoaderMsg[D], error)
+// LoaderFunc transforms a message using the client. The context is cancelled when the pipeline stops, which
+// interrupts the client's requests.
+type LoaderFunc[S, D any] func(context.Context, client.Client, *LoaderMsg[S]) (*LoaderMsg[D], error)
 
 func (loader *Loader[S, D]) Dst() <-chan *LoaderMsg[D] {
 	return loader.dst
 }
 
-func NewLoader[S, D any](client client.Client, src <-chan *LoaderMsg[S], f LoaderFunc[S, D]) *Loader[S, D] {
+func NewLoader[S, D any](ctx context.Context, client client.Client, src <-chan *LoaderMsg[S], f LoaderFunc[S, D], workers int) *Loader[S, D] {
 	dst := make(chan *LoaderMsg[D])
+	if workers < 1 {
+		workers = 1
+	}
 	loader := &Loader[S, D]{
+		ctx,
 		client,
 		src,
 		dst,
 		f,
+		workers,
 	}
 	return loader
 }
@@ -123,69 +401,133 @@ func NewLoader[S, D any](client client.Client, src <-chan *LoaderMsg[S], f Loade
 // transforms the data and sends it to the next loader.
 // Importantly, when it's src channel is closed, it closes its
 // dst channel, which causes a domino effect of closing loader channels.
+// It stops early when its context is cancelled, e.g. because another loader failed.
 func (loader *Loader[S, D]) Run() error {
 	// Close dst to signal to downstream loaders that there is
 	// no more data whenever execution stops.
 	defer close(loader.dst)
 
-	// Listen for messages from upstream loaders.
-	for msg := range loader.src {
-		output, err := loader.f(loader.client, msg)
-		if err != nil {
-			return err
+	var g errgroup.Group
+	for i := 0; i < loader.workers; i++ {
+		g.Go(loader.work)
+	}
+	return g.Wait()
+}
+
+// work listens for messages from upstream loaders until src is closed.
+func (loader *Loader[S, D]) work() error {
+	for {
+		select {
+		case msg, ok := <-loader.src:
+			if !ok {
+				return nil
+			}
+			output, err := loader.f(loader.ctx, loader.client, msg)
+			if err != nil {
+				return err
+			}
+			select {
+			case loader.dst <- output:
+			case <-loader.ctx.Done():
+				return loader.ctx.Err()
+			}
+		case <-loader.ctx.Done():
+			return loader.ctx.Err()
 		}
-		loader.dst <- output
 	}
-	return nil
 }
 
 // LoaderSink represents the last stage in a loader pipeline.
 type LoaderSink[S any] struct {
+	ctx context.Context
 	src <-chan *LoaderMsg[S]
 	f   LoaderSinkFunc[S]
+	// window has a slot freed after each commit, if set.
+	window <-chan struct{}
+
+	// pending stores messages received ahead of the next sequence number.
+	pending map[uint64]*LoaderMsg[S]
+	next    uint64
 }
 
 type LoaderSinkFunc[S any] func(database.DBTx, *LoaderMsg[S]) error
 
-func NewLoaderSink[S any](src <-chan *LoaderMsg[S], f LoaderSinkFunc[S]) *LoaderSink[S] {
+func NewLoaderSink[S any](ctx context.Context, src <-chan *LoaderMsg[S], f LoaderSinkFunc[S], window <-chan struct{}) *LoaderSink[S] {
 	loader := &LoaderSink[S]{
-		src,
-		f,
+		ctx:     ctx,
+		src:     src,
+		f:       f,
+		window:  window,
+		pending: make(map[uint64]*LoaderMsg[S]),
 	}
 	return loader
 }
 
+// Run fills the database transaction of each message with the function f and
+// commits it. Messages are committed in order of their sequence numbers, so
+// messages arriving early are held back until the ones before them are committed.
 func (loader *LoaderSink[S]) Run() error {
-	for msg := range loader.src {
-		err := loader.f(msg.dbTx, msg)
-		if err != nil {
+	for {
+		select {
+		case msg, ok := <-loader.src:
+			if !ok {
+				if len(loader.pending) > 0 {
+					return fmt.Errorf("loader stopped with %d uncommitted batches", len(loader.pending))
+				}
+				return nil
+			}
+			loader.pending[msg.seq] = msg
+			if err := loader.commitPending(); err != nil {
+				return err
+			}
+		case <-loader.ctx.Done():
+			return loader.ctx.Err()
+		}
+	}
+}
+
+// commitPending commits pending messages as long as the next one in sequence is available.
+func (loader *LoaderSink[S]) commitPending() error {
+	for {
+		msg, ok := loader.pending[loader.next]
+		if !ok {
+			return nil
+		}
+		delete(loader.pending, loader.next)
+		if err := loader.f(msg.dbTx, msg); err != nil {
 			return err
 		}
+		if err := msg.dbTx.Commit(); err != nil {
+			return fmt.Errorf("committing blocks %d to %d: %w", msg.blockRange.Start, msg.blockRange.End, err)
+		}
+		loader.next++
+		if loader.window != nil {
+			<-loader.window
+		}
 	}
-	return nil
 }
 
 // blockRangeHandler is a LoaderFunc that uses a block range to
 // retrieve a list of block hashes.
-func blockRangeHandler(client client.Client, msg *LoaderMsg[BlockRange]) (*LoaderMsg[[]*chainhash.Hash], error) {
+func blockRangeHandler(ctx context.Context, client client.Client, msg *LoaderMsg[BlockRange]) (*LoaderMsg[[]*chainhash.Hash], error) {
 	blockRange := msg.data
-	hashes, err := client.GetBlockHashesByRange(blockRange.Start, blockRange.End)
+	hashes, err := client.GetBlockHashesByRange(ctx, blockRange.Start, blockRange.End)
 	if err != nil {
 		return nil, err
 	}
-	newMsg := &LoaderMsg[[]*chainhash.Hash]{msg.blockRange, msg.dbTx, hashes}
+	newMsg := &LoaderMsg[[]*chainhash.Hash]{msg.seq, msg.blockRange, msg.dbTx, hashes}
 	return newMsg, nil
 }
 
 // blockHashHandler is a LoaderFunc that uses a list of block
 // hashes to retrieve block header and transaction data.
-func blockHashHandler(client client.Client, msg *LoaderMsg[[]*chainhash.Hash]) (*LoaderMsg[[]*types.Block], error) {
+func blockHashHandler(ctx context.Context, client client.Client, msg *LoaderMsg[[]*chainhash.Hash]) (*LoaderMsg[[]*types.Block], error) {
 	hashes := msg.data
-	blocks, err := client.GetBlocks(hashes)
+	blocks, err := client.GetBlocks(ctx, hashes)
 	if err != nil {
 		return nil, err
 	}
-	newMsg := &LoaderMsg[[]*types.Block]{msg.blockRange, msg.dbTx, blocks}
+	newMsg := &LoaderMsg[[]*types.Block]{msg.seq, msg.blockRange, msg.dbTx, blocks}
 	return newMsg, nil
 }
 
@@ -3,30 +3,41 @@ package loader
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/IlliniBlockchain/etl-bitcoin/chaingen"
 	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/replay"
+	rpcclient "github.com/IlliniBlockchain/etl-bitcoin/client/rpc"
+	"github.com/IlliniBlockchain/etl-bitcoin/client/rpc/rpctest"
 	"github.com/IlliniBlockchain/etl-bitcoin/types"
 	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
-func block_filename(height int64) string {
-	return "testdata/block_" + fmt.Sprint(height) + ".json"
-}
+// Replay fixtures served by testClient. testdata/replay holds the first blocks of mainnet and
+// testdata/replay_fork a longer chain replacing the blocks after height 2 with blocks of a different chain.
+const (
+	replayFixture = "testdata/replay"
+	forkFixture   = "testdata/replay_fork"
+)
 
 const MinBlockNumber = int64(0)
 const MaxBlockNumber = int64(5)
 
-func getTestBlockHashes(mockClient *MockClient) []*chainhash.Hash {
+func blockHashes(blocks []*types.Block) []*chainhash.Hash {
 	hashes := make([]*chainhash.Hash, 0)
-	for _, block := range mockClient.Blocks() {
+	for _, block := range blocks {
 		hash, err := chainhash.NewHashFromStr(block.BlockHeader.Hash())
 		if err != nil {
 			return nil
@@ -38,25 +49,17 @@ func getTestBlockHashes(mockClient *MockClient) []*chainhash.Hash {
 
 type LoaderTestSuite struct {
 	suite.Suite
-	mockClient   *MockClient
+	client       *testClient
+	blocks       []*types.Block
 	mockDatabase *MockDatabase
 }
 
 func (s *LoaderTestSuite) SetupTest() {
-	// Parse testdata and add to test suite
-	blocks := make([]*types.Block, 0)
-	for i := MinBlockNumber; i <= MaxBlockNumber; i++ {
-		var blockResult btcjson.GetBlockVerboseTxResult
-		filename := block_filename(i)
-		if err := parseTestData(filename, &blockResult); err != nil {
-			s.T().Fatal(err)
-		}
-		var block = types.NewBlock(blockResult)
-		blocks = append(blocks, block)
-	}
-	// Create mock client and add to test suite
-	s.mockClient = NewMockClient(blocks)
-	// Create mock database and add to test suite
+	var err error
+	s.client, err = newTestClient(replayFixture)
+	s.Require().NoError(err)
+	s.blocks, err = fixtureBlocks(replayFixture)
+	s.Require().NoError(err)
 	s.mockDatabase = NewMockDatabase()
 }
 
@@ -66,7 +69,7 @@ func (s *LoaderTestSuite) TestBlockRangeHandler() {
 		msg    *LoaderMsg[BlockRange]
 	}
 
-	hashes := getTestBlockHashes(s.mockClient)
+	hashes := blockHashes(s.blocks)
 
 	tests := []struct {
 		name    string
@@ -77,7 +80,7 @@ func (s *LoaderTestSuite) TestBlockRangeHandler() {
 		{
 			name: "Test blockRangeHandler with full range",
 			args: args{
-				client: s.mockClient,
+				client: s.client,
 				msg: &LoaderMsg[BlockRange]{
 					blockRange: BlockRange{
 						Start: MinBlockNumber,
@@ -103,7 +106,7 @@ func (s *LoaderTestSuite) TestBlockRangeHandler() {
 		{
 			name: "Test blockRangeHandler with invalid block range",
 			args: args{
-				client: s.mockClient,
+				client: s.client,
 				msg: &LoaderMsg[BlockRange]{
 					blockRange: BlockRange{
 						Start: MinBlockNumber,
@@ -123,7 +126,7 @@ func (s *LoaderTestSuite) TestBlockRangeHandler() {
 
 	for _, tt := range tests {
 		s.Run(tt.name, func() {
-			got, err := blockRangeHandler(tt.args.client, tt.args.msg)
+			got, err := blockRangeHandler(context.Background(), tt.args.client, tt.args.msg)
 
 			if tt.wantErr {
 				assert.Error(s.T(), err)
@@ -142,8 +145,8 @@ func (s *LoaderTestSuite) TestBlockHashHandler() {
 		msg    *LoaderMsg[[]*chainhash.Hash]
 	}
 
-	hashes := getTestBlockHashes(s.mockClient)
-	blocks := s.mockClient.Blocks()
+	hashes := blockHashes(s.blocks)
+	blocks := s.blocks
 
 	rand.Seed(time.Now().UnixNano())
 	invalidHashBytes := make([]byte, 32)
@@ -160,7 +163,7 @@ func (s *LoaderTestSuite) TestBlockHashHandler() {
 		{
 			name: "Test blockHashHandler with full range",
 			args: args{
-				client: s.mockClient,
+				client: s.client,
 				msg: &LoaderMsg[[]*chainhash.Hash]{
 					blockRange: BlockRange{
 						Start: MinBlockNumber,
@@ -183,7 +186,7 @@ func (s *LoaderTestSuite) TestBlockHashHandler() {
 		{
 			name: "Test blockHashHandler with invalid hash",
 			args: args{
-				client: s.mockClient,
+				client: s.client,
 				msg: &LoaderMsg[[]*chainhash.Hash]{
 					blockRange: BlockRange{
 						Start: MinBlockNumber,
@@ -200,7 +203,7 @@ func (s *LoaderTestSuite) TestBlockHashHandler() {
 
 	for _, tt := range tests {
 		s.Run(tt.name, func() {
-			got, err := blockHashHandler(tt.args.client, tt.args.msg)
+			got, err := blockHashHandler(context.Background(), tt.args.client, tt.args.msg)
 
 			if tt.wantErr {
 				assert.Error(s.T(), err)
@@ -220,7 +223,7 @@ func (s *LoaderTestSuite) TestBlockHandler() {
 	}
 
 	dbtx_full := s.mockDatabase.NewMockDBTx()
-	blocks := s.mockClient.Blocks()
+	blocks := s.blocks
 
 	tests := []struct {
 		name    string
@@ -275,25 +278,24 @@ func (s *LoaderTestSuite) TestLoaderManager() {
 	// create a context without a cancel
 	ctx := context.Background()
 	// Test loader manager with full range
-	loaderManager, _ := NewLoaderManager(ctx, s.mockClient, s.mockDatabase, nil)
-	dbTx := s.mockDatabase.NewMockDBTx()
+	loaderManager, _ := NewLoaderManager(ctx, s.client, s.mockDatabase, nil)
 
 	blockRange := BlockRange{
 		Start: MinBlockNumber,
 		End:   MaxBlockNumber,
 	}
-	loaderManager.SendInput(blockRange, dbTx)
-
-	// wait for the loader manager to finish
-	loaderManager.Close()
+	assert.NoError(s.T(), loaderManager.SendInput(blockRange))
 
-	// commit the dbTx
-	_ = dbTx.Commit()
+	// wait for the loader manager to finish and commit
+	assert.NoError(s.T(), loaderManager.Close())
+	assert.ErrorIs(s.T(), loaderManager.SendInput(blockRange), ErrLoaderClosed)
 
 	// check that the dbTx has the correct data
-	correctHeaders := make([]*types.BlockHeader, len(s.mockClient.Blocks()))
+	s.Len(s.mockDatabase.DBTxs(), 1)
+	dbTx := s.mockDatabase.DBTxs()[0]
+	correctHeaders := make([]*types.BlockHeader, len(s.blocks))
 	correctTxs := make([]*types.Transaction, 0)
-	for i, block := range s.mockClient.Blocks() {
+	for i, block := range s.blocks {
 		correctHeaders[i] = block.BlockHeader
 		correctTxs = append(correctTxs, block.Transactions()...)
 	}
@@ -301,19 +303,705 @@ func (s *LoaderTestSuite) TestLoaderManager() {
 	assert.Equal(s.T(), correctHeaders, dbTx.ReceivedBlockHeaders())
 	assert.Equal(s.T(), correctTxs, dbTx.ReceivedTxs())
 	assert.Equal(s.T(), dbTx.Committed(), true)
+	assert.EqualValues(s.T(), MaxBlockNumber, s.mockDatabase.lastBlockNumber)
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerBatches() {
+	s.client.SetMaxLatency(5 * time.Millisecond)
+	opts := LoaderOptions{"batchSize": 2, "maxWorkers": 3}
+	loaderManager, err := NewLoaderManager(context.Background(), s.client, s.mockDatabase, opts)
+	s.NoError(err)
+	s.NoError(loaderManager.SendInput(BlockRange{Start: MinBlockNumber, End: 2}))
+	s.NoError(loaderManager.SendInput(BlockRange{Start: 3, End: MaxBlockNumber}))
+	s.NoError(loaderManager.Close())
+
+	// One database transaction per batch: [0, 1], [2], [3, 4], [5]
+	dbTxs := s.mockDatabase.DBTxs()
+	s.Len(dbTxs, 4)
+	for _, dbTx := range dbTxs {
+		s.True(dbTx.Committed())
+	}
+	// Batches are committed in height order even if they are fetched out of order.
+	correctHeaders := make([]*types.BlockHeader, 0)
+	for _, block := range s.blocks {
+		correctHeaders = append(correctHeaders, block.BlockHeader)
+	}
+	s.Equal(correctHeaders, s.mockDatabase.CommittedBlockHeaders())
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerReplay() {
+	// testdata/replay was recorded from a node with replay.NewRecorder.
+	replayClient, err := replay.New(replayFixture)
+	s.Require().NoError(err)
+	opts := LoaderOptions{"batchSize": 4}
+	loaderManager, err := NewLoaderManager(context.Background(), replayClient, s.mockDatabase, opts)
+	s.Require().NoError(err)
+	s.NoError(loaderManager.SendInput(BlockRange{Start: MinBlockNumber, End: MaxBlockNumber}))
+	s.NoError(loaderManager.Close())
+
+	s.Len(s.mockDatabase.DBTxs(), 2)
+	committed := s.mockDatabase.CommittedBlockHeaders()
+	s.Require().Len(committed, len(s.blocks))
+	for i, block := range s.blocks {
+		s.Equal(block.BlockHeader, committed[i])
+	}
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerInvalidOptions() {
+	_, err := NewLoaderManager(context.Background(), s.client, s.mockDatabase, LoaderOptions{"batchSize": 0})
+	s.Error(err)
+	_, err = NewLoaderManager(context.Background(), s.client, s.mockDatabase, LoaderOptions{"maxWorkers": "4"})
+	s.Error(err)
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerCommitError() {
+	commitErr := errors.New("commit failed")
+	s.mockDatabase.SetCommitErr(commitErr)
+	loaderManager, err := NewLoaderManager(context.Background(), s.client, s.mockDatabase, nil)
+	s.NoError(err)
+
+	// The first input fails to commit which stops the pipeline, so later inputs must not block.
+	s.NoError(loaderManager.SendInput(BlockRange{Start: 0, End: 1}))
+	for i := int64(2); i <= MaxBlockNumber; i++ {
+		if err := loaderManager.SendInput(BlockRange{Start: i, End: i}); err != nil {
+			s.ErrorIs(err, context.Canceled)
+			break
+		}
+	}
+	s.ErrorIs(loaderManager.Close(), commitErr)
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerNewDBTxError() {
+	newDBTxErr := errors.New("new transaction failed")
+	loaderManager, err := NewLoaderManager(context.Background(), s.client, s.mockDatabase, LoaderOptions{"batchSize": 1, "maxWorkers": 1})
+	s.Require().NoError(err)
+
+	// More failures than the window has slots: each failed batch must free its slot.
+	failures := 2*cap(loaderManager.window) + 1
+	s.mockDatabase.SetNewDBTxErr(newDBTxErr, failures)
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < failures; i++ {
+			if err := loaderManager.SendInput(BlockRange{Start: 0, End: 0}); !errors.Is(err, newDBTxErr) {
+				done <- fmt.Errorf("batch %d: got %v, want %v", i, err, newDBTxErr)
+				return
+			}
+		}
+		done <- loaderManager.SendInput(BlockRange{Start: 0, End: MaxBlockNumber})
+	}()
+	select {
+	case err := <-done:
+		s.NoError(err)
+	case <-time.After(5 * time.Second):
+		s.FailNow("SendInput blocked on a full window")
+	}
+	s.NoError(loaderManager.Close())
+	last, err := s.mockDatabase.LastBlockNumber()
+	s.NoError(err)
+	s.Equal(MaxBlockNumber, last)
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerResume() {
+	tests := []struct {
+		name            string
+		lastBlockNumber int64
+		resume          bool
+		blockRange      BlockRange
+		wantHeights     []int64
+		wantErr         bool
+	}{
+		{
+			name:            "empty database",
+			lastBlockNumber: -1,
+			blockRange:      BlockRange{Start: MinBlockNumber, End: MaxBlockNumber},
+			wantHeights:     []int64{0, 1, 2, 3, 4, 5},
+		},
+		{
+			name:            "resume after last block",
+			lastBlockNumber: 2,
+			resume:          true,
+			blockRange:      BlockRange{Start: MinBlockNumber, End: MaxBlockNumber},
+			wantHeights:     []int64{3, 4, 5},
+		},
+		{
+			name:            "resume with range already loaded",
+			lastBlockNumber: MaxBlockNumber,
+			resume:          true,
+			blockRange:      BlockRange{Start: MinBlockNumber, End: MaxBlockNumber},
+			wantHeights:     []int64{},
+		},
+		{
+			name:            "refuse overlapping range",
+			lastBlockNumber: 2,
+			blockRange:      BlockRange{Start: MinBlockNumber, End: MaxBlockNumber},
+			wantErr:         true,
+		},
+		{
+			name:            "range after last block",
+			lastBlockNumber: 2,
+			blockRange:      BlockRange{Start: 3, End: MaxBlockNumber},
+			wantHeights:     []int64{3, 4, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.mockDatabase = NewMockDatabase()
+			headers := make([]*types.BlockHeader, 0)
+			for _, block := range s.blocks[:tt.lastBlockNumber+1] {
+				headers = append(headers, block.BlockHeader)
+			}
+			s.mockDatabase.SetBlocks(headers)
+			loaderManager, err := NewLoaderManager(context.Background(), s.client, s.mockDatabase, LoaderOptions{"resume": tt.resume})
+			s.NoError(err)
+			err = loaderManager.SendInput(tt.blockRange)
+			s.NoError(loaderManager.Close())
+			if tt.wantErr {
+				s.ErrorAs(err, &ErrRangeOverlap{})
+				return
+			}
+			s.NoError(err)
+			heights := make([]int64, 0)
+			for _, header := range s.mockDatabase.CommittedBlockHeaders() {
+				heights = append(heights, header.Height())
+			}
+			s.Equal(tt.wantHeights, heights)
+		})
+	}
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerCheckRange() {
+	tests := []struct {
+		name       string
+		chainInfo  btcjson.GetBlockChainInfoResult
+		blockRange BlockRange
+		wantErr    interface{}
+		wantMsg    string
+	}{
+		{
+			name:       "range up to tip",
+			blockRange: BlockRange{Start: MinBlockNumber, End: MaxBlockNumber},
+		},
+		{
+			name:       "range beyond tip",
+			blockRange: BlockRange{Start: MinBlockNumber, End: MaxBlockNumber + 1},
+			wantErr:    &ErrRangeBeyondTip{},
+			wantMsg:    "ends above the chain tip at block 5",
+		},
+		{
+			name:       "range beyond tip during initial block download",
+			chainInfo:  btcjson.GetBlockChainInfoResult{Headers: 100, VerificationProgress: 0.05, InitialBlockDownload: true},
+			blockRange: BlockRange{Start: MinBlockNumber, End: 50},
+			wantErr:    &ErrRangeBeyondTip{},
+			wantMsg:    "initial block download, 5.00% verified",
+		},
+		{
+			name:       "range below tip during initial block download",
+			chainInfo:  btcjson.GetBlockChainInfoResult{Headers: 100, VerificationProgress: 0.05, InitialBlockDownload: true},
+			blockRange: BlockRange{Start: MinBlockNumber, End: MaxBlockNumber},
+		},
+		{
+			name:       "range pruned",
+			chainInfo:  btcjson.GetBlockChainInfoResult{Pruned: true, PruneHeight: 2},
+			blockRange: BlockRange{Start: MinBlockNumber, End: MaxBlockNumber},
+			wantErr:    &ErrRangePruned{},
+			wantMsg:    "starts below block 2",
+		},
+		{
+			name:       "range after prune height",
+			chainInfo:  btcjson.GetBlockChainInfoResult{Pruned: true, PruneHeight: 2},
+			blockRange: BlockRange{Start: 2, End: MaxBlockNumber},
+		},
+		{
+			name:       "inverted range",
+			blockRange: BlockRange{Start: 3, End: 2},
+			wantMsg:    "invalid block range 3-2",
+		},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.SetupTest()
+			s.client.SetChainInfo(tt.chainInfo)
+			loaderManager, err := NewLoaderManager(context.Background(), s.client, s.mockDatabase, nil)
+			s.Require().NoError(err)
+			err = loaderManager.SendInput(tt.blockRange)
+			s.NoError(loaderManager.Close())
+			if tt.wantMsg != "" {
+				s.ErrorContains(err, tt.wantMsg)
+				if tt.wantErr != nil {
+					s.ErrorAs(err, tt.wantErr)
+				}
+				// Nothing is loaded from a refused range.
+				s.Empty(s.mockDatabase.DBTxs())
+				return
+			}
+			s.NoError(err)
+			s.Len(s.mockDatabase.CommittedBlockHeaders(), int(tt.blockRange.End-tt.blockRange.Start+1))
+		})
+	}
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerReorg() {
+	tests := []struct {
+		name          string
+		maxReorgDepth int
+		utxoSet       bool
+		wantErr       error
+	}{
+		{
+			name:          "roll back to fork point",
+			maxReorgDepth: DefaultMaxReorgDepth,
+		},
+		{
+			name:          "reorg too deep",
+			maxReorgDepth: 1,
+			wantErr:       &ErrReorgTooDeep{},
+		},
+		{
+			name:          "roll back UTXO set",
+			maxReorgDepth: DefaultMaxReorgDepth,
+			utxoSet:       true,
+		},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.SetupTest()
+			opts := LoaderOptions{"maxReorgDepth": tt.maxReorgDepth}
+			if tt.utxoSet {
+				opts["utxoDir"] = filepath.Join(s.T().TempDir(), "utxo")
+			}
+			loaderManager, err := NewLoaderManager(context.Background(), s.client, s.mockDatabase, opts)
+			s.NoError(err)
+			s.NoError(loaderManager.SendInput(BlockRange{Start: MinBlockNumber, End: MaxBlockNumber}))
+			s.NoError(loaderManager.Close())
+
+			// Blocks after height 2 are replaced by a longer chain.
+			s.Require().NoError(s.client.SetFixture(forkFixture))
+			forkBlocks, err := fixtureBlocks(forkFixture)
+			s.Require().NoError(err)
+			forkBlocks = forkBlocks[:MaxBlockNumber+2]
+
+			loaderManager, err = NewLoaderManager(context.Background(), s.client, s.mockDatabase, opts)
+			s.NoError(err)
+			s.NoError(loaderManager.SendInput(BlockRange{Start: MaxBlockNumber + 1, End: MaxBlockNumber + 1}))
+			err = loaderManager.Close()
+			if tt.wantErr != nil {
+				s.ErrorAs(err, tt.wantErr)
+				return
+			}
+			s.NoError(err)
+
+			wantHashes := make([]string, len(forkBlocks))
+			for i, block := range forkBlocks {
+				wantHashes[i] = block.Hash()
+			}
+			s.Equal(wantHashes, s.mockDatabase.BlockHashes())
+			if tt.utxoSet {
+				height, hash := loaderManager.utxos.Tip()
+				s.Equal(int64(len(forkBlocks)-1), height)
+				s.Equal(wantHashes[len(wantHashes)-1], hash)
+			}
+		})
+	}
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerReorgInFlight() {
+	// The chain is reorganized after height 2 once the hashes of block 4 are requested. With a single worker
+	// hashes are requested in height order, so block 3 of the old chain is committed before block 4 of the new
+	// chain reveals the reorg while block 5 is still in the pipeline.
+	s.Require().NoError(s.client.SetFixtureAbove(3, forkFixture))
+	s.client.SetMaxLatency(5 * time.Millisecond)
+	opts := LoaderOptions{"batchSize": 1, "maxWorkers": 1}
+	loaderManager, err := NewLoaderManager(context.Background(), s.client, s.mockDatabase, opts)
+	s.Require().NoError(err)
+	s.NoError(loaderManager.SendInput(BlockRange{Start: MinBlockNumber, End: MaxBlockNumber}))
+	s.NoError(loaderManager.Close())
+
+	committed := make([]string, 0)
+	for _, header := range s.mockDatabase.CommittedBlockHeaders() {
+		committed = append(committed, header.Hash())
+	}
+	s.Contains(committed, s.blocks[3].Hash())
+
+	forkBlocks, err := fixtureBlocks(forkFixture)
+	s.Require().NoError(err)
+	wantHashes := make([]string, 0)
+	for _, block := range forkBlocks[:MaxBlockNumber+1] {
+		wantHashes = append(wantHashes, block.Hash())
+	}
+	s.Equal(wantHashes, s.mockDatabase.BlockHashes())
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerCancel() {
+	// Fetching blocks would take an hour.
+	s.client.SetMaxLatency(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	loaderManager, err := NewLoaderManager(ctx, s.client, s.mockDatabase, nil)
+	s.Require().NoError(err)
+	s.NoError(loaderManager.SendInput(BlockRange{Start: MinBlockNumber, End: MaxBlockNumber}))
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	s.ErrorIs(loaderManager.Close(), context.Canceled)
+	s.Less(time.Since(start), time.Minute)
+	s.Empty(s.mockDatabase.BlockHashes())
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerFollow() {
+	loaderManager, err := NewLoaderManager(context.Background(), s.client, s.mockDatabase, LoaderOptions{"batchSize": 1, "maxWorkers": 1})
+	s.NoError(err)
+	s.Error(loaderManager.Follow(context.Background(), -1, time.Millisecond))
+	s.Error(loaderManager.Follow(context.Background(), 0, 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s.NoError(loaderManager.Follow(ctx, 2, time.Millisecond))
+	s.NoError(loaderManager.Close())
+
+	// Blocks within 2 confirmations of the tip are not loaded.
+	wantHashes := make([]string, 0)
+	for _, block := range s.blocks[:MaxBlockNumber-1] {
+		wantHashes = append(wantHashes, block.Hash())
+	}
+	s.Equal(wantHashes, s.mockDatabase.BlockHashes())
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerFollowChainInfoPerPoll() {
+	loaderManager, err := NewLoaderManager(context.Background(), s.client, s.mockDatabase, LoaderOptions{"batchSize": 1, "maxWorkers": 1})
+	s.Require().NoError(err)
+
+	// The blocks are loaded in 3 steps of 2 blocks during the first poll, the next one is an hour away.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- loaderManager.Follow(ctx, 0, time.Hour) }()
+	s.Eventually(func() bool { return loaderManager.NextHeight() == MaxBlockNumber+1 }, 5*time.Second, time.Millisecond)
+	cancel()
+	s.NoError(<-done)
+	s.NoError(loaderManager.Close())
+
+	s.Equal(1, s.client.ChainInfoCalls())
+	s.Len(s.mockDatabase.BlockHashes(), len(s.blocks))
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerWithoutChainInfo() {
+	// A fixture recorded without chain info can't be checked, so ranges are sent as is.
+	dir := s.T().TempDir()
+	s.Require().NoError(replay.Write(dir, s.blocks))
+	path := filepath.Join(dir, "chain.json")
+	raw, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	var chain map[string]json.RawMessage
+	s.Require().NoError(json.Unmarshal(raw, &chain))
+	delete(chain, "chain_info")
+	raw, err = json.Marshal(chain)
+	s.Require().NoError(err)
+	s.Require().NoError(os.WriteFile(path, raw, 0644))
+	replayClient, err := replay.New(dir)
+	s.Require().NoError(err)
+	_, err = replayClient.GetChainInfo(context.Background())
+	s.Require().ErrorAs(err, new(replay.ErrNotRecorded))
+
+	loaderManager, err := NewLoaderManager(context.Background(), replayClient, s.mockDatabase, LoaderOptions{"batchSize": 2})
+	s.Require().NoError(err)
+	s.NoError(loaderManager.SendInput(BlockRange{Start: MinBlockNumber, End: 2}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s.NoError(loaderManager.Follow(ctx, 0, time.Millisecond))
+	s.NoError(loaderManager.Close())
+	s.Len(s.mockDatabase.BlockHashes(), len(s.blocks))
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerPrevouts() {
+	config := chaingen.DefaultConfig()
+	config.CoinbaseMaturity = 1
+	generated, err := chaingen.Generate(config, 30)
+	s.Require().NoError(err)
+	chain := make([]*wire.MsgBlock, len(generated))
+	for i, blk := range generated {
+		chain[i] = blk.MsgBlock
+	}
+	server := rpctest.NewServer(config.Params, chain)
+	defer server.Close()
+	server.SetTxIndex(true)
+	rpcClient, err := rpcclient.New(server.ConnConfig(), nil)
+	s.Require().NoError(err)
+	defer rpcClient.Shutdown()
+
+	// The node doesn't give prevouts with the blocks, so they are taken from the batch or looked up.
+	opts := LoaderOptions{"batchSize": 7, "prevouts": true}
+	loaderManager, err := NewLoaderManager(context.Background(), rpcClient, s.mockDatabase, opts)
+	s.Require().NoError(err)
+	s.NoError(loaderManager.SendInput(BlockRange{Start: 1, End: 30}))
+	s.NoError(loaderManager.Close())
+
+	// They match the prevouts given by getblock with verbosity 3.
+	rpcClient.EnablePrevouts()
+	hashes := make([]*chainhash.Hash, 30)
+	for i := range hashes {
+		hash := chain[i+1].BlockHash()
+		hashes[i] = &hash
+	}
+	blocks, err := rpcClient.GetBlocks(context.Background(), hashes)
+	s.Require().NoError(err)
+	var want []*types.Prevout
+	for _, blk := range blocks {
+		for _, tx := range blk.Transactions() {
+			for _, in := range tx.Vin() {
+				want = append(want, in.Prevout())
+			}
+		}
+	}
+	var got []*types.Prevout
+	for _, tx := range s.mockDatabase.CommittedTxs() {
+		for _, in := range tx.Vin() {
+			got = append(got, in.Prevout())
+			s.Equal(tx.IsCoinbase(), in.Prevout() == nil)
+		}
+	}
+	s.Equal(want, got)
+
+	// Clients that can't look up prevouts fail the batches that need them.
+	dir := s.T().TempDir()
+	replayBlocks := make([]*types.Block, len(generated))
+	for i, blk := range generated {
+		replayBlocks[i] = blk.Block()
+	}
+	s.Require().NoError(replay.Write(dir, replayBlocks))
+	replayClient, err := replay.New(dir)
+	s.Require().NoError(err)
+	loaderManager, err = NewLoaderManager(context.Background(), replayClient, NewMockDatabase(), opts)
+	s.Require().NoError(err)
+	s.NoError(loaderManager.SendInput(BlockRange{Start: 20, End: 25}))
+	s.ErrorContains(loaderManager.Close(), "can't look up prevouts")
+}
+
+// prevoutsClient returns the given prevouts to every lookup.
+type prevoutsClient struct {
+	client.Client
+	prevouts []*types.Prevout
+}
+
+func (c prevoutsClient) GetPrevouts(ctx context.Context, outpoints []wire.OutPoint) ([]*types.Prevout, error) {
+	return c.prevouts, nil
+}
+
+func (s *LoaderTestSuite) TestPrevoutHandlerInvalidResult() {
+	config := chaingen.DefaultConfig()
+	config.CoinbaseMaturity = 1
+	generated, err := chaingen.Generate(config, 10)
+	s.Require().NoError(err)
+	// The last block spends outputs of earlier blocks, which are looked up, and of its own transactions.
+	inBlock := make(map[string]bool)
+	for _, tx := range generated[10].Block().Transactions() {
+		inBlock[tx.TxID()] = true
+	}
+	var prevouts []*types.Prevout
+	for _, tx := range generated[10].Block().Transactions()[1:] {
+		for _, in := range tx.Vin() {
+			if !inBlock[in.TxID()] {
+				prevouts = append(prevouts, types.NewPrevoutFromScript(1, nil, "nonstandard", nil, 1, false))
+			}
+		}
+	}
+	s.Require().NotEmpty(prevouts)
+	withNil := append([]*types.Prevout(nil), prevouts...)
+	withNil[len(withNil)-1] = nil
+
+	for _, result := range [][]*types.Prevout{prevouts[1:], withNil} {
+		block := generated[10].Block()
+		msg := &LoaderMsg[[]*types.Block]{blockRange: BlockRange{Start: 10, End: 10}, data: []*types.Block{block}}
+		_, err := prevoutHandler(context.Background(), prevoutsClient{s.client, result}, msg)
+		s.ErrorContains(err, "resolving prevouts of blocks 10 to 10")
+		// No looked up prevout is stored.
+		for _, tx := range block.Transactions()[1:] {
+			for _, in := range tx.Vin() {
+				if !inBlock[in.TxID()] {
+					s.Nil(in.Prevout())
+				}
+			}
+		}
+	}
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerUTXOSet() {
+	config := chaingen.DefaultConfig()
+	config.CoinbaseMaturity = 1
+	generated, err := chaingen.Generate(config, 30)
+	s.Require().NoError(err)
+	blocks := make([]*types.Block, len(generated))
+	var fees int64
+	for i, blk := range generated {
+		blocks[i] = blk.Block()
+		fees += blk.Fees
+	}
+	dir := s.T().TempDir()
+	s.Require().NoError(replay.Write(filepath.Join(dir, "replay"), blocks))
+	replayClient, err := replay.New(filepath.Join(dir, "replay"))
+	s.Require().NoError(err)
+
+	// The replay client can't look up prevouts, they are all resolved by the UTXO set.
+	utxoDir := filepath.Join(dir, "utxo")
+	opts := LoaderOptions{"batchSize": 7, "utxoDir": utxoDir, "utxoSnapshot": filepath.Join(dir, "utxo.snapshot")}
+	loaderManager, err := NewLoaderManager(context.Background(), replayClient, s.mockDatabase, opts)
+	s.Require().NoError(err)
+	s.NoError(loaderManager.SendInput(BlockRange{Start: 0, End: 20}))
+	s.NoError(loaderManager.Close())
+
+	// The set is reopened, or restored from its snapshot, where the database stopped.
+	s.Require().NoError(os.RemoveAll(utxoDir))
+	loaderManager, err = NewLoaderManager(context.Background(), replayClient, s.mockDatabase, opts)
+	s.Require().NoError(err)
+	s.NoError(loaderManager.SendInput(BlockRange{Start: 21, End: 25}))
+	s.NoError(loaderManager.Close())
+	loaderManager, err = NewLoaderManager(context.Background(), replayClient, s.mockDatabase, opts)
+	s.Require().NoError(err)
+	s.NoError(loaderManager.SendInput(BlockRange{Start: 26, End: 30}))
+	s.NoError(loaderManager.Close())
+
+	var got btcutil.Amount
+	for _, tx := range s.mockDatabase.CommittedTxs() {
+		for _, in := range tx.Vin() {
+			s.Equal(tx.IsCoinbase(), in.Prevout() == nil)
+		}
+		fee, ok := tx.Fee()
+		s.Require().True(ok)
+		got += fee
+	}
+	s.Equal(btcutil.Amount(fees), got)
+
+	// A set that doesn't match the database is refused.
+	opts["utxoDir"], opts["utxoSnapshot"] = filepath.Join(dir, "empty"), ""
+	_, err = NewLoaderManager(context.Background(), replayClient, s.mockDatabase, opts)
+	s.ErrorContains(err, "UTXO set")
+}
+
+func (s *LoaderTestSuite) TestLoaderManagerSnapshotMempool() {
+	config := chaingen.DefaultConfig()
+	config.CoinbaseMaturity = 1
+	generated, err := chaingen.Generate(config, 10)
+	s.Require().NoError(err)
+	chain := make([]*wire.MsgBlock, len(generated)-1)
+	for i := range chain {
+		chain[i] = generated[i].MsgBlock
+	}
+	server := rpctest.NewServer(config.Params, chain)
+	defer server.Close()
+	mempool := generated[10].Transactions[1:]
+	server.SetMempool(mempool)
+	rpcClient, err := rpcclient.New(server.ConnConfig(), nil)
+	s.Require().NoError(err)
+	defer rpcClient.Shutdown()
+
+	loaderManager, err := NewLoaderManager(context.Background(), rpcClient, s.mockDatabase, nil)
+	s.Require().NoError(err)
+	s.Error(loaderManager.SnapshotMempool(context.Background(), 0, 1))
+	s.NoError(loaderManager.SnapshotMempool(context.Background(), time.Millisecond, 2))
+	s.NoError(loaderManager.Close())
+
+	// Each snapshot holds every transaction of the mempool.
+	txs := s.mockDatabase.CommittedMempoolTxs()
+	s.Require().Len(txs, 2*len(mempool))
+	for i, tx := range txs {
+		s.Equal(mempool[i%len(mempool)].TxHash().String(), tx.TxID())
+		s.Positive(tx.FeeRate())
+	}
+	s.Empty(s.mockDatabase.CommittedBlockHeaders())
+
+	// Clients that can't fetch the mempool fail.
+	loaderManager, err = NewLoaderManager(context.Background(), s.client, NewMockDatabase(), nil)
+	s.Require().NoError(err)
+	s.ErrorContains(loaderManager.SnapshotMempool(context.Background(), time.Millisecond, 1), "can't fetch the mempool")
+	s.NoError(loaderManager.Close())
+}
+
+func TestCheckContinuity(t *testing.T) {
+	blocks, err := fixtureBlocks(replayFixture)
+	assert.NoError(t, err)
+	forkBlocks, err := fixtureBlocks(forkFixture)
+	assert.NoError(t, err)
+
+	assert.NoError(t, checkContinuity(chainTip{height: -1}, blocks))
+	assert.NoError(t, checkContinuity(chainTip{2, blocks[2].Hash()}, blocks[3:]))
+	assert.NoError(t, checkContinuity(chainTip{2, blocks[2].Hash()}, forkBlocks[3:]))
+	assert.ErrorAs(t, checkContinuity(chainTip{3, blocks[3].Hash()}, forkBlocks[4:]), &ErrReorg{})
+	// Batches fetched while the chain changed are inconsistent on their own.
+	assert.ErrorAs(t, checkContinuity(chainTip{height: -1}, append(blocks[:4:4], forkBlocks[4:]...)), &ErrReorg{})
+}
+
+func TestBlockRangeSplit(t *testing.T) {
+	tests := []struct {
+		name       string
+		blockRange BlockRange
+		size       int64
+		want       []BlockRange
+	}{
+		{
+			name:       "exact multiple",
+			blockRange: BlockRange{Start: 0, End: 5},
+			size:       3,
+			want:       []BlockRange{{0, 2}, {3, 5}},
+		},
+		{
+			name:       "remainder",
+			blockRange: BlockRange{Start: 10, End: 14},
+			size:       2,
+			want:       []BlockRange{{10, 11}, {12, 13}, {14, 14}},
+		},
+		{
+			name:       "smaller than size",
+			blockRange: BlockRange{Start: 3, End: 4},
+			size:       100,
+			want:       []BlockRange{{3, 4}},
+		},
+		{
+			name:       "invalid size",
+			blockRange: BlockRange{Start: 3, End: 4},
+			size:       0,
+			want:       []BlockRange{{3, 4}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.blockRange.Split(tt.size))
+		})
+	}
 }
 
 func TestLoaderTestSuite(t *testing.T) {
 	suite.Run(t, new(LoaderTestSuite))
 }
 
-func parseTestData[T any](filename string, v *T) error {
-	data, err := os.ReadFile(filename)
+func BenchmarkLoaderManager(b *testing.B) {
+	config := chaingen.DefaultConfig()
+	config.CoinbaseMaturity = 1
+	config.TxsPerBlock = 100
+	generated, err := chaingen.Generate(config, 500)
+	if err != nil {
+		b.Fatal(err)
+	}
+	blocks := make([]*types.Block, len(generated))
+	for i, blk := range generated {
+		blocks[i] = blk.Block()
+	}
+	dir := b.TempDir()
+	if err := replay.Write(dir, blocks); err != nil {
+		b.Fatal(err)
+	}
+	replayClient, err := replay.New(dir)
 	if err != nil {
-		return err
+		b.Fatal(err)
 	}
-	if err := json.Unmarshal(data, v); err != nil {
-		return err
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		loaderManager, err := NewLoaderManager(context.Background(), replayClient, NewMockDatabase(), LoaderOptions{"batchSize": 50})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := loaderManager.SendInput(BlockRange{Start: 0, End: int64(len(blocks) - 1)}); err != nil {
+			b.Fatal(err)
+		}
+		if err := loaderManager.Close(); err != nil {
+			b.Fatal(err)
+		}
 	}
-	return nil
 }
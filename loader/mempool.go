@@ -0,0 +1,68 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+)
+
+// SnapshotMempool loads a snapshot of the client's mempool into the database every `interval` until ctx is
+// cancelled, or until `count` snapshots were loaded if count is positive. The first snapshot is taken right away.
+// Each snapshot is committed in its own database transaction, independently of the blocks loaded by the pipeline.
+// The client must implement client.MempoolClient.
+//
+// SnapshotMempool returns nil when ctx is cancelled.
+func (loader *LoaderManager) SnapshotMempool(ctx context.Context, interval time.Duration, count int) error {
+	if interval <= 0 {
+		return fmt.Errorf("snapshot interval (%v) must be positive", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for n := 0; count <= 0 || n < count; n++ {
+		if n > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-loader.ctx.Done():
+				return loader.ctx.Err()
+			case <-ticker.C:
+			}
+		}
+		if err := loader.snapshotMempool(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotMempool loads the transactions currently in the client's mempool into the database.
+func (loader *LoaderManager) snapshotMempool(ctx context.Context) error {
+	loader.mu.Lock()
+	closed := loader.closed
+	loader.mu.Unlock()
+	if closed {
+		return ErrLoaderClosed
+	}
+	txs, err := client.GetMempool(ctx, loader.client)
+	if err != nil {
+		return fmt.Errorf("getting mempool: %w", err)
+	}
+	dbTx, err := loader.db.NewDBTx()
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		dbTx.AddMempoolTx(tx)
+	}
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("committing mempool snapshot: %w", err)
+	}
+	log.Printf("loaded mempool snapshot of %d transactions\n", len(txs))
+	return nil
+}
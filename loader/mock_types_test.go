@@ -1,129 +1,357 @@
 package loader
 
 import (
-	"fmt"
+	"context"
+	"math/rand"
+	"sync"
+	"time"
 
+	"github.com/IlliniBlockchain/etl-bitcoin/client/replay"
 	"github.com/IlliniBlockchain/etl-bitcoin/database"
 	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
-type MockClient struct {
-	blocks         []*types.Block
-	maxBlockNumber int64
-	minBlockNumber int64
+// testClient serves the chain recorded in a replay fixture in place of a node. Responses can be delayed, the
+// chain replaced by the one of another fixture, e.g. to simulate a chain reorganization, and the reported
+// state of the chain overridden. Like a node keeps stale blocks, blocks of replaced chains are still served
+// by hash.
+type testClient struct {
+	mu         sync.Mutex
+	fixture    *replay.Client
+	replaced   []*replay.Client
+	maxLatency time.Duration
+	chainInfo  *btcjson.GetBlockChainInfoResult
+	// chainInfoCalls counts the calls to GetChainInfo.
+	chainInfoCalls int
+	// next replaces fixture once the hashes of blocks above nextHeight are requested.
+	next       *replay.Client
+	nextHeight int64
 }
 
-func NewMockClient(blocks []*types.Block) *MockClient {
-	return &MockClient{
-		blocks:         blocks,
-		maxBlockNumber: int64(len(blocks)) - 1,
-		minBlockNumber: 0,
+func newTestClient(dir string) (*testClient, error) {
+	c := &testClient{}
+	if err := c.SetFixture(dir); err != nil {
+		return nil, err
 	}
+	return c, nil
 }
 
-func (c *MockClient) MaxBlockNumber() int64 {
-	return c.maxBlockNumber
+// SetFixture replaces the chain served by the client with the one recorded in dir.
+func (c *testClient) SetFixture(dir string) error {
+	fixture, err := replay.New(dir)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.replace(fixture)
+	return nil
+}
+
+// SetFixtureAbove replaces the chain served by the client with the one recorded in dir once the hashes of blocks
+// above height are requested, as if the chain was reorganized while earlier blocks were being loaded.
+func (c *testClient) SetFixtureAbove(height int64, dir string) error {
+	fixture, err := replay.New(dir)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next = fixture
+	c.nextHeight = height
+	return nil
+}
+
+// replace serves fixture from now on. c.mu must be held.
+func (c *testClient) replace(fixture *replay.Client) {
+	if c.fixture != nil {
+		c.replaced = append(c.replaced, c.fixture)
+	}
+	c.fixture = fixture
+}
+
+// SetMaxLatency makes every request for block hashes or blocks sleep for a random duration up to maxLatency.
+func (c *testClient) SetMaxLatency(maxLatency time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxLatency = maxLatency
 }
 
-func (c *MockClient) MinBlockNumber() int64 {
-	return c.minBlockNumber
+// SetChainInfo overrides the chain info returned by the client. The tip is always the one of the fixture.
+func (c *testClient) SetChainInfo(chainInfo btcjson.GetBlockChainInfoResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.chainInfo = &chainInfo
 }
 
-func (c *MockClient) Blocks() []*types.Block {
-	if c.blocks == nil {
+// ChainInfoCalls returns the number of times GetChainInfo was called.
+func (c *testClient) ChainInfoCalls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.chainInfoCalls
+}
+
+func (c *testClient) current() *replay.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fixture
+}
+
+// sleep waits for a random duration up to the maximum latency.
+func (c *testClient) sleep(ctx context.Context) error {
+	c.mu.Lock()
+	maxLatency := c.maxLatency
+	c.mu.Unlock()
+	if maxLatency <= 0 {
 		return nil
 	}
-	blocksCpy := make([]*types.Block, len(c.blocks))
-	for i, block := range c.blocks {
-		cpy := *block
-		blocksCpy[i] = &cpy
+	select {
+	case <-time.After(time.Duration(rand.Int63n(int64(maxLatency)))):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return blocksCpy
 }
 
-func (c *MockClient) GetBlockHashesByRange(minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error) {
-	// return error if minBlockNumber is less than minBlockNumber or maxBlockNumber is greater than maxBlockNumber
-	if minBlockNumber < c.minBlockNumber || maxBlockNumber > c.maxBlockNumber {
-		return nil, fmt.Errorf("invalid block range for mock client")
+func (c *testClient) GetBlockCount(ctx context.Context) (int64, error) {
+	return c.current().GetBlockCount(ctx)
+}
+
+func (c *testClient) GetBestBlock(ctx context.Context) (*chainhash.Hash, int64, error) {
+	return c.current().GetBestBlock(ctx)
+}
+
+func (c *testClient) GetChainInfo(ctx context.Context) (*types.ChainInfo, error) {
+	info, err := c.current().GetChainInfo(ctx)
+	c.mu.Lock()
+	c.chainInfoCalls++
+	override := c.chainInfo
+	c.mu.Unlock()
+	if err != nil || override == nil {
+		return info, err
 	}
-	hashes := make([]*chainhash.Hash, 0)
-	for _, block := range c.blocks {
-		hash, err := chainhash.NewHashFromStr(block.BlockHeader.Hash())
-		if err != nil {
-			return nil, err
-		}
-		hashes = append(hashes, hash)
+	chainInfo := *override
+	chainInfo.Blocks = int32(info.Blocks())
+	chainInfo.BestBlockHash = info.BestBlockHash()
+	if chainInfo.Headers < chainInfo.Blocks {
+		chainInfo.Headers = chainInfo.Blocks
 	}
-	return hashes, nil
+	return types.NewChainInfo(chainInfo), nil
 }
 
-func (c *MockClient) GetBlockHeaders(hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
-	// getblock headers by searching for the block
-	headers := make([]*types.BlockHeader, 0)
-	for _, hash := range hashes {
-		found := false
-		for _, block := range c.blocks {
-			if block.BlockHeader.Hash() == hash.String() {
-				headers = append(headers, block.BlockHeader)
-				found = true
-			}
-		}
-		if !found {
-			return nil, fmt.Errorf("block not found")
-		}
+func (c *testClient) GetBlockHashesByRange(ctx context.Context, minBlockNumber, maxBlockNumber int64) ([]*chainhash.Hash, error) {
+	c.mu.Lock()
+	if c.next != nil && maxBlockNumber > c.nextHeight {
+		c.replace(c.next)
+		c.next = nil
+	}
+	fixture := c.fixture
+	c.mu.Unlock()
+	if err := c.sleep(ctx); err != nil {
+		return nil, err
+	}
+	return fixture.GetBlockHashesByRange(ctx, minBlockNumber, maxBlockNumber)
+}
+
+func (c *testClient) GetBlockHeaders(ctx context.Context, hashes []*chainhash.Hash) ([]*types.BlockHeader, error) {
+	blocks, err := c.blocks(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	headers := make([]*types.BlockHeader, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.BlockHeader
 	}
 	return headers, nil
 }
 
-func (c *MockClient) GetBlocks(hashes []*chainhash.Hash) ([]*types.Block, error) {
-	// get blocks by searching for the block
-	blocks := make([]*types.Block, 0)
-	for _, hash := range hashes {
-		found := false
-		for _, block := range c.blocks {
-			if block.BlockHeader.Hash() == hash.String() {
-				blocks = append(blocks, block)
-				found = true
+func (c *testClient) GetBlocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	if err := c.sleep(ctx); err != nil {
+		return nil, err
+	}
+	return c.blocks(ctx, hashes)
+}
+
+// blocks returns the blocks with the given hashes from the current fixture or the replaced ones.
+func (c *testClient) blocks(ctx context.Context, hashes []*chainhash.Hash) ([]*types.Block, error) {
+	c.mu.Lock()
+	fixtures := append([]*replay.Client{c.fixture}, c.replaced...)
+	c.mu.Unlock()
+	blocks := make([]*types.Block, len(hashes))
+	for i, hash := range hashes {
+		var err error
+		for _, fixture := range fixtures {
+			var found []*types.Block
+			if found, err = fixture.GetBlocks(ctx, []*chainhash.Hash{hash}); err == nil {
+				blocks[i] = found[0]
+				break
 			}
 		}
-		if !found {
-			return nil, fmt.Errorf("block not found")
+		if err != nil {
+			return nil, err
 		}
 	}
 	return blocks, nil
 }
 
+// fixtureBlocks returns every block of the chain recorded in the replay fixture in dir, ordered by height.
+func fixtureBlocks(dir string) ([]*types.Block, error) {
+	fixture, err := replay.New(dir)
+	if err != nil {
+		return nil, err
+	}
+	count, err := fixture.GetBlockCount(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := fixture.GetBlockHashesByRange(context.Background(), 0, count)
+	if err != nil {
+		return nil, err
+	}
+	return fixture.GetBlocks(context.Background(), hashes)
+}
+
 type MockDatabase struct {
+	lastBlockNumber int64
+	blockHashes     map[int64]string
+	dbTxs           []*MockDBTx
+	commitErr       error
+	// newDBTxErr fails the next newDBTxErrs calls to NewDBTx.
+	newDBTxErr  error
+	newDBTxErrs int
 }
 
 func NewMockDatabase() *MockDatabase {
-	return &MockDatabase{}
+	return &MockDatabase{lastBlockNumber: -1, blockHashes: make(map[int64]string)}
+}
+
+// SetBlocks stores block headers as if they were committed before.
+func (db *MockDatabase) SetBlocks(headers []*types.BlockHeader) {
+	for _, header := range headers {
+		db.addBlock(header)
+	}
+}
+
+func (db *MockDatabase) addBlock(header *types.BlockHeader) {
+	db.blockHashes[header.Height()] = header.Hash()
+	if header.Height() > db.lastBlockNumber {
+		db.lastBlockNumber = header.Height()
+	}
 }
 
 func (db *MockDatabase) LastBlockNumber() (int64, error) {
-	return 0, nil
+	return db.lastBlockNumber, nil
+}
+
+func (db *MockDatabase) BlockHash(height int64) (string, error) {
+	hash, ok := db.blockHashes[height]
+	if !ok {
+		return "", database.NewErrBlockNotFound(height)
+	}
+	return hash, nil
+}
+
+func (db *MockDatabase) RemoveBlocksAbove(height int64) error {
+	for blockHeight := range db.blockHashes {
+		if blockHeight > height {
+			delete(db.blockHashes, blockHeight)
+		}
+	}
+	if db.lastBlockNumber > height {
+		db.lastBlockNumber = height
+	}
+	return nil
+}
+
+// BlockHashes returns the hashes of the blocks in the database ordered by height.
+func (db *MockDatabase) BlockHashes() []string {
+	hashes := make([]string, 0, len(db.blockHashes))
+	for height := int64(0); height <= db.lastBlockNumber; height++ {
+		if hash, ok := db.blockHashes[height]; ok {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+// SetCommitErr makes every commit to the database fail with err.
+func (db *MockDatabase) SetCommitErr(err error) {
+	db.commitErr = err
+}
+
+// SetNewDBTxErr makes the next count calls to NewDBTx fail with err.
+func (db *MockDatabase) SetNewDBTxErr(err error, count int) {
+	db.newDBTxErr, db.newDBTxErrs = err, count
 }
 
 func (db *MockDatabase) NewDBTx() (database.DBTx, error) {
-	return db.NewMockDBTx(), nil
+	if db.newDBTxErrs > 0 {
+		db.newDBTxErrs--
+		return nil, db.newDBTxErr
+	}
+	dbTx := db.NewMockDBTx()
+	db.dbTxs = append(db.dbTxs, dbTx)
+	return dbTx, nil
 }
 
 func (db *MockDatabase) NewMockDBTx() *MockDBTx {
 	return &MockDBTx{
+		db:                   db,
 		receivedBlockHeaders: make([]*types.BlockHeader, 0),
 		receivedTxs:          make([]*types.Transaction, 0),
 		committed:            false,
 	}
 }
 
+// DBTxs returns the database transactions created through NewDBTx.
+func (db *MockDatabase) DBTxs() []*MockDBTx {
+	return db.dbTxs
+}
+
+// CommittedBlockHeaders returns the block headers of all committed database transactions in commit order.
+func (db *MockDatabase) CommittedBlockHeaders() []*types.BlockHeader {
+	headers := make([]*types.BlockHeader, 0)
+	for _, dbTx := range db.dbTxs {
+		if dbTx.Committed() {
+			headers = append(headers, dbTx.ReceivedBlockHeaders()...)
+		}
+	}
+	return headers
+}
+
+// CommittedTxs returns the transactions of all committed database transactions in commit order.
+func (db *MockDatabase) CommittedTxs() []*types.Transaction {
+	txs := make([]*types.Transaction, 0)
+	for _, dbTx := range db.dbTxs {
+		if dbTx.Committed() {
+			txs = append(txs, dbTx.ReceivedTxs()...)
+		}
+	}
+	return txs
+}
+
+// CommittedMempoolTxs returns the unconfirmed transactions of all committed database transactions in commit order.
+func (db *MockDatabase) CommittedMempoolTxs() []*types.MempoolTx {
+	txs := make([]*types.MempoolTx, 0)
+	for _, dbTx := range db.dbTxs {
+		if dbTx.Committed() {
+			txs = append(txs, dbTx.receivedMempoolTxs...)
+		}
+	}
+	return txs
+}
+
 func (db *MockDatabase) Close() error {
 	return nil
 }
 
 type MockDBTx struct {
+	db                   *MockDatabase
 	receivedBlockHeaders []*types.BlockHeader
 	receivedTxs          []*types.Transaction
+	receivedMempoolTxs   []*types.MempoolTx
 	committed            bool
 }
 
@@ -135,8 +363,18 @@ func (tx *MockDBTx) AddTransaction(txn *types.Transaction) {
 	tx.receivedTxs = append(tx.receivedTxs, txn)
 }
 
+func (tx *MockDBTx) AddMempoolTx(txn *types.MempoolTx) {
+	tx.receivedMempoolTxs = append(tx.receivedMempoolTxs, txn)
+}
+
 func (tx *MockDBTx) Commit() error {
+	if tx.db.commitErr != nil {
+		return tx.db.commitErr
+	}
 	tx.committed = true
+	for _, header := range tx.receivedBlockHeaders {
+		tx.db.addBlock(header)
+	}
 	return nil
 }
 
@@ -0,0 +1,76 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/client"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// prevoutHandler is a LoaderFunc that resolves the outputs spent by the inputs of a batch of blocks. Inputs whose
+// prevout was given with the blocks (`getblock` with verbosity = 3) are left as is. Outputs created within the
+// batch are taken from its blocks and the others are looked up with the client, e.g. with `getrawtransaction`.
+func prevoutHandler(ctx context.Context, c client.Client, msg *LoaderMsg[[]*types.Block]) (*LoaderMsg[[]*types.Block], error) {
+	type output struct {
+		tx     *types.Transaction
+		height int64
+	}
+	outputs := make(map[chainhash.Hash]output)
+	for _, block := range msg.data {
+		for _, tx := range block.Transactions() {
+			txid, err := chainhash.NewHashFromStr(tx.TxID())
+			if err != nil {
+				return nil, err
+			}
+			outputs[*txid] = output{tx, block.Height()}
+		}
+	}
+
+	var outpoints []wire.OutPoint
+	var missing []*types.Vin
+	for _, block := range msg.data {
+		for _, tx := range block.Transactions() {
+			if tx.IsCoinbase() {
+				continue
+			}
+			for _, in := range tx.Vin() {
+				if in.Prevout() != nil {
+					continue
+				}
+				outpoint, err := in.OutPoint()
+				if err != nil {
+					return nil, fmt.Errorf("input of transaction %s: %w", tx, err)
+				}
+				if out, ok := outputs[outpoint.Hash]; ok && outpoint.Index < uint32(len(out.tx.Vout())) {
+					in.SetPrevout(types.NewPrevout(out.tx.Vout()[outpoint.Index], out.height, out.tx.IsCoinbase()))
+					continue
+				}
+				outpoints = append(outpoints, outpoint)
+				missing = append(missing, in)
+			}
+		}
+	}
+	if len(outpoints) > 0 {
+		prevouts, err := client.GetPrevouts(ctx, c, outpoints)
+		if err != nil {
+			return nil, fmt.Errorf("resolving prevouts of blocks %d to %d: %w", msg.blockRange.Start, msg.blockRange.End, err)
+		}
+		if len(prevouts) != len(missing) {
+			return nil, fmt.Errorf("resolving prevouts of blocks %d to %d: got %d prevouts for %d inputs",
+				msg.blockRange.Start, msg.blockRange.End, len(prevouts), len(missing))
+		}
+		for i, prevout := range prevouts {
+			if prevout == nil {
+				return nil, fmt.Errorf("resolving prevouts of blocks %d to %d: no prevout for %v",
+					msg.blockRange.Start, msg.blockRange.End, outpoints[i])
+			}
+		}
+		for i, in := range missing {
+			in.SetPrevout(prevouts[i])
+		}
+	}
+	return msg, nil
+}
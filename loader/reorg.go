@@ -0,0 +1,114 @@
+package loader
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/database"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+)
+
+// DefaultMaxReorgDepth is the default number of blocks a LoaderManager rolls back to find a fork point.
+const DefaultMaxReorgDepth = 100
+
+// maxRefetchAttempts is the number of times blocks are refetched after a reorg before giving up,
+// in case the chain keeps changing while they are fetched.
+const maxRefetchAttempts = 3
+
+// chainTip represents the last block loaded into the database.
+type chainTip struct {
+	height int64
+	hash   string
+}
+
+// checkContinuity checks that blocks extend tip and each other. It returns an ErrReorg if a block
+// does not build on the block before it.
+func checkContinuity(tip chainTip, blocks []*types.Block) error {
+	for _, block := range blocks {
+		if tip.hash != "" && block.Height() == tip.height+1 && block.PreviousHash() != tip.hash {
+			return ErrReorg{block.Height(), block.PreviousHash(), tip.hash}
+		}
+		tip = chainTip{block.Height(), block.Hash()}
+	}
+	return nil
+}
+
+// blockSinkHandler is the LoaderSinkFunc of a LoaderManager. It fills a database transaction with blocks
+// after checking that they extend the last block loaded. If they don't, the chain was reorganized: blocks
+// orphaned by the reorg are removed from the database and the blocks of the new chain are loaded instead.
+func (loader *LoaderManager) blockSinkHandler(dbTx database.DBTx, msg *LoaderMsg[[]*types.Block]) error {
+	blocks := msg.data
+	if err := checkContinuity(loader.tip, blocks); err != nil {
+		log.Printf("%v\n", err)
+		blocks, err = loader.reorg(msg.blockRange.End)
+		if err != nil {
+			return err
+		}
+		msg = &LoaderMsg[[]*types.Block]{msg.seq, msg.blockRange, dbTx, blocks}
+	}
+	if loader.utxos != nil {
+		if err := loader.utxos.ConnectBlocks(blocks); err != nil {
+			return err
+		}
+	}
+	if err := blockHandler(dbTx, msg); err != nil {
+		return err
+	}
+	if len(blocks) > 0 {
+		last := blocks[len(blocks)-1]
+		loader.tip = chainTip{last.Height(), last.Hash()}
+	}
+	return nil
+}
+
+// reorg rolls the database back to the fork point with the client's chain and returns the blocks of the
+// client's chain from the fork point up to `end`.
+func (loader *LoaderManager) reorg(end int64) ([]*types.Block, error) {
+	fork, err := loader.findForkPoint()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("rolling back %d blocks to fork point %d\n", loader.tip.height-fork.height, fork.height)
+	if err := loader.db.RemoveBlocksAbove(fork.height); err != nil {
+		return nil, fmt.Errorf("rolling back to block %d: %w", fork.height, err)
+	}
+	if loader.utxos != nil {
+		if err := loader.utxos.DisconnectBlocksAbove(fork.height); err != nil {
+			return nil, err
+		}
+	}
+	loader.tip = fork
+
+	for attempt := 0; attempt < maxRefetchAttempts; attempt++ {
+		hashes, err := loader.client.GetBlockHashesByRange(loader.ctx, fork.height+1, end)
+		if err != nil {
+			return nil, err
+		}
+		blocks, err := loader.client.GetBlocks(loader.ctx, hashes)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkContinuity(fork, blocks); err == nil {
+			return blocks, nil
+		}
+	}
+	return nil, fmt.Errorf("chain kept changing while refetching blocks %d to %d", fork.height+1, end)
+}
+
+// findForkPoint returns the last block loaded into the database that is also in the client's chain.
+func (loader *LoaderManager) findForkPoint() (chainTip, error) {
+	for height := loader.tip.height; height >= 0 && loader.tip.height-height <= loader.maxReorgDepth; height-- {
+		dbHash, err := loader.db.BlockHash(height)
+		if err != nil {
+			return chainTip{}, err
+		}
+		hashes, err := loader.client.GetBlockHashesByRange(loader.ctx, height, height)
+		if err != nil {
+			return chainTip{}, err
+		}
+		if hashes[0].String() == dbHash {
+			return chainTip{height, dbHash}, nil
+		}
+	}
+	return chainTip{}, ErrReorgTooDeep{loader.tip.height, loader.maxReorgDepth}
+}
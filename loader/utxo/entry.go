@@ -0,0 +1,230 @@
+package utxo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Key prefixes of the set's LevelDB database.
+const (
+	// outputPrefix is followed by an outpoint and stores the entry of the unspent output.
+	outputPrefix = 'u'
+	// undoPrefix is followed by a big endian block height and stores the undo record of the block.
+	undoPrefix = 'd'
+	// tipKey stores the height and hash of the last block connected to the set.
+	tipKey = 'B'
+)
+
+// maxEntrySize bounds the lengths read from the database, which are never larger than a block.
+const maxEntrySize = wire.MaxBlockPayload
+
+// entry is an unspent output along with the block that created it.
+type entry struct {
+	height    int64
+	coinbase  bool
+	value     btcutil.Amount
+	pkScript  []byte
+	class     string
+	addresses []string
+}
+
+// prevout returns the prevout of an input spending the output.
+func (e *entry) prevout() *types.Prevout {
+	return types.NewPrevoutFromScript(e.value, e.pkScript, e.class, e.addresses, e.height, e.coinbase)
+}
+
+// serialize writes the entry as the varint of its height shifted left by one with the coinbase flag in the low
+// bit, followed by its value, script, script type and addresses.
+func (e *entry) serialize(w io.Writer) error {
+	code := uint64(e.height) << 1
+	if e.coinbase {
+		code |= 1
+	}
+	if err := wire.WriteVarInt(w, 0, code); err != nil {
+		return err
+	}
+	if err := wire.WriteVarInt(w, 0, uint64(e.value)); err != nil {
+		return err
+	}
+	if err := wire.WriteVarBytes(w, 0, e.pkScript); err != nil {
+		return err
+	}
+	if err := wire.WriteVarString(w, 0, e.class); err != nil {
+		return err
+	}
+	if err := wire.WriteVarInt(w, 0, uint64(len(e.addresses))); err != nil {
+		return err
+	}
+	for _, address := range e.addresses {
+		if err := wire.WriteVarString(w, 0, address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deserialize reads an entry written by serialize.
+func (e *entry) deserialize(r io.Reader) error {
+	code, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	e.height, e.coinbase = int64(code>>1), code&1 == 1
+	value, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	e.value = btcutil.Amount(value)
+	if e.pkScript, err = wire.ReadVarBytes(r, 0, maxEntrySize, "pkScript"); err != nil {
+		return err
+	}
+	if e.class, err = wire.ReadVarString(r, 0); err != nil {
+		return err
+	}
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	if count > maxEntrySize {
+		return fmt.Errorf("entry has %d addresses", count)
+	}
+	e.addresses = nil
+	for i := uint64(0); i < count; i++ {
+		address, err := wire.ReadVarString(r, 0)
+		if err != nil {
+			return err
+		}
+		e.addresses = append(e.addresses, address)
+	}
+	return nil
+}
+
+// bytes returns the serialized entry.
+func (e *entry) bytes() []byte {
+	var buf bytes.Buffer
+	// Writes to a bytes.Buffer never fail.
+	_ = e.serialize(&buf)
+	return buf.Bytes()
+}
+
+// undo records how to disconnect a block from the set: the outputs it created and the entries of the outputs
+// it spent.
+type undo struct {
+	previousHash string
+	created      []wire.OutPoint
+	spent        []spentOutput
+}
+
+// spentOutput is an output spent by a block, with the entry it had in the set and the transaction spending it.
+type spentOutput struct {
+	outpoint wire.OutPoint
+	entry    *entry
+	// height and txid are the height of the spending block and the ID of the spending transaction.
+	height int64
+	txid   chainhash.Hash
+}
+
+// bytes returns the serialized undo record. Each spent output is written as its outpoint, its entry, the varint
+// height of the spending block and the hash of the spending transaction.
+func (u *undo) bytes() []byte {
+	var buf bytes.Buffer
+	// Writes to a bytes.Buffer never fail.
+	_ = wire.WriteVarString(&buf, 0, u.previousHash)
+	_ = wire.WriteVarInt(&buf, 0, uint64(len(u.created)))
+	for _, outpoint := range u.created {
+		buf.Write(outputKey(outpoint)[1:])
+	}
+	_ = wire.WriteVarInt(&buf, 0, uint64(len(u.spent)))
+	for _, spent := range u.spent {
+		buf.Write(outputKey(spent.outpoint)[1:])
+		_ = spent.entry.serialize(&buf)
+		_ = wire.WriteVarInt(&buf, 0, uint64(spent.height))
+		buf.Write(spent.txid[:])
+	}
+	return buf.Bytes()
+}
+
+// deserialize reads an undo record written by bytes.
+func (u *undo) deserialize(r io.Reader) error {
+	var err error
+	if u.previousHash, err = wire.ReadVarString(r, 0); err != nil {
+		return err
+	}
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return err
+	}
+	if count > maxEntrySize {
+		return fmt.Errorf("undo record has %d created outputs", count)
+	}
+	u.created = make([]wire.OutPoint, count)
+	for i := range u.created {
+		if u.created[i], err = readOutPoint(r); err != nil {
+			return err
+		}
+	}
+	if count, err = wire.ReadVarInt(r, 0); err != nil {
+		return err
+	}
+	if count > maxEntrySize {
+		return fmt.Errorf("undo record has %d spent outputs", count)
+	}
+	u.spent = make([]spentOutput, count)
+	for i := range u.spent {
+		if u.spent[i].outpoint, err = readOutPoint(r); err != nil {
+			return err
+		}
+		u.spent[i].entry = new(entry)
+		if err := u.spent[i].entry.deserialize(r); err != nil {
+			return err
+		}
+		height, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return err
+		}
+		u.spent[i].height = int64(height)
+		if _, err := io.ReadFull(r, u.spent[i].txid[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outputKey returns the key of the entry of an outpoint: outputPrefix followed by the transaction hash and the
+// big endian output index.
+func outputKey(outpoint wire.OutPoint) []byte {
+	key := make([]byte, 1+len(outpoint.Hash)+4)
+	key[0] = outputPrefix
+	copy(key[1:], outpoint.Hash[:])
+	binary.BigEndian.PutUint32(key[1+len(outpoint.Hash):], outpoint.Index)
+	return key
+}
+
+// readOutPoint reads an outpoint written as in outputKey, without the prefix.
+func readOutPoint(r io.Reader) (wire.OutPoint, error) {
+	var outpoint wire.OutPoint
+	if _, err := io.ReadFull(r, outpoint.Hash[:]); err != nil {
+		return outpoint, err
+	}
+	var index [4]byte
+	if _, err := io.ReadFull(r, index[:]); err != nil {
+		return outpoint, err
+	}
+	outpoint.Index = binary.BigEndian.Uint32(index[:])
+	return outpoint, nil
+}
+
+// undoKey returns the key of the undo record of the block at height.
+func undoKey(height int64) []byte {
+	key := make([]byte, 9)
+	key[0] = undoPrefix
+	binary.BigEndian.PutUint64(key[1:], uint64(height))
+	return key
+}
@@ -0,0 +1,43 @@
+package utxo
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrMissingOutput is returned when a block spends an output that isn't in the set.
+type ErrMissingOutput struct {
+	outpoint wire.OutPoint
+	height   int64
+}
+
+// Error implements error.Error interface.
+func (e ErrMissingOutput) Error() string {
+	return fmt.Sprintf("output %s spent in block %d is not in the UTXO set", e.outpoint, e.height)
+}
+
+// ErrNotContiguous is returned when connecting a block that doesn't build on the last block of the set.
+type ErrNotContiguous struct {
+	height       int64
+	previousHash string
+	tipHeight    int64
+	tipHash      string
+}
+
+// Error implements error.Error interface.
+func (e ErrNotContiguous) Error() string {
+	if e.height != e.tipHeight+1 {
+		return fmt.Sprintf(
+			"block %d doesn't follow the UTXO set at block %d (blocks must be connected in order from the genesis block)",
+			e.height,
+			e.tipHeight,
+		)
+	}
+	return fmt.Sprintf(
+		"block %d builds on %s instead of block %s of the UTXO set",
+		e.height,
+		e.previousHash,
+		e.tipHash,
+	)
+}
@@ -0,0 +1,171 @@
+package utxo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// snapshotMagic starts every snapshot, followed by its version.
+var snapshotMagic = []byte("etl-bitcoin utxo")
+
+// snapshotVersion is the version of the snapshot format written by Snapshot.
+const snapshotVersion = 1
+
+// restoreBatchSize is the number of records restored in one database write.
+const restoreBatchSize = 100000
+
+// Snapshot writes a gzipped copy of the set, including its tip and undo records, to w. The set can still be
+// modified while the snapshot is written: it has the content of the set when Snapshot was called.
+//
+// A snapshot is the magic string and version followed by every key and value of the database as CompactSize
+// prefixed byte strings, and ends with an empty key.
+func (set *Set) Snapshot(w io.Writer) error {
+	snapshot, err := set.db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Release()
+
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	bw.Write(snapshotMagic)
+	if err := wire.WriteVarInt(bw, 0, snapshotVersion); err != nil {
+		return err
+	}
+	iter := snapshot.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if err := wire.WriteVarBytes(bw, 0, iter.Key()); err != nil {
+			return err
+		}
+		if err := wire.WriteVarBytes(bw, 0, iter.Value()); err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if err := wire.WriteVarBytes(bw, 0, nil); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// SnapshotFile writes a snapshot of the set to the file at path. The snapshot is written to a temporary file
+// first so that a failure doesn't leave a truncated snapshot in place of the previous one.
+func (set *Set) SnapshotFile(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := set.Snapshot(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("writing UTXO set snapshot %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Restore creates the set at path from a snapshot written by Snapshot. The database at path must not exist or
+// be empty.
+func Restore(path string, r io.Reader, undoDepth int64) (*Set, error) {
+	set, err := Open(path, undoDepth)
+	if err != nil {
+		return nil, err
+	}
+	if err := set.restore(r); err != nil {
+		set.Close()
+		return nil, fmt.Errorf("restoring UTXO set %s: %w", path, err)
+	}
+	return set, nil
+}
+
+// RestoreFile creates the set at path from the snapshot file at snapshotPath, see Restore.
+func RestoreFile(path, snapshotPath string, undoDepth int64) (*Set, error) {
+	f, err := os.Open(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Restore(path, f, undoDepth)
+}
+
+// restore adds the records of a snapshot to the set's empty database.
+func (set *Set) restore(r io.Reader) error {
+	iter := set.db.NewIterator(nil, nil)
+	empty := !iter.First()
+	iter.Release()
+	if !empty {
+		return fmt.Errorf("database is not empty")
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(zr)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, snapshotMagic) {
+		return fmt.Errorf("not a UTXO set snapshot")
+	}
+	version, err := wire.ReadVarInt(br, 0)
+	if err != nil {
+		return err
+	}
+	if version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	// The tip is written last, so that an interrupted restore doesn't leave a set that looks complete.
+	var tip []byte
+	batch := new(leveldb.Batch)
+	for {
+		key, err := wire.ReadVarBytes(br, 0, maxEntrySize, "key")
+		if err == io.EOF {
+			return fmt.Errorf("snapshot is truncated")
+		}
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			break
+		}
+		value, err := wire.ReadVarBytes(br, 0, maxEntrySize, "value")
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(key, []byte{tipKey}) {
+			tip = value
+			continue
+		}
+		batch.Put(key, value)
+		if batch.Len() >= restoreBatchSize {
+			if err := set.db.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if tip != nil {
+		batch.Put([]byte{tipKey}, tip)
+	}
+	if err := set.db.Write(batch, nil); err != nil {
+		return err
+	}
+	return set.readTip()
+}
@@ -0,0 +1,255 @@
+// Package utxo implements an on-disk set of unspent transaction outputs, kept up to date with blocks connected
+// in height order. It resolves the outputs spent by transaction inputs without asking a node for them.
+package utxo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Set is a set of unspent transaction outputs (outpoint → value, script and height) stored in a LevelDB
+// database. Blocks are connected to the set in height order, starting from the genesis block, and the inputs
+// they contain are given the prevout of the output they spend.
+//
+// The set keeps an undo record for each of its last `undoDepth` blocks, so they can be disconnected when the
+// chain is reorganized or when the blocks they were connected with weren't saved.
+type Set struct {
+	db        *leveldb.DB
+	undoDepth int64
+
+	tipHeight int64
+	tipHash   string
+}
+
+// Open opens the set stored in the LevelDB database at path, creating an empty set if it doesn't exist.
+func Open(path string, undoDepth int64) (*Set, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("opening UTXO set %s: %w", path, err)
+	}
+	set := &Set{db: db, undoDepth: undoDepth}
+	if err := set.readTip(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening UTXO set %s: %w", path, err)
+	}
+	return set, nil
+}
+
+// Close closes the set's database.
+func (set *Set) Close() error {
+	return set.db.Close()
+}
+
+// Tip returns the height and hash of the last block connected to the set, or -1 if it is empty.
+func (set *Set) Tip() (int64, string) {
+	return set.tipHeight, set.tipHash
+}
+
+// readTip reads the last block connected to the set from its database.
+func (set *Set) readTip() error {
+	set.tipHeight, set.tipHash = -1, ""
+	value, err := set.db.Get([]byte{tipKey}, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r := bytes.NewReader(value)
+	height, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return fmt.Errorf("reading tip: %w", err)
+	}
+	hash, err := wire.ReadVarString(r, 0)
+	if err != nil {
+		return fmt.Errorf("reading tip: %w", err)
+	}
+	set.tipHeight, set.tipHash = int64(height), hash
+	return nil
+}
+
+// putTip records the last block connected to the set in batch.
+func putTip(batch *leveldb.Batch, height int64, hash string) {
+	if height < 0 {
+		batch.Delete([]byte{tipKey})
+		return
+	}
+	var buf bytes.Buffer
+	// Writes to a bytes.Buffer never fail.
+	_ = wire.WriteVarInt(&buf, 0, uint64(height))
+	_ = wire.WriteVarString(&buf, 0, hash)
+	batch.Put([]byte{tipKey}, buf.Bytes())
+}
+
+// ConnectBlocks adds the outputs created by blocks to the set and removes the outputs they spend, in one
+// database write. Inputs without a prevout are given the one of the output they spend, so that their value and
+// the fee of their transaction are known, and the prevouts record the block and transaction spending them.
+//
+// The blocks must follow each other and the last block of the set. Outputs that can't be spent (OP_RETURN) are
+// not added. A block spending an output missing from the set fails with ErrMissingOutput and leaves the set
+// unchanged.
+func (set *Set) ConnectBlocks(blocks []*types.Block) error {
+	batch := new(leveldb.Batch)
+	// outputs holds the outputs created or spent by the blocks connected so far, spent ones mapped to nil.
+	outputs := make(map[wire.OutPoint]*entry)
+	height, hash := set.tipHeight, set.tipHash
+	for _, block := range blocks {
+		if block.Height() != height+1 || (hash != "" && block.PreviousHash() != hash) {
+			return ErrNotContiguous{block.Height(), block.PreviousHash(), height, hash}
+		}
+		record := undo{previousHash: block.PreviousHash()}
+		for _, tx := range block.Transactions() {
+			txid, err := chainhash.NewHashFromStr(tx.TxID())
+			if err != nil {
+				return err
+			}
+			if !tx.IsCoinbase() {
+				for _, in := range tx.Vin() {
+					outpoint, err := in.OutPoint()
+					if err != nil {
+						return fmt.Errorf("input of transaction %s: %w", tx, err)
+					}
+					spent, err := set.lookup(outputs, outpoint)
+					if err != nil {
+						return err
+					}
+					if spent == nil {
+						return ErrMissingOutput{outpoint, block.Height()}
+					}
+					if in.Prevout() == nil {
+						in.SetPrevout(spent.prevout())
+					}
+					in.Prevout().SetSpentAt(block.Height(), tx.TxID())
+					record.spent = append(record.spent, spentOutput{outpoint, spent, block.Height(), *txid})
+					outputs[outpoint] = nil
+					batch.Delete(outputKey(outpoint))
+				}
+			}
+
+			for i, out := range tx.Vout() {
+				created, err := newEntry(out, block.Height(), tx.IsCoinbase())
+				if err != nil {
+					return fmt.Errorf("output %d of transaction %s: %w", i, tx, err)
+				}
+				if txscript.IsUnspendable(created.pkScript) {
+					continue
+				}
+				outpoint := wire.OutPoint{Hash: *txid, Index: uint32(i)}
+				record.created = append(record.created, outpoint)
+				outputs[outpoint] = created
+				batch.Put(outputKey(outpoint), created.bytes())
+			}
+		}
+		batch.Put(undoKey(block.Height()), record.bytes())
+		if old := block.Height() - set.undoDepth; old >= 0 {
+			batch.Delete(undoKey(old))
+		}
+		height, hash = block.Height(), block.Hash()
+	}
+	putTip(batch, height, hash)
+	if err := set.db.Write(batch, nil); err != nil {
+		return fmt.Errorf("connecting blocks to UTXO set: %w", err)
+	}
+	set.tipHeight, set.tipHash = height, hash
+	return nil
+}
+
+// lookup returns the entry of an unspent output, looking in outputs before the database, or nil if the output
+// isn't in the set.
+func (set *Set) lookup(outputs map[wire.OutPoint]*entry, outpoint wire.OutPoint) (*entry, error) {
+	if e, ok := outputs[outpoint]; ok {
+		return e, nil
+	}
+	value, err := set.db.Get(outputKey(outpoint), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	e := new(entry)
+	if err := e.deserialize(bytes.NewReader(value)); err != nil {
+		return nil, fmt.Errorf("reading UTXO set entry of %s: %w", outpoint, err)
+	}
+	return e, nil
+}
+
+// newEntry returns the entry of an output created at height, by a coinbase transaction if coinbase is set.
+func newEntry(out *types.Vout, height int64, coinbase bool) (*entry, error) {
+	script := out.ScriptPubKey()
+	pkScript, err := hex.DecodeString(script.Hex)
+	if err != nil {
+		return nil, err
+	}
+	return &entry{
+		height:    height,
+		coinbase:  coinbase,
+		value:     out.Value(),
+		pkScript:  pkScript,
+		class:     script.Type,
+		addresses: script.Addresses,
+	}, nil
+}
+
+// DisconnectBlocksAbove removes the blocks above height from the set: the outputs they created are removed and
+// the outputs they spent are added back. It fails if one of the blocks is deeper than the undo records kept.
+func (set *Set) DisconnectBlocksAbove(height int64) error {
+	if height >= set.tipHeight {
+		return nil
+	}
+	batch := new(leveldb.Batch)
+	tipHash := set.tipHash
+	for h := set.tipHeight; h > height; h-- {
+		value, err := set.db.Get(undoKey(h), nil)
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return fmt.Errorf("can't disconnect block %d from UTXO set: it only keeps the last %d blocks",
+				h, set.undoDepth)
+		}
+		if err != nil {
+			return err
+		}
+		var record undo
+		if err := record.deserialize(bytes.NewReader(value)); err != nil {
+			return fmt.Errorf("reading UTXO set undo record of block %d: %w", h, err)
+		}
+		// Spent outputs are added back before created outputs are removed, so that an output spent by the block
+		// that created it, or by a block above it, ends up removed.
+		for _, spent := range record.spent {
+			batch.Put(outputKey(spent.outpoint), spent.entry.bytes())
+		}
+		for _, outpoint := range record.created {
+			batch.Delete(outputKey(outpoint))
+		}
+		batch.Delete(undoKey(h))
+		tipHash = record.previousHash
+	}
+	if height < 0 {
+		tipHash = ""
+	}
+	putTip(batch, height, tipHash)
+	if err := set.db.Write(batch, nil); err != nil {
+		return fmt.Errorf("disconnecting blocks above %d from UTXO set: %w", height, err)
+	}
+	set.tipHeight, set.tipHash = height, tipHash
+	return nil
+}
+
+// Count returns the number of unspent outputs in the set.
+func (set *Set) Count() (int, error) {
+	iter := set.db.NewIterator(util.BytesPrefix([]byte{outputPrefix}), nil)
+	defer iter.Release()
+	count := 0
+	for iter.Next() {
+		count++
+	}
+	return count, iter.Error()
+}
@@ -0,0 +1,220 @@
+package utxo
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/chaingen"
+	"github.com/IlliniBlockchain/etl-bitcoin/types"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// generate returns a chain of n blocks after the genesis block whose coinbases can be spent by the next block.
+func generate(t *testing.T, n int) ([]*chaingen.Block, []*types.Block) {
+	config := chaingen.DefaultConfig()
+	config.CoinbaseMaturity = 1
+	generated, err := chaingen.Generate(config, n)
+	require.NoError(t, err)
+	blocks := make([]*types.Block, len(generated))
+	for i, blk := range generated {
+		blocks[i] = blk.Block()
+	}
+	return generated, blocks
+}
+
+// outputs returns the entries of the unspent outputs of set by key.
+func outputs(t *testing.T, set *Set) map[string][]byte {
+	entries := make(map[string][]byte)
+	iter := set.db.NewIterator(util.BytesPrefix([]byte{outputPrefix}), nil)
+	defer iter.Release()
+	for iter.Next() {
+		entries[string(iter.Key())] = append([]byte(nil), iter.Value()...)
+	}
+	require.NoError(t, iter.Error())
+	return entries
+}
+
+func TestConnectBlocks(t *testing.T) {
+	generated, blocks := generate(t, 40)
+	set, err := Open(filepath.Join(t.TempDir(), "utxo"), 10)
+	require.NoError(t, err)
+	defer set.Close()
+	height, hash := set.Tip()
+	assert.Equal(t, int64(-1), height)
+	assert.Empty(t, hash)
+
+	require.NoError(t, set.ConnectBlocks(blocks[:15]))
+	require.NoError(t, set.ConnectBlocks(blocks[15:]))
+	height, hash = set.Tip()
+	assert.Equal(t, int64(40), height)
+	assert.Equal(t, blocks[40].Hash(), hash)
+
+	// Inputs are given the prevouts of the outputs they spend, and the fees of the blocks add up.
+	prevouts := make(map[wire.OutPoint]*types.Prevout)
+	for _, block := range blocks {
+		var fees btcutil.Amount
+		for _, tx := range block.Transactions() {
+			for _, in := range tx.Vin() {
+				if tx.IsCoinbase() {
+					assert.Nil(t, in.Prevout())
+					continue
+				}
+				outpoint, err := in.OutPoint()
+				require.NoError(t, err)
+				require.Contains(t, prevouts, outpoint)
+				prevouts[outpoint].SetSpentAt(block.Height(), tx.TxID())
+				assert.Equal(t, prevouts[outpoint], in.Prevout())
+				delete(prevouts, outpoint)
+			}
+			fee, ok := tx.Fee()
+			require.True(t, ok)
+			fees += fee
+
+			txid, err := chainhash.NewHashFromStr(tx.TxID())
+			require.NoError(t, err)
+			for i, out := range tx.Vout() {
+				if out.ScriptPubKey().Type != "nulldata" {
+					outpoint := wire.OutPoint{Hash: *txid, Index: uint32(i)}
+					prevouts[outpoint] = types.NewPrevout(out, block.Height(), tx.IsCoinbase())
+				}
+			}
+		}
+		assert.Equal(t, btcutil.Amount(generated[block.Height()].Fees), fees, "fees of block %d", block.Height())
+		reward, ok := block.Reward(&chaincfg.RegressionNetParams)
+		require.True(t, ok)
+		assert.Equal(t, btcutil.Amount(generated[block.Height()].Subsidy)+fees, reward)
+	}
+	count, err := set.Count()
+	require.NoError(t, err)
+	assert.Equal(t, len(prevouts), count)
+}
+
+func TestConnectBlocksSpentAt(t *testing.T) {
+	_, blocks := generate(t, 10)
+	set, err := Open(filepath.Join(t.TempDir(), "utxo"), 10)
+	require.NoError(t, err)
+	defer set.Close()
+	require.NoError(t, set.ConnectBlocks(blocks))
+
+	// The block and transaction spending an output are given to the input and kept in the undo record.
+	tx := blocks[5].Transactions()[1]
+	in := tx.Vin()[0]
+	height, txid, ok := in.Prevout().SpentAt()
+	require.True(t, ok)
+	assert.Equal(t, int64(5), height)
+	assert.Equal(t, tx.TxID(), txid)
+
+	outpoint, err := in.OutPoint()
+	require.NoError(t, err)
+	value, err := set.db.Get(undoKey(5), nil)
+	require.NoError(t, err)
+	var record undo
+	require.NoError(t, record.deserialize(bytes.NewReader(value)))
+	var spent *spentOutput
+	for i := range record.spent {
+		if record.spent[i].outpoint == outpoint {
+			spent = &record.spent[i]
+		}
+	}
+	require.NotNil(t, spent, "undo record of block 5 doesn't spend %v", outpoint)
+	assert.Equal(t, int64(5), spent.height)
+	assert.Equal(t, tx.TxID(), spent.txid.String())
+}
+
+func TestConnectBlocksErrors(t *testing.T) {
+	_, blocks := generate(t, 10)
+	set, err := Open(filepath.Join(t.TempDir(), "utxo"), 10)
+	require.NoError(t, err)
+	defer set.Close()
+
+	// Blocks must be connected from the genesis block, in order.
+	assert.ErrorAs(t, set.ConnectBlocks(blocks[1:3]), &ErrNotContiguous{})
+	require.NoError(t, set.ConnectBlocks(blocks[:5]))
+	assert.ErrorAs(t, set.ConnectBlocks(blocks[6:7]), &ErrNotContiguous{})
+	config := chaingen.DefaultConfig()
+	config.Seed = 2
+	fork, err := chaingen.Generate(config, 5)
+	require.NoError(t, err)
+	assert.ErrorAs(t, set.ConnectBlocks([]*types.Block{fork[5].Block()}), &ErrNotContiguous{})
+
+	// A block spending an unknown output leaves the set unchanged.
+	before := outputs(t, set)
+	generated, _ := generate(t, 10)
+	generated[5].Transactions[1].TxIn[0].PreviousOutPoint.Index = 99
+	err = set.ConnectBlocks([]*types.Block{generated[5].Block()})
+	assert.ErrorAs(t, err, &ErrMissingOutput{})
+	height, _ := set.Tip()
+	assert.Equal(t, int64(4), height)
+	assert.Equal(t, before, outputs(t, set))
+}
+
+func TestDisconnectBlocksAbove(t *testing.T) {
+	_, blocks := generate(t, 40)
+	dir := t.TempDir()
+	set, err := Open(filepath.Join(dir, "utxo"), 10)
+	require.NoError(t, err)
+	defer set.Close()
+	want, err := Open(filepath.Join(dir, "want"), 10)
+	require.NoError(t, err)
+	defer want.Close()
+
+	require.NoError(t, set.ConnectBlocks(blocks))
+	require.NoError(t, want.ConnectBlocks(blocks[:36]))
+	require.NoError(t, set.DisconnectBlocksAbove(35))
+	assert.Equal(t, outputs(t, want), outputs(t, set))
+	height, hash := set.Tip()
+	assert.Equal(t, int64(35), height)
+	assert.Equal(t, blocks[35].Hash(), hash)
+
+	// Only the last 10 blocks can be disconnected.
+	assert.ErrorContains(t, set.DisconnectBlocksAbove(20), "only keeps the last 10 blocks")
+	height, _ = set.Tip()
+	assert.Equal(t, int64(35), height)
+
+	// Disconnected blocks can be connected again.
+	require.NoError(t, set.ConnectBlocks(blocks[36:]))
+	require.NoError(t, want.ConnectBlocks(blocks[36:]))
+	assert.Equal(t, outputs(t, want), outputs(t, set))
+}
+
+func TestSnapshot(t *testing.T) {
+	_, blocks := generate(t, 30)
+	dir := t.TempDir()
+	set, err := Open(filepath.Join(dir, "utxo"), 10)
+	require.NoError(t, err)
+	defer set.Close()
+	require.NoError(t, set.ConnectBlocks(blocks[:21]))
+
+	var snapshot bytes.Buffer
+	require.NoError(t, set.Snapshot(&snapshot))
+	restored, err := Restore(filepath.Join(dir, "restored"), bytes.NewReader(snapshot.Bytes()), 10)
+	require.NoError(t, err)
+	defer restored.Close()
+	height, hash := restored.Tip()
+	assert.Equal(t, int64(20), height)
+	assert.Equal(t, blocks[20].Hash(), hash)
+	assert.Equal(t, outputs(t, set), outputs(t, restored))
+
+	// The restored set keeps the undo records and follows the chain like the original.
+	require.NoError(t, restored.DisconnectBlocksAbove(15))
+	require.NoError(t, restored.ConnectBlocks(blocks[16:]))
+	require.NoError(t, set.ConnectBlocks(blocks[21:]))
+	assert.Equal(t, outputs(t, set), outputs(t, restored))
+
+	// Snapshots are only restored into empty sets, and truncated snapshots are refused.
+	other, err := Open(filepath.Join(dir, "other"), 10)
+	require.NoError(t, err)
+	require.NoError(t, other.ConnectBlocks(blocks[:1]))
+	require.NoError(t, other.Close())
+	_, err = Restore(filepath.Join(dir, "other"), bytes.NewReader(snapshot.Bytes()), 10)
+	assert.ErrorContains(t, err, "not empty")
+	_, err = Restore(filepath.Join(dir, "truncated"), bytes.NewReader(snapshot.Bytes()[:snapshot.Len()/2]), 10)
+	assert.Error(t, err)
+}
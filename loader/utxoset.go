@@ -0,0 +1,59 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/IlliniBlockchain/etl-bitcoin/loader/utxo"
+)
+
+// openUTXOSet opens the UTXO set in dir, restoring it from the snapshot file if dir doesn't exist yet and a
+// snapshot is given, and brings it in line with tip, the last block loaded into the database. Blocks of the set
+// above tip, connected with batches that weren't committed, are disconnected.
+func openUTXOSet(dir, snapshot string, undoDepth int64, tip chainTip) (*utxo.Set, error) {
+	var set *utxo.Set
+	_, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) && snapshot != "" {
+		if _, err := os.Stat(snapshot); err == nil {
+			log.Printf("restoring UTXO set %s from snapshot %s\n", dir, snapshot)
+			if set, err = utxo.RestoreFile(dir, snapshot, undoDepth); err != nil {
+				os.RemoveAll(dir)
+				return nil, err
+			}
+		}
+	}
+	if set == nil {
+		if set, err = utxo.Open(dir, undoDepth); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := set.DisconnectBlocksAbove(tip.height); err != nil {
+		set.Close()
+		return nil, err
+	}
+	if height, hash := set.Tip(); height != tip.height || hash != tip.hash {
+		set.Close()
+		return nil, fmt.Errorf("UTXO set %s is at block %d (%s) but the database is at block %d (%s): "+
+			"the set must be built along with the database from the genesis block", dir, height, hash, tip.height, tip.hash)
+	}
+	return set, nil
+}
+
+// closeUTXOSet writes a snapshot of the UTXO set if configured and closes it.
+func (loader *LoaderManager) closeUTXOSet() error {
+	if loader.utxos == nil {
+		return nil
+	}
+	var err error
+	if loader.utxoSnapshot != "" {
+		err = loader.utxos.SnapshotFile(loader.utxoSnapshot)
+	}
+	if closeErr := loader.utxos.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+package types
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// amountFromBTC converts a value in BTC, as given in the JSON results of the node, to satoshis. JSON values have
+// at most 8 decimals and any value up to the 21 million BTC supply is within half a satoshi of its float64
+// representation, so rounding to the nearest satoshi gives the exact amount. Invalid values give 0.
+func amountFromBTC(value float64) btcutil.Amount {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0
+	}
+	// btcutil.NewAmount only fails on NaN and infinities.
+	amount, _ := btcutil.NewAmount(value)
+	return amount
+}
+
+// FormatBTC formats an amount in BTC with all 8 decimals, e.g. "0.30000000". Unlike btcutil.Amount.String, the
+// amount isn't converted to a float64 so the result is exact.
+func FormatBTC(amount btcutil.Amount) string {
+	sign := ""
+	sats := int64(amount)
+	if sats < 0 {
+		sign = "-"
+		sats = -sats
+	}
+	whole := strconv.FormatInt(sats/btcutil.SatoshiPerBitcoin, 10)
+	frac := strconv.FormatInt(sats%btcutil.SatoshiPerBitcoin+btcutil.SatoshiPerBitcoin, 10)[1:]
+	return sign + whole + "." + frac
+}
@@ -0,0 +1,31 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmountFromBTC(t *testing.T) {
+	// Values that have no exact float64 representation are read as whole satoshis.
+	var vout btcjson.Vout
+	require.NoError(t, json.Unmarshal([]byte(`{"value":0.3,"n":0,"scriptPubKey":{}}`), &vout))
+	assert.Equal(t, btcutil.Amount(30_000_000), NewVout(&vout).Value())
+	assert.Equal(t, btcutil.Amount(30_000_000), amountFromBTC(0.1+0.2))
+	assert.Equal(t, btcutil.Amount(2_099_999_997_690_000), amountFromBTC(20999999.9769))
+	assert.Equal(t, btcutil.Amount(1), amountFromBTC(0.00000001))
+	assert.Zero(t, amountFromBTC(0))
+}
+
+func TestFormatBTC(t *testing.T) {
+	assert.Equal(t, "0.30000000", FormatBTC(30_000_000))
+	assert.Equal(t, "50.00000000", FormatBTC(50*btcutil.SatoshiPerBitcoin))
+	assert.Equal(t, "20999999.97690000", FormatBTC(2_099_999_997_690_000))
+	assert.Equal(t, "0.00000001", FormatBTC(1))
+	assert.Equal(t, "-0.00000546", FormatBTC(-546))
+	assert.Equal(t, "0.00000000", FormatBTC(0))
+}
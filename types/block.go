@@ -1,12 +1,17 @@
 package types
 
-import "github.com/btcsuite/btcd/btcjson"
+import (
+	"encoding/json"
 
-const (
-	BaseBlockReward   = 50.0
-	BlockRewardCutOff = 210_000
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
+// maxHalvings is the number of halvings after which the block subsidy is zero.
+const maxHalvings = 64
+
 // BlockHeader represents a Bitcoin block header.
 //
 // Wraps btcjson.GetBlockVerboseResult.
@@ -102,10 +107,13 @@ func (bh *BlockHeader) PreviousHash() string { return bh.data.PreviousHash }
 // NextHash returns the next block hash if it exists, else returns empty string.
 func (bh *BlockHeader) NextHash() string { return bh.data.NextHash }
 
-// Reward returns the mining reward of the block.
-func (bh *BlockHeader) Reward() float64 {
-	rewardLevel := bh.Height() / BlockRewardCutOff
-	return BaseBlockReward / float64(int(1)<<rewardLevel)
+// Subsidy returns the value of the new coins the coinbase of the block may claim on the network described by
+// params, in satoshis. It halves every params.SubsidyReductionInterval blocks and is zero after 64 halvings.
+func (bh *BlockHeader) Subsidy(params *chaincfg.Params) btcutil.Amount {
+	if params.SubsidyReductionInterval > 0 && bh.Height()/int64(params.SubsidyReductionInterval) >= maxHalvings {
+		return 0
+	}
+	return btcutil.Amount(blockchain.CalcBlockSubsidy(int32(bh.Height()), params))
 }
 
 // String implements the Stringer interface.
@@ -113,16 +121,26 @@ func (bh *BlockHeader) String() string {
 	return bh.data.Hash
 }
 
+// MarshalJSON implements the json.Marshaler interface. The header is encoded like the result of getblock with
+// verbosity = 1, without the transaction ids.
+func (bh *BlockHeader) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bh.data)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. It decodes a header encoded by MarshalJSON.
+func (bh *BlockHeader) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &bh.data)
+}
+
 // WithTransactions returns a Block with the given transactions.
 func (bh *BlockHeader) WithTransactions(txs []btcjson.TxRawResult) (*Block, error) {
 	block := &Block{
 		bh,
 		make([]*Transaction, len(txs)),
 	}
-	var err error
 	for i, tx := range txs {
-		block.txs[i], err = NewTransaction(tx).WithBlockAndIndex(block, i)
-		if err != nil {
+		block.txs[i] = NewTransaction(tx)
+		if _, err := block.txs[i].WithBlockAndIndex(block, i); err != nil {
 			return nil, err
 		}
 	}
@@ -164,3 +182,82 @@ func (b *Block) Transactions() []*Transaction {
 	}
 	return txsCpy
 }
+
+// Fee returns the total fee paid by the transactions of the block, in satoshis. It returns false if the prevout of
+// an input isn't resolved.
+func (b *Block) Fee() (btcutil.Amount, bool) {
+	var fee btcutil.Amount
+	for _, tx := range b.txs {
+		txFee, ok := tx.Fee()
+		if !ok {
+			return 0, false
+		}
+		fee += txFee
+	}
+	return fee, true
+}
+
+// Reward returns the value the coinbase of the block may claim on the network described by params: its subsidy
+// plus the fees of its transactions, in satoshis. It returns false if the fees aren't known, see Fee.
+func (b *Block) Reward(params *chaincfg.Params) (btcutil.Amount, bool) {
+	fee, ok := b.Fee()
+	if !ok {
+		return 0, false
+	}
+	return b.Subsidy(params) + fee, true
+}
+
+// MarshalJSON implements the json.Marshaler interface. The block is encoded like the result of getblock with
+// verbosity = 2, or 3 if the prevouts of its inputs were resolved.
+func (b *Block) MarshalJSON() ([]byte, error) {
+	var block struct {
+		btcjson.GetBlockVerboseTxResult
+		Tx []txResult `json:"tx"`
+	}
+	block.Tx = make([]txResult, len(b.txs))
+	for i, tx := range b.txs {
+		block.Tx[i] = newTxResult(tx)
+	}
+	block.GetBlockVerboseTxResult = btcjson.GetBlockVerboseTxResult{
+		Hash:          b.data.Hash,
+		Confirmations: b.data.Confirmations,
+		StrippedSize:  b.data.StrippedSize,
+		Size:          b.data.Size,
+		Weight:        b.data.Weight,
+		Height:        b.data.Height,
+		Version:       b.data.Version,
+		VersionHex:    b.data.VersionHex,
+		MerkleRoot:    b.data.MerkleRoot,
+		Time:          b.data.Time,
+		Nonce:         b.data.Nonce,
+		Bits:          b.data.Bits,
+		Difficulty:    b.data.Difficulty,
+		PreviousHash:  b.data.PreviousHash,
+		NextHash:      b.data.NextHash,
+	}
+	return json.Marshal(block)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. It decodes a block encoded by MarshalJSON or
+// returned by getblock with verbosity = 2 or 3.
+func (b *Block) UnmarshalJSON(data []byte) error {
+	var blockVerbose btcjson.GetBlockVerboseTxResult
+	if err := json.Unmarshal(data, &blockVerbose); err != nil {
+		return err
+	}
+	var core struct {
+		Tx []coreTx `json:"tx"`
+	}
+	if err := json.Unmarshal(data, &core); err != nil {
+		return err
+	}
+	for i, tx := range core.Tx {
+		tx.setAddresses(&blockVerbose.Tx[i])
+	}
+	*b = *NewBlock(blockVerbose)
+	for i, tx := range b.txs {
+		tx.block = b
+		core.Tx[i].setPrevouts(tx)
+	}
+	return nil
+}
@@ -6,6 +6,10 @@ import (
 	"testing"
 
 	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -42,11 +46,73 @@ func (s *BlockTestSuite) TestBlockHeaderData() {
 	s.Equal(s.blockHeader409008.NextHash, blk.NextHash())
 }
 
-func (s *BlockTestSuite) TestBlockReward() {
-	blk1000 := NewBlock(s.block1000)
-	blk409008 := NewBlockHeader(s.blockHeader409008)
-	s.EqualValues(50.0, blk1000.Reward())
-	s.EqualValues(25.0, blk409008.Reward())
+func TestBlockSubsidy(t *testing.T) {
+	tests := []struct {
+		params *chaincfg.Params
+		height int32
+		want   btcutil.Amount
+	}{
+		{&chaincfg.MainNetParams, 0, 50 * btcutil.SatoshiPerBitcoin},
+		{&chaincfg.MainNetParams, 209_999, 50 * btcutil.SatoshiPerBitcoin},
+		{&chaincfg.MainNetParams, 409_008, 25 * btcutil.SatoshiPerBitcoin},
+		{&chaincfg.MainNetParams, 840_000, 312_500_000},
+		{&chaincfg.MainNetParams, 6_720_000, 1},
+		{&chaincfg.MainNetParams, 6_930_000, 0},
+		{&chaincfg.MainNetParams, 64 * 210_000, 0},
+		{&chaincfg.MainNetParams, 1 << 30, 0},
+		{&chaincfg.TestNet3Params, 210_000, 25 * btcutil.SatoshiPerBitcoin},
+		{&chaincfg.RegressionNetParams, 149, 50 * btcutil.SatoshiPerBitcoin},
+		{&chaincfg.RegressionNetParams, 150, 25 * btcutil.SatoshiPerBitcoin},
+		{&chaincfg.RegressionNetParams, 64 * 150, 0},
+	}
+	for _, tt := range tests {
+		header := NewBlockHeader(btcjson.GetBlockHeaderVerboseResult{Height: tt.height})
+		assert.Equal(t, tt.want, header.Subsidy(tt.params), "%s block %d", tt.params.Name, tt.height)
+	}
+}
+
+func TestBlockFee(t *testing.T) {
+	hash := "00000000000000000002e4a0ae2e2e4a4ac2e84ef9b0ac8b9ff0ed1ef5f8b2c1"
+	header := NewBlockHeader(btcjson.GetBlockHeaderVerboseResult{Hash: hash, Height: 840_000})
+	block, err := header.WithTransactions([]btcjson.TxRawResult{
+		{
+			Txid:      "0000000000000000000000000000000000000000000000000000000000000001",
+			BlockHash: hash,
+			Vin:       []btcjson.Vin{{Coinbase: "03406e0c"}},
+			Vout:      []btcjson.Vout{{Value: 3.1251}},
+		},
+		{
+			Txid:      "0000000000000000000000000000000000000000000000000000000000000002",
+			BlockHash: hash,
+			Vin: []btcjson.Vin{
+				{Txid: "0000000000000000000000000000000000000000000000000000000000000003"},
+				{Txid: "0000000000000000000000000000000000000000000000000000000000000004", Vout: 1},
+			},
+			Vout: []btcjson.Vout{{Value: 0.1}, {Value: 0.2}},
+		},
+	})
+	require.NoError(t, err)
+
+	// Fees are only known once every prevout is resolved.
+	txs := block.Transactions()
+	_, ok := block.Fee()
+	assert.False(t, ok)
+	_, ok = block.Reward(&chaincfg.MainNetParams)
+	assert.False(t, ok)
+	txs[1].Vin()[0].SetPrevout(NewPrevoutFromScript(10_000_000, nil, "nonstandard", nil, 1, false))
+	_, ok = txs[1].Fee()
+	assert.False(t, ok)
+
+	txs[1].Vin()[1].SetPrevout(NewPrevoutFromScript(20_010_000, nil, "nonstandard", nil, 1, false))
+	fee, ok := txs[1].Fee()
+	assert.True(t, ok)
+	assert.Equal(t, btcutil.Amount(10_000), fee)
+	fee, ok = block.Fee()
+	assert.True(t, ok)
+	assert.Equal(t, btcutil.Amount(10_000), fee)
+	reward, ok := block.Reward(&chaincfg.MainNetParams)
+	assert.True(t, ok)
+	assert.Equal(t, btcutil.Amount(312_510_000), reward)
 }
 
 func (s *BlockTestSuite) TestBlockData() {
@@ -77,6 +143,36 @@ func TestBlockTestSuite(t *testing.T) {
 	suite.Run(t, new(BlockTestSuite))
 }
 
+func TestBlockJSON(t *testing.T) {
+	var blockVerbose btcjson.GetBlockVerboseTxResult
+	require.NoError(t, parseTestData("testdata/block_1000.json", &blockVerbose))
+	blk := NewBlock(blockVerbose)
+
+	data, err := json.Marshal(blk)
+	require.NoError(t, err)
+	var decoded Block
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, blk.BlockHeader, decoded.BlockHeader)
+	require.Len(t, decoded.Transactions(), len(blk.Transactions()))
+	for i, tx := range decoded.Transactions() {
+		assert.Equal(t, blk.Transactions()[i].data, tx.data)
+		assert.Equal(t, i, tx.Index())
+		assert.Equal(t, decoded.Hash(), tx.Block().Hash())
+	}
+}
+
+func TestBlockHeaderJSON(t *testing.T) {
+	var headerVerbose btcjson.GetBlockHeaderVerboseResult
+	require.NoError(t, parseTestData("testdata/block_header_1000.json", &headerVerbose))
+	header := NewBlockHeader(headerVerbose)
+
+	data, err := json.Marshal(header)
+	require.NoError(t, err)
+	var decoded BlockHeader
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, header, &decoded)
+}
+
 func parseTestData[T any](filename string, v *T) error {
 	data, err := os.ReadFile(filename)
 	if err != nil {
@@ -0,0 +1,104 @@
+package types
+
+import (
+	"encoding/json"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// ChainInfo represents the state of the chain of a bitcoin node.
+//
+// Wraps btcjson.GetBlockChainInfoResult.
+type ChainInfo struct {
+	data btcjson.GetBlockChainInfoResult
+}
+
+// NewChainInfo returns a new instance of chain info from a raw json getblockchaininfo result.
+func NewChainInfo(chainInfo btcjson.GetBlockChainInfoResult) *ChainInfo {
+	// Soft fork deployments aren't exposed and their two encodings can't be told apart when decoding.
+	chainInfo.SoftForks = nil
+	chainInfo.UnifiedSoftForks = nil
+	return &ChainInfo{chainInfo}
+}
+
+// Chain returns the name of the network as reported by Bitcoin Core, e.g. "main", "test", "signet" or "regtest".
+func (ci *ChainInfo) Chain() string { return ci.data.Chain }
+
+// Blocks returns the height of the most-work fully-validated chain.
+func (ci *ChainInfo) Blocks() int64 { return int64(ci.data.Blocks) }
+
+// Headers returns the height of the most-work chain of headers, which is ahead of Blocks while syncing.
+func (ci *ChainInfo) Headers() int64 { return int64(ci.data.Headers) }
+
+// BestBlockHash returns the hash of the tip of the most-work fully-validated chain.
+func (ci *ChainInfo) BestBlockHash() string { return ci.data.BestBlockHash }
+
+// Difficulty returns the difficulty of the tip.
+func (ci *ChainInfo) Difficulty() float64 { return ci.data.Difficulty }
+
+// MedianTime returns the median time of the tip expressed in UNIX epoch time.
+func (ci *ChainInfo) MedianTime() int64 { return ci.data.MedianTime }
+
+// VerificationProgress returns an estimate of the fraction of the chain verified, between 0 and 1.
+func (ci *ChainInfo) VerificationProgress() float64 { return ci.data.VerificationProgress }
+
+// InitialBlockDownload returns true while the node is in initial block download.
+func (ci *ChainInfo) InitialBlockDownload() bool { return ci.data.InitialBlockDownload }
+
+// Pruned returns true if the node discards old blocks.
+func (ci *ChainInfo) Pruned() bool { return ci.data.Pruned }
+
+// PruneHeight returns the height of the first block still stored by a pruned node.
+func (ci *ChainInfo) PruneHeight() int64 { return int64(ci.data.PruneHeight) }
+
+// String implements the Stringer interface.
+func (ci *ChainInfo) String() string {
+	return ci.data.Chain
+}
+
+// MarshalJSON implements the json.Marshaler interface. The chain info is encoded like the result of
+// getblockchaininfo without the soft fork deployments.
+func (ci *ChainInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ci.data)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. It decodes chain info encoded by MarshalJSON or
+// returned by getblockchaininfo.
+func (ci *ChainInfo) UnmarshalJSON(data []byte) error {
+	var chainInfo btcjson.GetBlockChainInfoResult
+	if err := json.Unmarshal(data, &chainInfo); err != nil {
+		return err
+	}
+	*ci = *NewChainInfo(chainInfo)
+	return nil
+}
+
+// NetworkParams returns the parameters of the network with the given name, either the name given by btcd (e.g.
+// "mainnet") or by Bitcoin Core (e.g. "main").
+func NetworkParams(name string) (*chaincfg.Params, bool) {
+	for _, params := range []*chaincfg.Params{
+		&chaincfg.MainNetParams, &chaincfg.TestNet3Params, &chaincfg.RegressionNetParams, &chaincfg.SigNetParams,
+	} {
+		if name == params.Name || name == ChainName(params) {
+			return params, true
+		}
+	}
+	return nil, false
+}
+
+// ChainName returns the name Bitcoin Core gives to the network described by params, e.g. "main" for mainnet.
+// Networks unknown to Bitcoin Core keep the name given by btcd.
+func ChainName(params *chaincfg.Params) string {
+	switch params.Net {
+	case chaincfg.MainNetParams.Net:
+		return "main"
+	case chaincfg.TestNet3Params.Net:
+		return "test"
+	case chaincfg.RegressionNetParams.Net:
+		return "regtest"
+	case chaincfg.SigNetParams.Net:
+		return "signet"
+	}
+	return params.Name
+}
@@ -0,0 +1,79 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/assert"
+)
+
+// chainInfoJSON is a getblockchaininfo result of Bitcoin Core 22 with its soft fork deployments.
+const chainInfoJSON = `{
+  "chain": "main",
+  "blocks": 709631,
+  "headers": 709632,
+  "bestblockhash": "0000000000000000000493ce3b0ee8d6b2ac0b4ec78f5d6ae1e4bf2ab35e9b0a",
+  "difficulty": 21659344833264.85,
+  "mediantime": 1637218474,
+  "verificationprogress": 0.9999987,
+  "initialblockdownload": false,
+  "chainwork": "00000000000000000000000000000000000000001f1e35c2cdd0a7c3c9a6e3f0",
+  "size_on_disk": 436185437645,
+  "pruned": false,
+  "softforks": {
+    "taproot": {"type": "bip9", "active": true, "height": 709632}
+  },
+  "warnings": ""
+}`
+
+func TestChainInfo(t *testing.T) {
+	info := new(ChainInfo)
+	assert.NoError(t, json.Unmarshal([]byte(chainInfoJSON), info))
+	assert.Equal(t, "main", info.Chain())
+	assert.EqualValues(t, 709631, info.Blocks())
+	assert.EqualValues(t, 709632, info.Headers())
+	assert.Equal(t, "0000000000000000000493ce3b0ee8d6b2ac0b4ec78f5d6ae1e4bf2ab35e9b0a", info.BestBlockHash())
+	assert.Equal(t, 21659344833264.85, info.Difficulty())
+	assert.EqualValues(t, 1637218474, info.MedianTime())
+	assert.Equal(t, 0.9999987, info.VerificationProgress())
+	assert.False(t, info.InitialBlockDownload())
+	assert.False(t, info.Pruned())
+
+	// Soft fork deployments are dropped.
+	data, err := json.Marshal(info)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "softforks")
+	decoded := new(ChainInfo)
+	assert.NoError(t, json.Unmarshal(data, decoded))
+	assert.Equal(t, info, decoded)
+}
+
+func TestChainName(t *testing.T) {
+	tests := []struct {
+		params *chaincfg.Params
+		want   string
+	}{
+		{&chaincfg.MainNetParams, "main"},
+		{&chaincfg.TestNet3Params, "test"},
+		{&chaincfg.RegressionNetParams, "regtest"},
+		{&chaincfg.SigNetParams, "signet"},
+		{&chaincfg.SimNetParams, "simnet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, ChainName(tt.params))
+		})
+	}
+}
+
+func TestNetworkParams(t *testing.T) {
+	for _, name := range []string{"mainnet", "main", "testnet3", "test", "regtest", "signet"} {
+		params, ok := NetworkParams(name)
+		if assert.True(t, ok, name) {
+			assert.Contains(t, []string{params.Name, ChainName(params)}, name)
+		}
+	}
+	_, ok := NetworkParams("simnet")
+	assert.False(t, ok)
+}
@@ -0,0 +1,247 @@
+package types
+
+import (
+	"encoding/hex"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// ScriptClass is the standard form of an output script.
+type ScriptClass uint8
+
+const (
+	// ScriptUnknown is the class of scripts that couldn't be decoded or inferred.
+	ScriptUnknown ScriptClass = iota
+	ScriptNonStandard
+	ScriptP2PK
+	ScriptP2PKH
+	ScriptP2SH
+	ScriptP2WPKH
+	ScriptP2WSH
+	ScriptP2TR
+	ScriptMultisig
+	ScriptOpReturn
+	// ScriptWitnessUnknown is the class of witness programs of versions or lengths not defined yet, which anyone
+	// can spend until a soft fork gives them a meaning.
+	ScriptWitnessUnknown
+)
+
+var scriptClassNames = [...]string{
+	ScriptUnknown:        "Unknown",
+	ScriptNonStandard:    "NonStandard",
+	ScriptP2PK:           "P2PK",
+	ScriptP2PKH:          "P2PKH",
+	ScriptP2SH:           "P2SH",
+	ScriptP2WPKH:         "P2WPKH",
+	ScriptP2WSH:          "P2WSH",
+	ScriptP2TR:           "P2TR",
+	ScriptMultisig:       "Multisig",
+	ScriptOpReturn:       "OpReturn",
+	ScriptWitnessUnknown: "WitnessUnknown",
+}
+
+// String returns the name of the class, e.g. "P2WPKH".
+func (c ScriptClass) String() string {
+	if int(c) < len(scriptClassNames) {
+		return scriptClassNames[c]
+	}
+	return scriptClassNames[ScriptUnknown]
+}
+
+// IsWitness reports whether scripts of the class are witness programs, spent with a witness.
+func (c ScriptClass) IsWitness() bool {
+	return c == ScriptP2WPKH || c == ScriptP2WSH || c == ScriptP2TR || c == ScriptWitnessUnknown
+}
+
+// ClassifyScript returns the class of an output script, following Bitcoin Core's `Solver`: unlike
+// txscript.GetScriptClass, any push only data after OP_RETURN is an OP_RETURN output, and witness programs of
+// versions 1 to 16 that aren't taproot outputs are ScriptWitnessUnknown.
+func ClassifyScript(pkScript []byte) ScriptClass {
+	switch txscript.GetScriptClass(pkScript) {
+	case txscript.PubKeyTy:
+		return ScriptP2PK
+	case txscript.PubKeyHashTy:
+		return ScriptP2PKH
+	case txscript.ScriptHashTy:
+		return ScriptP2SH
+	case txscript.WitnessV0PubKeyHashTy:
+		return ScriptP2WPKH
+	case txscript.WitnessV0ScriptHashTy:
+		return ScriptP2WSH
+	case txscript.WitnessV1TaprootTy:
+		return ScriptP2TR
+	case txscript.MultiSigTy:
+		return ScriptMultisig
+	case txscript.NullDataTy:
+		return ScriptOpReturn
+	}
+	if len(pkScript) > 0 && pkScript[0] == txscript.OP_RETURN && txscript.IsPushOnlyScript(pkScript[1:]) {
+		return ScriptOpReturn
+	}
+	if txscript.IsWitnessProgram(pkScript) {
+		// Version 0 programs of other lengths are unspendable.
+		if version, _, err := txscript.ExtractWitnessProgramInfo(pkScript); err == nil && version != 0 {
+			return ScriptWitnessUnknown
+		}
+	}
+	return ScriptNonStandard
+}
+
+// classifyScriptHex returns the class of a hex encoded output script, or ScriptUnknown if it isn't valid hex.
+func classifyScriptHex(pkScript string) ScriptClass {
+	script, err := hex.DecodeString(pkScript)
+	if err != nil {
+		return ScriptUnknown
+	}
+	return ClassifyScript(script)
+}
+
+// ScriptClass returns the class of the output script.
+func (v *Vout) ScriptClass() ScriptClass { return classifyScriptHex(v.data.ScriptPubKey.Hex) }
+
+// ScriptClass returns the class of the output script.
+func (p *Prevout) ScriptClass() ScriptClass { return classifyScriptHex(p.data.ScriptPubKey.Hex) }
+
+// SpendType is the way an input spends an output: the class of the output script and, for P2SH outputs wrapping a
+// witness program, the class of the program.
+type SpendType struct {
+	Class ScriptClass
+	// Nested is the class of the witness program redeemed by a P2SH output, or ScriptUnknown.
+	Nested ScriptClass
+}
+
+// String returns the name of the spend type, e.g. "P2SH-P2WPKH" or "P2TR", or an empty string if it is unknown.
+func (t SpendType) String() string {
+	switch {
+	case t.Class == ScriptUnknown:
+		return ""
+	case t.Nested == ScriptUnknown:
+		return t.Class.String()
+	}
+	return t.Class.String() + "-" + t.Nested.String()
+}
+
+// SpendType returns the way the input spends its output. The class of the output is the one of the prevout of the
+// input when it is resolved, and is inferred from the script and witness of the input otherwise. Inputs of
+// nonstandard outputs can't always be told apart from the standard ones, e.g. P2SH inputs redeeming a bare public
+// key, so an inferred class is a best guess. The spend type of coinbase inputs is unknown.
+func (v *Vin) SpendType() SpendType {
+	if v.IsCoinbase() {
+		return SpendType{}
+	}
+	pushes, ok := v.sigScriptPushes()
+	witness, witnessOk := v.witnessItems()
+	class := ScriptUnknown
+	if v.prevout != nil {
+		class = v.prevout.ScriptClass()
+	}
+	if class == ScriptUnknown && ok && witnessOk {
+		class = inferSpentClass(pushes, witness)
+	}
+	spendType := SpendType{Class: class}
+	if class == ScriptP2SH && ok && len(pushes) > 0 {
+		if nested := ClassifyScript(pushes[len(pushes)-1]); nested.IsWitness() {
+			spendType.Nested = nested
+		}
+	}
+	return spendType
+}
+
+// sigScriptPushes returns the data pushed by the script of the input, or false if it isn't push only.
+func (v *Vin) sigScriptPushes() ([][]byte, bool) {
+	if v.data.ScriptSig == nil {
+		return nil, true
+	}
+	script, err := hex.DecodeString(v.data.ScriptSig.Hex)
+	if err != nil || !txscript.IsPushOnlyScript(script) {
+		return nil, false
+	}
+	pushes, err := txscript.PushedData(script)
+	return pushes, err == nil
+}
+
+// witnessItems returns the decoded witness of the input, or false if it isn't valid hex.
+func (v *Vin) witnessItems() ([][]byte, bool) {
+	items := make([][]byte, len(v.data.Witness))
+	for i, item := range v.data.Witness {
+		var err error
+		if items[i], err = hex.DecodeString(item); err != nil {
+			return nil, false
+		}
+	}
+	return items, true
+}
+
+// inferSpentClass infers the class of the output spent by an input from the data pushed by its script and its
+// witness.
+func inferSpentClass(pushes, witness [][]byte) ScriptClass {
+	if len(witness) > 0 {
+		switch {
+		case len(pushes) == 1 && txscript.IsWitnessProgram(pushes[0]):
+			return ScriptP2SH
+		case len(pushes) > 0:
+			return ScriptUnknown
+		case len(witness) == 2 && isSignature(witness[0]) && isCompressedPubKey(witness[1]):
+			return ScriptP2WPKH
+		case isTaprootWitness(witness):
+			return ScriptP2TR
+		}
+		return ScriptP2WSH
+	}
+	switch {
+	case len(pushes) == 0:
+		return ScriptUnknown
+	case len(pushes) == 2 && isSignature(pushes[0]) && isPubKey(pushes[1]):
+		return ScriptP2PKH
+	case len(pushes) == 1 && isSignature(pushes[0]):
+		return ScriptP2PK
+	case len(pushes) > 1 && len(pushes[0]) == 0 && allSignatures(pushes[1:]):
+		// The extra item consumed by OP_CHECKMULTISIG, followed by the signatures.
+		return ScriptMultisig
+	}
+	if class := ClassifyScript(pushes[len(pushes)-1]); class != ScriptNonStandard {
+		return ScriptP2SH
+	}
+	return ScriptUnknown
+}
+
+// isTaprootWitness reports whether witness spends a taproot output, either with a single Schnorr signature or
+// with a script and its control block (BIP 341).
+func isTaprootWitness(witness [][]byte) bool {
+	if len(witness) >= 2 && len(witness[len(witness)-1]) > 0 && witness[len(witness)-1][0] == txscript.TaprootAnnexTag {
+		witness = witness[:len(witness)-1]
+	}
+	if len(witness) == 1 {
+		return len(witness[0]) == 64 || len(witness[0]) == 65
+	}
+	control := witness[len(witness)-1]
+	return len(control) >= txscript.ControlBlockBaseSize && len(control) <= txscript.ControlBlockMaxSize &&
+		(len(control)-txscript.ControlBlockBaseSize)%txscript.ControlBlockNodeSize == 0 &&
+		control[0]&txscript.TaprootLeafMask == byte(txscript.BaseLeafVersion)
+}
+
+// isSignature reports whether data looks like a DER encoded ECDSA signature followed by a hash type byte. Unlike
+// isStrictDERSignature, it accepts the loosely encoded signatures allowed before BIP 66.
+func isSignature(data []byte) bool {
+	return len(data) >= 9 && len(data) <= 73 && data[0] == 0x30
+}
+
+// allSignatures reports whether all items look like signatures.
+func allSignatures(items [][]byte) bool {
+	for _, item := range items {
+		if !isSignature(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// isPubKey reports whether data is a compressed or uncompressed public key.
+func isPubKey(data []byte) bool {
+	return isCompressedPubKey(data) || len(data) == 65 && data[0] == 0x04
+}
+
+// isCompressedPubKey reports whether data is a compressed public key.
+func isCompressedPubKey(data []byte) bool {
+	return len(data) == 33 && (data[0] == 0x02 || data[0] == 0x03)
+}
@@ -0,0 +1,108 @@
+package types
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testSig    = "304402200b78e195f1eb150a52ade3e1e0c593b2534ed3bf4236de4fedb5c8fe7171f3bf02202d63b6c3bd58aa91183a50afb445561854b4bebb6977500f85e61a75b0aa740301"
+	testPubKey = "02f3ae2c5c5c9616f9e27df9b823af2c748564203afc240a43b8f054dab83c7139"
+	testP2WPKH = "0014751e76e8199196d454941c45d1b3a323f1433bd6"
+	// testMultisig is a 1-of-1 multisig script.
+	testMultisig = "5121" + testPubKey + "51ae"
+)
+
+// push returns the script pushing the hex encoded data.
+func push(data string) string {
+	b, _ := hex.DecodeString(data)
+	if len(b) > 75 {
+		return "4c" + hex.EncodeToString([]byte{byte(len(b))}) + data
+	}
+	return hex.EncodeToString([]byte{byte(len(b))}) + data
+}
+
+func TestClassifyScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   ScriptClass
+	}{
+		{"p2pk", push(testPubKey) + "ac", ScriptP2PK},
+		{"p2pkh", "76a9148d1ec2350813b2a071353e16b41e884647405d3d88ac", ScriptP2PKH},
+		{"p2sh", "a914b4acb9d78d6a6256964a60484c95de490eaaae7587", ScriptP2SH},
+		{"p2wpkh", testP2WPKH, ScriptP2WPKH},
+		{"p2wsh", "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262", ScriptP2WSH},
+		{"p2tr", "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", ScriptP2TR},
+		{"multisig", testMultisig, ScriptMultisig},
+		{"op_return", "6a0568656c6c6f", ScriptOpReturn},
+		{"op_return pushes", "6a0568656c6c6f0568656c6c6f", ScriptOpReturn},
+		{"op_return empty", "6a", ScriptOpReturn},
+		{"op_return not push only", "6a0568656c6c6f87", ScriptNonStandard},
+		{"witness unknown", "5214751e76e8199196d454941c45d1b3a323f1433bd6", ScriptWitnessUnknown},
+		{"witness v0 unknown length", "0010751e76e8199196d454941c45d1b3a323", ScriptNonStandard},
+		{"nonstandard", "87", ScriptNonStandard},
+		{"empty", "", ScriptNonStandard},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := hex.DecodeString(tt.script)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, ClassifyScript(script))
+			vout := NewVout(&btcjson.Vout{ScriptPubKey: btcjson.ScriptPubKeyResult{Hex: tt.script}})
+			assert.Equal(t, tt.want, vout.ScriptClass())
+		})
+	}
+	vout := NewVout(&btcjson.Vout{ScriptPubKey: btcjson.ScriptPubKeyResult{Hex: "zz"}})
+	assert.Equal(t, ScriptUnknown, vout.ScriptClass())
+	assert.Equal(t, "Unknown", ScriptClass(255).String())
+}
+
+func TestVinSpendType(t *testing.T) {
+	schnorrSig := strings.Repeat("ab", 64)
+	controlBlock := "c0" + strings.Repeat("cd", 32+32)
+	tests := []struct {
+		name      string
+		scriptSig string
+		witness   []string
+		prevout   string
+		want      string
+	}{
+		{"p2pk", push(testSig), nil, "", "P2PK"},
+		{"p2pkh", push(testSig) + push(testPubKey), nil, "", "P2PKH"},
+		{"multisig", "00" + push(testSig), nil, "", "Multisig"},
+		{"p2sh multisig", "00" + push(testSig) + push(testMultisig), nil, "", "P2SH"},
+		{"p2sh-p2wpkh", push(testP2WPKH), []string{testSig, testPubKey}, "", "P2SH-P2WPKH"},
+		{"p2wpkh", "", []string{testSig, testPubKey}, "", "P2WPKH"},
+		{"p2wsh", "", []string{"", testSig, testMultisig}, "", "P2WSH"},
+		{"p2tr key path", "", []string{schnorrSig}, "", "P2TR"},
+		{"p2tr script path", "", []string{schnorrSig, "20" + strings.Repeat("ef", 32) + "ac", controlBlock}, "", "P2TR"},
+		{"p2tr annex", "", []string{schnorrSig, "50aa"}, "", "P2TR"},
+		{"unknown", "51", nil, "", ""},
+		{"prevout", push(testSig), nil, push(testPubKey) + "ac", "P2PK"},
+		{"prevout p2sh-p2wpkh", push(testP2WPKH), []string{testSig, testPubKey}, "a914b4acb9d78d6a6256964a60484c95de490eaaae7587", "P2SH-P2WPKH"},
+		{"prevout nonstandard", push(testSig) + push(testPubKey), nil, "87", "NonStandard"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vin := NewVin(&btcjson.Vin{
+				Txid:      strings.Repeat("00", 32),
+				ScriptSig: &btcjson.ScriptSig{Hex: tt.scriptSig},
+				Witness:   tt.witness,
+			})
+			if tt.prevout != "" {
+				pkScript, err := hex.DecodeString(tt.prevout)
+				assert.NoError(t, err)
+				vin.SetPrevout(NewPrevoutFromScript(btcutil.Amount(1), pkScript, "", nil, 1, false))
+			}
+			assert.Equal(t, tt.want, vin.SpendType().String())
+		})
+	}
+	coinbase := NewVin(&btcjson.Vin{Coinbase: "04ffff001d0104"})
+	assert.Equal(t, SpendType{}, coinbase.SpendType())
+}
@@ -0,0 +1,147 @@
+package types
+
+import (
+	"encoding/json"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// MempoolEntryResult models an entry of the result of `getrawmempool` with verbose = true, as returned by Bitcoin
+// Core. Unlike btcjson.GetRawMempoolVerboseResult, it includes the ancestor and descendant statistics, and the fees
+// are given both in the `fees` object used since v0.19 and in the `fee` field removed in v23.
+type MempoolEntryResult struct {
+	VSize           int32    `json:"vsize"`
+	Weight          int32    `json:"weight"`
+	Fee             float64  `json:"fee,omitempty"`
+	ModifiedFee     float64  `json:"modifiedfee,omitempty"`
+	Time            int64    `json:"time"`
+	Height          int64    `json:"height"`
+	DescendantCount int64    `json:"descendantcount"`
+	DescendantSize  int64    `json:"descendantsize"`
+	AncestorCount   int64    `json:"ancestorcount"`
+	AncestorSize    int64    `json:"ancestorsize"`
+	WTxID           string   `json:"wtxid"`
+	Fees            *Fees    `json:"fees,omitempty"`
+	Depends         []string `json:"depends"`
+	SpentBy         []string `json:"spentby"`
+	Replaceable     bool     `json:"bip125-replaceable"`
+}
+
+// Fees models the `fees` object of a mempool entry, in BTC.
+type Fees struct {
+	Base       float64 `json:"base"`
+	Modified   float64 `json:"modified"`
+	Ancestor   float64 `json:"ancestor"`
+	Descendant float64 `json:"descendant"`
+}
+
+// MempoolTx represents an unconfirmed transaction in the mempool of a node, as seen in a snapshot of the mempool.
+//
+// Wraps a Transaction and its MempoolEntryResult.
+type MempoolTx struct {
+	*Transaction
+	entry        MempoolEntryResult
+	snapshotTime int64
+}
+
+// NewMempoolTx returns the unconfirmed transaction tx with its mempool entry, seen in a snapshot of the mempool
+// taken at snapshotTime (in UNIX epoch time).
+func NewMempoolTx(tx *Transaction, entry MempoolEntryResult, snapshotTime int64) *MempoolTx {
+	return &MempoolTx{tx, entry, snapshotTime}
+}
+
+// SnapshotTime returns the time the snapshot of the mempool including the transaction was taken, expressed in
+// UNIX epoch time.
+func (tx *MempoolTx) SnapshotTime() int64 { return tx.snapshotTime }
+
+// FirstSeen returns the time the transaction entered the mempool, expressed in UNIX epoch time.
+func (tx *MempoolTx) FirstSeen() int64 { return tx.entry.Time }
+
+// EntryHeight returns the height of the chain tip when the transaction entered the mempool.
+func (tx *MempoolTx) EntryHeight() int64 { return tx.entry.Height }
+
+// Fee returns the fee paid by the transaction in satoshis. Unlike Transaction.Fee, it is given by the node so it
+// is known without the prevouts of the transaction.
+func (tx *MempoolTx) Fee() btcutil.Amount {
+	if tx.entry.Fees != nil {
+		return amountFromBTC(tx.entry.Fees.Base)
+	}
+	return amountFromBTC(tx.entry.Fee)
+}
+
+// ModifiedFee returns the fee of the transaction used by the node to prioritise it, in satoshis.
+func (tx *MempoolTx) ModifiedFee() btcutil.Amount {
+	if tx.entry.Fees != nil {
+		return amountFromBTC(tx.entry.Fees.Modified)
+	}
+	return amountFromBTC(tx.entry.ModifiedFee)
+}
+
+// VSize returns the virtual size of the transaction used by the node for its fee rate, which accounts for
+// signature operations.
+func (tx *MempoolTx) VSize() int32 { return tx.entry.VSize }
+
+// FeeRate returns the fee rate of the transaction in satoshis per virtual byte.
+func (tx *MempoolTx) FeeRate() float64 {
+	if tx.entry.VSize == 0 {
+		return 0
+	}
+	return float64(tx.Fee()) / float64(tx.entry.VSize)
+}
+
+// AncestorCount returns the number of unconfirmed ancestors of the transaction, including itself.
+func (tx *MempoolTx) AncestorCount() int64 { return tx.entry.AncestorCount }
+
+// AncestorSize returns the virtual size of the unconfirmed ancestors of the transaction, including itself.
+func (tx *MempoolTx) AncestorSize() int64 { return tx.entry.AncestorSize }
+
+// DescendantCount returns the number of unconfirmed descendants of the transaction, including itself.
+func (tx *MempoolTx) DescendantCount() int64 { return tx.entry.DescendantCount }
+
+// DescendantSize returns the virtual size of the unconfirmed descendants of the transaction, including itself.
+func (tx *MempoolTx) DescendantSize() int64 { return tx.entry.DescendantSize }
+
+// Depends returns the ids of the unconfirmed transactions spent by the transaction.
+func (tx *MempoolTx) Depends() []string { return tx.entry.Depends }
+
+// SpentBy returns the ids of the unconfirmed transactions spending the transaction.
+func (tx *MempoolTx) SpentBy() []string { return tx.entry.SpentBy }
+
+// Replaceable returns whether the transaction signals replaceability (BIP 125), directly or through an ancestor.
+func (tx *MempoolTx) Replaceable() bool { return tx.entry.Replaceable }
+
+// MarshalJSON implements the json.Marshaler interface. The transaction is encoded like the result of
+// `getrawtransaction` with verbose = true, with its mempool entry in an `entry` field and the time of the snapshot
+// in a `snapshottime` field.
+func (tx *MempoolTx) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(tx.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := json.Marshal(mempoolEntry{tx.entry, tx.snapshotTime})
+	if err != nil {
+		return nil, err
+	}
+	// Both are JSON objects, merged by joining their fields.
+	return append(append(data[:len(data)-1], ','), entry[1:]...), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, decoding transactions encoded by MarshalJSON.
+func (tx *MempoolTx) UnmarshalJSON(data []byte) error {
+	var entry mempoolEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return err
+	}
+	tx.Transaction = new(Transaction)
+	if err := json.Unmarshal(data, tx.Transaction); err != nil {
+		return err
+	}
+	tx.entry, tx.snapshotTime = entry.Entry, entry.SnapshotTime
+	return nil
+}
+
+// mempoolEntry holds the fields added by MempoolTx to the JSON encoding of a transaction.
+type mempoolEntry struct {
+	Entry        MempoolEntryResult `json:"entry"`
+	SnapshotTime int64              `json:"snapshottime"`
+}
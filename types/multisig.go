@@ -0,0 +1,107 @@
+package types
+
+import (
+	"encoding/hex"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// Multisig is an m-of-n multisig script, `OP_m <pubkey>... OP_n OP_CHECKMULTISIG`, spendable with signatures of
+// Required of its PubKeys.
+type Multisig struct {
+	// Required is the number of signatures required, m.
+	Required int
+	// PubKeys are the hex encoded public keys of the script, in order. Their number is n.
+	PubKeys []string
+}
+
+// ParseMultisig returns the multisig script encoded by script, or nil if it isn't a standard multisig script.
+func ParseMultisig(script []byte) *Multisig {
+	if ok, _ := txscript.IsMultisigScript(script); !ok {
+		return nil
+	}
+	_, required, err := txscript.CalcMultiSigStats(script)
+	if err != nil {
+		return nil
+	}
+	// The counts are small integers so only the public keys are pushed data.
+	pushes, err := txscript.PushedData(script)
+	if err != nil {
+		return nil
+	}
+	pubKeys := make([]string, len(pushes))
+	for i, pubKey := range pushes {
+		pubKeys[i] = hex.EncodeToString(pubKey)
+	}
+	return &Multisig{Required: required, PubKeys: pubKeys}
+}
+
+// parseMultisigHex returns the multisig script encoded by a hex encoded script, or nil if it isn't one.
+func parseMultisigHex(script string) *Multisig {
+	if script == "" {
+		return nil
+	}
+	b, err := hex.DecodeString(script)
+	if err != nil {
+		return nil
+	}
+	return ParseMultisig(b)
+}
+
+// N returns the number of public keys of the script.
+func (m *Multisig) N() int { return len(m.PubKeys) }
+
+// Addresses returns the P2PKH address of each public key on the network described by params, the way the keys of
+// P2PK outputs are given an address, or an empty string for keys that aren't valid.
+func (m *Multisig) Addresses(params *chaincfg.Params) []string {
+	addresses := make([]string, len(m.PubKeys))
+	for i, pubKey := range m.PubKeys {
+		b, err := hex.DecodeString(pubKey)
+		if err != nil {
+			continue
+		}
+		if addr, err := btcutil.NewAddressPubKey(b, params); err == nil {
+			addresses[i] = addr.EncodeAddress()
+		}
+	}
+	return addresses
+}
+
+// Multisig returns the bare multisig script of the output, or nil if the output isn't a bare multisig output.
+func (v *Vout) Multisig() *Multisig { return parseMultisigHex(v.data.ScriptPubKey.Hex) }
+
+// RedeemScript returns the hex encoded redeem script revealed by the input, the last item pushed by its script, or
+// an empty string if it doesn't spend a P2SH output.
+func (v *Vin) RedeemScript() string {
+	if v.SpendType().Class != ScriptP2SH {
+		return ""
+	}
+	pushes, ok := v.sigScriptPushes()
+	if !ok || len(pushes) == 0 {
+		return ""
+	}
+	return hex.EncodeToString(pushes[len(pushes)-1])
+}
+
+// WitnessScript returns the hex encoded witness script revealed by the input, the last item of its witness, or an
+// empty string if it doesn't spend a P2WSH output, directly or nested in a P2SH output.
+func (v *Vin) WitnessScript() string {
+	if spendType := v.SpendType(); spendType.Class != ScriptP2WSH && spendType.Nested != ScriptP2WSH {
+		return ""
+	}
+	if len(v.data.Witness) == 0 {
+		return ""
+	}
+	return v.data.Witness[len(v.data.Witness)-1]
+}
+
+// Multisig returns the multisig script redeemed by the input, its witness script or else its redeem script, or nil
+// if it doesn't redeem one. Bare multisig outputs are given by Vout.Multisig when they are created.
+func (v *Vin) Multisig() *Multisig {
+	if script := v.WitnessScript(); script != "" {
+		return parseMultisigHex(script)
+	}
+	return parseMultisigHex(v.RedeemScript())
+}
@@ -0,0 +1,81 @@
+package types
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/assert"
+)
+
+const testUncompressedPubKey = "047211a824f55b505228e4c3d5194c1fcfaa15a456abdf37f9b9d97a4040afc073dee6c89064984f03385237d92167c13e236446b417ab79a0fcae412ae3316b77"
+
+// test2of2 is a 2-of-2 multisig script.
+var test2of2 = "52" + push(testPubKey) + push(testUncompressedPubKey) + "52ae"
+
+func TestParseMultisig(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   *Multisig
+	}{
+		{"1-of-1", testMultisig, &Multisig{1, []string{testPubKey}}},
+		{"2-of-2", test2of2, &Multisig{2, []string{testPubKey, testUncompressedPubKey}}},
+		{"invalid key", "51" + push("02"+strings.Repeat("00", 31)) + "51ae", &Multisig{1, []string{"02" + strings.Repeat("00", 31)}}},
+		{"wrong count", "5121" + testPubKey + "52ae", nil},
+		{"p2pk", push(testPubKey) + "ac", nil},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := hex.DecodeString(tt.script)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, ParseMultisig(script))
+			vout := NewVout(&btcjson.Vout{ScriptPubKey: btcjson.ScriptPubKeyResult{Hex: tt.script}})
+			assert.Equal(t, tt.want, vout.Multisig())
+		})
+	}
+}
+
+func TestMultisigAddresses(t *testing.T) {
+	multisig := &Multisig{1, []string{testPubKey, testUncompressedPubKey, "02", "zz"}}
+	assert.Equal(t, 4, multisig.N())
+	assert.Equal(t, []string{"1QgTYzMYqStzZBQx8gguYaJQMjFRbagbh", "1HLoD9E4SDFFPDiYfNYnkBLQ85Y51J3Zb1", "", ""},
+		multisig.Addresses(&chaincfg.MainNetParams))
+}
+
+func TestVinMultisig(t *testing.T) {
+	// A P2WSH program nested in a P2SH output.
+	p2wsh := "0020" + strings.Repeat("ab", 32)
+	tests := []struct {
+		name          string
+		scriptSig     string
+		witness       []string
+		redeemScript  string
+		witnessScript string
+		want          *Multisig
+	}{
+		{"p2sh", "00" + push(testSig) + push(testSig) + push(test2of2), nil, test2of2, "",
+			&Multisig{2, []string{testPubKey, testUncompressedPubKey}}},
+		{"p2wsh", "", []string{"", testSig, testMultisig}, "", testMultisig, &Multisig{1, []string{testPubKey}}},
+		{"p2sh-p2wsh", push(p2wsh), []string{"", testSig, testSig, test2of2}, p2wsh, test2of2,
+			&Multisig{2, []string{testPubKey, testUncompressedPubKey}}},
+		{"p2sh not multisig", push(testSig) + push(push(testPubKey)+"ac"), nil, push(testPubKey) + "ac", "", nil},
+		{"p2pkh", push(testSig) + push(testPubKey), nil, "", "", nil},
+		{"bare multisig", "00" + push(testSig), nil, "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vin := NewVin(&btcjson.Vin{
+				Txid:      strings.Repeat("00", 32),
+				ScriptSig: &btcjson.ScriptSig{Hex: tt.scriptSig},
+				Witness:   tt.witness,
+			})
+			assert.Equal(t, tt.redeemScript, vin.RedeemScript())
+			assert.Equal(t, tt.witnessScript, vin.WitnessScript())
+			assert.Equal(t, tt.want, vin.Multisig())
+		})
+	}
+}
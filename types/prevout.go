@@ -0,0 +1,126 @@
+package types
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// Prevout represents the output spent by a transaction input, along with the height of the block that created it
+// and, once the loader's UTXO set has connected the spending block, where it was spent.
+//
+// Wraps the `prevout` field of inputs returned by `getblock` with verbosity = 3.
+type Prevout struct {
+	data  prevoutResult
+	value btcutil.Amount
+	// spentHeight and spentTxID are the height of the block and the transaction spending the output, if known.
+	spentHeight int64
+	spentTxID   string
+}
+
+// prevoutResult is the `prevout` field of an input returned by `getblock` with verbosity = 3.
+type prevoutResult struct {
+	Generated    bool                       `json:"generated"`
+	Height       int64                      `json:"height"`
+	Value        float64                    `json:"value"`
+	ScriptPubKey btcjson.ScriptPubKeyResult `json:"scriptPubKey"`
+}
+
+// NewPrevout returns the prevout of an input spending out, an output created at the given height by a coinbase
+// transaction if generated is set.
+func NewPrevout(out *Vout, height int64, generated bool) *Prevout {
+	return &Prevout{data: prevoutResult{
+		Generated:    generated,
+		Height:       height,
+		Value:        out.Value().ToBTC(),
+		ScriptPubKey: out.ScriptPubKey(),
+	}, value: out.Value()}
+}
+
+// NewPrevoutFromScript returns the prevout of an input spending an output of the given value paying to pkScript,
+// created at the given height by a coinbase transaction if generated is set. The type and addresses of the script
+// are the ones given by the node for the output.
+func NewPrevoutFromScript(value btcutil.Amount, pkScript []byte, scriptType string, addresses []string, height int64, generated bool) *Prevout {
+	return &Prevout{data: prevoutResult{
+		Generated: generated,
+		Height:    height,
+		Value:     value.ToBTC(),
+		ScriptPubKey: btcjson.ScriptPubKeyResult{
+			Asm:       scriptAsm(pkScript, false),
+			Hex:       hex.EncodeToString(pkScript),
+			Type:      scriptType,
+			Addresses: addresses,
+		},
+	}, value: value}
+}
+
+// Generated returns whether the output was created by a coinbase transaction.
+func (p *Prevout) Generated() bool { return p.data.Generated }
+
+// Height returns the height of the block that created the output.
+func (p *Prevout) Height() int64 { return p.data.Height }
+
+// Value returns the value of the output in satoshis.
+func (p *Prevout) Value() btcutil.Amount { return p.value }
+
+// ScriptPubKey returns the script of the output.
+func (p *Prevout) ScriptPubKey() btcjson.ScriptPubKeyResult { return p.data.ScriptPubKey }
+
+// SpentAt returns the height of the block and the ID of the transaction spending the output, or false if they
+// aren't known.
+func (p *Prevout) SpentAt() (int64, string, bool) {
+	return p.spentHeight, p.spentTxID, p.spentTxID != ""
+}
+
+// SetSpentAt records that the output is spent by transaction txid in the block at height.
+func (p *Prevout) SetSpentAt(height int64, txid string) {
+	p.spentHeight, p.spentTxID = height, txid
+}
+
+// Address returns the address the output pays to, or an empty string if it doesn't pay to a single address. Like
+// Vout.Address, it is the address given by the node or else the one derived from the script for the network
+// described by params.
+func (p *Prevout) Address(params *chaincfg.Params) string {
+	return scriptPubKeyAddress(p.data.ScriptPubKey, params)
+}
+
+// MarshalJSON implements the json.Marshaler interface. The prevout is encoded like in the result of getblock with
+// verbosity = 3.
+func (p *Prevout) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.data)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. The singular `address` given by Bitcoin Core since v22
+// is stored as the only element of the script's Addresses.
+func (p *Prevout) UnmarshalJSON(data []byte) error {
+	var prevout struct {
+		prevoutResult
+		ScriptPubKey coreScriptPubKey `json:"scriptPubKey"`
+	}
+	if err := json.Unmarshal(data, &prevout); err != nil {
+		return err
+	}
+	p.data = prevout.prevoutResult
+	p.data.ScriptPubKey = prevout.ScriptPubKey.result()
+	p.value = amountFromBTC(p.data.Value)
+	return nil
+}
+
+// coreScriptPubKey is an output script as returned by Bitcoin Core, which gives its address in a singular
+// `address` field since v22.
+type coreScriptPubKey struct {
+	btcjson.ScriptPubKeyResult
+	Address string `json:"address"`
+}
+
+// result returns the script with its singular address stored in Addresses.
+func (s coreScriptPubKey) result() btcjson.ScriptPubKeyResult {
+	result := s.ScriptPubKeyResult
+	if s.Address != "" && len(result.Addresses) == 0 {
+		result.Addresses = []string{s.Address}
+	}
+	return result
+}
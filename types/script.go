@@ -0,0 +1,150 @@
+package types
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// sigHashTypeNames are the names Bitcoin Core gives to the hash types of signatures in disassembled scripts.
+var sigHashTypeNames = map[txscript.SigHashType]string{
+	txscript.SigHashAll: "ALL",
+	txscript.SigHashAll | txscript.SigHashAnyOneCanPay: "ALL|ANYONECANPAY",
+	txscript.SigHashNone: "NONE",
+	txscript.SigHashNone | txscript.SigHashAnyOneCanPay:   "NONE|ANYONECANPAY",
+	txscript.SigHashSingle:                                "SINGLE",
+	txscript.SigHashSingle | txscript.SigHashAnyOneCanPay: "SINGLE|ANYONECANPAY",
+}
+
+// scriptAsm disassembles a script the way Bitcoin Core's `ScriptToAsmStr` does, so that decoded blocks match the
+// `asm` fields returned by the node. It differs from txscript.DisasmString in that pushes of up to 4 bytes are
+// printed as numbers, and, when decodeSigHash is set, the hash type of DER signatures is printed by name (e.g.
+// `[ALL]`) instead of as the last byte of the signature. Core only decodes hash types in input scripts.
+func scriptAsm(script []byte, decodeSigHash bool) string {
+	decodeSigHash = decodeSigHash &&
+		!(len(script) > 0 && script[0] == txscript.OP_RETURN) && len(script) <= txscript.MaxScriptSize
+
+	var asm strings.Builder
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	for first := true; ; first = false {
+		if tokenizer.Done() {
+			break
+		}
+		if !first {
+			asm.WriteByte(' ')
+		}
+		if !tokenizer.Next() {
+			asm.WriteString("[error]")
+			break
+		}
+		op, data := tokenizer.Opcode(), tokenizer.Data()
+		switch {
+		case op <= txscript.OP_PUSHDATA4 && len(data) <= 4:
+			fmt.Fprintf(&asm, "%d", scriptNum(data))
+		case op <= txscript.OP_PUSHDATA4:
+			if name, ok := sigHashTypeNames[txscript.SigHashType(data[len(data)-1])]; ok &&
+				decodeSigHash && isStrictDERSignature(data) {
+				asm.WriteString(hex.EncodeToString(data[:len(data)-1]))
+				asm.WriteString("[" + name + "]")
+			} else {
+				asm.WriteString(hex.EncodeToString(data))
+			}
+		default:
+			asm.WriteString(opcodeName(op))
+		}
+	}
+	return asm.String()
+}
+
+// scriptPubKeyAddress returns the single address given by the node for an output script, or else the one derived
+// from the script for the network described by params, or an empty string if it doesn't pay to a single address.
+func scriptPubKeyAddress(script btcjson.ScriptPubKeyResult, params *chaincfg.Params) string {
+	if addresses := script.Addresses; len(addresses) > 0 {
+		if len(addresses) == 1 {
+			return addresses[0]
+		}
+		return ""
+	}
+	pkScript, err := hex.DecodeString(script.Hex)
+	if err != nil {
+		return ""
+	}
+	return scriptAddress(pkScript, params)
+}
+
+// scriptAddress returns the address an output script pays to on the network described by params, or an empty
+// string if it doesn't pay to a single address. Bare public keys are given the P2PKH address of the key.
+func scriptAddress(pkScript []byte, params *chaincfg.Params) string {
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, params)
+	if err != nil || len(addrs) != 1 {
+		return ""
+	}
+	switch class {
+	case txscript.PubKeyTy, txscript.PubKeyHashTy, txscript.ScriptHashTy, txscript.WitnessV0PubKeyHashTy,
+		txscript.WitnessV0ScriptHashTy, txscript.WitnessV1TaprootTy:
+		// The address of a public key is encoded as its P2PKH address.
+		return addrs[0].EncodeAddress()
+	}
+	return ""
+}
+
+// opcodeName returns the name Bitcoin Core gives to a non push opcode.
+func opcodeName(op byte) string {
+	if op > txscript.OP_CHECKSIGADD && op < txscript.OP_INVALIDOPCODE {
+		return "OP_UNKNOWN"
+	}
+	// A single non push opcode always parses.
+	name, _ := txscript.DisasmString([]byte{op})
+	return name
+}
+
+// scriptNum decodes a little endian, sign and magnitude number as pushed by a script.
+func scriptNum(data []byte) int64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << (8 * i)
+	}
+	if last := len(data) - 1; data[last]&0x80 != 0 {
+		return -(n &^ (0x80 << (8 * last)))
+	}
+	return n
+}
+
+// isStrictDERSignature reports whether sig is a DER encoded signature followed by a hash type byte, as required by
+// BIP 66. It mirrors Bitcoin Core's `IsValidSignatureEncoding`.
+func isStrictDERSignature(sig []byte) bool {
+	if len(sig) < 9 || len(sig) > 73 {
+		return false
+	}
+	if sig[0] != 0x30 || int(sig[1]) != len(sig)-3 {
+		return false
+	}
+	lenR := int(sig[3])
+	if 5+lenR >= len(sig) {
+		return false
+	}
+	lenS := int(sig[5+lenR])
+	if lenR+lenS+7 != len(sig) {
+		return false
+	}
+	if sig[2] != 0x02 || lenR == 0 || sig[4]&0x80 != 0 {
+		return false
+	}
+	if lenR > 1 && sig[4] == 0x00 && sig[5]&0x80 == 0 {
+		return false
+	}
+	if sig[lenR+4] != 0x02 || lenS == 0 || sig[lenR+6]&0x80 != 0 {
+		return false
+	}
+	if lenS > 1 && sig[lenR+6] == 0x00 && sig[lenR+7]&0x80 == 0 {
+		return false
+	}
+	return true
+}
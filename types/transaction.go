@@ -1,9 +1,14 @@
 package types
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 )
 
 // Transaction represents a Bitcoin transaction.
@@ -89,6 +94,9 @@ func (tx *Transaction) Version() uint32 { return tx.data.Version }
 // LockTime returns the transaction lock time.
 func (tx *Transaction) LockTime() uint32 { return tx.data.LockTime }
 
+// IsCoinbase returns whether the transaction is a coinbase transaction.
+func (tx *Transaction) IsCoinbase() bool { return len(tx.vin) > 0 && tx.vin[0].IsCoinbase() }
+
 // Vin returns the transaction's inputs.
 func (tx *Transaction) Vin() []*Vin { return tx.vin }
 
@@ -107,6 +115,25 @@ func (tx *Transaction) Time() int64 { return tx.data.Time }
 // BlockTime returns the time of the block containing the transaction.
 func (tx *Transaction) BlockTime() int64 { return tx.data.Blocktime }
 
+// Fee returns the fee paid by the transaction: the value of the outputs spent by its inputs minus the value of its
+// outputs. It returns false if the prevout of an input isn't resolved. Coinbase transactions pay no fee.
+func (tx *Transaction) Fee() (btcutil.Amount, bool) {
+	if tx.IsCoinbase() {
+		return 0, true
+	}
+	var fee btcutil.Amount
+	for _, in := range tx.vin {
+		if in.prevout == nil {
+			return 0, false
+		}
+		fee += in.prevout.Value()
+	}
+	for _, out := range tx.vout {
+		fee -= out.Value()
+	}
+	return fee, true
+}
+
 // Block returns the block containing the transaction.
 func (tx *Transaction) Block() *Block {
 	if tx.block == nil {
@@ -121,9 +148,33 @@ func (tx *Transaction) String() string {
 	return tx.data.Txid
 }
 
+// MarshalJSON implements the json.Marshaler interface. The transaction is encoded like in the result of
+// getblock with verbosity = 3.
+func (tx *Transaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newTxResult(tx))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. It decodes a transaction encoded by MarshalJSON or
+// returned by getrawtransaction with verbose = true.
+func (tx *Transaction) UnmarshalJSON(data []byte) error {
+	var raw btcjson.TxRawResult
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var core coreTx
+	if err := json.Unmarshal(data, &core); err != nil {
+		return err
+	}
+	core.setAddresses(&raw)
+	*tx = *NewTransaction(raw)
+	core.setPrevouts(tx)
+	return nil
+}
+
 // Vin represents a Bitcoin transaction input.
 type Vin struct {
-	data *btcjson.Vin
+	data    *btcjson.Vin
+	prevout *Prevout
 }
 
 // NewVin creates a new Vin from raw json result.
@@ -169,23 +220,115 @@ func (v *Vin) IsCoinbase() bool {
 	return len(v.data.Coinbase) > 0
 }
 
+// OutPoint returns the outpoint of the output spent by the input.
+func (v *Vin) OutPoint() (wire.OutPoint, error) {
+	hash, err := chainhash.NewHashFromStr(v.data.Txid)
+	if err != nil {
+		return wire.OutPoint{}, err
+	}
+	return *wire.NewOutPoint(hash, v.data.Vout), nil
+}
+
+// Prevout returns the output spent by the input, or nil if it wasn't resolved.
+func (v *Vin) Prevout() *Prevout { return v.prevout }
+
+// SetPrevout stores the output spent by the input.
+func (v *Vin) SetPrevout(prevout *Prevout) { v.prevout = prevout }
+
 // Vout represents a Bitcoin transaction output.
 type Vout struct {
-	data *btcjson.Vout
+	data  *btcjson.Vout
+	value btcutil.Amount
 }
 
 // NewVout returns a new instance of a transaction output.
 func NewVout(vout *btcjson.Vout) *Vout {
 	return &Vout{
-		data: vout,
+		data:  vout,
+		value: amountFromBTC(vout.Value),
 	}
 }
 
-// Value returns the value of the output.
-func (v *Vout) Value() float64 { return v.data.Value }
+// Value returns the value of the output in satoshis.
+func (v *Vout) Value() btcutil.Amount { return v.value }
 
 // N returns the index of the output.
 func (v *Vout) N() uint32 { return v.data.N }
 
 // ScriptPubKey returns the script of the output.
 func (v *Vout) ScriptPubKey() btcjson.ScriptPubKeyResult { return v.data.ScriptPubKey }
+
+// Address returns the address the output pays to, or an empty string if it doesn't pay to a single address, e.g.
+// for bare multisig, OP_RETURN and nonstandard scripts.
+//
+// The address given by the node is used, from the singular `address` field of Bitcoin Core 22+ or the `addresses`
+// of older nodes. Otherwise it is derived from the script for the network described by params. P2PK outputs are
+// given the P2PKH address of their public key, as Bitcoin Core did before v22.
+func (v *Vout) Address(params *chaincfg.Params) string {
+	return scriptPubKeyAddress(v.data.ScriptPubKey, params)
+}
+
+// coreTx holds the fields of a transaction returned by Bitcoin Core that btcjson doesn't decode: the singular
+// `address` of output scripts given since v22, and the prevouts of inputs given by `getblock` with verbosity = 3.
+type coreTx struct {
+	Vin []struct {
+		Prevout *Prevout `json:"prevout"`
+	} `json:"vin"`
+	Vout []struct {
+		ScriptPubKey coreScriptPubKey `json:"scriptPubKey"`
+	} `json:"vout"`
+}
+
+// setAddresses stores the singular addresses of the outputs of tx in their Addresses.
+func (c coreTx) setAddresses(tx *btcjson.TxRawResult) {
+	for i, out := range c.Vout {
+		tx.Vout[i].ScriptPubKey = out.ScriptPubKey.result()
+	}
+}
+
+// setPrevouts stores the prevouts of the inputs of tx.
+func (c coreTx) setPrevouts(tx *Transaction) {
+	for i, in := range c.Vin {
+		if in.Prevout != nil {
+			tx.vin[i].prevout = in.Prevout
+		}
+	}
+}
+
+// txResult is a transaction encoded like in the result of getblock with verbosity = 3, with the prevouts of its
+// inputs.
+type txResult struct {
+	btcjson.TxRawResult
+	Vin []vinResult `json:"vin"`
+}
+
+// newTxResult returns the encoding of tx.
+func newTxResult(tx *Transaction) txResult {
+	res := txResult{tx.data, make([]vinResult, len(tx.vin))}
+	for i, in := range tx.vin {
+		res.Vin[i] = vinResult{*in.data, in.prevout}
+	}
+	return res
+}
+
+// vinResult is an input encoded like in the result of getblock with verbosity = 3.
+type vinResult struct {
+	btcjson.Vin
+	Prevout *Prevout
+}
+
+// MarshalJSON implements the json.Marshaler interface. btcjson.Vin has its own encoding, which the prevout is
+// appended to.
+func (v vinResult) MarshalJSON() ([]byte, error) {
+	data, err := v.Vin.MarshalJSON()
+	if err != nil || v.Prevout == nil {
+		return data, err
+	}
+	prevout, err := json.Marshal(v.Prevout)
+	if err != nil {
+		return nil, err
+	}
+	data = append(data[:len(data)-1], `,"prevout":`...)
+	data = append(data, prevout...)
+	return append(data, '}'), nil
+}
@@ -1,9 +1,15 @@
 package types
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"testing"
 
 	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -43,7 +49,9 @@ func (s *TransactionTestSuite) TestTransactionData() {
 	}
 	s.Len(tx.Vout(), len(s.tx.Vout))
 	for i, vout := range s.tx.Vout {
-		s.Equal(vout.Value, tx.Vout()[i].Value())
+		value, err := btcutil.NewAmount(vout.Value)
+		s.Require().NoError(err)
+		s.Equal(value, tx.Vout()[i].Value())
 		s.Equal(vout.N, tx.Vout()[i].N())
 		s.Equal(vout.ScriptPubKey, tx.Vout()[i].ScriptPubKey())
 	}
@@ -67,6 +75,92 @@ func (s *TransactionTestSuite) TestTransactionWithBlock() {
 	s.Nil(tx, "tx should be nil")
 }
 
+func (s *TransactionTestSuite) TestTransactionPrevoutJSON() {
+	tx := NewTransaction(s.tx)
+	s.Nil(tx.Vin()[0].Prevout())
+	outPoint, err := tx.Vin()[0].OutPoint()
+	s.NoError(err)
+	s.Equal(s.tx.Vin[0].Txid, outPoint.Hash.String())
+	s.Equal(s.tx.Vin[0].Vout, outPoint.Index)
+	prevout := NewPrevout(tx.Vout()[0], 409000, true)
+	tx.Vin()[0].SetPrevout(prevout)
+
+	// The prevout is encoded like by getblock with verbosity 3.
+	data, err := json.Marshal(tx)
+	s.Require().NoError(err)
+	var decoded Transaction
+	s.Require().NoError(json.Unmarshal(data, &decoded))
+	s.Equal(tx.data, decoded.data)
+	s.Equal(prevout, decoded.Vin()[0].Prevout())
+	s.Nil(decoded.Vin()[1].Prevout())
+	s.EqualValues(409000, decoded.Vin()[0].Prevout().Height())
+	s.True(decoded.Vin()[0].Prevout().Generated())
+	s.Equal(tx.Vout()[0].Value(), decoded.Vin()[0].Prevout().Value())
+
+	// Bitcoin Core gives the address of the prevout's script in a singular field.
+	var core Prevout
+	s.Require().NoError(json.Unmarshal([]byte(`{"generated":false,"height":5,"value":0.1,`+
+		`"scriptPubKey":{"asm":"","hex":"","type":"witness_v0_keyhash","address":"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"}}`), &core))
+	s.Equal("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", core.Address(&chaincfg.MainNetParams))
+	s.Equal([]string{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"}, core.ScriptPubKey().Addresses)
+}
+
 func TestTransactionTestSuite(t *testing.T) {
 	suite.Run(t, new(TransactionTestSuite))
 }
+
+func TestVoutAddress(t *testing.T) {
+	const pubKey = "047211a824f55b505228e4c3d5194c1fcfaa15a456abdf37f9b9d97a4040afc073dee6c89064984f03385237d92167c13e236446b417ab79a0fcae412ae3316b77"
+	tests := []struct {
+		name   string
+		vout   string
+		params *chaincfg.Params
+		want   string
+	}{
+		{"singular", `{"value":1,"n":0,"scriptPubKey":{"hex":"","address":"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"}}`,
+			&chaincfg.MainNetParams, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+		{"plural", `{"value":1,"n":0,"scriptPubKey":{"hex":"","addresses":["1DsB8CHc7fa87GUm6qs6YGoCRgQpBo2TJZ"]}}`,
+			&chaincfg.MainNetParams, "1DsB8CHc7fa87GUm6qs6YGoCRgQpBo2TJZ"},
+		{"several", `{"value":1,"n":0,"scriptPubKey":{"hex":"","addresses":["1DsB8CHc7fa87GUm6qs6YGoCRgQpBo2TJZ","1HLoD9E4SDFFPDiYfNYnkBLQ85Y51J3Zb1"]}}`,
+			&chaincfg.MainNetParams, ""},
+		{"p2pk", `{"value":1,"n":0,"scriptPubKey":{"hex":"41` + pubKey + `ac"}}`,
+			&chaincfg.MainNetParams, "1HLoD9E4SDFFPDiYfNYnkBLQ85Y51J3Zb1"},
+		{"p2pkh", `{"value":1,"n":0,"scriptPubKey":{"hex":"76a9148d1ec2350813b2a071353e16b41e884647405d3d88ac"}}`,
+			&chaincfg.MainNetParams, "1DsB8CHc7fa87GUm6qs6YGoCRgQpBo2TJZ"},
+		{"p2pkh testnet", `{"value":1,"n":0,"scriptPubKey":{"hex":"76a9148d1ec2350813b2a071353e16b41e884647405d3d88ac"}}`,
+			&chaincfg.TestNet3Params, "mtP8RFNavh1NtNxNpQqUNC1XHg1X6w6EHv"},
+		{"p2sh", `{"value":1,"n":0,"scriptPubKey":{"hex":"a914b4acb9d78d6a6256964a60484c95de490eaaae7587"}}`,
+			&chaincfg.MainNetParams, "3JALUHKvqB7NToPA2jALntCUWmvsgYMyGj"},
+		{"p2wpkh", `{"value":1,"n":0,"scriptPubKey":{"hex":"0014751e76e8199196d454941c45d1b3a323f1433bd6"}}`,
+			&chaincfg.MainNetParams, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+		{"p2wsh", `{"value":1,"n":0,"scriptPubKey":{"hex":"00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"}}`,
+			&chaincfg.MainNetParams, "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3"},
+		{"p2tr", `{"value":1,"n":0,"scriptPubKey":{"hex":"512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"}}`,
+			&chaincfg.MainNetParams, "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0"},
+		{"multisig", `{"value":1,"n":0,"scriptPubKey":{"hex":"5141` + pubKey + `51ae"}}`,
+			&chaincfg.MainNetParams, ""},
+		{"op_return", `{"value":0,"n":0,"scriptPubKey":{"hex":"6a0568656c6c6f"}}`,
+			&chaincfg.MainNetParams, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tx Transaction
+			require.NoError(t, json.Unmarshal([]byte(`{"txid":"","vin":[],"vout":[`+tt.vout+`]}`), &tx))
+			assert.Equal(t, tt.want, tx.Vout()[0].Address(tt.params))
+		})
+	}
+}
+
+func TestPrevoutAddress(t *testing.T) {
+	p2pkh, err := hex.DecodeString("76a9148d1ec2350813b2a071353e16b41e884647405d3d88ac")
+	require.NoError(t, err)
+	// Prevouts of the UTXO set and of older nodes may have no addresses: the address is derived from the script.
+	prevout := NewPrevoutFromScript(1, p2pkh, "pubkeyhash", nil, 1, false)
+	assert.Equal(t, "1DsB8CHc7fa87GUm6qs6YGoCRgQpBo2TJZ", prevout.Address(&chaincfg.MainNetParams))
+	assert.Equal(t, "mtP8RFNavh1NtNxNpQqUNC1XHg1X6w6EHv", prevout.Address(&chaincfg.TestNet3Params))
+	// The address given by the node is kept.
+	prevout = NewPrevoutFromScript(1, p2pkh, "pubkeyhash", []string{"1HLoD9E4SDFFPDiYfNYnkBLQ85Y51J3Zb1"}, 1, false)
+	assert.Equal(t, "1HLoD9E4SDFFPDiYfNYnkBLQ85Y51J3Zb1", prevout.Address(&chaincfg.MainNetParams))
+	prevout = NewPrevoutFromScript(0, []byte{0x6a}, "nulldata", nil, 1, false)
+	assert.Empty(t, prevout.Address(&chaincfg.MainNetParams))
+}
@@ -0,0 +1,176 @@
+package types
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// NewBlockFromWire returns a new instance of a block from a deserialized block. The values of its outputs are
+// the satoshi amounts of the block.
+//
+// Fields that depend on the rest of the chain (confirmations, next hash) are left empty.
+func NewBlockFromWire(msg *wire.MsgBlock, height int64, params *chaincfg.Params) *Block {
+	block := NewBlock(BlockVerboseFromWire(msg, height, params))
+	for i, tx := range msg.Transactions {
+		for j, out := range tx.TxOut {
+			block.txs[i].vout[j].value = btcutil.Amount(out.Value)
+		}
+	}
+	return block
+}
+
+// NewBlockHeaderFromWire returns a new instance of a block header from a deserialized block header.
+func NewBlockHeaderFromWire(header *wire.BlockHeader, height int64) *BlockHeader {
+	return NewBlockHeader(BlockHeaderVerboseFromWire(header, height))
+}
+
+// BlockHeaderVerboseFromWire converts a deserialized block header to the json result of `getblockheader`.
+func BlockHeaderVerboseFromWire(header *wire.BlockHeader, height int64) btcjson.GetBlockHeaderVerboseResult {
+	return btcjson.GetBlockHeaderVerboseResult{
+		Hash:         header.BlockHash().String(),
+		Height:       int32(height),
+		Version:      header.Version,
+		VersionHex:   fmt.Sprintf("%08x", uint32(header.Version)),
+		MerkleRoot:   header.MerkleRoot.String(),
+		Time:         header.Timestamp.Unix(),
+		Nonce:        uint64(header.Nonce),
+		Bits:         fmt.Sprintf("%08x", header.Bits),
+		Difficulty:   difficulty(header.Bits),
+		PreviousHash: previousHash(&header.PrevBlock),
+	}
+}
+
+// BlockVerboseFromWire converts a deserialized block to the json result of `getblock` with verbosity = 2.
+func BlockVerboseFromWire(msg *wire.MsgBlock, height int64, params *chaincfg.Params) btcjson.GetBlockVerboseTxResult {
+	header := &msg.Header
+	size := msg.SerializeSize()
+	strippedSize := msg.SerializeSizeStripped()
+	txs := make([]btcjson.TxRawResult, len(msg.Transactions))
+	for i, tx := range msg.Transactions {
+		txs[i] = TxRawResultFromWire(tx, params)
+	}
+	return btcjson.GetBlockVerboseTxResult{
+		Hash:         header.BlockHash().String(),
+		StrippedSize: int32(strippedSize),
+		Size:         int32(size),
+		Weight:       int32(strippedSize*(blockchain.WitnessScaleFactor-1) + size),
+		Height:       height,
+		Version:      header.Version,
+		VersionHex:   fmt.Sprintf("%08x", uint32(header.Version)),
+		MerkleRoot:   header.MerkleRoot.String(),
+		Tx:           txs,
+		Time:         header.Timestamp.Unix(),
+		Nonce:        header.Nonce,
+		Bits:         fmt.Sprintf("%08x", header.Bits),
+		Difficulty:   difficulty(header.Bits),
+		PreviousHash: previousHash(&header.PrevBlock),
+	}
+}
+
+// TxRawResultFromWire converts a deserialized transaction to the json result of `getrawtransaction`
+// with verbose = true. Fields related to the block containing the transaction are left empty.
+func TxRawResultFromWire(tx *wire.MsgTx, params *chaincfg.Params) btcjson.TxRawResult {
+	var buf bytes.Buffer
+	buf.Grow(tx.SerializeSize())
+	// Writing to a bytes.Buffer can't fail.
+	_ = tx.Serialize(&buf)
+
+	size := tx.SerializeSize()
+	weight := tx.SerializeSizeStripped()*(blockchain.WitnessScaleFactor-1) + size
+	isCoinbase := blockchain.IsCoinBaseTx(tx)
+
+	vin := make([]btcjson.Vin, len(tx.TxIn))
+	for i, in := range tx.TxIn {
+		vin[i] = btcjson.Vin{Sequence: in.Sequence}
+		if isCoinbase {
+			vin[i].Coinbase = hex.EncodeToString(in.SignatureScript)
+		} else {
+			vin[i].Txid = in.PreviousOutPoint.Hash.String()
+			vin[i].Vout = in.PreviousOutPoint.Index
+			vin[i].ScriptSig = &btcjson.ScriptSig{
+				Asm: scriptAsm(in.SignatureScript, true),
+				Hex: hex.EncodeToString(in.SignatureScript),
+			}
+		}
+		if len(in.Witness) > 0 {
+			vin[i].Witness = make([]string, len(in.Witness))
+			for j, item := range in.Witness {
+				vin[i].Witness[j] = hex.EncodeToString(item)
+			}
+		}
+	}
+
+	vout := make([]btcjson.Vout, len(tx.TxOut))
+	for i, out := range tx.TxOut {
+		vout[i] = btcjson.Vout{
+			Value:        btcutil.Amount(out.Value).ToBTC(),
+			N:            uint32(i),
+			ScriptPubKey: scriptPubKeyFromWire(out.PkScript, params),
+		}
+	}
+
+	return btcjson.TxRawResult{
+		Hex:      hex.EncodeToString(buf.Bytes()),
+		Txid:     tx.TxHash().String(),
+		Hash:     tx.WitnessHash().String(),
+		Size:     int32(size),
+		Vsize:    int32((weight + blockchain.WitnessScaleFactor - 1) / blockchain.WitnessScaleFactor),
+		Weight:   int32(weight),
+		Version:  uint32(tx.Version),
+		LockTime: tx.LockTime,
+		Vin:      vin,
+		Vout:     vout,
+	}
+}
+
+// scriptPubKeyFromWire decodes an output script like Bitcoin Core does since v22, which only gives an address
+// for scripts paying to a single address, i.e. not for bare public keys and multisig. Core returns it in a
+// singular `address` field that btcjson doesn't have, so it is stored as the only element of Addresses, as
+// Block.UnmarshalJSON does with the results of the node.
+func scriptPubKeyFromWire(pkScript []byte, params *chaincfg.Params) btcjson.ScriptPubKeyResult {
+	class, addrs, _, _ := txscript.ExtractPkScriptAddrs(pkScript, params)
+	result := btcjson.ScriptPubKeyResult{
+		Asm:  scriptAsm(pkScript, false),
+		Hex:  hex.EncodeToString(pkScript),
+		Type: class.String(),
+	}
+	switch class {
+	case txscript.PubKeyTy, txscript.MultiSigTy, txscript.NullDataTy, txscript.NonStandardTy:
+	default:
+		for _, addr := range addrs {
+			result.Addresses = append(result.Addresses, addr.EncodeAddress())
+		}
+	}
+	return result
+}
+
+// difficulty returns the difficulty of the given compact target as computed by Bitcoin Core's `GetDifficulty`,
+// relative to the mainnet minimum difficulty regardless of the network.
+func difficulty(bits uint32) float64 {
+	shift := (bits >> 24) & 0xff
+	diff := float64(0x0000ffff) / float64(bits&0x00ffffff)
+	for ; shift < 29; shift++ {
+		diff *= 256.0
+	}
+	for ; shift > 29; shift-- {
+		diff /= 256.0
+	}
+	return diff
+}
+
+// previousHash returns the hex encoded previous block hash, or an empty string for the genesis block.
+func previousHash(hash *chainhash.Hash) string {
+	if *hash == (chainhash.Hash{}) {
+		return ""
+	}
+	return hash.String()
+}
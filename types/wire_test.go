@@ -0,0 +1,149 @@
+package types
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/suite"
+)
+
+type WireTestSuite struct {
+	suite.Suite
+	block1000 btcjson.GetBlockVerboseTxResult
+	tx        btcjson.TxRawResult
+}
+
+func (s *WireTestSuite) SetupTest() {
+	s.NoError(parseTestData("testdata/block_1000.json", &s.block1000))
+	s.NoError(parseTestData("testdata/transaction.json", &s.tx))
+}
+
+func (s *WireTestSuite) TestBlockVerboseFromWire() {
+	msg := s.msgBlock(s.block1000)
+	s.Equal(s.block1000.Hash, msg.BlockHash().String())
+
+	expected := s.block1000
+	expected.Confirmations = 0
+	expected.NextHash = ""
+	s.Equal(expected, BlockVerboseFromWire(msg, s.block1000.Height, &chaincfg.MainNetParams))
+
+	blk := NewBlockFromWire(msg, s.block1000.Height, &chaincfg.MainNetParams)
+	s.Equal(s.block1000.Hash, blk.Hash())
+	s.Len(blk.Transactions(), 1)
+	s.Equal(blk.Hash(), blk.Transactions()[0].BlockHash())
+
+	header := NewBlockHeaderFromWire(&msg.Header, s.block1000.Height)
+	s.Equal(blk.Hash(), header.Hash())
+	s.Equal(blk.Bits(), header.Bits())
+	s.Equal(blk.Difficulty(), header.Difficulty())
+	s.Equal(blk.PreviousHash(), header.PreviousHash())
+}
+
+func (s *WireTestSuite) TestTxRawResultFromWire() {
+	msg := s.msgTx(s.tx.Hex)
+	tx := TxRawResultFromWire(msg, &chaincfg.MainNetParams)
+
+	s.Equal(s.tx.Hex, tx.Hex)
+	s.Equal(s.tx.Txid, tx.Txid)
+	s.Equal(s.tx.Hash, tx.Hash)
+	s.Equal(s.tx.Size, tx.Size)
+	s.Equal(s.tx.Vsize, tx.Vsize)
+	s.Equal(s.tx.Weight, tx.Weight)
+	s.Equal(s.tx.Version, tx.Version)
+	s.Equal(s.tx.LockTime, tx.LockTime)
+	s.Require().Len(tx.Vin, len(s.tx.Vin))
+	for i, vin := range s.tx.Vin {
+		s.Equal(vin.Txid, tx.Vin[i].Txid)
+		s.Equal(vin.Vout, tx.Vin[i].Vout)
+		s.Equal(vin.Sequence, tx.Vin[i].Sequence)
+		s.Equal(vin.ScriptSig.Asm, tx.Vin[i].ScriptSig.Asm)
+		s.Equal(vin.ScriptSig.Hex, tx.Vin[i].ScriptSig.Hex)
+		s.Empty(tx.Vin[i].Coinbase)
+	}
+	s.Require().Len(tx.Vout, len(s.tx.Vout))
+	for i, vout := range s.tx.Vout {
+		s.Equal(vout.Value, tx.Vout[i].Value)
+		s.Equal(vout.N, tx.Vout[i].N)
+		s.Equal(vout.ScriptPubKey.Asm, tx.Vout[i].ScriptPubKey.Asm)
+		s.Equal(vout.ScriptPubKey.Hex, tx.Vout[i].ScriptPubKey.Hex)
+		s.Equal(vout.ScriptPubKey.Type, tx.Vout[i].ScriptPubKey.Type)
+	}
+	s.Equal([]string{"1DsB8CHc7fa87GUm6qs6YGoCRgQpBo2TJZ"}, tx.Vout[0].ScriptPubKey.Addresses)
+}
+
+func (s *WireTestSuite) TestDifficulty() {
+	tests := []struct {
+		name string
+		bits uint32
+		want float64
+	}{
+		{"mainnet_genesis", 0x1d00ffff, 1},
+		{"block_409008", 0x1806274b, 178678307671.6884},
+		{"regtest", 0x207fffff, 4.656542373906925e-10},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			s.InDelta(tt.want, difficulty(tt.bits), tt.want*1e-9)
+		})
+	}
+}
+
+func (s *WireTestSuite) TestScriptAsm() {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"numbers", "000101018102e8034f60", "0 1 -1 1000 -1 16"},
+		{"witness_commitment", "6a04aa21a9ed", "OP_RETURN -1839800746"},
+		{"opcode_names", "bbbaffb1", "OP_UNKNOWN OP_CHECKSIGADD OP_INVALIDOPCODE OP_CHECKLOCKTIMEVERIFY"},
+		{"truncated_push", "764c", "OP_DUP [error]"},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			script, err := hex.DecodeString(tt.script)
+			s.Require().NoError(err)
+			s.Equal(tt.want, scriptAsm(script, false))
+		})
+	}
+}
+
+// msgBlock rebuilds the deserialized block described by a `getblock` result.
+func (s *WireTestSuite) msgBlock(blk btcjson.GetBlockVerboseTxResult) *wire.MsgBlock {
+	prevHash, err := chainhash.NewHashFromStr(blk.PreviousHash)
+	s.Require().NoError(err)
+	merkleRoot, err := chainhash.NewHashFromStr(blk.MerkleRoot)
+	s.Require().NoError(err)
+	bits, err := hex.DecodeString(blk.Bits)
+	s.Require().NoError(err)
+	msg := wire.NewMsgBlock(&wire.BlockHeader{
+		Version:    blk.Version,
+		PrevBlock:  *prevHash,
+		MerkleRoot: *merkleRoot,
+		Timestamp:  time.Unix(blk.Time, 0),
+		Bits:       uint32(bits[0])<<24 | uint32(bits[1])<<16 | uint32(bits[2])<<8 | uint32(bits[3]),
+		Nonce:      blk.Nonce,
+	})
+	for _, tx := range blk.Tx {
+		s.Require().NoError(msg.AddTransaction(s.msgTx(tx.Hex)))
+	}
+	return msg
+}
+
+func (s *WireTestSuite) msgTx(txHex string) *wire.MsgTx {
+	raw, err := hex.DecodeString(txHex)
+	s.Require().NoError(err)
+	msg := wire.NewMsgTx(wire.TxVersion)
+	s.Require().NoError(msg.Deserialize(bytes.NewReader(raw)))
+	return msg
+}
+
+func TestWireTestSuite(t *testing.T) {
+	suite.Run(t, new(WireTestSuite))
+}